@@ -273,6 +273,7 @@ func main() {
 	var certManager *resource.CertificateManager
 	var configStore *resource.ConfigStore
 	var ftpServer *server2.FtpServer
+	var sftpServer *server.DaptinSftpServer
 	var imapServerInstance *imapServer.Server
 	var olricDb *olric.Olric
 
@@ -298,7 +299,7 @@ func main() {
 	}()
 
 	hostSwitch, mailDaemon, taskScheduler, configStore, certManager,
-		ftpServer, imapServerInstance, olricDb = server.Main(boxRoot, db, *localStoragePath, olricDb)
+		ftpServer, sftpServer, imapServerInstance, olricDb = server.Main(boxRoot, db, *localStoragePath, olricDb)
 	rhs := RestartHandlerServer{
 		HostSwitch: &hostSwitch,
 	}
@@ -345,6 +346,10 @@ func main() {
 		if ftpServer != nil {
 			ftpServer.Stop()
 		}
+		if sftpServer != nil {
+			err = sftpServer.Stop()
+			resource.CheckErr(err, "Failed to stop sftp server")
+		}
 
 		if mailDaemon != nil {
 			mailDaemon.Shutdown()
@@ -365,7 +370,7 @@ func main() {
 		}
 
 		hostSwitch, mailDaemon, taskScheduler, configStore, certManager,
-			ftpServer, imapServerInstance, olricDb = server.Main(boxRoot, db1, *localStoragePath, olricDb)
+			ftpServer, sftpServer, imapServerInstance, olricDb = server.Main(boxRoot, db1, *localStoragePath, olricDb)
 		rhs.HostSwitch = &hostSwitch
 		err = db.Close()
 		auth.CheckErr(err, "Failed to close old db connection")
@@ -430,10 +435,11 @@ func main() {
 			}
 
 			tlsServer := &http.Server{Addr: *httpsPort, Handler: &rhs}
-			tlsServer.TLSConfig.Certificates = []tls.Certificate{
-				{
-					Certificate: [][]byte{certBytes},
-					PrivateKey:  cert,
+			tlsServer.TLSConfig = &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				// certificates for subsite hostnames are picked (and obtained on demand) by the certificate manager
+				GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+					return certManager.GetCertificate(hello)
 				},
 			}
 
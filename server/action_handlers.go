@@ -28,6 +28,30 @@ func GetActionPerformers(initConfig *resource.CmsConfig, configStore *resource.C
 	resource.CheckErr(err, "Failed to create otp verify performer")
 	performers = append(performers, otpLoginVerifyActionPerformer)
 
+	mfaVerifyPerformer, err := resource.NewMfaVerifyActionPerformer(cruds, configStore)
+	resource.CheckErr(err, "Failed to create mfa verify performer")
+	performers = append(performers, mfaVerifyPerformer)
+
+	webauthnRegisterBeginPerformer, err := resource.NewWebauthnRegisterBeginActionPerformer(cruds, configStore)
+	resource.CheckErr(err, "Failed to create webauthn register begin performer")
+	performers = append(performers, webauthnRegisterBeginPerformer)
+
+	webauthnRegisterFinishPerformer, err := resource.NewWebauthnRegisterFinishActionPerformer(cruds, configStore)
+	resource.CheckErr(err, "Failed to create webauthn register finish performer")
+	performers = append(performers, webauthnRegisterFinishPerformer)
+
+	webauthnLoginBeginPerformer, err := resource.NewWebauthnLoginBeginActionPerformer(cruds, configStore)
+	resource.CheckErr(err, "Failed to create webauthn login begin performer")
+	performers = append(performers, webauthnLoginBeginPerformer)
+
+	webauthnLoginFinishPerformer, err := resource.NewWebauthnLoginFinishActionPerformer(cruds, configStore)
+	resource.CheckErr(err, "Failed to create webauthn login finish performer")
+	performers = append(performers, webauthnLoginFinishPerformer)
+
+	recoveryCodesGeneratePerformer, err := resource.NewRecoveryCodesGenerateActionPerformer(cruds, configStore)
+	resource.CheckErr(err, "Failed to create recovery codes generate performer")
+	performers = append(performers, recoveryCodesGeneratePerformer)
+
 	makeResponsePerformer, err := resource.NewMakeResponsePerformer()
 	resource.CheckErr(err, "Failed to create make response performer")
 	performers = append(performers, makeResponsePerformer)
@@ -132,6 +156,34 @@ func GetActionPerformers(initConfig *resource.CmsConfig, configStore *resource.C
 	resource.CheckErr(err, "Failed to create column rename performer")
 	performers = append(performers, columnRenamePerformer)
 
+	rotateEncryptionKeyPerformer, err := resource.NewRotateEncryptionKeyActionPerformer(initConfig, cruds, configStore)
+	resource.CheckErr(err, "Failed to create rotate encryption key performer")
+	performers = append(performers, rotateEncryptionKeyPerformer)
+
+	restoreVersionPerformer, err := resource.NewRestoreVersionActionPerformer(cruds)
+	resource.CheckErr(err, "Failed to create restore version performer")
+	performers = append(performers, restoreVersionPerformer)
+
+	pruneAuditLogPerformer, err := resource.NewPruneAuditLogActionPerformer(cruds, configStore)
+	resource.CheckErr(err, "Failed to create prune audit log performer")
+	performers = append(performers, pruneAuditLogPerformer)
+
+	pruneServerFunctionLogPerformer, err := resource.NewPruneServerFunctionLogActionPerformer(cruds, configStore)
+	resource.CheckErr(err, "Failed to create prune server function log performer")
+	performers = append(performers, pruneServerFunctionLogPerformer)
+
+	exchangeSyncPerformer, err := resource.NewExchangeSyncActionPerformer(cruds)
+	resource.CheckErr(err, "Failed to create exchange sync performer")
+	performers = append(performers, exchangeSyncPerformer)
+
+	restoreFromTrashPerformer, err := resource.NewRestoreFromTrashActionPerformer(cruds)
+	resource.CheckErr(err, "Failed to create restore from trash performer")
+	performers = append(performers, restoreFromTrashPerformer)
+
+	purgeTrashPerformer, err := resource.NewPurgeTrashActionPerformer(cruds, configStore)
+	resource.CheckErr(err, "Failed to create purge trash performer")
+	performers = append(performers, purgeTrashPerformer)
+
 	randomValueGeneratePerformer, err := resource.NewRandomValueGeneratePerformer()
 	resource.CheckErr(err, "Failed to create random value generate performer")
 	performers = append(performers, randomValueGeneratePerformer)
@@ -156,10 +208,14 @@ func GetActionPerformers(initConfig *resource.CmsConfig, configStore *resource.C
 	resource.CheckErr(err, "Failed to create cloudStoreSiteCreateActionPerformer")
 	performers = append(performers, cloudStoreSiteCreateActionPerformer)
 
-	acmeTlsCertificateGenerateActionPerformer, err := resource.NewAcmeTlsCertificateGenerateActionPerformer(cruds, configStore, hostSwitch.handlerMap["api"])
+	acmeTlsCertificateGenerateActionPerformer, err := resource.NewAcmeTlsCertificateGenerateActionPerformer(cruds, certificateManager)
 	resource.CheckErr(err, "Failed to create acme tls certificate generator")
 	performers = append(performers, acmeTlsCertificateGenerateActionPerformer)
 
+	acmeTlsCertificateRenewActionPerformer, err := resource.NewAcmeTlsCertificateRenewActionPerformer(certificateManager)
+	resource.CheckErr(err, "Failed to create acme tls certificate renew performer")
+	performers = append(performers, acmeTlsCertificateRenewActionPerformer)
+
 	selfTlsCertificateGenerateActionPerformer, err := resource.NewSelfTlsCertificateGenerateActionPerformer(cruds, configStore, certificateManager)
 	resource.CheckErr(err, "Failed to create self tls certificate generator")
 	performers = append(performers, selfTlsCertificateGenerateActionPerformer)
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateActionJobStatusHandler serves the status, progress and, once it is done, the responses of an asynchronous
+// action request to the user who made it
+func CreateActionJobStatusHandler(cruds map[string]*resource.DbResource) func(*gin.Context) {
+	return func(c *gin.Context) {
+
+		jobId := c.Param("jobId")
+
+		sessionUser, _ := c.Request.Context().Value("user").(*auth.SessionUser)
+		if sessionUser == nil {
+			c.AbortWithStatus(403)
+			return
+		}
+
+		dbResource := cruds[resource.ActionJobTableName]
+		job, _, err := dbResource.GetSingleRowByReferenceId(resource.ActionJobTableName, jobId, nil)
+		if err != nil {
+			c.AbortWithStatusJSON(404, ErrorResponse{Message: fmt.Sprintf("no such job [%v]", jobId)})
+			return
+		}
+
+		if !dbResource.IsAdmin(sessionUser.UserReferenceId) && !cruds["world"].GetRowPermission(map[string]interface{}{
+			"__type":       resource.ActionJobTableName,
+			"reference_id": jobId,
+		}).CanRead(sessionUser.UserReferenceId, sessionUser.Groups) {
+			c.AbortWithStatus(403)
+			return
+		}
+
+		var responses interface{}
+		if responsesJson, ok := job["responses"].(string); ok && responsesJson != "" {
+			err = json.Unmarshal([]byte(responsesJson), &responses)
+			resource.CheckErr(err, "Failed to read the responses of job [%v]", jobId)
+		}
+
+		c.JSON(200, map[string]interface{}{
+			"job_id":           jobId,
+			"action_name":      job["action_name"],
+			"on_type":          job["on_type"],
+			"status":           job["status"],
+			"progress":         job["progress"],
+			"progress_message": job["progress_message"],
+			"error":            job["error"],
+			"responses":        responses,
+			"created_at":       job["created_at"],
+			"started_at":       job["started_at"],
+			"finished_at":      job["finished_at"],
+		})
+	}
+}
@@ -69,6 +69,9 @@ func CreateColumnLine(colInfo api2go.ColumnInfo) map[string]interface{} {
 	m := map[string]interface{}{
 		"type": typ,
 	}
+	if colInfo.ColumnDescription != "" {
+		m["description"] = colInfo.ColumnDescription
+	}
 	//if !colInfo.IsNullable {
 	//	m["required"] = true
 	//}
@@ -180,6 +183,26 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 	}
 	typeMap["PaginationStatus"] = paginationStatus
 	typeMap["ActionResponse"] = actionResponse
+	for name, schema := range ClientResponseTypes() {
+		typeMap[name] = schema
+	}
+	typeMap["Query"] = QueryObject
+	typeMap["AggregateRow"] = map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"type": map[string]interface{}{
+				"type": "string",
+			},
+			"id": map[string]interface{}{
+				"type": "string",
+			},
+			"attributes": map[string]interface{}{
+				"type":                 "object",
+				"description":          "Values of the projected columns",
+				"additionalProperties": true,
+			},
+		},
+	}
 
 	IncludedRelationship := make(map[string]interface{})
 	IncludedRelationship["type"] = "object"
@@ -230,7 +253,9 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 		}
 
 		ramlType["properties"] = properties
-		ramlType["required"] = requiredCols
+		if len(requiredCols) > 0 {
+			ramlType["required"] = requiredCols
+		}
 
 		typeMap[strcase.ToCamel(tableInfo.TableName)] = ramlType
 
@@ -269,7 +294,9 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 		}
 
 		ramlType["properties"] = properties
-		ramlType["required"] = requiredCols
+		if len(requiredCols) > 0 {
+			ramlType["required"] = requiredCols
+		}
 
 		typeMap["New"+strcase.ToCamel(tableInfo.TableName)] = ramlType
 
@@ -280,25 +307,37 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 		ramlActionType["type"] = "object"
 
 		actionProperties := make(map[string]interface{})
+		requiredFields := make([]string, 0)
 		for _, colInfo := range action.InFields {
-			if colInfo.IsForeignKey {
-				continue
-			}
 			if skipColumns[colInfo.ColumnName] {
 				continue
 			}
 
-			actionProperties[colInfo.ColumnName] = CreateColumnLine(colInfo)
+			if colInfo.IsForeignKey {
+				actionProperties[colInfo.ColumnName] = map[string]interface{}{
+					"type":        "string",
+					"description": "reference id of a " + colInfo.ForeignKeyData.Namespace,
+				}
+			} else {
+				actionProperties[colInfo.ColumnName] = CreateColumnLine(colInfo)
+			}
+			if !colInfo.IsNullable {
+				requiredFields = append(requiredFields, colInfo.ColumnName)
+			}
 		}
 		if !action.InstanceOptional {
 			actionProperties[action.OnType+"_id"] = map[string]interface{}{
 				"type":        "string",
 				"description": "reference id of a " + action.OnType,
 			}
+			requiredFields = append(requiredFields, action.OnType+"_id")
 		}
 		ramlActionType["description"] = action.Label
 
 		ramlActionType["properties"] = actionProperties
+		if len(requiredFields) > 0 {
+			ramlActionType["required"] = requiredFields
+		}
 		typeMap[fmt.Sprintf("%sOn%sRequestObject", strcase.ToCamel(action.Name), strcase.ToCamel(action.OnType))] = ramlActionType
 
 	}
@@ -363,10 +402,10 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 				relatedTable := tableInfoMap[rel.Object]
 				getMethod := CreateGetAllMethod(relatedTable, CreateDataInResponse(relatedTable))
 				getMethod["description"] = fmt.Sprintf("Returns a list of all %v", ProperCase(relatedTable.TableName)+" related to a "+tableInfo.TableName)
-				getMethod["operationId"] = fmt.Sprintf("Get" + strcase.ToCamel(rel.ObjectName) + "Of" + strcase.ToCamel(rel.SubjectName))
+				getMethod["operationId"] = fmt.Sprintf("Get" + strcase.ToCamel(rel.ObjectName) + "Of" + strcase.ToCamel(tableInfo.TableName))
 				getMethod["summary"] = fmt.Sprintf("Fetch related %s of %v", rel.ObjectName, tableInfo.TableName)
 
-				getMethod["parameters"] = []map[string]interface{}{
+				getMethod["parameters"] = append([]map[string]interface{}{
 					{
 						"name": "referenceId",
 						"schema": map[string]interface{}{
@@ -376,7 +415,7 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 						"in":          "path",
 						"description": "Reference Id of the " + tableInfo.TableName,
 					},
-				}
+				}, ListParameterRefs()...)
 
 				deleteMethod := CreateDeleteRelationMethod(relatedTable)
 				deleteMethod["description"] = fmt.Sprintf("Remove a related %v from the %v", tableInfo.TableName, rel.ObjectName)
@@ -400,23 +439,23 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 					},
 				}
 
-				nestedMap[fmt.Sprintf("/api/%s/{referenceId}/%s", tableInfo.TableName, rel.Object)] = relationsById
+				nestedMap[fmt.Sprintf("/api/%s/{referenceId}/%s", tableInfo.TableName, rel.ObjectName)] = relationsById
+				nestedMap[fmt.Sprintf("/api/%s/{referenceId}/relationships/%s", tableInfo.TableName, rel.ObjectName)] = CreateRelationshipMethods(tableInfo, rel.ObjectName, rel.Relation)
 			} else {
 				relatedTable := tableInfoMap[rel.Subject]
 				getMethod := CreateGetAllMethod(relatedTable, CreateDataInResponse(relatedTable))
 				getMethod["summary"] = "Related " + strcase.ToCamel(rel.SubjectName) + " of a " + strcase.ToCamel(tableInfo.TableName)
 				getMethod["operationId"] = "Related" + strcase.ToCamel(rel.SubjectName) + "Of" + strcase.ToCamel(tableInfo.TableName)
-				patchMethod["summary"] = fmt.Sprintf("Fetch related %s of %v", rel.SubjectName, tableInfo.TableName)
-				patchMethod["tags"] = []string{rel.ObjectName, rel.Subject, rel.SubjectName, rel.Object, rel.Relation, "get"}
+				getMethod["tags"] = []string{rel.ObjectName, rel.Subject, rel.SubjectName, rel.Object, rel.Relation, "get"}
 
 				deleteMethod := CreateDeleteRelationMethod(relatedTable)
 				deleteMethod["description"] = fmt.Sprintf("Remove a related %v from the %v", rel.SubjectName, rel.ObjectName)
-				deleteMethod["operationId"] = "Delete" + strcase.ToCamel(relatedTable.TableName) + "Of" + strcase.ToCamel(tableInfo.TableName)
-				patchMethod["summary"] = fmt.Sprintf("Delete related %s of %v", rel.SubjectName, tableInfo.TableName)
-				patchMethod["tags"] = []string{rel.ObjectName, rel.Subject, rel.SubjectName, rel.Object, rel.Relation, "delete"}
+				deleteMethod["operationId"] = "Delete" + strcase.ToCamel(rel.SubjectName) + "Of" + strcase.ToCamel(tableInfo.TableName)
+				deleteMethod["summary"] = fmt.Sprintf("Delete related %s of %v", rel.SubjectName, tableInfo.TableName)
+				deleteMethod["tags"] = []string{rel.ObjectName, rel.Subject, rel.SubjectName, rel.Object, rel.Relation, "delete"}
 				relationsById["get"] = getMethod
 
-				getMethod["parameters"] = []map[string]interface{}{
+				getMethod["parameters"] = append([]map[string]interface{}{
 					{
 						"name": "referenceId",
 						"schema": map[string]interface{}{
@@ -426,7 +465,7 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 						"in":          "path",
 						"description": "Reference Id of the " + tableInfo.TableName,
 					},
-				}
+				}, ListParameterRefs()...)
 
 				deleteMethod["parameters"] = []map[string]interface{}{
 					{
@@ -441,7 +480,8 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 				}
 
 				relationsById["delete"] = deleteMethod
-				nestedMap[fmt.Sprintf("/api/%s/{referenceId}/%s", tableInfo.TableName, rel.Subject)] = relationsById
+				nestedMap[fmt.Sprintf("/api/%s/{referenceId}/%s", tableInfo.TableName, rel.SubjectName)] = relationsById
+				nestedMap[fmt.Sprintf("/api/%s/{referenceId}/relationships/%s", tableInfo.TableName, rel.SubjectName)] = CreateRelationshipMethods(tableInfo, rel.SubjectName, rel.Relation)
 			}
 			// END: Get relations method
 
@@ -458,6 +498,14 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 		}
 
 		resourcesMap["/api/"+tableInfo.TableName] = resourceInstance
+		resourcesMap["/aggregate/"+tableInfo.TableName] = CreateAggregateMethod(tableInfo)
+	}
+
+	for _, stream := range config.Streams {
+		typeMap[strcase.ToCamel(stream.StreamName)] = CreateStreamType(stream)
+		resourcesMap["/api/"+stream.StreamName] = map[string]interface{}{
+			"get": CreateGetStreamMethod(stream),
+		}
 	}
 
 	for _, action := range config.Actions {
@@ -471,7 +519,12 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 					"content": map[string]interface{}{
 						"application/json": map[string]interface{}{
 							"schema": map[string]interface{}{
-								"$ref": "#/components/schemas/" + fmt.Sprintf("%sOn%sRequestObject", strcase.ToCamel(action.Name), strcase.ToCamel(action.OnType)),
+								"type": "object",
+								"properties": map[string]interface{}{
+									"attributes": map[string]interface{}{
+										"$ref": "#/components/schemas/" + fmt.Sprintf("%sOn%sRequestObject", strcase.ToCamel(action.Name), strcase.ToCamel(action.OnType)),
+									},
+								},
 							},
 						},
 					},
@@ -483,10 +536,8 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 						"content": map[string]interface{}{
 							"application/json": map[string]interface{}{
 								"schema": map[string]interface{}{
-									"type": "array",
-									"items": map[string]interface{}{
-										"$ref": "#/components/schemas/ActionResponse",
-									},
+									"type":  "array",
+									"items": CreateActionResponseItems(action),
 								},
 							},
 						},
@@ -505,19 +556,27 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 	}
 
 	apiDefinition["components"] = map[string]interface{}{
-		"schemas": typeMap,
+		"schemas":    typeMap,
+		"parameters": ListParameters,
 		"securitySchemes": map[string]map[string]string{
 			"bearerAuth": {
 				"type":         "http",
 				"scheme":       "bearer",
 				"bearerFormat": "JWT",
 			},
+			"basicAuth": {
+				"type":   "http",
+				"scheme": "basic",
+			},
 		},
 	}
 	apiDefinition["security"] = []map[string][]string{
 		{
 			"bearerAuth": []string{},
 		},
+		{
+			"basicAuth": []string{},
+		},
 	}
 
 	ym, _ := yaml.Marshal(apiDefinition)
@@ -528,10 +587,13 @@ func BuildApiBlueprint(config *resource.CmsConfig, cruds map[string]*resource.Db
 func CreateDataInResponse(tableInfo resource.TableInfo) map[string]interface{} {
 	relationshipMap := make(map[string]interface{}, 0)
 	for _, relation := range tableInfo.Relations {
+		includedRelationship := map[string]interface{}{
+			"$ref": "#/components/schemas/IncludedRelationship",
+		}
 		if relation.Object == tableInfo.TableName {
-			relationshipMap[relation.SubjectName] = "IncludedRelationship"
+			relationshipMap[relation.SubjectName] = includedRelationship
 		} else {
-			relationshipMap[relation.ObjectName] = "IncludedRelationship"
+			relationshipMap[relation.ObjectName] = includedRelationship
 		}
 	}
 
@@ -539,9 +601,7 @@ func CreateDataInResponse(tableInfo resource.TableInfo) map[string]interface{} {
 		"type": "object",
 		"properties": map[string]interface{}{
 			"attributes": map[string]interface{}{
-				"schema": map[string]interface{}{
-					"$ref": "#/components/schemas/New" + strcase.ToCamel(tableInfo.TableName),
-				},
+				"$ref": "#/components/schemas/New" + strcase.ToCamel(tableInfo.TableName),
 			},
 			"id": map[string]interface{}{
 				"type": "string",
@@ -618,44 +678,7 @@ func CreateGetAllMethod(tableInfo resource.TableInfo, dataInResponse map[string]
 	getAllMethod["operationId"] = fmt.Sprintf("Get" + strcase.ToCamel(tableInfo.TableName))
 	getAllMethod["summary"] = fmt.Sprintf("List all %v", tableInfo.TableName)
 	getAllMethod["tags"] = []string{tableInfo.TableName, "find", "get"}
-	getAllMethod["parameters"] = []map[string]interface{}{
-		{
-			"name": "sort",
-			"schema": map[string]interface{}{
-				"type": "string",
-			},
-			"required":    false,
-			"in":          "query",
-			"description": "Field name to sort by",
-		},
-		{
-			"name": "page[number]",
-			"in":   "query",
-			"schema": map[string]interface{}{
-				"type": "string",
-			},
-			"required":    false,
-			"description": "Page number for the query set, starts with 1",
-		},
-		{
-			"schema": map[string]interface{}{
-				"type": "string",
-			},
-			"name":        "page[size]",
-			"required":    false,
-			"in":          "query",
-			"description": "Size of one page, try 10",
-		},
-		{
-			"schema": map[string]interface{}{
-				"type": "string",
-			},
-			"in":          "query",
-			"name":        "query",
-			"required":    false,
-			"description": "search text in indexed columns",
-		},
-	}
+	getAllMethod["parameters"] = ListParameterRefs()
 	getResponseMap := make(map[string]interface{})
 	get200Response := make(map[string]interface{})
 	get200Response["description"] = "list of all " + tableInfo.TableName
@@ -853,6 +876,9 @@ func CreatePatchMethod(tableInfo resource.TableInfo) map[string]interface{} {
 	}
 	patchOkResponse["description"] = "updated " + tableInfo.TableName
 	patchResponseMap["200"] = patchOkResponse
+	patchResponseMap["409"] = map[string]interface{}{
+		"description": "the " + tableInfo.TableName + " was changed since the version in If-Match was read",
+	}
 	patchMethod["parameters"] = []map[string]interface{}{
 		{
 			"name": "referenceId",
@@ -863,6 +889,15 @@ func CreatePatchMethod(tableInfo resource.TableInfo) map[string]interface{} {
 			"in":          "path",
 			"description": "Reference Id of the " + tableInfo.TableName,
 		},
+		{
+			"name": "If-Match",
+			"schema": map[string]interface{}{
+				"type": "string",
+			},
+			"required":    false,
+			"in":          "header",
+			"description": "ETag of the " + tableInfo.TableName + " the update is made on",
+		},
 	}
 	patchMethod["responses"] = patchResponseMap
 	return patchMethod
@@ -0,0 +1,117 @@
+package apiblueprint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func TestBuildApiBlueprintIsValidOpenApi(t *testing.T) {
+
+	resource.InitialiseColumnManager()
+
+	tables := []resource.TableInfo{
+		{
+			TableName: "author",
+			Columns: []api2go.ColumnInfo{
+				{ColumnName: "reference_id", ColumnType: "alias", IsNullable: false},
+				{ColumnName: "name", ColumnType: "label", IsNullable: false},
+			},
+			Relations: []api2go.TableRelation{
+				api2go.NewTableRelation("book", "has_many", "author"),
+			},
+		},
+		{
+			TableName: "book",
+			Columns: []api2go.ColumnInfo{
+				{ColumnName: "reference_id", ColumnType: "alias", IsNullable: false},
+				{ColumnName: "title", ColumnType: "label", IsNullable: false},
+				{ColumnName: "pages", ColumnType: "measurement", IsNullable: true},
+			},
+			Relations: []api2go.TableRelation{
+				api2go.NewTableRelation("book", "has_many", "author"),
+				api2go.NewTableRelation("book", "belongs_to", "user_account"),
+			},
+		},
+		{
+			TableName: "user_account",
+			Columns: []api2go.ColumnInfo{
+				{ColumnName: "email", ColumnType: "email", IsNullable: false},
+			},
+		},
+	}
+
+	config := &resource.CmsConfig{
+		Hostname: "localhost",
+		Tables:   tables,
+		Actions:  resource.SystemActions,
+		Streams: []resource.StreamContract{
+			{
+				StreamName:     "book_titles",
+				RootEntityName: "book",
+				Columns: []api2go.ColumnInfo{
+					{ColumnName: "title", ColumnType: "label"},
+				},
+			},
+		},
+	}
+
+	document := BuildApiBlueprint(config, nil)
+
+	swagger, err := openapi3.NewSwaggerLoader().LoadSwaggerFromData([]byte(document))
+	if err != nil {
+		t.Fatalf("Failed to load generated spec: %v", err)
+	}
+	err = swagger.Validate(context.Background())
+	if err != nil {
+		t.Fatalf("Generated spec is not valid: %v", err)
+	}
+
+	for _, path := range []string{
+		"/api/book",
+		"/api/book/{referenceId}",
+		"/api/book/{referenceId}/author_id",
+		"/api/book/{referenceId}/relationships/author_id",
+		"/api/author/{referenceId}/book_id",
+		"/aggregate/book",
+		"/api/book_titles",
+		"/action/user_account/signup",
+	} {
+		if swagger.Paths.Find(path) == nil {
+			t.Errorf("Expected path [%v] in generated spec", path)
+		}
+	}
+
+	if swagger.Paths.Find("/api/book/{referenceId}/relationships/author_id").Post == nil {
+		t.Errorf("Expected to many relationship to accept new members")
+	}
+	if swagger.Paths.Find("/api/book/{referenceId}/relationships/user_account_id").Post != nil {
+		t.Errorf("Expected to one relationship to only be replaced")
+	}
+
+	signup := swagger.Paths.Find("/action/user_account/signup").Post
+	attributes := signup.RequestBody.Value.Content.Get("application/json").Schema.Value.Properties["attributes"].Value
+	if len(attributes.Required) == 0 || attributes.Properties["email"] == nil {
+		t.Errorf("Expected action in fields as required request attributes, found %v", attributes.Required)
+	}
+
+	if len(swagger.Components.SecuritySchemes) != 2 {
+		t.Errorf("Expected bearer and basic security schemes, found %v", swagger.Components.SecuritySchemes)
+	}
+
+	operationIds := make(map[string]string)
+	for path, item := range swagger.Paths {
+		for method, operation := range item.Operations() {
+			if operation.OperationID == "" {
+				continue
+			}
+			if other, ok := operationIds[operation.OperationID]; ok {
+				t.Errorf("Duplicate operation id [%v] on [%v %v] and [%v]", operation.OperationID, method, path, other)
+			}
+			operationIds[operation.OperationID] = method + " " + path
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package apiblueprint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/iancoleman/strcase"
+)
+
+// QueryObject is one condition of the json query language accepted in the query parameter of list endpoints
+var QueryObject = map[string]interface{}{
+	"type":        "object",
+	"description": "A condition on a column, the query parameter takes a json array of these",
+	"properties": map[string]interface{}{
+		"column": map[string]interface{}{
+			"type":        "string",
+			"description": "Name of the column",
+		},
+		"operator": map[string]interface{}{
+			"type":        "string",
+			"description": "Comparison to apply",
+			"enum":        queryOperators(),
+		},
+		"value": map[string]interface{}{
+			"description": "Value to compare with, an array for in, any of and none of",
+		},
+	},
+	"required": []string{"column", "operator"},
+}
+
+func queryOperators() []string {
+	operators := make([]string, 0, len(resource.OperatorMap))
+	for operator := range resource.OperatorMap {
+		operators = append(operators, operator)
+	}
+	sort.Strings(operators)
+	return operators
+}
+
+// ListParameters are the parameters of every list endpoint, referenced from #/components/parameters
+var ListParameters = map[string]interface{}{
+	"sort": map[string]interface{}{
+		"name":        "sort",
+		"in":          "query",
+		"required":    false,
+		"description": "Comma separated column names to sort by, prefix a column with - for descending order",
+		"schema": map[string]interface{}{
+			"type": "string",
+		},
+	},
+	"pageNumber": map[string]interface{}{
+		"name":        "page[number]",
+		"in":          "query",
+		"required":    false,
+		"description": "Page number for the query set, starts with 1",
+		"schema": map[string]interface{}{
+			"type":    "integer",
+			"minimum": 1,
+		},
+	},
+	"pageSize": map[string]interface{}{
+		"name":        "page[size]",
+		"in":          "query",
+		"required":    false,
+		"description": "Size of one page, try 10",
+		"schema": map[string]interface{}{
+			"type":    "integer",
+			"minimum": 1,
+		},
+	},
+	"pageAfter": map[string]interface{}{
+		"name":        "page[after]",
+		"in":          "query",
+		"required":    false,
+		"description": "Reference id of the object after which to look for",
+		"schema": map[string]interface{}{
+			"type": "string",
+		},
+	},
+	"query": map[string]interface{}{
+		"name":        "query",
+		"in":          "query",
+		"required":    false,
+		"description": "Json array of conditions on the columns, all of them have to match",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{
+					"type": "array",
+					"items": map[string]interface{}{
+						"$ref": "#/components/schemas/Query",
+					},
+				},
+			},
+		},
+	},
+	"filter": map[string]interface{}{
+		"name":        "filter",
+		"in":          "query",
+		"required":    false,
+		"description": "search text in indexed columns",
+		"schema": map[string]interface{}{
+			"type": "string",
+		},
+	},
+	"includedRelations": map[string]interface{}{
+		"name":        "included_relations",
+		"in":          "query",
+		"required":    false,
+		"description": "Comma separated names of the relations to include in the response, * for all",
+		"schema": map[string]interface{}{
+			"type": "string",
+		},
+	},
+}
+
+// ListParameterRefs returns references to all the ListParameters
+func ListParameterRefs() []map[string]interface{} {
+	names := make([]string, 0, len(ListParameters))
+	for name := range ListParameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	refs := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		refs = append(refs, map[string]interface{}{
+			"$ref": "#/components/parameters/" + name,
+		})
+	}
+	return refs
+}
+
+// clientResponseAttributes are the attributes of the action responses the clients know how to handle
+var clientResponseAttributes = map[string]map[string]interface{}{
+	"client.notify": {
+		"type":    "string",
+		"title":   "string",
+		"message": "string",
+	},
+	"client.redirect": {
+		"location": "string",
+		"window":   "string",
+		"delay":    "integer",
+	},
+	"client.store.set": {
+		"key":   "string",
+		"value": "string",
+	},
+	"client.cookie.set": {
+		"key":   "string",
+		"value": "string",
+	},
+	"client.file.download": {
+		"content":     "string",
+		"name":        "string",
+		"contentType": "string",
+		"message":     "string",
+	},
+}
+
+func clientResponseSchemaName(responseType string) string {
+	return strcase.ToCamel(strings.Replace(responseType, ".", "_", -1)) + "Response"
+}
+
+// ClientResponseTypes returns a schema for every action response type known to the clients
+func ClientResponseTypes() map[string]map[string]interface{} {
+	schemas := make(map[string]map[string]interface{})
+	for responseType, attributes := range clientResponseAttributes {
+		properties := make(map[string]interface{})
+		for name, attributeType := range attributes {
+			properties[name] = map[string]interface{}{
+				"type": attributeType,
+			}
+		}
+		schemas[clientResponseSchemaName(responseType)] = map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"ResponseType": map[string]interface{}{
+					"type": "string",
+					"enum": []string{responseType},
+				},
+				"Attributes": map[string]interface{}{
+					"type":       "object",
+					"properties": properties,
+				},
+			},
+		}
+	}
+	return schemas
+}
+
+// CreateActionResponseItems is the schema of one response of the action, typed by the outcomes of the action
+func CreateActionResponseItems(action resource.Action) map[string]interface{} {
+
+	refs := make([]map[string]interface{}, 0)
+	added := make(map[string]bool)
+
+	for _, outcome := range action.OutFields {
+		if outcome.SkipInResponse || added[outcome.Type] {
+			continue
+		}
+		if _, ok := clientResponseAttributes[outcome.Type]; !ok {
+			continue
+		}
+		added[outcome.Type] = true
+		refs = append(refs, map[string]interface{}{
+			"$ref": "#/components/schemas/" + clientResponseSchemaName(outcome.Type),
+		})
+	}
+
+	// performers of the other outcomes add responses of their own
+	genericResponse := map[string]interface{}{
+		"$ref": "#/components/schemas/ActionResponse",
+	}
+	if len(refs) == 0 {
+		return genericResponse
+	}
+	return map[string]interface{}{
+		"anyOf": append(refs, genericResponse),
+	}
+}
+
+// CreateRelationshipMethods returns the json:api relationship endpoints of a relation of the table
+// to many relations can also be added to and removed from
+func CreateRelationshipMethods(tableInfo resource.TableInfo, relationName string, relationType string) map[string]interface{} {
+
+	referenceIdParameter := []map[string]interface{}{
+		{
+			"name": "referenceId",
+			"schema": map[string]interface{}{
+				"type": "string",
+			},
+			"required":    true,
+			"in":          "path",
+			"description": "Reference Id of the " + tableInfo.TableName,
+		},
+	}
+
+	isToMany := relationType == "has_many" || relationType == "has_many_and_belongs_to_many"
+
+	linkageSchema := map[string]interface{}{
+		"$ref": "#/components/schemas/RelatedStructure",
+	}
+	if isToMany {
+		linkageSchema = map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"$ref": "#/components/schemas/RelatedStructure",
+			},
+		}
+	}
+	linkageContent := map[string]interface{}{
+		"application/json": map[string]interface{}{
+			"schema": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"data": linkageSchema,
+				},
+			},
+		},
+	}
+
+	operationName := strcase.ToCamel(relationName) + "RelationshipOf" + strcase.ToCamel(tableInfo.TableName)
+	tags := []string{tableInfo.TableName, relationName, "relationship"}
+
+	methods := map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "Get" + operationName,
+			"summary":     fmt.Sprintf("Get the %v relationship of a %v", relationName, tableInfo.TableName),
+			"tags":        tags,
+			"parameters":  referenceIdParameter,
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "identifiers of the related objects",
+					"content":     linkageContent,
+				},
+			},
+		},
+		"patch": map[string]interface{}{
+			"operationId": "Replace" + operationName,
+			"summary":     fmt.Sprintf("Replace the %v relationship of a %v", relationName, tableInfo.TableName),
+			"tags":        tags,
+			"parameters":  referenceIdParameter,
+			"requestBody": map[string]interface{}{
+				"required": true,
+				"content":  linkageContent,
+			},
+			"responses": map[string]interface{}{
+				"204": map[string]interface{}{
+					"description": "relationship updated",
+				},
+			},
+		},
+	}
+
+	if isToMany {
+		methods["post"] = map[string]interface{}{
+			"operationId": "Add" + operationName,
+			"summary":     fmt.Sprintf("Add to the %v relationship of a %v", relationName, tableInfo.TableName),
+			"tags":        tags,
+			"parameters":  referenceIdParameter,
+			"requestBody": map[string]interface{}{
+				"required": true,
+				"content":  linkageContent,
+			},
+			"responses": map[string]interface{}{
+				"204": map[string]interface{}{
+					"description": "objects added to the relationship",
+				},
+			},
+		}
+		methods["delete"] = map[string]interface{}{
+			"operationId": "Remove" + operationName,
+			"summary":     fmt.Sprintf("Remove from the %v relationship of a %v", relationName, tableInfo.TableName),
+			"tags":        tags,
+			"parameters":  referenceIdParameter,
+			"requestBody": map[string]interface{}{
+				"required": true,
+				"content":  linkageContent,
+			},
+			"responses": map[string]interface{}{
+				"204": map[string]interface{}{
+					"description": "objects removed from the relationship",
+				},
+			},
+		}
+	}
+
+	return methods
+}
+
+// CreateAggregateMethod returns the aggregate endpoint of the table
+func CreateAggregateMethod(tableInfo resource.TableInfo) map[string]interface{} {
+
+	arrayParameter := func(name string, description string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":        name,
+			"in":          "query",
+			"required":    false,
+			"description": description,
+			"style":       "form",
+			"explode":     true,
+			"schema": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "string",
+				},
+			},
+		}
+	}
+	stringParameter := func(name string, description string) map[string]interface{} {
+		return map[string]interface{}{
+			"name":        name,
+			"in":          "query",
+			"required":    false,
+			"description": description,
+			"schema": map[string]interface{}{
+				"type": "string",
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"get": map[string]interface{}{
+			"operationId": "Aggregate" + strcase.ToCamel(tableInfo.TableName),
+			"summary":     fmt.Sprintf("Aggregate %v", tableInfo.TableName),
+			"tags":        []string{tableInfo.TableName, "aggregate"},
+			"parameters": []map[string]interface{}{
+				arrayParameter("column", "Columns or expressions like count or sum(column) to project"),
+				arrayParameter("group", "Columns to group by"),
+				arrayParameter("filter", "Conditions like eq(column,value) on the rows"),
+				arrayParameter("having", "Conditions like gt(count,10) on the groups"),
+				arrayParameter("join", "Tables to join like other_table@eq(other_table.column,value)"),
+				arrayParameter("order", "Columns to order by, prefix with - for descending"),
+				stringParameter("timesample", "Sample the rows by a time unit"),
+				stringParameter("timefrom", "Start of the time range"),
+				stringParameter("timeto", "End of the time range"),
+			},
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "aggregated rows of " + tableInfo.TableName,
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{
+							"schema": map[string]interface{}{
+								"type": "object",
+								"properties": map[string]interface{}{
+									"data": map[string]interface{}{
+										"type": "array",
+										"items": map[string]interface{}{
+											"$ref": "#/components/schemas/AggregateRow",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// CreateStreamType is the schema of one row of the stream
+func CreateStreamType(stream resource.StreamContract) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for _, column := range stream.Columns {
+		properties[column.ColumnName] = CreateColumnLine(column)
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+// CreateGetStreamMethod returns the read only list endpoint of the stream
+func CreateGetStreamMethod(stream resource.StreamContract) map[string]interface{} {
+	return CreateGetAllMethod(resource.TableInfo{
+		TableName: stream.StreamName,
+		Columns:   stream.Columns,
+		Relations: []api2go.TableRelation{},
+	}, nil)
+}
@@ -0,0 +1,444 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daptin/daptin/server/resource"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultAssetVariants are the named image variants available on every asset column, they can be
+// overridden by asset.variant.<name> or per column by asset.variant.<table>.<column>.<name> in _config
+var DefaultAssetVariants = map[string]string{
+	"thumbnail": "resize=150,0,Lanczos",
+	"medium":    "resize=800,0,Lanczos",
+}
+
+// assetMaxDimension is the largest width, height or offset accepted in the transform parameters of an image
+const assetMaxDimension = 4096
+
+// assetMaxRadius is the largest radius accepted by the blur and morphology filters
+const assetMaxRadius = 50
+
+// assetFlagParams transform the image when present with a true value, emboss and sharpen with any value
+var assetFlagParams = []string{
+	"colorspaceLinearToSRGB", "colorspaceSRGBToLinear", "flipHorizontal", "flipVertical",
+	"grayscale", "invert", "rotate90", "rotate180", "rotate270", "sobel", "transpose", "transverse",
+}
+
+// assetRadiusParams take a radius up to assetMaxRadius
+var assetRadiusParams = []string{"boxblur", "gaussianblur", "dilate", "edgedetection", "erode", "median", "gaussianBlur"}
+
+// assetNumberParams take a single number
+var assetNumberParams = []string{"brightness", "contrast", "gamma", "hue", "saturation", "sepia", "threshold"}
+
+var assetResamplings = []string{"NearestNeighbor", "Box", "Linear", "Cubic", "Lanczos"}
+var assetInterpolations = []string{"NearestNeighbor", "Linear", "Cubic"}
+var assetAnchors = []string{"Center", "TopLeft", "Top", "TopRight", "Left", "Right", "BottomLeft", "Bottom", "BottomRight"}
+var assetFits = []string{"fill", "contain", "cover"}
+var assetFormats = []string{"jpeg", "png"}
+
+func assetCacheRoot() string {
+	cacheFolder := os.Getenv("DAPTIN_CACHE_FOLDER")
+	if cacheFolder == "" {
+		cacheFolder = os.TempDir()
+	}
+	return filepath.Join(cacheFolder, "daptin-assets")
+}
+
+// AssetDerivativeCache keeps transformed images on disk, keyed by the source file version and the transform parameters.
+// The files take at most maxBytes, the least recently used are removed first
+type AssetDerivativeCache struct {
+	path     string
+	maxBytes int64
+	lock     sync.Mutex
+	size     int64
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+// assetDerivative is a stored derivative, the front of the order is the most recently used
+type assetDerivative struct {
+	key      string
+	fileName string
+	size     int64
+}
+
+// NewAssetDerivativeCache indexes the derivatives already in cachePath, oldest first, and trims them to maxBytes
+func NewAssetDerivativeCache(cachePath string, maxBytes int64) (*AssetDerivativeCache, error) {
+	dc := &AssetDerivativeCache{
+		path:     cachePath,
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+	err := os.MkdirAll(cachePath, 0750)
+	if err != nil {
+		return dc, err
+	}
+
+	files, err := ioutil.ReadDir(cachePath)
+	if err != nil {
+		return dc, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(file.Name(), ".tmp") {
+			_ = os.Remove(filepath.Join(cachePath, file.Name()))
+			continue
+		}
+		key := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		dc.add(key, file.Name(), file.Size())
+	}
+
+	dc.lock.Lock()
+	dc.evict()
+	dc.lock.Unlock()
+	return dc, nil
+}
+
+// Key is a stable name for a derivative of a file
+func (dc *AssetDerivativeCache) Key(parts ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(hash[:])
+}
+
+// Get returns the stored derivative and its content type
+func (dc *AssetDerivativeCache) Get(key string) ([]byte, string, bool) {
+	dc.lock.Lock()
+	element, ok := dc.entries[key]
+	if !ok {
+		dc.lock.Unlock()
+		return nil, "", false
+	}
+	dc.order.MoveToFront(element)
+	fileName := element.Value.(*assetDerivative).fileName
+	dc.lock.Unlock()
+
+	data, err := ioutil.ReadFile(filepath.Join(dc.path, fileName))
+	if err != nil {
+		dc.lock.Lock()
+		dc.remove(key)
+		dc.lock.Unlock()
+		return nil, "", false
+	}
+	return data, "image/" + strings.TrimPrefix(filepath.Ext(fileName), "."), true
+}
+
+// Put stores a derivative, the file is renamed into place so readers never see a partial image
+func (dc *AssetDerivativeCache) Put(key string, format string, data []byte) error {
+	tempFile, err := ioutil.TempFile(dc.path, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tempFile.Write(data)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+	dc.remove(key)
+	err = os.Rename(tempFile.Name(), filepath.Join(dc.path, key+"."+format))
+	if err != nil {
+		return err
+	}
+	dc.add(key, key+"."+format, int64(len(data)))
+	dc.evict()
+	return nil
+}
+
+func (dc *AssetDerivativeCache) add(key string, fileName string, size int64) {
+	dc.entries[key] = dc.order.PushFront(&assetDerivative{
+		key:      key,
+		fileName: fileName,
+		size:     size,
+	})
+	dc.size += size
+}
+
+// remove deletes the derivative file and its entry, the lock is held by the caller
+func (dc *AssetDerivativeCache) remove(key string) {
+	element, ok := dc.entries[key]
+	if !ok {
+		return
+	}
+	derivative := element.Value.(*assetDerivative)
+	_ = os.Remove(filepath.Join(dc.path, derivative.fileName))
+	dc.order.Remove(element)
+	delete(dc.entries, key)
+	dc.size -= derivative.size
+}
+
+// evict removes the least recently used derivatives until they fit in maxBytes, the lock is held by the caller
+func (dc *AssetDerivativeCache) evict() {
+	for dc.size > dc.maxBytes && dc.order.Len() > 0 {
+		dc.remove(dc.order.Back().Value.(*assetDerivative).key)
+	}
+}
+
+// assetTransformParams returns the image transform parameters of the request, a ?variant= is expanded to its
+// configured parameters and explicit parameters in the request take precedence over those of the variant
+func assetTransformParams(query url.Values, configStore *resource.ConfigStore, typeName string, columnName string) (url.Values, error) {
+
+	params := url.Values{}
+
+	variantName := query.Get("variant")
+	if variantName != "" {
+		variant, err := assetVariant(configStore, typeName, columnName, variantName)
+		if err != nil {
+			return nil, err
+		}
+		params, err = url.ParseQuery(variant)
+		if err != nil {
+			return nil, fmt.Errorf("invalid definition of variant [%v]: %v", variantName, err)
+		}
+	}
+
+	for key, values := range query {
+		params[key] = values
+	}
+
+	// only the known parameters are kept, with a single value written the same way for every request asking for
+	// the same image, so the number of derivatives of a file stays bounded
+	normalised := url.Values{}
+	for key, values := range params {
+		value, ok, err := normaliseAssetTransformParam(key, values[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid value [%v] of [%v]: %v", values[0], key, err)
+		}
+		if ok {
+			normalised.Set(key, value)
+		}
+	}
+
+	return normalised, nil
+}
+
+// normaliseAssetTransformParam checks the value of a transform parameter and writes it in its canonical form,
+// ok is false for parameters which do not transform the image
+func normaliseAssetTransformParam(key string, value string) (string, bool, error) {
+
+	switch {
+	case key == "emboss" || key == "sharpen":
+		return "1", true, nil
+
+	case assetParamIn(key, assetFlagParams):
+		flag := strings.ToLower(value)
+		return "1", flag == "true" || flag == "1", nil
+
+	case assetParamIn(key, assetRadiusParams):
+		radius, err := assetNumbers(value, 1, 0, assetMaxRadius)
+		if err != nil {
+			return "", false, err
+		}
+		return radius, true, nil
+
+	case assetParamIn(key, assetNumberParams):
+		number, err := assetNumbers(value, 1, -1000, 1000)
+		if err != nil {
+			return "", false, err
+		}
+		return number, true, nil
+
+	case key == "colorBalance" || key == "colorize":
+		numbers, err := assetNumbers(value, 3, -1000, 1000)
+		if err != nil {
+			return "", false, err
+		}
+		return numbers, true, nil
+
+	case key == "crop":
+		numbers, err := assetNumbers(value, 4, 0, assetMaxDimension)
+		if err != nil {
+			return "", false, err
+		}
+		return numbers, true, nil
+
+	case key == "cropToSize" || key == "resize":
+		choices := assetAnchors
+		if key == "resize" {
+			choices = assetResamplings
+		}
+		vals := strings.Split(value, ",")
+		if len(vals) != 3 || !assetParamIn(vals[2], choices) {
+			return "", false, fmt.Errorf("expected width,height and one of %v", choices)
+		}
+		numbers, err := assetNumbers(vals[0]+","+vals[1], 2, 0, assetMaxDimension)
+		if err != nil {
+			return "", false, err
+		}
+		return numbers + "," + vals[2], true, nil
+
+	case key == "rotate":
+		vals := strings.Split(value, ",")
+		if len(vals) != 3 {
+			return "", false, fmt.Errorf("expected angle,color,interpolation")
+		}
+		angle, err := assetNumbers(vals[0], 1, -360, 360)
+		if err != nil {
+			return "", false, err
+		}
+		if _, err = ParseHexColor("#" + vals[1]); err != nil {
+			return "", false, err
+		}
+		if !assetParamIn(vals[2], assetInterpolations) {
+			return "", false, fmt.Errorf("expected one of %v", assetInterpolations)
+		}
+		return angle + "," + strings.ToLower(vals[1]) + "," + vals[2], true, nil
+
+	case key == "width" || key == "height":
+		size, err := assetNumbers(value, 1, 1, assetMaxDimension)
+		if err != nil {
+			return "", false, err
+		}
+		return strings.Split(size, ".")[0], true, nil
+
+	case key == "quality":
+		quality, err := assetNumbers(value, 1, 1, 100)
+		if err != nil {
+			return "", false, err
+		}
+		return strings.Split(quality, ".")[0], true, nil
+
+	case key == "fit" || key == "format":
+		choices := assetFits
+		if key == "format" {
+			choices = assetFormats
+		}
+		choice := strings.ToLower(value)
+		if choice == "jpg" {
+			choice = "jpeg"
+		}
+		if !assetParamIn(choice, choices) {
+			return "", false, fmt.Errorf("expected one of %v", choices)
+		}
+		return choice, true, nil
+	}
+
+	return "", false, nil
+}
+
+func assetParamIn(value string, values []string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// assetNumbers parses count comma separated numbers, clamps them to min and max and writes them back with
+// at most two decimals
+func assetNumbers(value string, count int, min float64, max float64) (string, error) {
+	vals := strings.Split(value, ",")
+	if len(vals) != count {
+		return "", fmt.Errorf("expected %d numbers", count)
+	}
+	numbers := make([]string, 0, count)
+	for _, val := range vals {
+		number, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		if err != nil || math.IsNaN(number) {
+			return "", fmt.Errorf("[%v] is not a number", val)
+		}
+		number = math.Max(min, math.Min(max, number))
+		numbers = append(numbers, strconv.FormatFloat(math.Round(number*100)/100, 'f', -1, 64))
+	}
+	return strings.Join(numbers, ","), nil
+}
+
+func assetVariant(configStore *resource.ConfigStore, typeName string, columnName string, variantName string) (string, error) {
+
+	if configStore != nil {
+		variant, err := configStore.GetConfigValueFor(fmt.Sprintf("asset.variant.%s.%s.%s", typeName, columnName, variantName), "backend")
+		if err == nil && variant != "" {
+			return variant, nil
+		}
+		variant, err = configStore.GetConfigValueFor("asset.variant."+variantName, "backend")
+		if err == nil && variant != "" {
+			return variant, nil
+		}
+	}
+
+	variant, ok := DefaultAssetVariants[variantName]
+	if !ok {
+		return "", fmt.Errorf("unknown variant [%v]", variantName)
+	}
+	return variant, nil
+}
+
+type assetFile interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// openAssetFile opens the file from the local copy of the column, or from the cloud store when it is not synced yet
+func openAssetFile(ctx context.Context, dbResource *resource.DbResource, assetCache *resource.AssetFolderCache, fileName string) (assetFile, error) {
+
+	file, err := assetCache.GetFileByName(fileName)
+	if err == nil {
+		return file, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	object, err := dbResource.OpenCloudStoreObject(ctx, assetCache.CloudStore, assetCache.Keyname, fileName)
+	if err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// serveAssetFile writes the file with support for Range and conditional requests
+func serveAssetFile(c *gin.Context, dbResource *resource.DbResource, assetCache *resource.AssetFolderCache, fileName string, fileType string) {
+
+	file, err := openAssetFile(c.Request.Context(), dbResource, assetCache, fileName)
+	if err != nil {
+		log.Errorf("failed to get file by name [%v] => %v", fileName, err)
+		c.AbortWithStatus(404)
+		return
+	}
+
+	var modTime time.Time
+	switch typedFile := file.(type) {
+	case *os.File:
+		if fileInfo, err := typedFile.Stat(); err == nil {
+			modTime = fileInfo.ModTime()
+		}
+	case *resource.CloudStoreObjectReader:
+		modTime = typedFile.Object.ModTime(c.Request.Context())
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", fileType)
+	http.ServeContent(c.Writer, c.Request, path.Base(fileName), modTime, file)
+}
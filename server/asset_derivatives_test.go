@@ -0,0 +1,144 @@
+package server
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daptin/daptin/server/resource"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAssetTransformParams(t *testing.T) {
+
+	query, _ := url.ParseQuery("variant=thumbnail&grayscale=1&file=a.png")
+	params, err := assetTransformParams(query, nil, "product", "photo")
+	if err != nil {
+		t.Fatalf("Failed to expand variant: %v", err)
+	}
+	if params.Get("resize") != DefaultAssetVariants["thumbnail"][len("resize="):] || params.Get("grayscale") != "1" {
+		t.Errorf("Unexpected transform parameters %v", params)
+	}
+	if params.Get("file") != "" || params.Get("variant") != "" {
+		t.Errorf("Expected file and variant to be removed from %v", params)
+	}
+
+	query, _ = url.ParseQuery("variant=thumbnail&resize=10,10,Box")
+	params, _ = assetTransformParams(query, nil, "product", "photo")
+	if params.Get("resize") != "10,10,Box" {
+		t.Errorf("Expected explicit parameter to override the variant, found %v", params)
+	}
+
+	query, _ = url.ParseQuery("variant=poster")
+	if _, err = assetTransformParams(query, nil, "product", "photo"); err == nil {
+		t.Errorf("Expected unknown variant to fail")
+	}
+
+	query, _ = url.ParseQuery("file=a.png&v=123&grayscale=false")
+	params, _ = assetTransformParams(query, nil, "product", "photo")
+	if len(params) != 0 {
+		t.Errorf("Expected no transform parameters, found %v", params)
+	}
+
+	query, _ = url.ParseQuery("width=100000&height=120.0&fit=cover&format=JPG&quality=90&brightness=10.004&gaussianblur=500")
+	params, _ = assetTransformParams(query, nil, "product", "photo")
+	if params.Encode() != "brightness=10&fit=cover&format=jpeg&gaussianblur=50&height=120&quality=90&width=4096" {
+		t.Errorf("Unexpected normalised parameters %v", params.Encode())
+	}
+
+	for _, invalid := range []string{"width=wide", "resize=10,10,Huge", "fit=stretch", "crop=1,2,3"} {
+		query, _ = url.ParseQuery(invalid)
+		if _, err = assetTransformParams(query, nil, "product", "photo"); err == nil {
+			t.Errorf("Expected [%v] to be rejected", invalid)
+		}
+	}
+
+}
+
+func TestAssetDerivativeCache(t *testing.T) {
+
+	cacheFolder, _ := ioutil.TempDir("", "derivatives")
+	defer os.RemoveAll(cacheFolder)
+
+	cache, err := NewAssetDerivativeCache(cacheFolder, 10)
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+
+	key := cache.Key("product", "ref1", "photo", "a.png", "md5-10", "resize=150")
+	if key == cache.Key("product", "ref1", "photo", "a.png", "md5-11", "resize=150") {
+		t.Errorf("Expected a new file version to change the key")
+	}
+	if _, _, ok := cache.Get(key); ok {
+		t.Errorf("Expected empty cache")
+	}
+	if err = cache.Put(key, "png", []byte("image")); err != nil {
+		t.Fatalf("Failed to store derivative: %v", err)
+	}
+	data, contentType, ok := cache.Get(key)
+	if !ok || string(data) != "image" || contentType != "image/png" {
+		t.Errorf("Unexpected cached derivative [%v] [%v] %v", string(data), contentType, ok)
+	}
+
+	otherKey := cache.Key("product", "ref1", "photo", "b.png", "md5-10", "resize=150")
+	_ = cache.Put(otherKey, "jpeg", []byte("other"))
+	cache.Get(key)
+	_ = cache.Put(cache.Key("product", "ref1", "photo", "c.png", "md5-10", "resize=150"), "png", []byte("third"))
+	if _, _, ok = cache.Get(otherKey); ok {
+		t.Errorf("Expected the least recently used derivative to be evicted")
+	}
+	if _, _, ok = cache.Get(key); !ok {
+		t.Errorf("Expected the recently used derivative to be kept")
+	}
+
+	reopened, _ := NewAssetDerivativeCache(cacheFolder, 10)
+	if _, contentType, ok = reopened.Get(key); !ok || contentType != "image/png" {
+		t.Errorf("Expected the stored derivatives to be indexed on start, found [%v] %v", contentType, ok)
+	}
+
+}
+
+func TestServeAssetFileRange(t *testing.T) {
+
+	assetFolder, _ := ioutil.TempDir("", "assets")
+	defer os.RemoveAll(assetFolder)
+	_ = ioutil.WriteFile(filepath.Join(assetFolder, "video.mp4"), []byte("0123456789"), 0644)
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest("GET", "/asset/product/ref1/video.mp4", nil)
+	c.Request.Header.Set("Range", "bytes=2-5")
+
+	serveAssetFile(c, nil, &resource.AssetFolderCache{LocalSyncPath: assetFolder}, "video.mp4", "video/mp4")
+
+	if recorder.Code != http.StatusPartialContent {
+		t.Fatalf("Expected partial content, found %v", recorder.Code)
+	}
+	if recorder.Body.String() != "2345" || recorder.Header().Get("Content-Range") != "bytes 2-5/10" {
+		t.Errorf("Unexpected range response [%v] [%v]", recorder.Body.String(), recorder.Header().Get("Content-Range"))
+	}
+
+}
+
+func TestImageTransformFiltersOrder(t *testing.T) {
+
+	params, _ := url.ParseQuery("flipVertical=1&contrast=20&brightness=10&flipHorizontal=1&colorspaceLinearToSRGB=1")
+	expected := ""
+	for i := 0; i < 20; i++ {
+		filters, _ := imageTransformFilters(params)
+		order := ""
+		for _, filter := range filters {
+			order += fmt.Sprintf("%T ", filter)
+		}
+		if i == 0 {
+			expected = order
+		} else if order != expected {
+			t.Fatalf("Expected the same filter order for the same parameters, found %v and %v", expected, order)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"bytes"
 	"crypto/md5"
 	"fmt"
 	"github.com/anthonynsimon/bild/blur"
@@ -15,7 +16,9 @@ import (
 	"image/png"
 	"io"
 	"net/http"
-	"os"
+	"net/url"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -35,7 +38,18 @@ func Etag(content []byte) (string, error) {
 	return fmt.Sprintf(etagFormat, hash.Sum(nil)), nil
 }
 
-func CreateDbAssetHandler(cruds map[string]*resource.DbResource) func(*gin.Context) {
+// CreateDbAssetHandler serves files of asset columns, with byte ranges for all files and cached image derivatives
+// for requests with transform parameters or a named ?variant=
+func CreateDbAssetHandler(cruds map[string]*resource.DbResource, configStore *resource.ConfigStore) func(*gin.Context) {
+
+	derivativeCacheSize, err := configStore.GetConfigIntValueFor("asset.derivative_cache_mb", "backend")
+	if err != nil {
+		derivativeCacheSize = 512
+		_ = configStore.SetConfigIntValueFor("asset.derivative_cache_mb", derivativeCacheSize, "backend")
+	}
+	derivativeCache, err := NewAssetDerivativeCache(filepath.Join(assetCacheRoot(), "derivatives"), int64(derivativeCacheSize)*1024*1024)
+	resource.CheckErr(err, "Failed to create asset derivative cache folder")
+
 	return func(c *gin.Context) {
 		var typeName = c.Param("typename")
 		var resourceId = c.Param("resource_id")
@@ -94,6 +108,7 @@ func CreateDbAssetHandler(cruds map[string]*resource.DbResource) func(*gin.Conte
 
 			fileToServe := ""
 			fileType := "application/octet-stream"
+			fileVersion := ""
 			for _, fileData := range colData.([]map[string]interface{}) {
 				//fileData := fileInterface.(map[string]interface{})
 				fileName := fileData["name"].(string)
@@ -109,14 +124,13 @@ func CreateDbAssetHandler(cruds map[string]*resource.DbResource) func(*gin.Conte
 					}
 
 					fileType = fileData["type"].(string)
+					fileVersion = fmt.Sprintf("%v-%v", fileData["md5"], fileData["size"])
 					break
 				}
 			}
 
-			file, err := cruds["world"].AssetFolderCache[typeName][columnName].GetFileByName(fileToServe)
-
-			if err != nil {
-				log.Errorf("failed to get file by name [%v] => %v", fileToServe, err)
+			assetCache, ok := cruds["world"].AssetFolderCache[typeName][columnName]
+			if !ok || fileToServe == "" {
 				c.AbortWithStatus(404)
 				return
 			}
@@ -126,309 +140,37 @@ func CreateDbAssetHandler(cruds map[string]*resource.DbResource) func(*gin.Conte
 
 			case "image":
 
-				bildFilters := make([]func(image.Image) image.Image, 0)
-				filters := make([]gift.Filter, 0)
-				for key, values := range c.Request.URL.Query() {
-					param := gin.Param{
-						Key:   key,
-						Value: values[0],
-					}
-
-					valueFloat64, floatError := strconv.ParseFloat(param.Value, 32)
-					valueFloat32 := float32(valueFloat64)
-
-					switch param.Key {
-
-					case "boxblur":
-						bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
-							return func(img image.Image) image.Image {
-								return blur.Box(img, radius)
-							}
-						}(valueFloat64))
-					case "gaussianblur":
-						bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
-							return func(img image.Image) image.Image {
-								return blur.Gaussian(img, radius)
-							}
-						}(valueFloat64))
-					case "dilate":
-						bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
-							return func(img image.Image) image.Image {
-								return effect.Dilate(img, radius)
-							}
-						}(valueFloat64))
-					case "edgedetection":
-						bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
-							return func(img image.Image) image.Image {
-								return effect.EdgeDetection(img, radius)
-							}
-						}(valueFloat64))
-					case "erode":
-						bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
-							return func(img image.Image) image.Image {
-								return effect.Erode(img, radius)
-							}
-						}(valueFloat64))
-					case "emboss":
-						bildFilters = append(bildFilters, func() func(img image.Image) image.Image {
-							return func(img image.Image) image.Image {
-								return effect.Emboss(img)
-							}
-						}())
-
-					case "median":
-						bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
-							return func(img image.Image) image.Image {
-								return effect.Median(img, radius)
-							}
-						}(valueFloat64))
-
-					case "sharpen":
-						bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
-							return func(img image.Image) image.Image {
-								return effect.Sharpen(img)
-							}
-						}(valueFloat64))
-
-					case "brightness":
-						filters = append(filters, gift.Brightness(valueFloat32))
-						break
-					case "colorBalance":
-						vals := strings.Split(param.Value, ",")
-						if len(vals) != 3 {
-							continue
-						}
-
-						red, _ := strconv.ParseFloat(vals[0], 32)
-						green, _ := strconv.ParseFloat(vals[1], 32)
-						blue, _ := strconv.ParseFloat(vals[2], 32)
-						filters = append(filters, gift.ColorBalance(float32(red), float32(green), float32(blue)))
-						break
-					case "colorize":
-
-						vals := strings.Split(param.Value, ",")
-						if len(vals) != 3 {
-							continue
-						}
-
-						hue, _ := strconv.ParseFloat(vals[0], 32)
-						saturattion, _ := strconv.ParseFloat(vals[1], 32)
-						percent, _ := strconv.ParseFloat(vals[2], 32)
-						filters = append(filters, gift.ColorBalance(float32(hue), float32(saturattion), float32(percent)))
-						break
-					case "colorspaceLinearToSRGB":
-						if strings.ToLower(param.Value) == "true" || param.Value == "1" {
-							filters = append(filters, gift.ColorspaceLinearToSRGB())
-						}
-						break
-					case "colorspaceSRGBToLinear":
-						if strings.ToLower(param.Value) == "true" || param.Value == "1" {
-							filters = append(filters, gift.ColorspaceSRGBToLinear())
-						}
-						break
-					case "contrast":
-						if floatError == nil {
-							filters = append(filters, gift.Contrast(valueFloat32))
-						}
-						break
-					case "crop":
-
-						vals := strings.Split(param.Value, ",")
-						if len(vals) != 4 {
-							continue
-						}
-
-						minX, _ := strconv.ParseInt(vals[0], 10, 32)
-						minY, _ := strconv.ParseInt(vals[1], 10, 32)
-						maxX, _ := strconv.ParseInt(vals[2], 10, 32)
-						maxY, _ := strconv.ParseInt(vals[3], 10, 32)
-
-						rect := image.Rectangle{
-							Min: image.Point{
-								X: int(minX),
-								Y: int(minY),
-							},
-							Max: image.Point{
-								X: int(maxX),
-								Y: int(maxY),
-							},
-						}
-						filters = append(filters, gift.Crop(rect))
-						break
-					case "cropToSize":
-
-						vals := strings.Split(param.Value, ",")
-						if len(vals) != 3 {
-							continue
-						}
-						height, _ := strconv.ParseInt(vals[0], 10, 32)
-						weight, _ := strconv.ParseInt(vals[1], 10, 32)
-						anchor := gift.CenterAnchor
-
-						switch vals[2] {
-						case "Center":
-							anchor = gift.CenterAnchor
-							break
-						case "TopLeft":
-							anchor = gift.TopLeftAnchor
-							break
-						case "Top":
-							anchor = gift.TopAnchor
-							break
-						case "TopRight":
-							anchor = gift.TopRightAnchor
-							break
-						case "Left":
-							anchor = gift.LeftAnchor
-							break
-						case "Right":
-							anchor = gift.RightAnchor
-							break
-						case "BottomLeft":
-							anchor = gift.BottomLeftAnchor
-							break
-						case "Bottom":
-							anchor = gift.BottomAnchor
-							break
-						case "BottomRight":
-							anchor = gift.BottomRightAnchor
-							break
-						}
-						filters = append(filters, gift.CropToSize(int(height), int(weight), anchor))
-						break
-					case "flipHorizontal":
-						if strings.ToLower(param.Value) == "true" || param.Value == "1" {
-							filters = append(filters, gift.FlipHorizontal())
-						}
-						break
-					case "flipVertical":
-						if strings.ToLower(param.Value) == "true" || param.Value == "1" {
-							filters = append(filters, gift.FlipVertical())
-						}
-						break
-					case "gamma":
-						filters = append(filters, gift.Gamma(valueFloat32))
-						break
-					case "gaussianBlur":
-						filters = append(filters, gift.GaussianBlur(valueFloat32))
-						break
-					case "grayscale":
-						if strings.ToLower(param.Value) == "true" || param.Value == "1" {
-							filters = append(filters, gift.Grayscale())
-						}
-						break
-					case "hue":
-						filters = append(filters, gift.Hue(valueFloat32))
-						break
-					case "invert":
-						if strings.ToLower(param.Value) == "true" || param.Value == "1" {
-
-							filters = append(filters, gift.Invert())
-						}
-						break
-					case "resize":
-						vals := strings.Split(param.Value, ",")
-						if len(vals) != 3 {
-							continue
-						}
-						height, _ := strconv.ParseInt(vals[0], 10, 32)
-						weight, _ := strconv.ParseInt(vals[1], 10, 32)
-						resampling := gift.NearestNeighborResampling
-
-						switch vals[2] {
-						case "NearestNeighbor":
-							resampling = gift.NearestNeighborResampling
-							break
-						case "Box":
-							resampling = gift.BoxResampling
-							break
-						case "Linear":
-							resampling = gift.LinearResampling
-							break
-						case "Cubic":
-							resampling = gift.CubicResampling
-							break
-						case "Lanczos":
-							resampling = gift.LanczosResampling
-							break
-						}
-						filters = append(filters, gift.Resize(int(height), int(weight), resampling))
-						break
-					case "rotate":
-
-						vals := strings.Split(param.Value, ",")
-						if len(vals) != 3 {
-							continue
-						}
-						angle, _ := strconv.ParseFloat(vals[0], 32)
-						backgroundColor, _ := ParseHexColor("#" + vals[1])
-						interpolation := gift.NearestNeighborInterpolation
-
-						switch vals[2] {
-						case "NearestNeighbor":
-							interpolation = gift.NearestNeighborInterpolation
-							break
-						case "Linear":
-							interpolation = gift.LinearInterpolation
-							break
-						case "Cubic":
-							interpolation = gift.CubicInterpolation
-							break
-						}
-						filters = append(filters, gift.Rotate(float32(angle), backgroundColor, interpolation))
-						break
-					case "rotate180":
-						if strings.ToLower(param.Value) == "true" || param.Value == "1" {
-
-							filters = append(filters, gift.Rotate180())
-						}
-						break
-					case "rotate270":
-						if strings.ToLower(param.Value) == "true" || param.Value == "1" {
-
-							filters = append(filters, gift.Rotate270())
-						}
-						break
-					case "rotate90":
-						if strings.ToLower(param.Value) == "true" || param.Value == "1" {
-
-							filters = append(filters, gift.Rotate270())
-						}
-						break
-					case "saturation":
-						filters = append(filters, gift.Saturation(valueFloat32))
-						break
-					case "sepia":
-						filters = append(filters, gift.Sepia(valueFloat32))
-						break
-					case "sobel":
-						if strings.ToLower(param.Value) == "true" || param.Value == "1" {
-
-							filters = append(filters, gift.Sobel())
-						}
-						break
-					case "threshold":
-						filters = append(filters, gift.Threshold(valueFloat32))
-
-						break
-					case "transpose":
-						if strings.ToLower(param.Value) == "true" || param.Value == "1" {
-
-							filters = append(filters, gift.Transpose())
-						}
-
-						break
-					case "transverse":
-						if strings.ToLower(param.Value) == "true" || param.Value == "1" {
-
-							filters = append(filters, gift.Transverse())
-						}
-						break
+				transformParams, err := assetTransformParams(c.Request.URL.Query(), configStore, typeName, columnName)
+				if err != nil {
+					c.AbortWithStatusJSON(400, resource.NewDaptinError("Invalid image parameters", err.Error()))
+					return
+				}
+				if len(transformParams) == 0 {
+					serveAssetFile(c, cruds["world"], assetCache, fileToServe, fileType)
+					return
+				}
 
-					}
+				cacheKey := derivativeCache.Key(typeName, resourceId, columnName, fileToServe, fileVersion, transformParams.Encode())
+				etag := "\"" + cacheKey + "\""
+				if c.GetHeader("If-None-Match") == etag {
+					c.AbortWithStatus(304)
+					return
+				}
+				if data, contentType, ok := derivativeCache.Get(cacheKey); ok {
+					c.Header("ETag", etag)
+					c.Data(200, contentType, data)
+					return
+				}
 
+				file, err := openAssetFile(c.Request.Context(), cruds["world"], assetCache, fileToServe)
+				if err != nil {
+					log.Errorf("failed to get file by name [%v] => %v", fileToServe, err)
+					c.AbortWithStatus(404)
+					return
 				}
+				defer file.Close()
 
+				filters, bildFilters := imageTransformFilters(transformParams)
 				f := gift.New(filters...)
 
 				img, formatName, err := image.Decode(file)
@@ -446,21 +188,34 @@ func CreateDbAssetHandler(cruds map[string]*resource.DbResource) func(*gin.Conte
 				dst := image.NewNRGBA(f.Bounds(img.Bounds()))
 				f.Draw(dst, img)
 
-				c.Writer.Header().Set("Content-Type", "image/"+formatName)
-				if formatName == "png" {
-					err = png.Encode(c.Writer, dst)
+				if format := transformParams.Get("format"); format != "" {
+					formatName = format
+				}
+				output := bytes.Buffer{}
+				if formatName != "png" {
+					formatName = "jpeg"
+					var options *jpeg.Options
+					if quality, err := strconv.Atoi(transformParams.Get("quality")); err == nil {
+						options = &jpeg.Options{Quality: quality}
+					}
+					err = jpeg.Encode(&output, dst, options)
 				} else {
-					err = jpeg.Encode(c.Writer, dst, nil)
+					err = png.Encode(&output, dst)
 				}
 				if err != nil {
 					log.Printf("failed to write converted image :%v", err)
+					c.AbortWithStatus(500)
+					return
 				}
 
-				c.AbortWithStatus(200)
+				err = derivativeCache.Put(cacheKey, formatName, output.Bytes())
+				resource.CheckErr(err, "Failed to store image derivative [%v]", fileToServe)
+
+				c.Header("ETag", etag)
+				c.Data(200, "image/"+formatName, output.Bytes())
 
 			default:
-				c.Writer.Header().Set("Content-Type", fileType)
-				c.File(cruds["world"].AssetFolderCache[typeName][columnName].LocalSyncPath + string(os.PathSeparator) + fileToServe)
+				serveAssetFile(c, cruds["world"], assetCache, fileToServe, fileType)
 
 			}
 		} else if colInfo.ColumnType == "markdown" {
@@ -472,3 +227,333 @@ func CreateDbAssetHandler(cruds map[string]*resource.DbResource) func(*gin.Conte
 
 	}
 }
+
+// imageTransformFilters builds the gift and bild filters for the transform parameters of an image asset request
+func imageTransformFilters(params url.Values) ([]gift.Filter, []func(image.Image) image.Image) {
+	bildFilters := make([]func(image.Image) image.Image, 0)
+	filters := make([]gift.Filter, 0)
+
+	// filters are applied in the order of the sorted keys, the same order url.Values.Encode uses for the cache key
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		param := gin.Param{
+			Key:   key,
+			Value: params.Get(key),
+		}
+
+		valueFloat64, floatError := strconv.ParseFloat(param.Value, 32)
+		valueFloat32 := float32(valueFloat64)
+
+		switch param.Key {
+
+		case "boxblur":
+			bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return blur.Box(img, radius)
+				}
+			}(valueFloat64))
+		case "gaussianblur":
+			bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return blur.Gaussian(img, radius)
+				}
+			}(valueFloat64))
+		case "dilate":
+			bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return effect.Dilate(img, radius)
+				}
+			}(valueFloat64))
+		case "edgedetection":
+			bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return effect.EdgeDetection(img, radius)
+				}
+			}(valueFloat64))
+		case "erode":
+			bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return effect.Erode(img, radius)
+				}
+			}(valueFloat64))
+		case "emboss":
+			bildFilters = append(bildFilters, func() func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return effect.Emboss(img)
+				}
+			}())
+
+		case "median":
+			bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return effect.Median(img, radius)
+				}
+			}(valueFloat64))
+
+		case "sharpen":
+			bildFilters = append(bildFilters, func(radius float64) func(img image.Image) image.Image {
+				return func(img image.Image) image.Image {
+					return effect.Sharpen(img)
+				}
+			}(valueFloat64))
+
+		case "brightness":
+			filters = append(filters, gift.Brightness(valueFloat32))
+			break
+		case "colorBalance":
+			vals := strings.Split(param.Value, ",")
+			if len(vals) != 3 {
+				continue
+			}
+
+			red, _ := strconv.ParseFloat(vals[0], 32)
+			green, _ := strconv.ParseFloat(vals[1], 32)
+			blue, _ := strconv.ParseFloat(vals[2], 32)
+			filters = append(filters, gift.ColorBalance(float32(red), float32(green), float32(blue)))
+			break
+		case "colorize":
+
+			vals := strings.Split(param.Value, ",")
+			if len(vals) != 3 {
+				continue
+			}
+
+			hue, _ := strconv.ParseFloat(vals[0], 32)
+			saturattion, _ := strconv.ParseFloat(vals[1], 32)
+			percent, _ := strconv.ParseFloat(vals[2], 32)
+			filters = append(filters, gift.ColorBalance(float32(hue), float32(saturattion), float32(percent)))
+			break
+		case "colorspaceLinearToSRGB":
+			if strings.ToLower(param.Value) == "true" || param.Value == "1" {
+				filters = append(filters, gift.ColorspaceLinearToSRGB())
+			}
+			break
+		case "colorspaceSRGBToLinear":
+			if strings.ToLower(param.Value) == "true" || param.Value == "1" {
+				filters = append(filters, gift.ColorspaceSRGBToLinear())
+			}
+			break
+		case "contrast":
+			if floatError == nil {
+				filters = append(filters, gift.Contrast(valueFloat32))
+			}
+			break
+		case "crop":
+
+			vals := strings.Split(param.Value, ",")
+			if len(vals) != 4 {
+				continue
+			}
+
+			minX, _ := strconv.ParseInt(vals[0], 10, 32)
+			minY, _ := strconv.ParseInt(vals[1], 10, 32)
+			maxX, _ := strconv.ParseInt(vals[2], 10, 32)
+			maxY, _ := strconv.ParseInt(vals[3], 10, 32)
+
+			rect := image.Rectangle{
+				Min: image.Point{
+					X: int(minX),
+					Y: int(minY),
+				},
+				Max: image.Point{
+					X: int(maxX),
+					Y: int(maxY),
+				},
+			}
+			filters = append(filters, gift.Crop(rect))
+			break
+		case "cropToSize":
+
+			vals := strings.Split(param.Value, ",")
+			if len(vals) != 3 {
+				continue
+			}
+			height, _ := strconv.ParseInt(vals[0], 10, 32)
+			weight, _ := strconv.ParseInt(vals[1], 10, 32)
+			anchor := gift.CenterAnchor
+
+			switch vals[2] {
+			case "Center":
+				anchor = gift.CenterAnchor
+				break
+			case "TopLeft":
+				anchor = gift.TopLeftAnchor
+				break
+			case "Top":
+				anchor = gift.TopAnchor
+				break
+			case "TopRight":
+				anchor = gift.TopRightAnchor
+				break
+			case "Left":
+				anchor = gift.LeftAnchor
+				break
+			case "Right":
+				anchor = gift.RightAnchor
+				break
+			case "BottomLeft":
+				anchor = gift.BottomLeftAnchor
+				break
+			case "Bottom":
+				anchor = gift.BottomAnchor
+				break
+			case "BottomRight":
+				anchor = gift.BottomRightAnchor
+				break
+			}
+			filters = append(filters, gift.CropToSize(int(height), int(weight), anchor))
+			break
+		case "flipHorizontal":
+			if strings.ToLower(param.Value) == "true" || param.Value == "1" {
+				filters = append(filters, gift.FlipHorizontal())
+			}
+			break
+		case "flipVertical":
+			if strings.ToLower(param.Value) == "true" || param.Value == "1" {
+				filters = append(filters, gift.FlipVertical())
+			}
+			break
+		case "gamma":
+			filters = append(filters, gift.Gamma(valueFloat32))
+			break
+		case "gaussianBlur":
+			filters = append(filters, gift.GaussianBlur(valueFloat32))
+			break
+		case "grayscale":
+			if strings.ToLower(param.Value) == "true" || param.Value == "1" {
+				filters = append(filters, gift.Grayscale())
+			}
+			break
+		case "hue":
+			filters = append(filters, gift.Hue(valueFloat32))
+			break
+		case "invert":
+			if strings.ToLower(param.Value) == "true" || param.Value == "1" {
+
+				filters = append(filters, gift.Invert())
+			}
+			break
+		case "resize":
+			vals := strings.Split(param.Value, ",")
+			if len(vals) != 3 {
+				continue
+			}
+			height, _ := strconv.ParseInt(vals[0], 10, 32)
+			weight, _ := strconv.ParseInt(vals[1], 10, 32)
+			resampling := gift.NearestNeighborResampling
+
+			switch vals[2] {
+			case "NearestNeighbor":
+				resampling = gift.NearestNeighborResampling
+				break
+			case "Box":
+				resampling = gift.BoxResampling
+				break
+			case "Linear":
+				resampling = gift.LinearResampling
+				break
+			case "Cubic":
+				resampling = gift.CubicResampling
+				break
+			case "Lanczos":
+				resampling = gift.LanczosResampling
+				break
+			}
+			filters = append(filters, gift.Resize(int(height), int(weight), resampling))
+			break
+		case "rotate":
+
+			vals := strings.Split(param.Value, ",")
+			if len(vals) != 3 {
+				continue
+			}
+			angle, _ := strconv.ParseFloat(vals[0], 32)
+			backgroundColor, _ := ParseHexColor("#" + vals[1])
+			interpolation := gift.NearestNeighborInterpolation
+
+			switch vals[2] {
+			case "NearestNeighbor":
+				interpolation = gift.NearestNeighborInterpolation
+				break
+			case "Linear":
+				interpolation = gift.LinearInterpolation
+				break
+			case "Cubic":
+				interpolation = gift.CubicInterpolation
+				break
+			}
+			filters = append(filters, gift.Rotate(float32(angle), backgroundColor, interpolation))
+			break
+		case "rotate180":
+			if strings.ToLower(param.Value) == "true" || param.Value == "1" {
+
+				filters = append(filters, gift.Rotate180())
+			}
+			break
+		case "rotate270":
+			if strings.ToLower(param.Value) == "true" || param.Value == "1" {
+
+				filters = append(filters, gift.Rotate270())
+			}
+			break
+		case "rotate90":
+			if strings.ToLower(param.Value) == "true" || param.Value == "1" {
+
+				filters = append(filters, gift.Rotate270())
+			}
+			break
+		case "saturation":
+			filters = append(filters, gift.Saturation(valueFloat32))
+			break
+		case "sepia":
+			filters = append(filters, gift.Sepia(valueFloat32))
+			break
+		case "sobel":
+			if strings.ToLower(param.Value) == "true" || param.Value == "1" {
+
+				filters = append(filters, gift.Sobel())
+			}
+			break
+		case "threshold":
+			filters = append(filters, gift.Threshold(valueFloat32))
+
+			break
+		case "transpose":
+			if strings.ToLower(param.Value) == "true" || param.Value == "1" {
+
+				filters = append(filters, gift.Transpose())
+			}
+
+			break
+		case "transverse":
+			if strings.ToLower(param.Value) == "true" || param.Value == "1" {
+
+				filters = append(filters, gift.Transverse())
+			}
+			break
+
+		}
+
+	}
+
+	// width and height scale the image, fit=contain keeps it inside both and fit=cover fills both and crops the rest
+	if params.Get("width") != "" || params.Get("height") != "" {
+		width, _ := strconv.Atoi(params.Get("width"))
+		height, _ := strconv.Atoi(params.Get("height"))
+		switch {
+		case params.Get("fit") == "contain" && width > 0 && height > 0:
+			filters = append(filters, gift.ResizeToFit(width, height, gift.LanczosResampling))
+		case params.Get("fit") == "cover" && width > 0 && height > 0:
+			filters = append(filters, gift.ResizeToFill(width, height, gift.LanczosResampling, gift.CenterAnchor))
+		default:
+			filters = append(filters, gift.Resize(width, height, gift.LanczosResampling))
+		}
+	}
+
+	return filters, bildFilters
+}
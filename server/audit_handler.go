@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateAuditHistoryHandler serves the changes made to an object as field level diffs with the user who made them,
+// the history of a deleted object is only served to administrators
+func CreateAuditHistoryHandler(cruds map[string]*resource.DbResource) func(*gin.Context) {
+	return func(c *gin.Context) {
+
+		typeName := c.Param("typename")
+		referenceId := c.Param("referenceId")
+		dbResource, ok := cruds[typeName]
+		if !ok || dbResource.TableInfo() == nil || !dbResource.TableInfo().IsAuditEnabled {
+			c.AbortWithStatusJSON(404, ErrorResponse{Message: fmt.Sprintf("audit is not enabled for [%v]", typeName)})
+			return
+		}
+
+		sessionUser, _ := c.Request.Context().Value("user").(*auth.SessionUser)
+		if sessionUser == nil {
+			c.AbortWithStatus(403)
+			return
+		}
+
+		if !cruds["world"].GetObjectPermissionByWhereClause("world", "table_name", typeName).
+			CanRead(sessionUser.UserReferenceId, sessionUser.Groups) {
+			c.AbortWithStatus(403)
+			return
+		}
+
+		allowed := false
+		if _, err := dbResource.GetReferenceIdToId(typeName, referenceId); err == nil {
+			allowed = cruds["world"].GetRowPermission(map[string]interface{}{
+				"__type":       typeName,
+				"reference_id": referenceId,
+			}).CanRead(sessionUser.UserReferenceId, sessionUser.Groups)
+		} else {
+			allowed = dbResource.IsAdmin(sessionUser.UserReferenceId)
+		}
+		if !allowed {
+			log.Infof("user [%v] not allowed to read the history of [%v][%v]", sessionUser.UserReferenceId, typeName, referenceId)
+			c.AbortWithStatus(403)
+			return
+		}
+
+		history, err := dbResource.GetAuditHistory(referenceId)
+		if err != nil {
+			c.AbortWithStatusJSON(500, resource.NewDaptinError("Failed to read the audit history", err.Error()))
+			return
+		}
+
+		c.JSON(200, map[string]interface{}{
+			"table":        typeName,
+			"reference_id": referenceId,
+			"history":      history,
+		})
+	}
+}
@@ -66,6 +66,7 @@ func (a AuthPermission) String() string {
 type ResourceAdapter interface {
 	api2go.CRUD
 	GetUserPassword(email string) (string, error)
+	AllowsPasswordOnlySignInByEmail(email string) bool
 }
 
 type AuthMiddleware struct {
@@ -168,7 +169,8 @@ func (a *AuthMiddleware) BasicAuthCheckMiddlewareWithHttp(req *http.Request, wri
 		return
 	}
 
-	if BcryptCheckStringHash(password, existingPasswordHash) {
+	// users who have to present a second factor sign in with a token
+	if BcryptCheckStringHash(password, existingPasswordHash) && a.userCrud.AllowsPasswordOnlySignInByEmail(username) {
 		token = &jwt.Token{
 			Claims: jwt.MapClaims{
 				"name":  strings.Split(username, "@")[0],
@@ -267,6 +269,10 @@ func (a *AuthMiddleware) AuthCheckMiddlewareWithHttp(req *http.Request, writer h
 		hasUser = true
 	}
 
+	if hasUser && userJwtToken != nil && !IsSessionToken(userJwtToken) {
+		hasUser = false
+	}
+
 	if hasUser {
 
 		if userJwtToken == nil {
@@ -486,6 +492,30 @@ func (a *AuthMiddleware) AuthCheckMiddleware(c *gin.Context) {
 
 }
 
+// MfaPendingClaim marks the tokens issued at sign in to users who still have to present a second factor, these
+// tokens are only accepted by the second factor actions
+const MfaPendingClaim = "mfa_pending"
+
+// OAuthAccessTokenType is the typ claim of the access tokens issued to oauth clients
+const OAuthAccessTokenType = "oauth-access"
+
+// IsSessionToken is true for tokens which sign in a user, tokens waiting for a second factor, oauth access tokens and
+// tokens without an email, like the ones carrying a form through the oauth consent, are not
+func IsSessionToken(token *jwt.Token) bool {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	if _, ok := claims["email"].(string); !ok {
+		return false
+	}
+	if claims["typ"] == OAuthAccessTokenType {
+		return false
+	}
+	_, pending := claims[MfaPendingClaim]
+	return !pending
+}
+
 type SessionUser struct {
 	UserId          int64
 	UserReferenceId string
@@ -3,6 +3,8 @@ package auth
 import (
 	"fmt"
 	"testing"
+
+	"github.com/dgrijalva/jwt-go"
 )
 
 func TestAllPermission(t *testing.T) {
@@ -89,3 +91,20 @@ func TestAuthPermissions(t *testing.T) {
 		}
 	}
 }
+
+func TestIsSessionToken(t *testing.T) {
+
+	cases := []struct {
+		claims  jwt.MapClaims
+		session bool
+	}{
+		{jwt.MapClaims{"email": "user@example.com", "name": "user"}, true},
+		{jwt.MapClaims{"email": "user@example.com", MfaPendingClaim: true}, false},
+		{jwt.MapClaims{"aud": "oauth-consent", "sub": "user-1"}, false},
+	}
+	for _, c := range cases {
+		if IsSessionToken(jwt.NewWithClaims(jwt.SigningMethodHS256, c.claims)) != c.session {
+			t.Errorf("Expected %v to be a session token: %v", c.claims, c.session)
+		}
+	}
+}
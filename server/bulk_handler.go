@@ -0,0 +1,72 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateBulkOperationsHandler runs a JSON:API atomic operations request, all of its operations are applied in one
+// transaction or none of them are
+func CreateBulkOperationsHandler(cruds map[string]*resource.DbResource) func(*gin.Context) {
+	return func(c *gin.Context) {
+
+		var body map[string][]resource.BulkOperation
+		err := json.NewDecoder(c.Request.Body).Decode(&body)
+		if err != nil {
+			c.AbortWithStatusJSON(400, resource.NewDaptinError("Invalid bulk request", err.Error()))
+			return
+		}
+		operations, ok := body[resource.BulkOperationsKey]
+		if !ok || len(operations) == 0 {
+			c.AbortWithStatusJSON(400, ErrorResponse{Message: fmt.Sprintf("expected a list of operations in [%v]", resource.BulkOperationsKey)})
+			return
+		}
+
+		results, err := resource.ExecuteBulkOperations(cruds, operations, c.Request.Context())
+		if err != nil {
+			bulkError, ok := err.(resource.BulkOperationError)
+			if !ok {
+				c.AbortWithStatusJSON(500, resource.NewDaptinError("Failed to apply the operations", err.Error()))
+				return
+			}
+			c.AbortWithStatusJSON(bulkError.Status(), map[string]interface{}{
+				"errors": bulkOperationErrors(bulkError),
+			})
+			return
+		}
+
+		c.JSON(200, map[string]interface{}{
+			resource.BulkResultsKey: results,
+		})
+	}
+}
+
+// bulkOperationErrors are the JSON:API errors of the failed operation, pointing to it in the request
+func bulkOperationErrors(bulkError resource.BulkOperationError) []api2go.Error {
+	pointer := fmt.Sprintf("/%v/%d", resource.BulkOperationsKey, bulkError.Index)
+	status := strconv.Itoa(bulkError.Status())
+
+	errors := make([]api2go.Error, 0)
+	if httpError, ok := bulkError.Err.(api2go.HTTPError); ok {
+		errors = append(errors, httpError.Errors...)
+	}
+	if len(errors) == 0 {
+		errors = append(errors, api2go.Error{
+			Status: status,
+			Title:  http.StatusText(bulkError.Status()),
+			Detail: bulkError.Err.Error(),
+		})
+	}
+	for i := range errors {
+		if errors[i].Status == "" {
+			errors[i].Status = status
+		}
+		errors[i].Source = &api2go.ErrorSource{Pointer: pointer}
+	}
+	return errors
+}
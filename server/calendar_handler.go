@@ -0,0 +1,91 @@
+package server
+
+import (
+	"github.com/araddon/dateparse"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// CreateCalendarOccurrenceHandler lists the event occurrences of the logged in user between ?start= and ?end=
+// recurring events are expanded into one entry per occurrence
+func CreateCalendarOccurrenceHandler(cruds map[string]*resource.DbResource) func(*gin.Context) {
+
+	return func(c *gin.Context) {
+
+		sessionUser, start, end, ok := calendarRequestRange(c)
+		if !ok {
+			return
+		}
+
+		occurrences, err := cruds["calendar"].GetCalendarOccurrences(sessionUser.UserId, start, end)
+		if err != nil {
+			log.Errorf("failed to list calendar occurrences: %v", err)
+			c.JSON(500, resource.NewDaptinError("Failed to list occurrences", err.Error()))
+			return
+		}
+
+		c.JSON(200, occurrences)
+	}
+
+}
+
+// CreateCalendarFreeBusyHandler returns the merged busy periods of the logged in user between ?start= and ?end=
+func CreateCalendarFreeBusyHandler(cruds map[string]*resource.DbResource) func(*gin.Context) {
+
+	return func(c *gin.Context) {
+
+		sessionUser, start, end, ok := calendarRequestRange(c)
+		if !ok {
+			return
+		}
+
+		periods, err := cruds["calendar"].GetFreeBusy(sessionUser.UserId, start, end)
+		if err != nil {
+			log.Errorf("failed to query free busy: %v", err)
+			c.JSON(500, resource.NewDaptinError("Failed to query free busy", err.Error()))
+			return
+		}
+
+		if c.Query("format") == "ical" {
+			c.Data(200, "text/calendar; charset=utf-8", []byte(resource.FreeBusyToIcal(periods, start, end)))
+			return
+		}
+
+		c.JSON(200, periods)
+	}
+
+}
+
+func calendarRequestRange(c *gin.Context) (*auth.SessionUser, time.Time, time.Time, bool) {
+
+	user := c.Request.Context().Value("user")
+	if user == nil {
+		c.AbortWithStatus(403)
+		return nil, time.Time{}, time.Time{}, false
+	}
+	sessionUser := user.(*auth.SessionUser)
+	if sessionUser.UserId == 0 {
+		c.AbortWithStatus(403)
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	start, err := dateparse.ParseLocal(c.Query("start"))
+	if err != nil {
+		c.JSON(400, resource.NewDaptinError("Invalid start", "start must be a date"))
+		return nil, time.Time{}, time.Time{}, false
+	}
+	end, err := dateparse.ParseLocal(c.Query("end"))
+	if err != nil {
+		c.JSON(400, resource.NewDaptinError("Invalid end", "end must be a date"))
+		return nil, time.Time{}, time.Time{}, false
+	}
+	if !end.After(start) {
+		c.JSON(400, resource.NewDaptinError("Invalid range", "end must be after start"))
+		return nil, time.Time{}, time.Time{}, false
+	}
+
+	return sessionUser, start, end, true
+}
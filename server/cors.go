@@ -72,6 +72,7 @@ func (cm *CorsMiddleware) CorsMiddlewareFunc(c *gin.Context) {
 	c.Header("Access-Control-Allow-Methods", "*")
 	c.Header("Access-Control-Allow-Credentials", "true")
 	c.Header("Access-Control-Allow-Headers", "*")
+	c.Header("Access-Control-Expose-Headers", "ETag")
 
 	if c.Request.Method == "OPTIONS" {
 		c.AbortWithStatus(200)
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrNestedTransaction is returned when a transaction is started on a connection which is already a transaction
+var ErrNestedTransaction = errors.New("a transaction is already open on this connection")
+
+// TransactionConnection is a DatabaseConnection which runs every query inside an open transaction, so code written
+// against a connection can take part in a larger transaction
+type TransactionConnection struct {
+	*sqlx.Tx
+	parent DatabaseConnection
+}
+
+func NewTransactionConnection(parent DatabaseConnection, tx *sqlx.Tx) *TransactionConnection {
+	return &TransactionConnection{
+		Tx:     tx,
+		parent: parent,
+	}
+}
+
+// MustBegin panics since transactions cannot be nested
+func (tc *TransactionConnection) MustBegin() *sqlx.Tx {
+	panic(ErrNestedTransaction)
+}
+
+// Beginx fails since transactions cannot be nested
+func (tc *TransactionConnection) Beginx() (*sqlx.Tx, error) {
+	return nil, ErrNestedTransaction
+}
+
+// Stats are the stats of the connection pool the transaction was started on
+func (tc *TransactionConnection) Stats() sql.DBStats {
+	return tc.parent.Stats()
+}
@@ -169,6 +169,10 @@ func (driver *DaptinFtpDriver) AuthUser(cc server.ClientContext, user, pass stri
 	if !resource.BcryptCheckStringHash(pass, userAccount["password"].(string)) {
 		return nil, fmt.Errorf("could not authenticate you")
 	}
+	userId, _ := userAccount["id"].(int64)
+	if !driver.cruds["user_account"].AllowsPasswordOnlySignIn(userId) {
+		return nil, fmt.Errorf("could not authenticate you")
+	}
 	return &ClientDriver{
 		BaseDir:    "/",
 		CurrentDir: "/",
@@ -17,7 +17,6 @@ import (
 	"github.com/json-iterator/go"
 	//"fmt"
 	"fmt"
-	"github.com/artpar/api2go/jsonapi"
 )
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
@@ -180,20 +179,6 @@ func MakeGraphqlSchema(cmsConfig *resource.CmsConfig, resources map[string]*reso
 
 	}
 
-	tableColumnMap := map[string]map[string]api2go.ColumnInfo{}
-
-	for _, table := range cmsConfig.Tables {
-		if table.IsJoinTable {
-			continue
-		}
-		columnMap := map[string]api2go.ColumnInfo{}
-
-		for _, col := range table.Columns {
-			columnMap[col.ColumnName] = col
-		}
-		tableColumnMap[table.TableName] = columnMap
-	}
-
 	for _, table := range cmsConfig.Tables {
 
 		if len(table.TableName) < 1 {
@@ -261,11 +246,13 @@ func MakeGraphqlSchema(cmsConfig *resource.CmsConfig, resources map[string]*reso
 				fields[targetName] = &graphql.Field{
 					Type:        graphql.NewNonNull(inputTypesMap[targetObject]),
 					Description: fmt.Sprintf("Belongs to %v", relation.Subject),
+					Resolve:     relationResolver(resources, table.TableName, targetName, relation, false),
 				}
 			case "has_one":
 				fields[targetName] = &graphql.Field{
 					Type:        inputTypesMap[targetObject],
 					Description: fmt.Sprintf("Has one %v", relation.Subject),
+					Resolve:     relationResolver(resources, table.TableName, targetName, relation, false),
 				}
 
 			case "has_many":
@@ -276,12 +263,20 @@ func MakeGraphqlSchema(cmsConfig *resource.CmsConfig, resources map[string]*reso
 				fields[targetName] = &graphql.Field{
 					Type:        graphql.NewList(listType),
 					Description: fmt.Sprintf("Has many %v", relation.Subject),
+					Args: graphql.FieldConfigArgument{
+						"page": &pageConfig,
+					},
+					Resolve: relationResolver(resources, table.TableName, targetName, relation, true),
 				}
 
 			case "has_many_and_belongs_to_many":
 				fields[targetName] = &graphql.Field{
 					Type:        graphql.NewList(inputTypesMap[targetObject]),
 					Description: fmt.Sprintf("Related %v", relation.Subject),
+					Args: graphql.FieldConfigArgument{
+						"page": &pageConfig,
+					},
+					Resolve: relationResolver(resources, table.TableName, targetName, relation, true),
 				}
 
 			}
@@ -342,34 +337,17 @@ func MakeGraphqlSchema(cmsConfig *resource.CmsConfig, resources map[string]*reso
 					}
 					pr = pr.WithContext(params.Context)
 
-					pageNumber := 1
-					pageSize := 10
-					pageParams, ok := params.Args["page"]
-					if ok {
-						pageParamsMap, ok := pageParams.(map[string]interface{})
-						if ok {
-							pageSizeNew, ok := pageParamsMap["size"]
-							if ok {
-								pageSize, ok = pageSizeNew.(int)
-							}
-							pageNumberNew, ok := pageParamsMap["number"]
-							if ok {
-								pageNumber, ok = pageNumberNew.(int)
-							}
-						}
-
-					}
+					pageNumber, pageSize := graphqlPageArgument(params.Args)
 
 					jsStr, err := json.Marshal(filters)
 					req := api2go.Request{
 						PlainRequest: pr,
 
 						QueryParams: map[string][]string{
-							"query":              {string(jsStr)},
-							"filter":             {filter.(string)},
-							"page[number]":       {fmt.Sprintf("%v", pageNumber)},
-							"page[size]":         {fmt.Sprintf("%v", pageSize)},
-							"included_relations": {"*"},
+							"query":        {string(jsStr)},
+							"filter":       {filter.(string)},
+							"page[number]": {fmt.Sprintf("%v", pageNumber)},
+							"page[size]":   {fmt.Sprintf("%v", pageSize)},
 						},
 					}
 
@@ -386,40 +364,9 @@ func MakeGraphqlSchema(cmsConfig *resource.CmsConfig, resources map[string]*reso
 
 					}
 
-					columnMap := tableColumnMap[table.TableName]
-
+					// relations are resolved by the relation loader of the request in batches
 					for _, r := range results {
-
-						included := r.Includes
-						includedMap := make(map[string]jsonapi.MarshalIdentifier)
-
-						for _, included := range included {
-							includedMap[included.GetID()] = included
-						}
-
 						data := r.Data
-
-						for key, val := range data {
-							colInfo, ok := columnMap[key]
-							if !ok {
-								continue
-							}
-
-							strVal, ok := val.(string)
-							if !ok {
-								continue
-							}
-
-							if colInfo.IsForeignKey {
-								fObj, ok := includedMap[strVal]
-
-								if ok {
-									data[key] = fObj.GetAttributes()
-								}
-							}
-
-						}
-
 						items = append(items, data)
 
 					}
@@ -701,6 +648,10 @@ func MakeGraphqlSchema(cmsConfig *resource.CmsConfig, resources map[string]*reso
 				Type:        graphql.NewNonNull(graphql.String),
 				Description: "Resource id",
 			}
+			updateInputFields["version"] = &graphql.ArgumentConfig{
+				Type:        graphql.Int,
+				Description: "Version the update is made on, the update is rejected when the resource has changed since",
+			}
 
 			mutationFields["update"+strcase.ToCamel(table.TableName)] = &graphql.Field{
 				Type:        inputTypesMap[table.TableName],
@@ -1049,10 +1000,13 @@ func MakeGraphqlSchema(cmsConfig *resource.CmsConfig, resources map[string]*reso
 		Fields: mutationFields,
 	})
 
+	subscriptionType := makeGraphqlSubscriptionType(cmsConfig, inputTypesMap)
+
 	var err error
 	Schema, err = graphql.NewSchema(graphql.SchemaConfig{
-		Query:    rootQuery,
-		Mutation: mutationType,
+		Query:        rootQuery,
+		Mutation:     mutationType,
+		Subscription: subscriptionType,
 	})
 	if err != nil {
 		log.Errorf("Failed to generate graphql schema: %v", err)
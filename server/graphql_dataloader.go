@@ -0,0 +1,307 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/graphql-go/graphql"
+)
+
+// key of the relation loader in the root object of a graphql request
+const graphqlRelationLoaderKey = "relationLoader"
+
+// graphqlRelationFetchFn loads the related rows for a list of keys, the result is keyed by the same keys
+type graphqlRelationFetchFn func(keys []string) (map[string][]map[string]interface{}, error)
+
+type graphqlRelationBatch struct {
+	fetch   graphqlRelationFetchFn
+	pending []string
+	queued  map[string]bool
+	results map[string][]map[string]interface{}
+	errors  map[string]error
+}
+
+// graphqlRelationLoader batches and caches the relation lookups of one graphql request
+// Relation fields return thunks, the executor resolves all fields of a level before calling the thunks, so
+// the keys collected from every row of a list are fetched with one query per relation on the first thunk call
+type graphqlRelationLoader struct {
+	lock      sync.Mutex
+	resources map[string]*resource.DbResource
+	batches   map[string]*graphqlRelationBatch
+}
+
+func newGraphqlRelationLoader(resources map[string]*resource.DbResource) *graphqlRelationLoader {
+	return &graphqlRelationLoader{
+		resources: resources,
+		batches:   make(map[string]*graphqlRelationBatch),
+	}
+}
+
+// graphqlRootObject is the root object of a graphql request, a new relation loader for every request
+func graphqlRootObject(resources map[string]*resource.DbResource) map[string]interface{} {
+	return map[string]interface{}{
+		graphqlRelationLoaderKey: newGraphqlRelationLoader(resources),
+	}
+}
+
+func relationLoaderFromParams(params graphql.ResolveParams, resources map[string]*resource.DbResource) *graphqlRelationLoader {
+	root, _ := params.Info.RootValue.(map[string]interface{})
+	loader, ok := root[graphqlRelationLoaderKey].(*graphqlRelationLoader)
+	if !ok {
+		// no loader for this execution, results are still correct but not batched across rows
+		return newGraphqlRelationLoader(resources)
+	}
+	return loader
+}
+
+// Load queues the key in the named batch and returns a thunk which returns the related rows of the key
+func (loader *graphqlRelationLoader) Load(batchName string, key string, fetch graphqlRelationFetchFn) func() ([]map[string]interface{}, error) {
+
+	loader.lock.Lock()
+	batch, ok := loader.batches[batchName]
+	if !ok {
+		batch = &graphqlRelationBatch{
+			fetch:   fetch,
+			queued:  make(map[string]bool),
+			results: make(map[string][]map[string]interface{}),
+			errors:  make(map[string]error),
+		}
+		loader.batches[batchName] = batch
+	}
+	if !batch.queued[key] {
+		batch.queued[key] = true
+		batch.pending = append(batch.pending, key)
+	}
+	loader.lock.Unlock()
+
+	return func() ([]map[string]interface{}, error) {
+		loader.lock.Lock()
+		defer loader.lock.Unlock()
+
+		if len(batch.pending) > 0 {
+			keys := batch.pending
+			batch.pending = nil
+			results, err := batch.fetch(keys)
+			for _, k := range keys {
+				batch.results[k] = results[k]
+				batch.errors[k] = err
+			}
+		}
+
+		return batch.results[key], batch.errors[key]
+	}
+}
+
+// relationResolver resolves a relation field of table through the loader of the request
+// Only the rows the user of the request can read are returned, a page of them for list relations
+func relationResolver(resources map[string]*resource.DbResource, table string, fieldName string, relation api2go.TableRelation, isList bool) graphql.FieldResolveFn {
+
+	isSubject := relation.Subject == table
+
+	return func(params graphql.ResolveParams) (interface{}, error) {
+
+		// list relations are fetched a page at a time, fields asking for different pages are batched separately
+		batchName := table + "." + fieldName
+		offset, limit := 0, 0
+		if isList {
+			pageNumber, pageSize := graphqlPageArgument(params.Args)
+			offset, limit = (pageNumber-1)*pageSize, pageSize
+			batchName = fmt.Sprintf("%v[%d:%d]", batchName, offset, limit)
+		}
+
+		source, ok := params.Source.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+
+		var key string
+		if isSubject && (relation.Relation == "belongs_to" || relation.Relation == "has_one") {
+			switch value := source[fieldName].(type) {
+			case map[string]interface{}:
+				// already included in the row
+				return value, nil
+			case string:
+				key = value
+			}
+		} else {
+			key, _ = source["reference_id"].(string)
+		}
+		if key == "" {
+			return nil, nil
+		}
+
+		fetch := func(keys []string) (map[string][]map[string]interface{}, error) {
+			rows, err := fetchRelatedRows(resources, relation, isSubject, keys, offset, limit)
+			if err != nil {
+				return nil, err
+			}
+			return filterReadableRows(params.Context, resources, rows), nil
+		}
+
+		thunk := relationLoaderFromParams(params, resources).Load(batchName, key, fetch)
+
+		return func() (interface{}, error) {
+			rows, err := thunk()
+			if err != nil {
+				return nil, err
+			}
+			if isList {
+				return rows, nil
+			}
+			if len(rows) == 0 {
+				return nil, nil
+			}
+			return rows[0], nil
+		}, nil
+	}
+}
+
+// fetchRelatedRows loads the rows on the other side of the relation for a list of keys
+// keys are reference ids of the related rows for the foreign key side of belongs_to and has_one relations
+// and the reference ids of the rows of the table for all the other cases. When limit is more than 0 the
+// query returns only limit rows after the first offset rows for each key
+func fetchRelatedRows(resources map[string]*resource.DbResource, relation api2go.TableRelation, isSubject bool, keys []string, offset int, limit int) (map[string][]map[string]interface{}, error) {
+
+	result := make(map[string][]map[string]interface{})
+
+	switch relation.Relation {
+	case "belongs_to", "has_one":
+
+		if isSubject {
+			rows, _, err := resources[relation.GetObject()].GetRowsByWhereClause(relation.GetObject(), nil, goqu.Ex{"reference_id": keys})
+			if err != nil {
+				return nil, err
+			}
+			for _, row := range rows {
+				referenceId := fmt.Sprintf("%v", row["reference_id"])
+				result[referenceId] = append(result[referenceId], row)
+			}
+			return result, nil
+		}
+
+		// the rows pointing to the parents through the foreign key column, paged like a join table
+		return fetchJoinedRows(resources, relation.GetObject(), keys, relation.GetSubject(), relation.GetSubject(),
+			relation.GetObjectName(), "id", offset, limit)
+
+	case "has_many", "has_many_and_belongs_to_many":
+
+		fromTable, fromColumn, toTable, toColumn := relation.GetSubject(), relation.GetSubjectName(), relation.GetObject(), relation.GetObjectName()
+		if !isSubject {
+			fromTable, fromColumn, toTable, toColumn = toTable, toColumn, fromTable, fromColumn
+		}
+
+		return fetchJoinedRows(resources, fromTable, keys, toTable, relation.GetJoinTableName(), fromColumn, toColumn, offset, limit)
+	}
+
+	return result, nil
+}
+
+// fetchJoinedRows loads the rows of toTable joined to the rows of fromTable with the reference ids in keys through
+// the fromColumn and toColumn of joinTable, a page of them for each key when limit is more than 0
+func fetchJoinedRows(resources map[string]*resource.DbResource, fromTable string, keys []string, toTable string,
+	joinTable string, fromColumn string, toColumn string, offset int, limit int) (map[string][]map[string]interface{}, error) {
+
+	result := make(map[string][]map[string]interface{})
+
+	idMap, err := resources[fromTable].GetReferenceIdListToIdList(fromTable, keys)
+	if err != nil || len(idMap) == 0 {
+		return result, err
+	}
+	fromIds := make([]int64, 0, len(idMap))
+	for _, id := range idMap {
+		fromIds = append(fromIds, id)
+	}
+
+	joinedIds, err := resources[fromTable].GetJoinTableIdMap(joinTable, fromColumn, toColumn, fromIds, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	toIds := make([]int64, 0)
+	for _, ids := range joinedIds {
+		toIds = append(toIds, ids...)
+	}
+	if len(toIds) == 0 {
+		return result, nil
+	}
+
+	rows, _, err := resources[toTable].GetRowsByWhereClause(toTable, nil, goqu.Ex{"id": toIds})
+	if err != nil {
+		return nil, err
+	}
+	rowsById := make(map[int64]map[string]interface{})
+	for _, row := range rows {
+		if id, ok := row["id"].(int64); ok {
+			rowsById[id] = row
+		}
+	}
+
+	for referenceId, fromId := range idMap {
+		for _, toId := range joinedIds[fromId] {
+			row, ok := rowsById[toId]
+			if ok {
+				result[referenceId] = append(result[referenceId], row)
+			}
+		}
+	}
+	return result, nil
+}
+
+// filterReadableRows drops the rows in the trash and the rows which the user in the context cannot read, checking
+// the permission of the table of the row first, as the TableAccessPermissionChecker does for the rows of a request,
+// and then the permission of the row
+func filterReadableRows(ctx context.Context, resources map[string]*resource.DbResource, rowsByKey map[string][]map[string]interface{}) map[string][]map[string]interface{} {
+
+	userReferenceId := ""
+	userGroups := []auth.GroupPermission{}
+	if ctx != nil {
+		if user, ok := ctx.Value("user").(*auth.SessionUser); ok && user != nil {
+			userReferenceId = user.UserReferenceId
+			userGroups = user.Groups
+		}
+	}
+
+	isAdmin := userReferenceId != "" && resources["world"].IsAdmin(userReferenceId)
+
+	tablePermissions := make(map[string]bool)
+	permissions := make(map[string]bool)
+	filtered := make(map[string][]map[string]interface{})
+	for key, rows := range rowsByKey {
+		for _, row := range rows {
+			tableName := fmt.Sprintf("%v", row["__type"])
+			if tableResource, ok := resources[tableName]; ok && tableResource.HidesTrashedRow(api2go.Request{}, row) {
+				continue
+			}
+			if isAdmin {
+				filtered[key] = append(filtered[key], row)
+				continue
+			}
+
+			canReadTable, checked := tablePermissions[tableName]
+			if !checked {
+				canReadTable = resources["world"].GetObjectPermissionByWhereClause("world", "table_name", tableName).
+					CanRead(userReferenceId, userGroups)
+				tablePermissions[tableName] = canReadTable
+			}
+			if !canReadTable {
+				continue
+			}
+
+			permissionKey := fmt.Sprintf("%v.%v", tableName, row["reference_id"])
+			canRead, checked := permissions[permissionKey]
+			if !checked {
+				canRead = resources["world"].GetRowPermission(row).CanRead(userReferenceId, userGroups)
+				permissions[permissionKey] = canRead
+			}
+			if canRead {
+				filtered[key] = append(filtered[key], row)
+			}
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/graphql-go/graphql"
+)
+
+func TestGraphqlRelationLoaderBatches(t *testing.T) {
+
+	loader := newGraphqlRelationLoader(nil)
+
+	fetchCount := 0
+	var fetchedKeys []string
+	fetch := func(keys []string) (map[string][]map[string]interface{}, error) {
+		fetchCount++
+		fetchedKeys = keys
+		result := make(map[string][]map[string]interface{})
+		for _, key := range keys {
+			result[key] = []map[string]interface{}{{"reference_id": key}}
+		}
+		return result, nil
+	}
+
+	first := loader.Load("order.customer", "c1", fetch)
+	second := loader.Load("order.customer", "c2", fetch)
+	repeated := loader.Load("order.customer", "c1", fetch)
+
+	rows, err := second()
+	if err != nil || len(rows) != 1 || rows[0]["reference_id"] != "c2" {
+		t.Fatalf("Unexpected rows %v %v", rows, err)
+	}
+	if rows, _ = first(); rows[0]["reference_id"] != "c1" {
+		t.Errorf("Unexpected rows for first key %v", rows)
+	}
+	if rows, _ = repeated(); rows[0]["reference_id"] != "c1" {
+		t.Errorf("Unexpected rows for repeated key %v", rows)
+	}
+	if fetchCount != 1 || len(fetchedKeys) != 2 {
+		t.Errorf("Expected one fetch of 2 keys, found %d fetches of %v", fetchCount, fetchedKeys)
+	}
+
+	cached := loader.Load("order.customer", "c2", fetch)
+	if rows, _ = cached(); len(rows) != 1 || fetchCount != 1 {
+		t.Errorf("Expected cached rows without a fetch, found %v after %d fetches", rows, fetchCount)
+	}
+}
+
+func TestGraphqlPageArgument(t *testing.T) {
+
+	defer SetGraphqlQueryLimits(graphqlQueryLimits)
+	SetGraphqlQueryLimits(GraphqlQueryLimits{MaxDepth: 3, MaxComplexity: 200})
+
+	if number, size := graphqlPageArgument(nil); number != 1 || size != graphqlDefaultListSize {
+		t.Errorf("Expected the first page of %d rows without a page argument, found %d of %d", graphqlDefaultListSize, number, size)
+	}
+	number, size := graphqlPageArgument(map[string]interface{}{"page": map[string]interface{}{"number": 3, "size": 25}})
+	if number != 3 || size != 25 {
+		t.Errorf("Expected page 3 of 25 rows, found %d of %d", number, size)
+	}
+	if _, size = graphqlPageArgument(map[string]interface{}{"page": map[string]interface{}{"size": 100000}}); size != 200 {
+		t.Errorf("Expected the page size to be limited to the max complexity, found %d", size)
+	}
+}
+
+func TestGraphqlQueryLimitRule(t *testing.T) {
+
+	nodeType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "node",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"name":     &graphql.Field{Type: graphql.String},
+				"children": &graphql.Field{Type: graphql.NewList(nodeTypeForTest)},
+			}
+		}),
+	})
+	nodeTypeForTest = nodeType
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"nodes": &graphql.Field{
+					Type: graphql.NewList(nodeType),
+					Args: graphql.FieldConfigArgument{
+						"page": &graphql.ArgumentConfig{
+							Type: graphql.NewInputObject(graphql.InputObjectConfig{
+								Name: "nodePage",
+								Fields: graphql.InputObjectConfigFieldMap{
+									"size": &graphql.InputObjectFieldConfig{Type: graphql.Int},
+								},
+							}),
+						},
+					},
+				},
+			},
+		}),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	defer SetGraphqlQueryLimits(graphqlQueryLimits)
+	SetGraphqlQueryLimits(GraphqlQueryLimits{MaxDepth: 3, MaxComplexity: 200})
+
+	runWithVariables := func(query string, variables map[string]interface{}) *graphql.Result {
+		if errs := GraphqlQueryLimitErrors(&schema, query, variables); len(errs) > 0 {
+			return &graphql.Result{Errors: errs}
+		}
+		return graphql.Do(graphql.Params{Schema: schema, RequestString: query, VariableValues: variables})
+	}
+	run := func(query string) *graphql.Result {
+		return runWithVariables(query, nil)
+	}
+
+	if result := run(`{ nodes { name children { name } } }`); len(result.Errors) > 0 {
+		t.Errorf("Expected query within limits to pass: %v", result.Errors)
+	}
+
+	result := run(`{ nodes { children { children { children { name } } } } }`)
+	if len(result.Errors) == 0 || !strings.Contains(result.Errors[0].Message, "depth") {
+		t.Errorf("Expected depth limit error, found %v", result.Errors)
+	}
+
+	result = run(`{ ...deep } fragment deep on Query { nodes { children { children { children { name } } } } }`)
+	if len(result.Errors) == 0 || !strings.Contains(result.Errors[0].Message, "depth") {
+		t.Errorf("Expected depth limit error through fragments, found %v", result.Errors)
+	}
+
+	result = run(`{ nodes(page: {size: 50}) { name children { name } } }`)
+	if len(result.Errors) == 0 || !strings.Contains(result.Errors[0].Message, "complexity") {
+		t.Errorf("Expected complexity limit error, found %v", result.Errors)
+	}
+
+	result = runWithVariables(`query ($size: Int) { nodes(page: {size: $size}) { name children { name } } }`, map[string]interface{}{"size": float64(50)})
+	if len(result.Errors) == 0 || !strings.Contains(result.Errors[0].Message, "complexity") {
+		t.Errorf("Expected complexity limit error for a page size variable, found %v", result.Errors)
+	}
+
+	result = runWithVariables(`query ($page: nodePage) { nodes(page: $page) { name children { name } } }`, map[string]interface{}{"page": map[string]interface{}{"size": float64(50)}})
+	if len(result.Errors) == 0 || !strings.Contains(result.Errors[0].Message, "complexity") {
+		t.Errorf("Expected complexity limit error for a page variable, found %v", result.Errors)
+	}
+
+	if result = runWithVariables(`query ($size: Int) { nodes(page: {size: $size}) { name } }`, map[string]interface{}{"size": float64(5)}); len(result.Errors) > 0 {
+		t.Errorf("Expected a small page size variable to pass: %v", result.Errors)
+	}
+}
+
+var nodeTypeForTest *graphql.Object
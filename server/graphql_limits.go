@@ -0,0 +1,299 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/kinds"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/graphql-go/graphql/language/visitor"
+	graphqlhandler "github.com/graphql-go/handler"
+)
+
+// GraphqlQueryLimits protects the server from expensive queries, a limit of 0 disables the check
+// Set from graphql.max_depth and graphql.max_complexity in _config
+type GraphqlQueryLimits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+var graphqlQueryLimits = GraphqlQueryLimits{
+	MaxDepth:      10,
+	MaxComplexity: 1000,
+}
+
+// page size used to estimate the cost of a list field when the query does not ask for a page size
+const graphqlDefaultListSize = 10
+
+// SetGraphqlQueryLimits sets the limits checked by GraphqlQueryLimitRule
+func SetGraphqlQueryLimits(limits GraphqlQueryLimits) {
+	graphqlQueryLimits = limits
+}
+
+// GraphqlQueryLimitErrors checks the query of a request against the limits before it is executed, page sizes
+// passed as variables are read from the variables of the request. Queries which do not parse are left to the
+// executor to report
+func GraphqlQueryLimitErrors(schema *graphql.Schema, query string, variables map[string]interface{}) []gqlerrors.FormattedError {
+
+	document, err := parser.Parse(parser.ParseParams{
+		Source: source.NewSource(&source.Source{
+			Body: []byte(query),
+			Name: "GraphQL request",
+		}),
+	})
+	if err != nil {
+		return nil
+	}
+
+	result := graphql.ValidateDocument(schema, document, []graphql.ValidationRuleFn{GraphqlQueryLimitRule(variables)})
+	return result.Errors
+}
+
+// GraphqlQueryLimitHandler rejects the graphql requests which exceed the limits before they reach the handler
+func GraphqlQueryLimitHandler(schema *graphql.Schema, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// the body is read once to find the query and variables and again by the handler
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		options := graphqlhandler.NewRequestOptions(r)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		errs := GraphqlQueryLimitErrors(schema, options.Query, options.Variables)
+		if len(errs) > 0 {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			response, _ := json.Marshal(&graphql.Result{Errors: errs})
+			_, _ = w.Write(response)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GraphqlQueryLimitRule rejects operations nested deeper than the max depth or with a complexity above the max
+// Every field costs 1, the fields selected under a list field are counted once for every item of the page
+func GraphqlQueryLimitRule(variables map[string]interface{}) graphql.ValidationRuleFn {
+	return func(context *graphql.ValidationContext) *graphql.ValidationRuleInstance {
+		return graphqlQueryLimitRule(context, variables)
+	}
+}
+
+func graphqlQueryLimitRule(context *graphql.ValidationContext, variables map[string]interface{}) *graphql.ValidationRuleInstance {
+
+	limits := graphqlQueryLimits
+
+	visitorOpts := &visitor.VisitorOptions{
+		KindFuncMap: map[string]visitor.NamedVisitFuncs{
+			kinds.OperationDefinition: {
+				Kind: func(p visitor.VisitFuncParams) (string, interface{}) {
+					operation, ok := p.Node.(*ast.OperationDefinition)
+					if !ok || operation == nil {
+						return visitor.ActionSkip, nil
+					}
+
+					depth, complexity := selectionSetCost(context, variables, context.Schema().TypeMap()[operationRootTypeName(context.Schema(), operation)], operation.SelectionSet, map[string]bool{})
+
+					if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+						context.ReportError(gqlerrors.NewError(
+							fmt.Sprintf("Query depth %d exceeds the maximum depth of %d", depth, limits.MaxDepth),
+							[]ast.Node{operation}, "", nil, []int{}, nil,
+						))
+					}
+					if limits.MaxComplexity > 0 && complexity > limits.MaxComplexity {
+						context.ReportError(gqlerrors.NewError(
+							fmt.Sprintf("Query complexity %d exceeds the maximum complexity of %d", complexity, limits.MaxComplexity),
+							[]ast.Node{operation}, "", nil, []int{}, nil,
+						))
+					}
+					return visitor.ActionSkip, nil
+				},
+			},
+		},
+	}
+
+	return &graphql.ValidationRuleInstance{
+		VisitorOpts: visitorOpts,
+	}
+}
+
+func operationRootTypeName(schema *graphql.Schema, operation *ast.OperationDefinition) string {
+	switch operation.Operation {
+	case ast.OperationTypeMutation:
+		if schema.MutationType() != nil {
+			return schema.MutationType().Name()
+		}
+	case ast.OperationTypeSubscription:
+		if schema.SubscriptionType() != nil {
+			return schema.SubscriptionType().Name()
+		}
+	}
+	if schema.QueryType() != nil {
+		return schema.QueryType().Name()
+	}
+	return ""
+}
+
+// selectionSetCost returns the depth and complexity of a selection set on parentType, fragments are inlined
+// and a fragment already being expanded is skipped, cycles are reported by NoFragmentCyclesRule
+func selectionSetCost(context *graphql.ValidationContext, variables map[string]interface{}, parentType graphql.Type, selectionSet *ast.SelectionSet, expanding map[string]bool) (int, int) {
+
+	if selectionSet == nil {
+		return 0, 0
+	}
+
+	maxDepth := 0
+	complexity := 0
+
+	addCost := func(depth int, cost int) {
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		complexity += cost
+	}
+
+	for _, selection := range selectionSet.Selections {
+		switch node := selection.(type) {
+		case *ast.Field:
+			fieldType := fieldOutputType(parentType, node.Name.Value)
+			namedType, isList := unwrapOutputType(fieldType)
+
+			childDepth, childComplexity := selectionSetCost(context, variables, namedType, node.SelectionSet, expanding)
+			if isList {
+				childComplexity = childComplexity * listSizeArgument(node, variables)
+			}
+			addCost(childDepth+1, childComplexity+1)
+
+		case *ast.InlineFragment:
+			fragmentType := parentType
+			if node.TypeCondition != nil {
+				if typeByName, ok := context.Schema().TypeMap()[node.TypeCondition.Name.Value]; ok {
+					fragmentType = typeByName
+				}
+			}
+			addCost(selectionSetCost(context, variables, fragmentType, node.SelectionSet, expanding))
+
+		case *ast.FragmentSpread:
+			name := node.Name.Value
+			if expanding[name] {
+				continue
+			}
+			fragment := context.Fragment(name)
+			if fragment == nil {
+				continue
+			}
+			fragmentType := parentType
+			if fragment.TypeCondition != nil {
+				if typeByName, ok := context.Schema().TypeMap()[fragment.TypeCondition.Name.Value]; ok {
+					fragmentType = typeByName
+				}
+			}
+			expanding[name] = true
+			addCost(selectionSetCost(context, variables, fragmentType, fragment.SelectionSet, expanding))
+			delete(expanding, name)
+		}
+	}
+
+	return maxDepth, complexity
+}
+
+func fieldOutputType(parentType graphql.Type, fieldName string) graphql.Type {
+	switch typed := parentType.(type) {
+	case *graphql.Object:
+		if field, ok := typed.Fields()[fieldName]; ok {
+			return field.Type
+		}
+	case *graphql.Interface:
+		if field, ok := typed.Fields()[fieldName]; ok {
+			return field.Type
+		}
+	}
+	return nil
+}
+
+// unwrapOutputType removes the non null and list wrappers, reporting if there was a list
+func unwrapOutputType(fieldType graphql.Type) (graphql.Type, bool) {
+	isList := false
+	for {
+		switch typed := fieldType.(type) {
+		case *graphql.NonNull:
+			fieldType = typed.OfType
+		case *graphql.List:
+			isList = true
+			fieldType = typed.OfType
+		default:
+			return fieldType, isList
+		}
+	}
+}
+
+// listSizeArgument is the page size asked for a list field, from the page: {size: n} argument or the variables
+// of the request, limited the same way as the page size which is served
+func listSizeArgument(field *ast.Field, variables map[string]interface{}) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "page" {
+			continue
+		}
+		switch page := argument.Value.(type) {
+		case *ast.Variable:
+			pageValue, _ := variables[page.Name.Value].(map[string]interface{})
+			return graphqlListSize(pageValue["size"])
+		case *ast.ObjectValue:
+			for _, pageField := range page.Fields {
+				if pageField.Name.Value != "size" {
+					continue
+				}
+				if sizeVariable, ok := pageField.Value.(*ast.Variable); ok {
+					return graphqlListSize(variables[sizeVariable.Name.Value])
+				}
+				return graphqlListSize(pageField.Value.GetValue())
+			}
+		}
+	}
+	return graphqlDefaultListSize
+}
+
+// graphqlPageArgument returns the page number and size asked in the page: {number, size} argument of a list field
+func graphqlPageArgument(args map[string]interface{}) (int, int) {
+	pageNumber := 1
+	page, _ := args["page"].(map[string]interface{})
+	if number, ok := page["number"].(int); ok && number > 0 {
+		pageNumber = number
+	}
+	return pageNumber, graphqlListSize(page["size"])
+}
+
+// graphqlListSize converts a page size from the query, the variables or the arguments of a field, missing and invalid
+// sizes are graphqlDefaultListSize. A page is never larger than the max complexity, so a list field is not served
+// with more items than its complexity was checked for
+func graphqlListSize(value interface{}) int {
+	size := 0
+	switch typed := value.(type) {
+	case int:
+		size = typed
+	case float64:
+		size = int(typed)
+	case string:
+		if _, err := fmt.Sscanf(typed, "%d", &size); err != nil {
+			size = 0
+		}
+	}
+	if size < 1 {
+		return graphqlDefaultListSize
+	}
+	if graphqlQueryLimits.MaxComplexity > 0 && size > graphqlQueryLimits.MaxComplexity {
+		return graphqlQueryLimits.MaxComplexity
+	}
+	return size
+}
@@ -0,0 +1,437 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/buraksezer/olric"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/daptin/daptin/server/websockets"
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/iancoleman/strcase"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+// GraphqlWsProtocol is the websocket sub protocol of subscriptions-transport-ws which is used by most graphql clients
+const GraphqlWsProtocol = "graphql-ws"
+
+// key of the event in the root object of a subscription execution
+const graphqlSubscriptionEventKey = "event"
+
+// graphqlSubscriptionTables maps the subscription field names to the table they listen on
+var graphqlSubscriptionTables = map[string]string{}
+
+// makeGraphqlSubscriptionType creates the Subscription root type with an on<Table>Changed field for every table
+// The fields are resolved against the event in the root object, events which do not match the arguments resolve to null
+func makeGraphqlSubscriptionType(cmsConfig *resource.CmsConfig, inputTypesMap map[string]*graphql.Object) *graphql.Object {
+
+	subscriptionFields := make(graphql.Fields)
+	subscriptionTables := make(map[string]string)
+
+	columnFilterArgument := graphql.ArgumentConfig{
+		Type: graphql.NewList(graphql.NewInputObject(graphql.InputObjectConfig{
+			Name:        "changeFilter",
+			Description: "match events where the column has the value",
+			Fields: graphql.InputObjectConfigFieldMap{
+				"column": &graphql.InputObjectFieldConfig{
+					Type: graphql.NewNonNull(graphql.String),
+				},
+				"value": &graphql.InputObjectFieldConfig{
+					Type: graphql.String,
+				},
+			},
+		})),
+		Description: "filter events by column values",
+	}
+
+	for _, table := range cmsConfig.Tables {
+
+		tableType, ok := inputTypesMap[table.TableName]
+		if !ok {
+			continue
+		}
+
+		changeEventType := graphql.NewObject(graphql.ObjectConfig{
+			Name:        strcase.ToCamel(table.TableName) + "ChangeEvent",
+			Description: "A change to a row of " + table.TableName,
+			Fields: graphql.Fields{
+				"eventType": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.String),
+					Description: "create, update or delete",
+				},
+				"source": &graphql.Field{
+					Type:        graphql.String,
+					Description: "source of the change",
+				},
+				"data": &graphql.Field{
+					Type:        tableType,
+					Description: "the row after the change",
+				},
+			},
+		})
+
+		fieldName := "on" + strcase.ToCamel(table.TableName) + "Changed"
+		subscriptionTables[fieldName] = table.TableName
+		subscriptionFields[fieldName] = &graphql.Field{
+			Type:        changeEventType,
+			Description: "Changes to " + table.TableName,
+			Args: graphql.FieldConfigArgument{
+				"eventType": &graphql.ArgumentConfig{
+					Type:        graphql.String,
+					Description: "only events of this type: create, update or delete",
+				},
+				"filter": &columnFilterArgument,
+			},
+			Resolve: func(tableName string) graphql.FieldResolveFn {
+				return func(params graphql.ResolveParams) (interface{}, error) {
+
+					root, _ := params.Source.(map[string]interface{})
+					event, ok := root[graphqlSubscriptionEventKey].(resource.EventMessage)
+					if !ok || event.ObjectType != tableName {
+						return nil, nil
+					}
+
+					if !graphqlSubscriptionEventMatches(event, params.Args) {
+						return nil, nil
+					}
+
+					return map[string]interface{}{
+						"eventType": event.EventType,
+						"source":    event.MessageSource,
+						"data":      event.EventData,
+					}, nil
+				}
+			}(table.TableName),
+		}
+	}
+
+	graphqlSubscriptionTables = subscriptionTables
+
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name:   "Subscription",
+		Fields: subscriptionFields,
+	})
+}
+
+// graphqlSubscriptionEventMatches checks the eventType and filter arguments of a subscription field against the event
+func graphqlSubscriptionEventMatches(event resource.EventMessage, args map[string]interface{}) bool {
+
+	eventType, _ := args["eventType"].(string)
+	if eventType != "" && eventType != event.EventType {
+		return false
+	}
+
+	filters, _ := args["filter"].([]interface{})
+	for _, filter := range filters {
+		filterMap, ok := filter.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		column, _ := filterMap["column"].(string)
+		value, ok := event.EventData[column]
+		if !ok {
+			return false
+		}
+		expected, _ := filterMap["value"].(string)
+		if value == nil {
+			if filterMap["value"] != nil {
+				return false
+			}
+			continue
+		}
+		if fmt.Sprintf("%v", value) != expected {
+			return false
+		}
+	}
+
+	return true
+}
+
+// graphqlSubscriptionField returns the table and the response key of the single root field of a subscription
+func graphqlSubscriptionField(query string, operationName string) (string, string, error) {
+
+	document, err := parser.Parse(parser.ParseParams{
+		Source: query,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	var operation *ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		operationDefinition, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || (operationDefinition.Name != nil && operationDefinition.Name.Value == operationName) {
+			if operation != nil {
+				return "", "", errors.New("operationName is required when the document has multiple operations")
+			}
+			operation = operationDefinition
+		}
+	}
+
+	if operation == nil {
+		return "", "", fmt.Errorf("unknown operation [%v]", operationName)
+	}
+	if operation.Operation != ast.OperationTypeSubscription {
+		return "", "", fmt.Errorf("operation [%v] is not a subscription", operation.Operation)
+	}
+	if operation.SelectionSet == nil || len(operation.SelectionSet.Selections) != 1 {
+		return "", "", errors.New("a subscription must select exactly one field")
+	}
+
+	field, ok := operation.SelectionSet.Selections[0].(*ast.Field)
+	if !ok {
+		return "", "", errors.New("a subscription must select exactly one field")
+	}
+
+	tableName, ok := graphqlSubscriptionTables[field.Name.Value]
+	if !ok {
+		return "", "", fmt.Errorf("unknown subscription [%v]", field.Name.Value)
+	}
+
+	responseKey := field.Name.Value
+	if field.Alias != nil {
+		responseKey = field.Alias.Value
+	}
+
+	return tableName, responseKey, nil
+}
+
+type graphqlWsMessage struct {
+	Id      string                 `json:"id,omitempty"`
+	Type    string                 `json:"type"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+type graphqlWsResponse struct {
+	Id      string      `json:"id,omitempty"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+type graphqlWsSubscription struct {
+	topic      *olric.DTopic
+	listenerId uint64
+}
+
+// graphqlWsSession is one websocket connection speaking the graphql-ws protocol
+type graphqlWsSession struct {
+	conn          *websocket.Conn
+	ctx           context.Context
+	user          *auth.SessionUser
+	schema        *graphql.Schema
+	dtopicMap     *map[string]*olric.DTopic
+	cruds         map[string]*resource.DbResource
+	lock          sync.Mutex
+	subscriptions map[string]graphqlWsSubscription
+}
+
+// CreateGraphqlSubscriptionHandler serves subscriptions on the schema over the graphql-ws websocket protocol
+// Every subscription is a listener on the olric topic of its table
+func CreateGraphqlSubscriptionHandler(schema *graphql.Schema, dtopicMap *map[string]*olric.DTopic, cruds map[string]*resource.DbResource) func(*gin.Context) {
+
+	websocketServer := websocket.Server{
+		Handshake: func(config *websocket.Config, req *http.Request) error {
+			for _, protocol := range config.Protocol {
+				if protocol == GraphqlWsProtocol {
+					config.Protocol = []string{GraphqlWsProtocol}
+					return nil
+				}
+			}
+			return fmt.Errorf("unsupported websocket protocol %v", config.Protocol)
+		},
+		Handler: func(conn *websocket.Conn) {
+			user, _ := conn.Request().Context().Value("user").(*auth.SessionUser)
+			session := &graphqlWsSession{
+				conn:          conn,
+				ctx:           conn.Request().Context(),
+				user:          user,
+				schema:        schema,
+				dtopicMap:     dtopicMap,
+				cruds:         cruds,
+				subscriptions: make(map[string]graphqlWsSubscription),
+			}
+			session.serve()
+		},
+	}
+
+	return func(c *gin.Context) {
+		user := c.Request.Context().Value("user")
+		if user == nil {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		websocketServer.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+func (session *graphqlWsSession) serve() {
+	defer session.stopAll()
+
+	for {
+		var message graphqlWsMessage
+		err := websocket.JSON.Receive(session.conn, &message)
+		if err != nil {
+			log.Debugf("graphql subscription connection closed: %v", err)
+			return
+		}
+
+		switch message.Type {
+		case "connection_init":
+			session.send(graphqlWsResponse{Type: "connection_ack"})
+		case "start":
+			err = session.start(message.Id, message.Payload)
+			if err != nil {
+				session.send(graphqlWsResponse{
+					Id:      message.Id,
+					Type:    "error",
+					Payload: map[string]interface{}{"message": err.Error()},
+				})
+			}
+		case "stop":
+			session.stop(message.Id)
+			session.send(graphqlWsResponse{Id: message.Id, Type: "complete"})
+		case "connection_terminate":
+			return
+		default:
+			session.send(graphqlWsResponse{
+				Id:      message.Id,
+				Type:    "error",
+				Payload: map[string]interface{}{"message": "unknown message type " + message.Type},
+			})
+		}
+	}
+}
+
+func (session *graphqlWsSession) send(response graphqlWsResponse) {
+	session.lock.Lock()
+	defer session.lock.Unlock()
+	err := websocket.JSON.Send(session.conn, response)
+	if err != nil {
+		log.Debugf("Failed to send graphql subscription message: %v", err)
+	}
+}
+
+func (session *graphqlWsSession) start(id string, payload map[string]interface{}) error {
+
+	if id == "" {
+		return errors.New("subscription id is required")
+	}
+
+	query, _ := payload["query"].(string)
+	operationName, _ := payload["operationName"].(string)
+	variables, _ := payload["variables"].(map[string]interface{})
+
+	tableName, responseKey, err := graphqlSubscriptionField(query, operationName)
+	if err != nil {
+		return err
+	}
+
+	if errs := GraphqlQueryLimitErrors(session.schema, query, variables); len(errs) > 0 {
+		return errs[0]
+	}
+
+	validation := graphql.Do(graphql.Params{
+		Schema:         *session.schema,
+		RequestString:  query,
+		VariableValues: variables,
+		OperationName:  operationName,
+		Context:        session.ctx,
+	})
+	if len(validation.Errors) > 0 {
+		return validation.Errors[0]
+	}
+
+	topic, ok := (*session.dtopicMap)[tableName]
+	if !ok {
+		return fmt.Errorf("no change events for [%v]", tableName)
+	}
+
+	session.stop(id)
+
+	listenerId, err := topic.AddListener(func(message olric.DTopicMessage) {
+		eventMessage, ok := message.Message.(resource.EventMessage)
+		if !ok {
+			return
+		}
+
+		if !websockets.CanReadEvent(session.cruds, eventMessage, session.user) {
+			return
+		}
+
+		result := graphql.Do(graphql.Params{
+			Schema:         *session.schema,
+			RequestString:  query,
+			VariableValues: variables,
+			OperationName:  operationName,
+			RootObject: map[string]interface{}{
+				graphqlSubscriptionEventKey: eventMessage,
+				graphqlRelationLoaderKey:    newGraphqlRelationLoader(session.cruds),
+			},
+			Context: session.ctx,
+		})
+
+		if len(result.Errors) == 0 {
+			data, _ := result.Data.(map[string]interface{})
+			if data[responseKey] == nil {
+				return
+			}
+		}
+
+		session.send(graphqlWsResponse{
+			Id:      id,
+			Type:    "data",
+			Payload: result,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	session.lock.Lock()
+	session.subscriptions[id] = graphqlWsSubscription{
+		topic:      topic,
+		listenerId: listenerId,
+	}
+	session.lock.Unlock()
+
+	return nil
+}
+
+func (session *graphqlWsSession) stop(id string) {
+	session.lock.Lock()
+	subscription, ok := session.subscriptions[id]
+	delete(session.subscriptions, id)
+	session.lock.Unlock()
+
+	if !ok {
+		return
+	}
+	err := subscription.topic.RemoveListener(subscription.listenerId)
+	if err != nil {
+		log.Printf("Failed to remove listener from topic: %v", err)
+	}
+}
+
+func (session *graphqlWsSession) stopAll() {
+	session.lock.Lock()
+	ids := make([]string, 0, len(session.subscriptions))
+	for id := range session.subscriptions {
+		ids = append(ids, id)
+	}
+	session.lock.Unlock()
+
+	for _, id := range ids {
+		session.stop(id)
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/daptin/daptin/server/resource"
+	"github.com/graphql-go/graphql"
+)
+
+func TestGraphqlSubscriptionField(t *testing.T) {
+
+	todoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "todo",
+		Fields: graphql.Fields{
+			"title": &graphql.Field{Type: graphql.String},
+		},
+	})
+	subscriptionType := makeGraphqlSubscriptionType(&resource.CmsConfig{
+		Tables: []resource.TableInfo{{TableName: "todo"}},
+	}, map[string]*graphql.Object{"todo": todoType})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name:   "Query",
+			Fields: graphql.Fields{"ping": &graphql.Field{Type: graphql.String}},
+		}),
+		Subscription: subscriptionType,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	query := `subscription { changes: onTodoChanged(eventType: "update", filter: [{column: "title", value: "one"}]) { eventType data { title } } }`
+
+	tableName, responseKey, err := graphqlSubscriptionField(query, "")
+	if err != nil || tableName != "todo" || responseKey != "changes" {
+		t.Fatalf("Unexpected subscription field [%v] [%v] %v", tableName, responseKey, err)
+	}
+
+	if _, _, err = graphqlSubscriptionField(`{ ping }`, ""); err == nil {
+		t.Errorf("Expected a query operation to be rejected")
+	}
+
+	execute := func(event resource.EventMessage) interface{} {
+		result := graphql.Do(graphql.Params{
+			Schema:        schema,
+			RequestString: query,
+			RootObject:    map[string]interface{}{graphqlSubscriptionEventKey: event},
+		})
+		if len(result.Errors) > 0 {
+			t.Fatalf("Failed to execute subscription: %v", result.Errors)
+		}
+		return result.Data.(map[string]interface{})[responseKey]
+	}
+
+	matching := resource.EventMessage{
+		EventType:  "update",
+		ObjectType: "todo",
+		EventData:  map[string]interface{}{"title": "one"},
+	}
+	changes, ok := execute(matching).(map[string]interface{})
+	if !ok || changes["eventType"] != "update" || changes["data"].(map[string]interface{})["title"] != "one" {
+		t.Errorf("Expected matching event to be delivered, found %v", changes)
+	}
+
+	otherColumn := matching
+	otherColumn.EventData = map[string]interface{}{"title": "two"}
+	if execute(otherColumn) != nil {
+		t.Errorf("Expected event with other column value to be skipped")
+	}
+
+	otherType := matching
+	otherType.EventType = "delete"
+	if execute(otherType) != nil {
+		t.Errorf("Expected event of other type to be skipped")
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/daptin/daptin/server/resource"
+	"github.com/gin-gonic/gin"
+)
+
+// inboundHookMaxBody is the largest body a hook accepts
+const inboundHookMaxBody = 1 << 20
+
+// CreateInboundHookHandler receives the requests third party systems post to an inbound hook, they are
+// authenticated by the secret url and the signature of the hook instead of a user session
+func CreateInboundHookHandler(cruds map[string]*resource.DbResource) func(*gin.Context) {
+	return func(c *gin.Context) {
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, inboundHookMaxBody))
+		if err != nil {
+			c.AbortWithStatusJSON(413, ErrorResponse{Message: "request body is too large"})
+			return
+		}
+
+		result, err := resource.ReceiveInboundHook(cruds, c.Param("hookId"), c.Request.Header, body)
+		if err != nil {
+			status := 500
+			if hookError, ok := err.(resource.InboundHookError); ok {
+				status = hookError.Status
+			}
+			c.AbortWithStatusJSON(status, ErrorResponse{Message: err.Error()})
+			return
+		}
+
+		c.JSON(200, map[string]interface{}{
+			"data": result,
+		})
+	}
+}
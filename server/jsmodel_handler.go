@@ -6,6 +6,7 @@ import (
 	"github.com/daptin/daptin/server/apiblueprint"
 	"github.com/daptin/daptin/server/auth"
 	"github.com/daptin/daptin/server/resource"
+	"github.com/daptin/daptin/server/sdkgen"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
 	"image/color"
@@ -19,6 +20,27 @@ func CreateApiBlueprintHandler(initConfig *resource.CmsConfig, cruds map[string]
 	}
 }
 
+// CreateSdkHandler serves a typed client generated from the current schema, for the language in the path
+func CreateSdkHandler(initConfig *resource.CmsConfig) func(ctx *gin.Context) {
+	return func(c *gin.Context) {
+		language := strings.ToLower(c.Param("language"))
+		if _, ok := sdkgen.Languages[language]; !ok {
+			c.AbortWithStatusJSON(404, ErrorResponse{Message: fmt.Sprintf("no sdk for language [%v]", language)})
+			return
+		}
+
+		contents, fileName, err := sdkgen.GenerateSdk(language, initConfig)
+		if err != nil {
+			log.Errorf("Failed to generate %v sdk: %v", language, err)
+			c.AbortWithStatusJSON(500, ErrorResponse{Message: err.Error()})
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%v", fileName))
+		c.Data(200, "text/plain; charset=utf-8", contents)
+	}
+}
+
 type ErrorResponse struct {
 	Message string
 }
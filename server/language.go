@@ -5,27 +5,81 @@ import (
 	"github.com/daptin/daptin/server/resource"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/text/language"
+	"strings"
 )
 
 // CorsMiddleware provides a configurable CORS implementation.
 type LanguageMiddleware struct {
 	configStore     *resource.ConfigStore
 	defaultLanguage string
+	// fallbackChains lists the languages tried after a language when a translation is missing, "" holds the
+	// languages tried after every language
+	fallbackChains map[string][]string
 }
 
 func NewLanguageMiddleware(configStore *resource.ConfigStore) *LanguageMiddleware {
 
-	defaultLanguage, err := configStore.GetConfigValueFor("langauge.default", "backend")
+	defaultLanguage, err := configStore.GetConfigValueFor("language.default", "backend")
 	if err != nil {
 		defaultLanguage = "en"
 		err = configStore.SetConfigValueFor("language.default", "en", "backend")
 		resource.CheckErr(err, "Failed to store default value for default language")
 	}
 
+	fallbackChains := make(map[string][]string)
+	for name, value := range configStore.GetAllConfig() {
+		if name != "language.fallback" && !strings.HasPrefix(name, "language.fallback.") {
+			continue
+		}
+		language := strings.TrimPrefix(strings.TrimPrefix(name, "language.fallback"), ".")
+		fallbackChains[language] = splitLanguageList(value)
+	}
+
 	return &LanguageMiddleware{
 		configStore:     configStore,
 		defaultLanguage: defaultLanguage,
+		fallbackChains:  fallbackChains,
+	}
+}
+
+func splitLanguageList(value string) []string {
+	languages := make([]string, 0)
+	for _, language := range strings.Split(value, ",") {
+		language = strings.TrimSpace(language)
+		if language != "" {
+			languages = append(languages, language)
+		}
+	}
+	return languages
+}
+
+// LanguageChain expands the preferred languages with their fallback languages, in the order they are tried
+// the default language is left out since the rows themselves hold it
+func (lm *LanguageMiddleware) LanguageChain(preference []string) []string {
+	chain := make([]string, 0)
+	added := make(map[string]bool)
+
+	var add func(language string)
+	add = func(language string) {
+		if added[language] || language == lm.defaultLanguage {
+			return
+		}
+		added[language] = true
+		chain = append(chain, language)
+		for _, fallback := range lm.fallbackChains[language] {
+			add(fallback)
+		}
+	}
+
+	for _, language := range preference {
+		add(language)
+	}
+	if len(chain) > 0 {
+		for _, fallback := range lm.fallbackChains[""] {
+			add(fallback)
+		}
 	}
+	return chain
 }
 
 func (lm *LanguageMiddleware) LanguageMiddlewareFunc(c *gin.Context) {
@@ -34,7 +88,9 @@ func (lm *LanguageMiddleware) LanguageMiddlewareFunc(c *gin.Context) {
 	pref := GetLanguagePreference(c.GetHeader("Accept-Language"), lm.defaultLanguage)
 
 	//c.Request.Context("language_preference", pref)
-	c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), "language_preference", pref))
+	ctx := context.WithValue(c.Request.Context(), "language_preference", pref)
+	ctx = context.WithValue(ctx, "language_chain", lm.LanguageChain(pref))
+	c.Request = c.Request.WithContext(ctx)
 
 }
 
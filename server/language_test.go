@@ -0,0 +1,35 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLanguageChain(t *testing.T) {
+
+	lm := &LanguageMiddleware{
+		defaultLanguage: "en",
+		fallbackChains: map[string][]string{
+			"":   {"es"},
+			"pt": {"gl", "en", "es"},
+			"gl": {"pt"},
+		},
+	}
+
+	cases := []struct {
+		preference []string
+		chain      []string
+	}{
+		{[]string{"pt"}, []string{"pt", "gl", "es"}},
+		{[]string{"fr", "de"}, []string{"fr", "de", "es"}},
+		{[]string{"en"}, []string{}},
+		{[]string{}, []string{}},
+	}
+
+	for _, testCase := range cases {
+		chain := lm.LanguageChain(testCase.preference)
+		if !reflect.DeepEqual(chain, testCase.chain) {
+			t.Errorf("Expected chain %v for %v, found %v", testCase.chain, testCase.preference, chain)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"html/template"
+	"net/url"
+	"strings"
+
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/gin-gonic/gin"
+)
+
+var oauthConsentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Allow {{.ClientName}}</title>
+<style>
+body { font-family: sans-serif; max-width: 420px; margin: 60px auto; padding: 0 16px; color: #222; }
+li { margin: 4px 0; }
+button { padding: 8px 20px; margin-right: 8px; }
+</style>
+</head>
+<body>
+<h2>{{.ClientName}} wants to know who you are</h2>
+<p>It will be able to:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end}}</ul>
+<form method="POST" action="/oauth/authorize">
+<input type="hidden" name="consent_token" value="{{.ConsentToken}}">
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+// oauthScopeDescriptions are shown on the consent page, the tokens of a client only read the claims of these scopes
+// from the userinfo endpoint and do not sign the client in to daptin as the user
+var oauthScopeDescriptions = map[string]string{
+	"openid":         "Confirm your identity",
+	"profile":        "See your name",
+	"email":          "See your email address",
+	"offline_access": "Keep this access after you leave",
+}
+
+// oauthIssuer is the url of the provider, which is the url daptin is reached at
+func oauthIssuer(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if forwardedProto := c.GetHeader("X-Forwarded-Proto"); forwardedProto != "" {
+		scheme = strings.Split(forwardedProto, ",")[0]
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+func oauthErrorResponse(c *gin.Context, err error) {
+	oauthError, ok := err.(resource.OAuthError)
+	if !ok {
+		oauthError = resource.OAuthError{Code: "server_error", Description: err.Error(), Status: 500}
+	}
+	if oauthError.Code == "invalid_client" {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.Header("Cache-Control", "no-store")
+	c.AbortWithStatusJSON(oauthError.Status, map[string]string{
+		"error":             oauthError.Code,
+		"error_description": oauthError.Description,
+	})
+}
+
+// CreateOAuthDiscoveryHandler serves the openid configuration
+func CreateOAuthDiscoveryHandler(oauthServer *resource.OAuthServer) func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(200, oauthServer.Discovery(oauthIssuer(c)))
+	}
+}
+
+// CreateOAuthJwksHandler serves the keys id tokens are signed with
+func CreateOAuthJwksHandler(oauthServer *resource.OAuthServer) func(*gin.Context) {
+	return func(c *gin.Context) {
+		c.JSON(200, oauthServer.Jwks())
+	}
+}
+
+// CreateOAuthAuthorizeHandler asks the signed in user to allow a client, and sends the client back an authorization
+// code. Users who are not signed in are sent to the login url first, with this request as the url to come back to
+func CreateOAuthAuthorizeHandler(oauthServer *resource.OAuthServer, loginUrl string) func(*gin.Context) {
+	return func(c *gin.Context) {
+
+		request, client, canRedirect, err := oauthServer.ValidateAuthorization(c.Request.URL.Query())
+		if err != nil {
+			if oauthError, ok := err.(resource.OAuthError); ok && canRedirect {
+				c.Redirect(302, request.RedirectError(oauthError))
+				return
+			}
+			oauthErrorResponse(c, err)
+			return
+		}
+
+		sessionUser, _ := c.Request.Context().Value("user").(*auth.SessionUser)
+		if sessionUser == nil || sessionUser.UserReferenceId == "" {
+			c.Redirect(302, loginUrl+"?redirect="+url.QueryEscape(c.Request.URL.RequestURI()))
+			return
+		}
+
+		if oauthServer.NeedsConsent(sessionUser, request, client) {
+			consentToken, err := oauthServer.ConsentToken(sessionUser, request)
+			if err != nil {
+				oauthErrorResponse(c, err)
+				return
+			}
+			scopes := make([]string, 0)
+			for _, scope := range strings.Fields(request.Scope) {
+				description, ok := oauthScopeDescriptions[scope]
+				if !ok {
+					description = scope
+				}
+				scopes = append(scopes, description)
+			}
+			c.Header("Cache-Control", "no-store")
+			c.Header("X-Frame-Options", "DENY")
+			c.Status(200)
+			c.Header("Content-Type", "text/html; charset=utf-8")
+			err = oauthConsentTemplate.Execute(c.Writer, map[string]interface{}{
+				"ClientName":   client.Name,
+				"Scopes":       scopes,
+				"ConsentToken": consentToken,
+			})
+			resource.CheckErr(err, "Failed to render the oauth consent page")
+			return
+		}
+
+		redirect, err := oauthServer.IssueCode(sessionUser, request)
+		if err != nil {
+			c.Redirect(302, request.RedirectError(resource.OAuthError{Code: "server_error", Description: "failed to issue a code"}))
+			return
+		}
+		c.Redirect(302, redirect)
+	}
+}
+
+// CreateOAuthConsentHandler takes the answer of the consent form
+func CreateOAuthConsentHandler(oauthServer *resource.OAuthServer) func(*gin.Context) {
+	return func(c *gin.Context) {
+
+		sessionUser, _ := c.Request.Context().Value("user").(*auth.SessionUser)
+		if sessionUser == nil || sessionUser.UserReferenceId == "" {
+			c.AbortWithStatus(403)
+			return
+		}
+
+		request, err := oauthServer.ParseConsentToken(sessionUser, c.PostForm("consent_token"))
+		if err != nil {
+			oauthErrorResponse(c, err)
+			return
+		}
+
+		if c.PostForm("decision") != "allow" {
+			c.Redirect(302, request.RedirectError(resource.OAuthError{Code: "access_denied", Description: "the user denied the request"}))
+			return
+		}
+
+		if _, err = oauthServer.GetClient(request.ClientId); err != nil {
+			oauthErrorResponse(c, err)
+			return
+		}
+		err = oauthServer.SaveConsent(sessionUser, request)
+		resource.CheckErr(err, "Failed to store the consent of [%v] for [%v]", sessionUser.UserReferenceId, request.ClientId)
+
+		redirect, err := oauthServer.IssueCode(sessionUser, request)
+		if err != nil {
+			c.Redirect(302, request.RedirectError(resource.OAuthError{Code: "server_error", Description: "failed to issue a code"}))
+			return
+		}
+		c.Redirect(302, redirect)
+	}
+}
+
+// oauthClientCredentials reads the client from basic auth or from the form
+func oauthClientCredentials(c *gin.Context) (string, string) {
+	if clientId, clientSecret, ok := c.Request.BasicAuth(); ok {
+		clientId, _ = url.QueryUnescape(clientId)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+		return clientId, clientSecret
+	}
+	return c.PostForm("client_id"), c.PostForm("client_secret")
+}
+
+// CreateOAuthTokenHandler exchanges codes, refresh tokens and client credentials for tokens
+func CreateOAuthTokenHandler(oauthServer *resource.OAuthServer) func(*gin.Context) {
+	return func(c *gin.Context) {
+
+		err := c.Request.ParseForm()
+		if err != nil {
+			oauthErrorResponse(c, resource.OAuthError{Code: "invalid_request", Description: err.Error(), Status: 400})
+			return
+		}
+
+		client, err := oauthServer.AuthenticateClient(oauthClientCredentials(c))
+		if err != nil {
+			oauthErrorResponse(c, err)
+			return
+		}
+
+		tokens, err := oauthServer.Token(client, c.Request.PostForm, oauthIssuer(c))
+		if err != nil {
+			oauthErrorResponse(c, err)
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.Header("Pragma", "no-cache")
+		c.JSON(200, tokens)
+	}
+}
+
+// CreateOAuthUserInfoHandler returns the claims about the user of a bearer access token
+func CreateOAuthUserInfoHandler(oauthServer *resource.OAuthServer) func(*gin.Context) {
+	return func(c *gin.Context) {
+
+		accessToken := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer"))
+		if accessToken == "" {
+			accessToken = c.PostForm("access_token")
+		}
+
+		claims, err := oauthServer.UserInfo(accessToken)
+		if err != nil {
+			if oauthError, ok := err.(resource.OAuthError); ok {
+				c.Header("WWW-Authenticate", `Bearer error="`+oauthError.Code+`"`)
+			}
+			oauthErrorResponse(c, err)
+			return
+		}
+		c.JSON(200, claims)
+	}
+}
+
+// CreateOAuthRevokeHandler revokes a refresh token of the client
+func CreateOAuthRevokeHandler(oauthServer *resource.OAuthServer) func(*gin.Context) {
+	return func(c *gin.Context) {
+
+		client, err := oauthServer.AuthenticateClient(oauthClientCredentials(c))
+		if err != nil {
+			oauthErrorResponse(c, err)
+			return
+		}
+		err = oauthServer.Revoke(client, c.PostForm("token"))
+		if err != nil {
+			oauthErrorResponse(c, err)
+			return
+		}
+		c.Status(200)
+	}
+}
@@ -0,0 +1,120 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+)
+
+// isDatabaseOutcome is true for the outcomes which write rows, these are undone by rolling back the transaction of
+// a transactional action and do not need to be compensated
+func isDatabaseOutcome(outcome Outcome) bool {
+	switch outcome.Method {
+	case "POST", "PATCH", "DELETE":
+		return true
+	}
+	return false
+}
+
+// checkTransactionalOutcomes rejects a transactional action which has an EXECUTE outcome without a compensation,
+// performers do not run in the transaction of the action so rolling it back cannot undo what they did
+func checkTransactionalOutcomes(action Action) error {
+	if !action.Transactional {
+		return nil
+	}
+	for _, outcome := range action.OutFields {
+		if outcome.Method == "EXECUTE" && outcome.Compensation == nil {
+			return fmt.Errorf("transactional action [%v] executes [%v] without a compensation", action.Name, outcome.Type)
+		}
+	}
+	return nil
+}
+
+// outcomeContext is the context outcomes are run with, outcomes act as the administrator
+func (db *DbResource) outcomeContext(requestContext context.Context) context.Context {
+	var adminUserReferenceId string
+	adminUserReferenceIds := db.GetAdminReferenceId()
+	for id, _ := range adminUserReferenceIds {
+		adminUserReferenceId = id
+		break
+	}
+
+	if len(adminUserReferenceId) > 0 {
+		requestContext = context.WithValue(requestContext, "user", &auth.SessionUser{
+			UserReferenceId: adminUserReferenceId,
+		})
+	}
+	return requestContext
+}
+
+// abortAction rolls back the transaction of a failed action and runs the compensations of the outcomes which were
+// done before the failure, the last one first. Compensations are best effort, a failed compensation is logged and
+// the rest still run
+func (db *DbResource) abortAction(transaction *sqlx.Tx, compensations []Outcome, inFieldMap map[string]interface{}, req api2go.Request) {
+
+	if transaction != nil {
+		err := transaction.Rollback()
+		CheckErr(err, "Failed to rollback action transaction")
+	}
+
+	for i := len(compensations) - 1; i >= 0; i-- {
+		compensation := compensations[i]
+		err := db.runCompensation(compensation, inFieldMap, req)
+		if err != nil {
+			log.Errorf("Failed to compensate with outcome [%v][%v]: %v", compensation.Type, compensation.Method, err)
+		}
+	}
+}
+
+// runCompensation runs a compensating outcome outside of any transaction, compensations call a performer or write
+// rows directly
+func (db *DbResource) runCompensation(outcome Outcome, inFieldMap map[string]interface{}, req api2go.Request) error {
+
+	if outcome.Attributes == nil {
+		outcome.Attributes = make(map[string]interface{})
+	}
+	model, request, err := BuildOutcome(inFieldMap, outcome)
+	if err != nil {
+		return err
+	}
+	request.PlainRequest = request.PlainRequest.WithContext(db.outcomeContext(req.PlainRequest.Context()))
+
+	switch outcome.Method {
+	case "EXECUTE":
+		performer, ok := db.GetActionPerformer(model.GetName())
+		if !ok {
+			return fmt.Errorf("no performer [%v]", model.GetName())
+		}
+		sessionUser, ok := req.PlainRequest.Context().Value("user").(*auth.SessionUser)
+		if !ok {
+			sessionUser = &auth.SessionUser{}
+		}
+		outcome.Attributes["user"] = sessionUser
+		_, _, errs := performer.DoAction(outcome, model.Data)
+		if len(errs) > 0 {
+			return errs[0]
+		}
+		return nil
+	}
+
+	dbResource, ok := db.Cruds[outcome.Type]
+	if !ok {
+		return fmt.Errorf("no such type [%v]", outcome.Type)
+	}
+	switch outcome.Method {
+	case "POST":
+		_, err = dbResource.Create(model, request)
+	case "PATCH":
+		_, err = dbResource.Update(model, request)
+	case "DELETE":
+		referenceId, _ := model.Data["reference_id"].(string)
+		err = dbResource.DeleteWithoutFilters(referenceId, request)
+	default:
+		err = fmt.Errorf("method [%v] cannot be used to compensate", outcome.Method)
+	}
+	return err
+}
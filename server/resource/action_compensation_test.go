@@ -0,0 +1,89 @@
+package resource
+
+import (
+	json1 "encoding/json"
+	"testing"
+)
+
+func TestIsDatabaseOutcome(t *testing.T) {
+
+	for _, method := range []string{"POST", "PATCH", "DELETE"} {
+		if !isDatabaseOutcome(Outcome{Method: method}) {
+			t.Errorf("Expected [%v] to be undone by the transaction", method)
+		}
+	}
+	for _, method := range []string{"EXECUTE", "GET", "GET_BY_ID", "ACTIONRESPONSE"} {
+		if isDatabaseOutcome(Outcome{Method: method}) {
+			t.Errorf("Expected [%v] to need a compensation", method)
+		}
+	}
+}
+
+func TestActionSchemaKeepsCompensation(t *testing.T) {
+
+	action := Action{
+		Name:          "order_and_notify",
+		Transactional: true,
+		OutFields: []Outcome{
+			{
+				Type:   "order",
+				Method: "POST",
+			},
+			{
+				Type:       "webhook.send",
+				Method:     "EXECUTE",
+				Attributes: map[string]interface{}{"event": "order.created"},
+				Compensation: &Outcome{
+					Type:       "webhook.send",
+					Method:     "EXECUTE",
+					Attributes: map[string]interface{}{"event": "order.cancelled"},
+				},
+			},
+		},
+	}
+
+	schema, err := json1.Marshal(action)
+	if err != nil {
+		t.Fatalf("Failed to marshal action: %v", err)
+	}
+	var stored Action
+	err = json1.Unmarshal(schema, &stored)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal action: %v", err)
+	}
+
+	if !stored.Transactional {
+		t.Errorf("Expected the action to stay transactional")
+	}
+	compensation := stored.OutFields[1].Compensation
+	if stored.OutFields[0].Compensation != nil || compensation == nil ||
+		compensation.Attributes["event"] != "order.cancelled" {
+		t.Errorf("Unexpected compensations %v %v", stored.OutFields[0].Compensation, compensation)
+	}
+}
+
+func TestCheckTransactionalOutcomes(t *testing.T) {
+
+	action := Action{
+		Name:          "order_and_notify",
+		Transactional: true,
+		OutFields: []Outcome{
+			{Type: "order", Method: "POST"},
+			{Type: "mail.send", Method: "EXECUTE"},
+		},
+	}
+	if checkTransactionalOutcomes(action) == nil {
+		t.Errorf("Expected an EXECUTE outcome without a compensation to be rejected")
+	}
+
+	action.OutFields[1].Compensation = &Outcome{Type: "mail.send", Method: "EXECUTE"}
+	if err := checkTransactionalOutcomes(action); err != nil {
+		t.Errorf("Expected a compensated EXECUTE outcome to be allowed, found %v", err)
+	}
+
+	action.Transactional = false
+	action.OutFields[1].Compensation = nil
+	if err := checkTransactionalOutcomes(action); err != nil {
+		t.Errorf("Expected actions outside a transaction to be allowed, found %v", err)
+	}
+}
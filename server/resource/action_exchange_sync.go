@@ -0,0 +1,317 @@
+package resource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+// DataExchangeTableName holds the exchanges, the ones with the rest source type and the self target type pull rows
+// from a REST API into a table
+const DataExchangeTableName = "data_exchange"
+
+// exchangeSyncResult counts what a sync did
+type exchangeSyncResult struct {
+	Created   int
+	Updated   int
+	Pages     int
+	Watermark string
+}
+
+type exchangeSyncActionPerformer struct {
+	cruds  map[string]*DbResource
+	client *http.Client
+}
+
+func (d *exchangeSyncActionPerformer) Name() string {
+	return "data_exchange.sync"
+}
+
+// DoAction pulls the items of the rest source of the exchange into its target table, as the user running the action
+func (d *exchangeSyncActionPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	referenceId, _ := inFields["reference_id"].(string)
+	exchange, _, err := d.cruds[DataExchangeTableName].GetSingleRowByReferenceId(DataExchangeTableName, referenceId, nil)
+	if err != nil {
+		return nil, nil, []error{fmt.Errorf("no such exchange [%v]", referenceId)}
+	}
+
+	sessionUser, ok := request.Attributes["user"].(*auth.SessionUser)
+	if !ok {
+		sessionUser = &auth.SessionUser{}
+	}
+
+	result, err := d.sync(exchange, sessionUser)
+	if err != nil {
+		log.Errorf("Exchange [%v] failed to sync: %v", exchange["name"], err)
+		return nil, []ActionResponse{
+			NewActionResponse("client.notify", NewClientNotification("error",
+				fmt.Sprintf("Sync failed after %d new and %d updated rows: %v", result.Created, result.Updated, err), "Failed")),
+		}, []error{err}
+	}
+
+	log.Infof("Exchange [%v] synced %d new and %d updated rows from %d pages", exchange["name"], result.Created, result.Updated, result.Pages)
+	return nil, []ActionResponse{
+		NewActionResponse("client.notify", NewClientNotification("message",
+			fmt.Sprintf("Synced %d new and %d updated rows", result.Created, result.Updated), "Success")),
+	}, nil
+}
+
+// sync pages through the source, upserts every item into the target table by the key column and, when every page
+// was read, stores the watermark to start the next sync from
+func (d *exchangeSyncActionPerformer) sync(exchange map[string]interface{}, sessionUser *auth.SessionUser) (exchangeSyncResult, error) {
+
+	result := exchangeSyncResult{}
+	if exchange["source_type"] != "rest" || exchange["target_type"] != "self" {
+		return result, errors.New("only exchanges from a rest source to self can be synced")
+	}
+
+	source, err := NewRestPullSource(toJson(exchange["source_attributes"]))
+	if err != nil {
+		return result, err
+	}
+
+	var target struct {
+		Name      string `json:"name"`
+		KeyColumn string `json:"key_column"`
+	}
+	err = json.Unmarshal([]byte(toJson(exchange["target_attributes"])), &target)
+	if err != nil {
+		return result, fmt.Errorf("invalid target attributes: %v", err)
+	}
+	dbResource, ok := d.cruds[target.Name]
+	if !ok {
+		return result, fmt.Errorf("no such table [%v]", target.Name)
+	}
+	if target.KeyColumn == "" {
+		return result, errors.New("the target has no key_column to match rows by")
+	}
+	if _, ok := dbResource.TableInfo().GetColumnByName(target.KeyColumn); !ok {
+		return result, fmt.Errorf("no column [%v] in [%v]", target.KeyColumn, target.Name)
+	}
+
+	var mapping ColumnMapping
+	if mappingJson := toJson(exchange["attributes"]); mappingJson != "" && mappingJson != "null" {
+		err = json.Unmarshal([]byte(mappingJson), &mapping)
+		if err != nil {
+			return result, fmt.Errorf("invalid column mapping: %v", err)
+		}
+	}
+
+	watermark, _ := exchange["watermark"].(string)
+	ctx := context.WithValue(context.Background(), "user", sessionUser)
+
+	watermark, result.Pages, err = source.Fetch(d.client, watermark, func(item map[string]interface{}) error {
+		attributes, err := mapping.Apply(item)
+		if err != nil {
+			return err
+		}
+		created, err := upsertExchangeRow(dbResource, target.Name, target.KeyColumn, attributes, ctx)
+		if err != nil {
+			return err
+		}
+		if created {
+			result.Created += 1
+		} else {
+			result.Updated += 1
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	result.Watermark = watermark
+
+	query, args, err := statementbuilder.Squirrel.Update(DataExchangeTableName).Prepared(true).Set(goqu.Record{
+		"watermark":      watermark,
+		"last_synced_at": time.Now(),
+	}).Where(goqu.Ex{"reference_id": exchange["reference_id"]}).ToSQL()
+	if err != nil {
+		return result, err
+	}
+	_, err = d.cruds[DataExchangeTableName].db.Exec(query, args...)
+	return result, err
+}
+
+// upsertExchangeRow updates the row with the key of the attributes, or creates it, and tells if it was created
+func upsertExchangeRow(dbResource *DbResource, tableName string, keyColumn string, attributes map[string]interface{}, ctx context.Context) (bool, error) {
+
+	key, ok := attributes[keyColumn]
+	if !ok || key == nil {
+		return false, fmt.Errorf("an item has no value for the key column [%v]", keyColumn)
+	}
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("reference_id")).From(tableName).
+		Where(goqu.Ex{keyColumn: key}).Limit(1).ToSQL()
+	if err != nil {
+		return false, err
+	}
+	var referenceId string
+	err = dbResource.connection.QueryRowx(query, args...).Scan(&referenceId)
+
+	if err == sql.ErrNoRows {
+		pr := &http.Request{
+			Method: "POST",
+		}
+		_, err = dbResource.Create(api2go.NewApi2GoModelWithData(tableName, nil, 0, nil, attributes), api2go.Request{
+			PlainRequest: pr.WithContext(ctx),
+		})
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	existing, _, err := dbResource.GetSingleRowByReferenceId(tableName, referenceId, nil)
+	if err != nil {
+		return false, err
+	}
+	model := api2go.NewApi2GoModelWithData(tableName, nil, 0, nil, existing)
+	model.SetAttributes(attributes)
+	pr := &http.Request{
+		Method: "PATCH",
+	}
+	_, err = dbResource.Update(model, api2go.Request{
+		PlainRequest: pr.WithContext(ctx),
+	})
+	return false, err
+}
+
+func NewExchangeSyncActionPerformer(cruds map[string]*DbResource) (ActionPerformerInterface, error) {
+
+	handler := exchangeSyncActionPerformer{
+		cruds: cruds,
+		client: &http.Client{
+			Timeout: time.Minute,
+		},
+	}
+
+	return &handler, nil
+}
+
+// GetSyncExchanges returns the reference ids and schedules of the exchanges pulled from a rest source on a schedule
+func (dr *DbResource) GetSyncExchanges() (map[string]string, error) {
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("reference_id"), goqu.C("schedule")).
+		From(DataExchangeTableName).Where(goqu.Ex{"source_type": "rest", "target_type": "self"}).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := dr.connection.Queryx(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = rows.Close()
+		CheckErr(err, "Failed to close exchange rows")
+	}()
+
+	schedules := make(map[string]string)
+	for rows.Next() {
+		var referenceId string
+		var schedule *string
+		err = rows.Scan(&referenceId, &schedule)
+		if err != nil {
+			return nil, err
+		}
+		if schedule != nil && *schedule != "" {
+			schedules[referenceId] = *schedule
+		}
+	}
+	return schedules, nil
+}
+
+// ExchangeSyncScheduler runs the syncs of the exchanges on their schedules, it is reloaded when an exchange is
+// created, changed or deleted
+type ExchangeSyncScheduler struct {
+	cruds       map[string]*DbResource
+	cronService *cron.Cron
+	entries     map[string]exchangeSyncEntry
+	lock        sync.Mutex
+}
+
+// exchangeSyncEntry is the scheduled sync of an exchange
+type exchangeSyncEntry struct {
+	schedule string
+	entryId  cron.EntryID
+}
+
+var exchangeSyncScheduler *ExchangeSyncScheduler
+
+// StartExchangeSyncScheduler schedules the syncs of the exchanges
+func StartExchangeSyncScheduler(cruds map[string]*DbResource) (*ExchangeSyncScheduler, error) {
+	scheduler := &ExchangeSyncScheduler{
+		cruds:       cruds,
+		cronService: cron.New(),
+		entries:     make(map[string]exchangeSyncEntry),
+	}
+	err := scheduler.Reload()
+	if err != nil {
+		return nil, err
+	}
+	scheduler.cronService.Start()
+	exchangeSyncScheduler = scheduler
+	return scheduler, nil
+}
+
+// ReloadExchangeSyncs picks up a change of the data_exchange table
+func ReloadExchangeSyncs() {
+	if exchangeSyncScheduler == nil {
+		return
+	}
+	err := exchangeSyncScheduler.Reload()
+	CheckErr(err, "Failed to reload exchange syncs")
+}
+
+// Reload reads the schedules of the exchanges, and schedules the new ones, reschedules the changed ones and stops
+// the removed ones
+func (s *ExchangeSyncScheduler) Reload() error {
+
+	schedules, err := s.cruds[DataExchangeTableName].GetSyncExchanges()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for referenceId, entry := range s.entries {
+		if schedules[referenceId] != entry.schedule {
+			s.cronService.Remove(entry.entryId)
+			delete(s.entries, referenceId)
+		}
+	}
+
+	for referenceId, schedule := range schedules {
+		if _, ok := s.entries[referenceId]; ok {
+			continue
+		}
+		task := s.cruds["task"].NewActiveTaskInstance(Task{
+			EntityName:  DataExchangeTableName,
+			ActionName:  "sync_data_exchange",
+			Attributes:  map[string]interface{}{DataExchangeTableName + "_id": referenceId},
+			AsUserEmail: s.cruds[USER_ACCOUNT_TABLE_NAME].GetAdminEmailId(),
+			Schedule:    schedule,
+		})
+		entryId, err := s.cronService.AddJob(schedule, task)
+		if err != nil {
+			log.Errorf("Failed to schedule the sync of exchange [%v] at [%v]: %v", referenceId, schedule, err)
+			continue
+		}
+		log.Printf("Scheduled the sync of exchange [%v] at %v", referenceId, schedule)
+		s.entries[referenceId] = exchangeSyncEntry{schedule: schedule, entryId: entryId}
+	}
+	return nil
+}
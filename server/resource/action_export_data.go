@@ -1,9 +1,21 @@
 package resource
 
 import (
+	"bufio"
+	"context"
 	"encoding/base64"
+	json1 "encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
 	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/doug-martin/goqu/v9"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -12,62 +24,317 @@ type exportDataPerformer struct {
 	cruds     map[string]*DbResource
 }
 
+// exportPageSize is the number of rows read from a table at a time
+const exportPageSize = 1000
+
+// exportMaxDownloadMb is the default of export.max_download_mb, larger exports have to go to a cloud store since
+// downloads are returned base64 encoded in the action response
+const exportMaxDownloadMb = 50
+
 func (d *exportDataPerformer) Name() string {
 	return "__data_export"
 }
 
+// DoAction streams the rows of a table, or of every table for the json dump, to a file in the format. The file is
+// uploaded to the path in the cloud store when one is named and downloaded otherwise
 func (d *exportDataPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
 
-	responses := make([]ActionResponse, 0)
+	format, _ := inFields["format"].(string)
+	if format == "" {
+		format = DataFormatJson
+	}
+	contentType, ok := DataFormatContentTypes[format]
+	if !ok {
+		return nil, nil, []error{fmt.Errorf("unknown format [%v]", format)}
+	}
 
-	tableName, ok := inFields["table_name"]
+	columnNames := make([]string, 0)
+	if columns, _ := inFields["columns"].(string); columns != "" {
+		for _, columnName := range strings.Split(columns, ",") {
+			if columnName = strings.TrimSpace(columnName); columnName != "" {
+				columnNames = append(columnNames, columnName)
+			}
+		}
+	}
+	queries, err := exportQueries(inFields["query"])
+	if err != nil {
+		return nil, nil, []error{err}
+	}
 
 	finalName := "complete"
+	tableNames := make([]string, 0)
+	if tableName, _ := inFields["table_name"].(string); tableName != "" {
+		if _, ok := d.cruds[tableName]; !ok {
+			return nil, nil, []error{fmt.Errorf("unknown table [%v]", tableName)}
+		}
+		log.Printf("Export data for table: %v", tableName)
+		tableNames = append(tableNames, tableName)
+		finalName = tableName
+	} else {
+		if format != DataFormatJson {
+			return nil, nil, []error{fmt.Errorf("table_name is required to export as %v", format)}
+		}
+		if len(columnNames) > 0 || len(queries) > 0 {
+			return nil, nil, []error{errors.New("table_name is required to export selected columns or rows")}
+		}
+		for _, tableInfo := range d.cmsConfig.Tables {
+			tableNames = append(tableNames, tableInfo.TableName)
+		}
+	}
+	fileName := fmt.Sprintf("daptin_dump_%v.%v", finalName, format)
 
-	var finalString []byte
-	result := make(map[string]interface{})
+	// rows in the trash are left out unless asked for with trashed set to with or only, as in find requests
+	trashedRequest := api2go.Request{
+		QueryParams: map[string][]string{},
+	}
+	if trashed, _ := inFields[TrashedQueryParameter].(string); trashed != "" {
+		trashedRequest.QueryParams[TrashedQueryParameter] = []string{trashed}
+	}
 
-	if ok && tableName != nil {
+	export := func(out io.Writer) (int, error) {
+		return d.export(out, format, tableNames, columnNames, queries, trashedRequest)
+	}
 
-		tableNameStr := tableName.(string)
-		log.Printf("Export data for table: %v", tableNameStr)
+	if cloudStoreName, _ := inFields["cloud_store_name"].(string); cloudStoreName != "" {
+		cloudStore, err := d.cruds["cloud_store"].GetCloudStoreByName(cloudStoreName)
+		if err != nil {
+			return nil, nil, []error{err}
+		}
+		if cloudStore.Name == "" {
+			return nil, nil, []error{fmt.Errorf("no cloud store named [%v]", cloudStoreName)}
+		}
+		filePath, _ := inFields["path"].(string)
+		if filePath == "" || strings.HasSuffix(filePath, "/") {
+			filePath = filePath + fileName
+		}
 
-		objects, err := d.cruds[tableNameStr].GetAllRawObjects(tableNameStr)
+		count, err := d.exportToCloudStore(cloudStore, filePath, export)
 		if err != nil {
-			log.Errorf("Failed to get all objects of type [%v] : %v", tableNameStr, err)
+			log.Errorf("Failed to export [%v] to cloud store [%v] after %d rows: %v", finalName, cloudStoreName, count, err)
+			return nil, nil, []error{err}
 		}
+		return nil, []ActionResponse{
+			NewActionResponse("client.notify", NewClientNotification("success",
+				fmt.Sprintf("Exported %d rows to [%v] in [%v]", count, filePath, cloudStoreName), "Export")),
+		}, nil
+	}
 
-		result[tableNameStr] = objects
-		finalName = tableNameStr
-	} else {
+	// without a cloud store the file is spooled to disk and returned in the response
+	tempFile, err := ioutil.TempFile("", "daptin-export-*."+format)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	defer os.Remove(tempFile.Name())
+	out := bufio.NewWriter(tempFile)
+	_, err = export(out)
+	if err == nil {
+		err = out.Flush()
+	}
+	tempFile.Close()
+	if err != nil {
+		log.Errorf("Failed to export [%v]: %v", finalName, err)
+		return nil, nil, []error{err}
+	}
+	content, err := d.downloadContent(tempFile.Name())
+	if err != nil {
+		return nil, nil, []error{err}
+	}
 
-		for _, tableInfo := range d.cmsConfig.Tables {
-			data, err := d.cruds[tableInfo.TableName].GetAllRawObjects(tableInfo.TableName)
-			if err != nil {
-				log.Errorf("Failed to export objects of type [%v]: %v", tableInfo.TableName, err)
-				continue
+	responseAttrs := make(map[string]interface{})
+	responseAttrs["content"] = content
+	responseAttrs["name"] = fileName
+	responseAttrs["contentType"] = contentType
+	responseAttrs["message"] = "Downloading data"
+
+	return nil, []ActionResponse{
+		NewActionResponse("client.file.download", responseAttrs),
+	}, nil
+}
+
+// downloadContent returns the base64 encoded contents of the exported file, when it is within export.max_download_mb
+func (d *exportDataPerformer) downloadContent(fileName string) (string, error) {
+
+	configStore := d.cruds["world"].configStore
+	maxDownloadMb, err := configStore.GetConfigIntValueFor("export.max_download_mb", "backend")
+	if err != nil {
+		maxDownloadMb = exportMaxDownloadMb
+		err = configStore.SetConfigIntValueFor("export.max_download_mb", maxDownloadMb, "backend")
+		CheckErr(err, "Failed to store default value for export.max_download_mb")
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fileInfo.Size() > int64(maxDownloadMb)<<20 {
+		return "", fmt.Errorf("the export is larger than the %d MB which can be downloaded, export it to a cloud store with cloud_store_name", maxDownloadMb)
+	}
+
+	content := &strings.Builder{}
+	content.Grow(base64.StdEncoding.EncodedLen(int(fileInfo.Size())))
+	encoder := base64.NewEncoder(base64.StdEncoding, content)
+	_, err = io.Copy(encoder, file)
+	if err == nil {
+		err = encoder.Close()
+	}
+	return content.String(), err
+}
+
+// exportQueries reads the query filters of the export, given as a json array of column, operator and value
+func exportQueries(query interface{}) ([]Query, error) {
+	queries := make([]Query, 0)
+	var queryJson []byte
+	switch value := query.(type) {
+	case nil:
+		return queries, nil
+	case string:
+		if value == "" {
+			return queries, nil
+		}
+		queryJson = []byte(value)
+	default:
+		var err error
+		queryJson, err = json1.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := json1.Unmarshal(queryJson, &queries)
+	if err != nil {
+		return nil, fmt.Errorf("query is not a list of filters: %v", err)
+	}
+	return queries, nil
+}
+
+// export writes the rows of the tables to out and returns the number of rows written
+func (d *exportDataPerformer) export(out io.Writer, format string, tableNames []string, columnNames []string, queries []Query, trashedRequest api2go.Request) (int, error) {
+
+	dataWriter, err := NewDataWriter(format, out)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, tableName := range tableNames {
+		count, err := d.exportTable(dataWriter, tableName, columnNames, queries, trashedRequest)
+		total += count
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, dataWriter.Close()
+}
+
+// exportTable writes the rows of the table matching the queries a page at a time, paging by id
+func (d *exportDataPerformer) exportTable(dataWriter DataWriter, tableName string, columnNames []string, queries []Query, trashedRequest api2go.Request) (int, error) {
+
+	dbResource := d.cruds[tableName]
+	tableInfo := dbResource.TableInfo()
+
+	columns := make([]api2go.ColumnInfo, 0)
+	if len(columnNames) == 0 {
+		columns = append(columns, tableInfo.Columns...)
+	} else {
+		for _, columnName := range columnNames {
+			column, ok := tableInfo.GetColumnByName(columnName)
+			if !ok {
+				return 0, fmt.Errorf("no column [%v] in [%v]", columnName, tableName)
 			}
-			result[tableInfo.TableName] = data
+			columns = append(columns, *column)
+		}
+	}
+
+	// filters on unknown columns fail the export instead of being skipped and exporting every row
+	for _, query := range queries {
+		if _, ok := tableInfo.GetColumnByName(query.ColumnName); !ok {
+			return 0, fmt.Errorf("no column [%v] in [%v] to filter on", query.ColumnName, tableName)
 		}
+	}
 
+	exportColumns := []interface{}{goqu.I(tableName + ".id")}
+	for _, column := range columns {
+		if column.ColumnName != "id" {
+			exportColumns = append(exportColumns, goqu.I(tableName+"."+column.ColumnName))
+		}
 	}
 
-	finalString, err := json.Marshal(result)
+	err := dataWriter.StartTable(tableName, columns)
 	if err != nil {
-		log.Errorf("Failed to marshal objects as json: %v", err)
+		return 0, err
 	}
 
-	responseAttrs := make(map[string]interface{})
-	responseAttrs["content"] = base64.StdEncoding.EncodeToString(finalString)
-	responseAttrs["name"] = fmt.Sprintf("daptin_dump_%v.json", finalName)
-	responseAttrs["contentType"] = "application/json"
-	responseAttrs["message"] = "Downloading data"
+	count := 0
+	lastId := int64(0)
+	for {
+		queryBuilder := statementbuilder.Squirrel.Select(exportColumns...).From(tableName).
+			Where(goqu.I(tableName + ".id").Gt(lastId)).Order(goqu.I(tableName + ".id").Asc()).Limit(exportPageSize)
+		countQueryBuilder := statementbuilder.Squirrel.Select(goqu.COUNT("*")).From(tableName)
+		queryBuilder, _ = dbResource.addFilters(queryBuilder, countQueryBuilder, queries, tableName+".")
+		if trashCondition := dbResource.TrashCondition(trashedRequest); trashCondition != nil {
+			queryBuilder = queryBuilder.Where(trashCondition)
+		}
 
-	actionResponse := NewActionResponse("client.file.download", responseAttrs)
+		query, args, err := queryBuilder.ToSQL()
+		if err != nil {
+			return count, err
+		}
+		rows, err := dbResource.connection.Queryx(query, args...)
+		if err != nil {
+			return count, err
+		}
+		page, err := RowsToMap(rows, tableName)
+		rows.Close()
+		if err != nil {
+			return count, err
+		}
 
-	responses = append(responses, actionResponse)
+		for _, row := range page {
+			err = dataWriter.WriteRow(row)
+			if err != nil {
+				return count, err
+			}
+			count++
+		}
+		if len(page) < exportPageSize {
+			return count, nil
+		}
+		lastId, err = strconv.ParseInt(valueToString(page[len(page)-1]["id"]), 10, 64)
+		if err != nil {
+			return count, err
+		}
+	}
+}
 
-	return nil, responses, nil
+// exportToCloudStore streams the export into the file at filePath inside the root path of the cloud store, paths
+// leaving the root path are rejected
+func (d *exportDataPerformer) exportToCloudStore(cloudStore CloudStore, filePath string, export func(out io.Writer) (int, error)) (int, error) {
+
+	filePath, err := cloudStoreFilePath(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	pipeReader, pipeWriter := io.Pipe()
+	uploaded := make(chan error, 1)
+	go func() {
+		err := d.cruds["cloud_store"].WriteCloudStoreObject(context.Background(), cloudStore, "", filePath, pipeReader)
+		// a failed upload stops the export from writing to the pipe
+		pipeReader.CloseWithError(err)
+		uploaded <- err
+	}()
+
+	count, err := export(pipeWriter)
+	pipeWriter.CloseWithError(err)
+	uploadErr := <-uploaded
+	if err == nil {
+		err = uploadErr
+	}
+	return count, err
 }
 
 func NewExportDataPerformer(initConfig *CmsConfig, cruds map[string]*DbResource) (ActionPerformerInterface, error) {
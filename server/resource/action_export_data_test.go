@@ -0,0 +1,43 @@
+package resource
+
+import (
+	"io"
+	"testing"
+)
+
+func TestExportToCloudStorePath(t *testing.T) {
+
+	d := &exportDataPerformer{}
+	exported := false
+	export := func(out io.Writer) (int, error) {
+		exported = true
+		return 0, nil
+	}
+
+	for _, filePath := range []string{"../outside.json", "exports/../../outside.json", ".."} {
+		if _, err := d.exportToCloudStore(CloudStore{}, filePath, export); err == nil {
+			t.Errorf("Expected [%v] to be rejected", filePath)
+		}
+	}
+	if exported {
+		t.Errorf("Expected nothing to be exported to a rejected path")
+	}
+}
+
+func TestCloudStoreFilePath(t *testing.T) {
+
+	for filePath, expected := range map[string]string{
+		"dump.json":            "dump.json",
+		"/exports/dump.json":   "exports/dump.json",
+		"exports//./dump.json": "exports/dump.json",
+		"exports/..dump.json":  "exports/..dump.json",
+	} {
+		cleaned, err := cloudStoreFilePath(filePath)
+		if err != nil || cleaned != expected {
+			t.Errorf("Expected [%v] to be cleaned to [%v], found [%v] %v", filePath, expected, cleaned, err)
+		}
+	}
+	if _, err := cloudStoreFilePath("imports/../../dump.json"); err == nil {
+		t.Errorf("Expected a path leaving the cloud store to be rejected")
+	}
+}
@@ -15,6 +15,7 @@ type generateJwtTokenActionPerformer struct {
 	secret         []byte
 	tokenLifeTime  int
 	jwtTokenIssuer string
+	secondFactor   *secondFactor
 }
 
 func (d *generateJwtTokenActionPerformer) Name() string {
@@ -60,57 +61,29 @@ func (d *generateJwtTokenActionPerformer) DoAction(request Outcome, inFieldMap m
 		existingUser := existingUsers[0]
 		if skipPasswordCheck || (existingUser["password"] != nil && BcryptCheckStringHash(password, existingUser["password"].(string))) {
 
-			// Create a new token object, specifying signing method and the claims
-			// you would like it to contain.
-			u, _ := uuid.NewV4()
-			timeNow := time.Now()
-
-			timeNow.Add(-2 * time.Minute) // allow clock skew of 2 minutes
-			token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-				"email": existingUser["email"],
-				"sub":   existingUser["reference_id"],
-				"name":  existingUser["name"],
-				"nbf":   timeNow.Unix(),
-				"exp":   timeNow.Add(time.Duration(d.tokenLifeTime) * time.Hour).Unix(),
-				"iss":   d.jwtTokenIssuer,
-				"iat":   timeNow.Unix(),
-				"jti":   u.String(),
-			})
-
-			// Sign and get the complete encoded token as a string using the secret
-			tokenString, err := token.SignedString(d.secret)
-			//fmt.Printf("%v %v", tokenString, err)
+			userId, _ := existingUser["id"].(int64)
+			required, factors, err := d.cruds[USER_ACCOUNT_TABLE_NAME].RequiresSecondFactor(userId)
 			if err != nil {
-				log.Errorf("Failed to sign string: %v", err)
+				log.Errorf("Failed to check the second factors of [%v]: %v", email, err)
 				return nil, nil, []error{err}
 			}
+			if required {
+				if d.secondFactor == nil {
+					return nil, nil, []error{fmt.Errorf("second factors are not set up")}
+				}
+				pendingResponses, err := d.secondFactor.pendingResponses(existingUser, factors, firstFactorPassword)
+				if err != nil {
+					return nil, nil, []error{err}
+				}
+				return nil, pendingResponses, nil
+			}
 
-			responseAttrs = make(map[string]interface{})
-			responseAttrs["value"] = string(tokenString)
-			responseAttrs["key"] = "token"
-
-			actionResponse := NewActionResponse("client.store.set", responseAttrs)
-			responses = append(responses, actionResponse)
-
-			cookieResponseAttrs := make(map[string]interface{})
-			cookieResponseAttrs["value"] = string(tokenString) + "; SameSite=Strict"
-			cookieResponseAttrs["key"] = "token"
-
-			actionResponse = NewActionResponse("client.cookie.set", cookieResponseAttrs)
-			responses = append(responses, actionResponse)
-
-			notificationAttrs := make(map[string]string)
-			notificationAttrs["message"] = "Logged in"
-			notificationAttrs["title"] = "Success"
-			notificationAttrs["type"] = "success"
-			responses = append(responses, NewActionResponse("client.notify", notificationAttrs))
-
-			responseAttrs = make(map[string]interface{})
-			responseAttrs["location"] = "/"
-			responseAttrs["window"] = "self"
-			responseAttrs["delay"] = 2000
-
-			responses = append(responses, NewActionResponse("client.redirect", responseAttrs))
+			tokenString, err := newUserToken(existingUser, d.secret, d.jwtTokenIssuer, d.tokenLifeTime)
+			if err != nil {
+				log.Errorf("Failed to sign string: %v", err)
+				return nil, nil, []error{err}
+			}
+			responses = append(responses, newSigninResponses(tokenString)...)
 
 		} else {
 			responseAttrs = make(map[string]interface{})
@@ -125,6 +98,65 @@ func (d *generateJwtTokenActionPerformer) DoAction(request Outcome, inFieldMap m
 	return nil, responses, nil
 }
 
+// newUserToken is the token a user signs in with
+func newUserToken(user map[string]interface{}, secret []byte, jwtTokenIssuer string, tokenLifeTime int) (string, error) {
+
+	// Create a new token object, specifying signing method and the claims
+	// you would like it to contain.
+	u, _ := uuid.NewV4()
+	timeNow := time.Now()
+
+	timeNow.Add(-2 * time.Minute) // allow clock skew of 2 minutes
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email": user["email"],
+		"sub":   user["reference_id"],
+		"name":  user["name"],
+		"nbf":   timeNow.Unix(),
+		"exp":   timeNow.Add(time.Duration(tokenLifeTime) * time.Hour).Unix(),
+		"iss":   jwtTokenIssuer,
+		"iat":   timeNow.Unix(),
+		"jti":   u.String(),
+	})
+
+	// Sign and get the complete encoded token as a string using the secret
+	return token.SignedString(secret)
+}
+
+// newSigninResponses store the token on the client and take the user home
+func newSigninResponses(tokenString string) []ActionResponse {
+
+	responses := make([]ActionResponse, 0)
+
+	responseAttrs := make(map[string]interface{})
+	responseAttrs["value"] = string(tokenString)
+	responseAttrs["key"] = "token"
+
+	actionResponse := NewActionResponse("client.store.set", responseAttrs)
+	responses = append(responses, actionResponse)
+
+	cookieResponseAttrs := make(map[string]interface{})
+	cookieResponseAttrs["value"] = string(tokenString) + "; SameSite=Strict"
+	cookieResponseAttrs["key"] = "token"
+
+	actionResponse = NewActionResponse("client.cookie.set", cookieResponseAttrs)
+	responses = append(responses, actionResponse)
+
+	notificationAttrs := make(map[string]string)
+	notificationAttrs["message"] = "Logged in"
+	notificationAttrs["title"] = "Success"
+	notificationAttrs["type"] = "success"
+	responses = append(responses, NewActionResponse("client.notify", notificationAttrs))
+
+	responseAttrs = make(map[string]interface{})
+	responseAttrs["location"] = "/"
+	responseAttrs["window"] = "self"
+	responseAttrs["delay"] = 2000
+
+	responses = append(responses, NewActionResponse("client.redirect", responseAttrs))
+
+	return responses
+}
+
 func NewGenerateJwtTokenPerformer(configStore *ConfigStore, cruds map[string]*DbResource) (ActionPerformerInterface, error) {
 
 	secret, _ := configStore.GetConfigValueFor("jwt.secret", "backend")
@@ -145,8 +177,12 @@ func NewGenerateJwtTokenPerformer(configStore *ConfigStore, cruds map[string]*Db
 		err = configStore.SetConfigValueFor("jwt.token.issuer", jwtTokenIssuer, "backend")
 	}
 
+	secondFactor, err := newSecondFactor(configStore, cruds)
+	CheckErr(err, "Failed to set up second factors, users who need one cannot sign in")
+
 	handler := generateJwtTokenActionPerformer{
 		cruds:          cruds,
+		secondFactor:   secondFactor,
 		secret:         []byte(secret),
 		tokenLifeTime:  tokenLifeTimeHours,
 		jwtTokenIssuer: jwtTokenIssuer,
@@ -1,10 +1,17 @@
 package resource
 
 import (
+	"context"
 	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
 	"github.com/artpar/api2go"
+	uuid "github.com/artpar/go.uuid"
+	"github.com/jmoiron/sqlx"
 	log "github.com/sirupsen/logrus"
-	"strings"
 )
 
 type importDataPerformer struct {
@@ -12,125 +19,253 @@ type importDataPerformer struct {
 	cruds     map[string]*DbResource
 }
 
+// importBatchSize is the default number of rows committed in each transaction of an import
+const importBatchSize = 500
+
 func (d *importDataPerformer) Name() string {
 	return "__data_import"
 }
 
+// importSource is a file to import rows from
+type importSource struct {
+	name   string
+	reader io.Reader
+}
+
+// DoAction streams the rows of the dump files, or of the file at the path in the cloud store, into the tables. Rows
+// are committed in batches, with a key column rows having its value are updated instead of inserted again
 func (d *importDataPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
 
-	responses := make([]ActionResponse, 0)
-
-	tableName, isSubjected := inFields["table_name"]
-	user, isUserPresent := inFields["user"]
-	userReferenceId := ""
-	userIdInt := int64(1)
-	var err error
-	if isUserPresent {
-		userMap := user.(map[string]interface{})
-		userReferenceId = userMap["reference_id"].(string)
-		userIdInt, err = d.cruds[USER_ACCOUNT_TABLE_NAME].GetReferenceIdToId(USER_ACCOUNT_TABLE_NAME, userReferenceId)
+	tableName, _ := inFields["table_name"].(string)
+	format, _ := inFields["format"].(string)
+	keyColumn, _ := inFields["key_column"].(string)
+	truncateBeforeInsert, _ := inFields["truncate_before_insert"].(bool)
+
+	batchSize := importBatchSize
+	if inFields["batch_size"] != nil {
+		size, err := strconv.Atoi(fmt.Sprintf("%v", inFields["batch_size"]))
+		if err != nil || size < 1 {
+			return nil, nil, []error{fmt.Errorf("batch_size should be a positive number, found [%v]", inFields["batch_size"])}
+		}
+		batchSize = size
+	}
+
+	var userId *int64
+	if user, ok := inFields["user"].(map[string]interface{}); ok {
+		userReferenceId, _ := user["reference_id"].(string)
+		userIdInt, err := d.cruds[USER_ACCOUNT_TABLE_NAME].GetReferenceIdToId(USER_ACCOUNT_TABLE_NAME, userReferenceId)
 		if err != nil {
 			log.Errorf("Failed to get user id from user reference id: %v", err)
+		} else {
+			userId = &userIdInt
 		}
 	}
 
-	files := inFields["dump_file"].([]interface{})
-
-	truncate_before_insert := inFields["truncate_before_insert"].(bool)
-	//execute_middleware_chain := inFields["execute_middleware_chain"].(bool)
-
-	imports := make(map[string][]interface{})
-
+	sources := make([]importSource, 0)
+	files, _ := inFields["dump_file"].([]interface{})
 	for _, fileInterface := range files {
-		file := fileInterface.(map[string]interface{})
-
-		fileName := file["name"].(string)
-		fileContentsBase64 := file["file"].(string)
-		fileBytes, err := base64.StdEncoding.DecodeString(strings.Split(fileContentsBase64, ",")[1])
+		file, ok := fileInterface.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fileName, _ := file["name"].(string)
+		fileContentsBase64, _ := file["file"].(string)
+		if i := strings.Index(fileContentsBase64, ","); i > -1 {
+			fileContentsBase64 = fileContentsBase64[i+1:]
+		}
+		sources = append(sources, importSource{
+			name:   fileName,
+			reader: base64.NewDecoder(base64.StdEncoding, strings.NewReader(fileContentsBase64)),
+		})
+	}
 
+	if cloudStoreName, _ := inFields["cloud_store_name"].(string); cloudStoreName != "" {
+		filePath, _ := inFields["path"].(string)
+		filePath, err := cloudStoreFilePath(filePath)
 		if err != nil {
-			log.Errorf("Failed to read file contents as base64 encoded: %v", err)
-			continue
+			return nil, nil, []error{err}
+		}
+		cloudStore, err := d.cruds["cloud_store"].GetCloudStoreByName(cloudStoreName)
+		if err != nil {
+			return nil, nil, []error{err}
+		}
+		if cloudStore.Name == "" {
+			return nil, nil, []error{fmt.Errorf("no cloud store named [%v]", cloudStoreName)}
+		}
+		object, err := d.cruds["cloud_store"].OpenCloudStoreObject(context.Background(), cloudStore, "", filePath)
+		if err != nil {
+			return nil, nil, []error{err}
 		}
+		defer object.Close()
+		sources = append(sources, importSource{
+			name:   filePath,
+			reader: object,
+		})
+	}
 
-		log.Printf("Processing file: %v", fileName)
+	if len(sources) == 0 {
+		return nil, nil, []error{fmt.Errorf("dump_file or cloud_store_name and path are required")}
+	}
 
-		var jsonData map[string]interface{}
+	dataImport := &dataImport{
+		cruds:     d.cruds,
+		keyColumn: keyColumn,
+		batchSize: batchSize,
+		truncate:  truncateBeforeInsert,
+		truncated: make(map[string]bool),
+		skipped:   make(map[string]bool),
+		userId:    userId,
+	}
 
-		err = json.Unmarshal(fileBytes, &jsonData)
-		if err != nil {
-			log.Errorf("Failed to read data as list: %v", err)
-			continue
+	for _, source := range sources {
+		sourceFormat := format
+		if sourceFormat == "" {
+			sourceFormat = DataFormatOfFileName(source.name)
+		}
+		if sourceFormat == "" {
+			sourceFormat = DataFormatJson
+		}
+		if sourceFormat != DataFormatJson && tableName == "" {
+			return nil, nil, []error{fmt.Errorf("table_name is required to import %v", sourceFormat)}
 		}
 
-		if isSubjected {
-			//log.Printf("Subject isntance: %v", subjectInstance)
-			//subjectInstanceMap := subjectInstance.(map[string]interface{})
-			subjectTableName := tableName.(string)
+		log.Printf("Processing file: %v", source.name)
+		err := ReadDataRows(sourceFormat, source.reader, tableName, dataImport.importRow)
+		if err == nil {
+			err = dataImport.commit()
+		}
+		if err != nil {
+			dataImport.rollback()
+			log.Errorf("Failed to import [%v] after %d rows: %v", source.name, dataImport.inserted+dataImport.updated, err)
+			return nil, []ActionResponse{
+				NewActionResponse("client.notify", NewClientNotification("error",
+					fmt.Sprintf("Imported %d rows and updated %d before failing on [%v]: %v",
+						dataImport.inserted, dataImport.updated, source.name, err), "Import")),
+			}, []error{err}
+		}
+	}
 
-			_, ok := imports[subjectTableName]
-			if !ok {
-				arr := make([]interface{}, 0)
-				imports[subjectTableName] = arr
-			}
-			imports[subjectTableName] = append(imports[subjectTableName], jsonData[subjectTableName])
-		} else {
-			for tableName, val := range jsonData {
+	return nil, []ActionResponse{
+		NewActionResponse("client.notify", NewClientNotification("success",
+			fmt.Sprintf("Imported %d rows and updated %d", dataImport.inserted, dataImport.updated), "Import")),
+	}, nil
+}
 
-				_, ok := imports[tableName]
-				if !ok {
-					arr := make([]interface{}, 0)
-					imports[tableName] = arr
-				}
-				imports[tableName] = append(imports[tableName], val)
+// dataImport writes the rows read from the files, in transactions of batchSize rows. The counts are of the rows of
+// committed transactions
+type dataImport struct {
+	cruds     map[string]*DbResource
+	keyColumn string
+	batchSize int
+	truncate  bool
+	truncated map[string]bool
+	skipped   map[string]bool
+	userId    *int64
+
+	transaction      *sqlx.Tx
+	transactionCruds map[string]*DbResource
+	pending          int
+	pendingInserted  int
+	inserted         int
+	updated          int
+}
 
-			}
+func (di *dataImport) importRow(tableName string, row map[string]interface{}) error {
 
+	dbResource, ok := di.cruds[tableName]
+	if !ok {
+		if !di.skipped[tableName] {
+			log.Errorf("Skipping the rows of [%v], no such table", tableName)
+			di.skipped[tableName] = true
 		}
-
+		return nil
 	}
+	tableInfo := dbResource.TableInfo()
 
-	for tableName, importedDatas := range imports {
-
-		if truncate_before_insert {
+	if di.transaction == nil {
+		transaction, err := di.cruds["world"].connection.Beginx()
+		if err != nil {
+			return err
+		}
+		di.transaction = transaction
+		di.transactionCruds = NewCrudsWithTransaction(di.cruds, transaction)
+	}
+	txResource := di.transactionCruds[tableName]
 
-			instance, ok := d.cruds[tableName]
+	if di.truncate && !di.truncated[tableName] {
+		err := txResource.TruncateTable(tableName, false)
+		if err != nil {
+			return fmt.Errorf("failed to truncate [%v] before importing data: %v", tableName, err)
+		}
+		di.truncated[tableName] = true
+	}
 
-			if !ok {
-				log.Printf("Wanted to truncate table, but no instance yet: %v", tableName)
-				d.cruds["world"].TruncateTable(tableName, false)
-				continue
-			}
+	if row["reference_id"] == nil {
+		u, _ := uuid.NewV4()
+		row["reference_id"] = u.String()
+	}
+	if _, ok := tableInfo.GetColumnByName(USER_ACCOUNT_ID_COLUMN); ok && row[USER_ACCOUNT_ID_COLUMN] == nil && di.userId != nil {
+		row[USER_ACCOUNT_ID_COLUMN] = *di.userId
+	}
 
-			err := instance.TruncateTable(tableName, false)
-			if err != nil {
-				log.Errorf("Failed to truncate table before importing data: %v", err)
-			}
+	if di.keyColumn != "" {
+		if _, ok := tableInfo.GetColumnByName(di.keyColumn); !ok {
+			return fmt.Errorf("no column [%v] in [%v]", di.keyColumn, tableName)
 		}
+		inserted, err := txResource.DirectUpsert(tableName, di.keyColumn, row)
+		if err != nil {
+			return err
+		}
+		if inserted {
+			di.pendingInserted++
+		}
+	} else {
+		err := txResource.DirectInsert(tableName, row)
+		if err != nil {
+			return err
+		}
+		di.pendingInserted++
+	}
 
-		for _, importedData := range importedDatas {
-			dataAsArray, ok := importedData.([]interface{})
-			if !ok {
-				log.Errorf("Data for [%v] in invalid format", tableName)
-				continue
-			}
-
-			for _, row := range dataAsArray {
-				data := row.(map[string]interface{})
+	di.pending++
+	if di.pending >= di.batchSize {
+		return di.commit()
+	}
+	return nil
+}
 
-				if isUserPresent {
-					data[USER_ACCOUNT_TABLE_NAME] = userIdInt
-				}
+// commit commits the rows written since the last commit
+func (di *dataImport) commit() error {
+	if di.transaction == nil {
+		return nil
+	}
+	err := di.transaction.Commit()
+	if err == nil {
+		RunAfterCommit(di.transactionCruds)
+	}
+	di.transaction = nil
+	di.transactionCruds = nil
+	if err != nil {
+		return err
+	}
+	di.inserted += di.pendingInserted
+	di.updated += di.pending - di.pendingInserted
+	di.pending = 0
+	di.pendingInserted = 0
+	return nil
+}
 
-				err := d.cruds[tableName].DirectInsert(tableName, data)
-				if err != nil {
-					log.Errorf("Was about to insert this: %v", data)
-					log.Errorf("Failed to direct insert into table [%v] : %v", tableName, err)
-				}
-			}
-		}
+// rollback drops the rows written since the last commit
+func (di *dataImport) rollback() {
+	if di.transaction == nil {
+		return
 	}
-	return nil, responses, nil
+	err := di.transaction.Rollback()
+	CheckErr(err, "Failed to rollback the import batch")
+	di.transaction = nil
+	di.transactionCruds = nil
+	di.pending = 0
+	di.pendingInserted = 0
 }
 
 func NewImportDataPerformer(initConfig *CmsConfig, cruds map[string]*DbResource) (ActionPerformerInterface, error) {
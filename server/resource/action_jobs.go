@@ -0,0 +1,397 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/artpar/api2go"
+	"github.com/buraksezer/olric"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/doug-martin/goqu/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// ActionJobTableName is the table asynchronous action requests are queued in
+const ActionJobTableName = "action_job"
+
+// Statuses of a queued action request
+const (
+	ActionJobQueued    = "queued"
+	ActionJobRunning   = "running"
+	ActionJobCompleted = "completed"
+	ActionJobFailed    = "failed"
+)
+
+// A running job refreshes its updated_at every actionJobHeartbeat, a running job which was not refreshed for
+// actionJobStaleAfter was left by a node which is gone
+const (
+	actionJobHeartbeat  = 30 * time.Second
+	actionJobStaleAfter = 4 * actionJobHeartbeat
+)
+
+// ActionProgressReporter is told how many outcomes of an action are done, it is put in the context of the action
+// request as "action_progress"
+type ActionProgressReporter func(done int, total int, message string)
+
+// reportActionProgress tells the reporter of the action request, if there is one, how far the action is
+func reportActionProgress(req api2go.Request, done int, total int, message string) {
+	reporter, ok := req.PlainRequest.Context().Value("action_progress").(ActionProgressReporter)
+	if !ok {
+		return
+	}
+	reporter(done, total, message)
+}
+
+// ActionJobQueue runs action requests in the background. Jobs are stored in the action_job table, so the ones still
+// queued when the server stops are run when it starts again. Every change of a job is published on the action_job
+// topic, which the owner of the job can subscribe to on /live
+type ActionJobQueue struct {
+	cruds   map[string]*DbResource
+	workers int
+	jobs    chan string
+	topic   *olric.DTopic
+}
+
+func NewActionJobQueue(cruds map[string]*DbResource, workers int) *ActionJobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	queue := &ActionJobQueue{
+		cruds:   cruds,
+		workers: workers,
+		jobs:    make(chan string, 1024),
+	}
+	if olricDb := cruds["world"].OlricDb; olricDb != nil {
+		topic, err := olricDb.NewDTopic(ActionJobTableName, 4, 1)
+		CheckErr(err, "Failed to open the action job topic")
+		queue.topic = topic
+	}
+	return queue
+}
+
+// Enqueue stores the action request as a job of the user and returns the reference id of the job
+func (q *ActionJobQueue) Enqueue(actionRequest ActionRequest, sessionUser *auth.SessionUser) (string, error) {
+
+	if sessionUser == nil || sessionUser.UserId == 0 {
+		return "", errors.New("asynchronous actions need a signed in user")
+	}
+
+	pr := &http.Request{
+		Method: "POST",
+	}
+	pr = pr.WithContext(context.WithValue(context.Background(), "user", sessionUser))
+	req := api2go.Request{
+		PlainRequest: pr,
+	}
+
+	job, err := q.cruds[ActionJobTableName].CreateWithoutFilter(api2go.NewApi2GoModelWithData(ActionJobTableName, nil, 0, nil, map[string]interface{}{
+		"action_name":    actionRequest.Action,
+		"on_type":        actionRequest.Type,
+		"status":         ActionJobQueued,
+		"progress":       0,
+		"action_request": toJson(actionRequest),
+	}), req)
+	if err != nil {
+		return "", err
+	}
+
+	referenceId := job["reference_id"].(string)
+	q.publish(referenceId, sessionUser.UserReferenceId, map[string]interface{}{
+		"action_name": actionRequest.Action,
+		"on_type":     actionRequest.Type,
+		"status":      ActionJobQueued,
+		"progress":    0,
+	})
+	go func() {
+		q.jobs <- referenceId
+	}()
+	return referenceId, nil
+}
+
+// Start runs the workers. Jobs left running by a node which is gone are marked failed, since their outcomes may have
+// been partly applied, and the queued ones are run again. Every node runs the queued jobs, a job is run by the node
+// which claims it first
+func (q *ActionJobQueue) Start() {
+
+	dbResource := q.cruds[ActionJobTableName]
+	q.failStaleJobs()
+	go func() {
+		for range time.Tick(actionJobStaleAfter) {
+			q.failStaleJobs()
+		}
+	}()
+
+	queued, err := dbResource.getActionJobsByStatus(ActionJobQueued)
+	CheckErr(err, "Failed to list queued action jobs")
+	if len(queued) > 0 {
+		log.Infof("Resuming %d queued action jobs", len(queued))
+	}
+
+	for i := 0; i < q.workers; i++ {
+		go func() {
+			for referenceId := range q.jobs {
+				q.run(referenceId)
+			}
+		}()
+	}
+
+	go func() {
+		for _, referenceId := range queued {
+			q.jobs <- referenceId
+		}
+	}()
+}
+
+// failStaleJobs marks failed the running jobs whose node stopped refreshing them
+func (q *ActionJobQueue) failStaleJobs() {
+
+	dbResource := q.cruds[ActionJobTableName]
+	staleBefore := time.Now().Add(-actionJobStaleAfter)
+	interrupted, err := dbResource.getStaleActionJobs(staleBefore)
+	CheckErr(err, "Failed to list interrupted action jobs")
+	for _, referenceId := range interrupted {
+		failed, err := dbResource.failStaleActionJob(referenceId, staleBefore)
+		if err != nil {
+			log.Errorf("Failed to mark interrupted action job [%v] failed: %v", referenceId, err)
+			continue
+		}
+		if failed {
+			log.Infof("Action job [%v] was interrupted, its node stopped while the job was running", referenceId)
+		}
+	}
+}
+
+// run executes the job as the user who queued it and stores the responses or the error it finished with
+func (q *ActionJobQueue) run(referenceId string) {
+
+	dbResource := q.cruds[ActionJobTableName]
+	job, _, err := dbResource.GetSingleRowByReferenceId(ActionJobTableName, referenceId, nil)
+	if err != nil {
+		log.Errorf("Failed to load action job [%v]: %v", referenceId, err)
+		return
+	}
+	if job["status"] != ActionJobQueued {
+		return
+	}
+	userReferenceId, _ := job[USER_ACCOUNT_ID_COLUMN].(string)
+
+	startedAt := time.Now()
+	claimed, err := dbResource.claimActionJob(referenceId, startedAt)
+	if err != nil {
+		log.Errorf("Failed to claim action job [%v]: %v", referenceId, err)
+		return
+	}
+	if !claimed {
+		// another node is running the job
+		return
+	}
+	q.publish(referenceId, userReferenceId, map[string]interface{}{
+		"status":     ActionJobRunning,
+		"started_at": startedAt,
+	})
+
+	heartbeat := time.NewTicker(actionJobHeartbeat)
+	defer heartbeat.Stop()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-heartbeat.C:
+				err := dbResource.updateActionJob(referenceId, nil)
+				CheckErr(err, "Failed to refresh running action job [%v]", referenceId)
+			}
+		}
+	}()
+
+	update := func(changes map[string]interface{}) {
+		err := dbResource.updateActionJob(referenceId, changes)
+		CheckErr(err, "Failed to update action job [%v]", referenceId)
+		q.publish(referenceId, userReferenceId, changes)
+	}
+
+	var actionRequest ActionRequest
+	err = json.Unmarshal([]byte(toJson(job["action_request"])), &actionRequest)
+	if err != nil {
+		update(map[string]interface{}{
+			"status":      ActionJobFailed,
+			"error":       "invalid action request: " + err.Error(),
+			"finished_at": time.Now(),
+		})
+		return
+	}
+
+	sessionUser := &auth.SessionUser{}
+	if userReferenceId != "" {
+		user, err := dbResource.GetReferenceIdToObject(USER_ACCOUNT_TABLE_NAME, userReferenceId)
+		if err == nil {
+			sessionUser.UserReferenceId = userReferenceId
+			sessionUser.UserId, _ = user["id"].(int64)
+			sessionUser.Groups = dbResource.GetObjectUserGroupsByWhere(USER_ACCOUNT_TABLE_NAME, "reference_id", userReferenceId)
+		}
+	}
+
+	var reporter ActionProgressReporter = func(done int, total int, message string) {
+		update(map[string]interface{}{
+			"progress":         done * 100 / total,
+			"progress_message": message,
+		})
+	}
+	ctx := context.WithValue(context.Background(), "user", sessionUser)
+	ctx = context.WithValue(ctx, "action_progress", reporter)
+	pr := &http.Request{
+		Method: "POST",
+	}
+	req := api2go.Request{
+		PlainRequest: pr.WithContext(ctx),
+	}
+
+	actionCrudResource, ok := q.cruds[actionRequest.Type]
+	if !ok {
+		actionCrudResource = q.cruds["world"]
+	}
+	responses, err := q.handle(actionCrudResource, actionRequest, req)
+
+	if err != nil {
+		log.Errorf("Action job [%v] for [%v][%v] failed: %v", referenceId, actionRequest.Type, actionRequest.Action, err)
+		update(map[string]interface{}{
+			"status":      ActionJobFailed,
+			"responses":   toJson(responses),
+			"error":       err.Error(),
+			"finished_at": time.Now(),
+		})
+		return
+	}
+	update(map[string]interface{}{
+		"status":      ActionJobCompleted,
+		"progress":    100,
+		"responses":   toJson(responses),
+		"finished_at": time.Now(),
+	})
+}
+
+// handle runs the action, a panic in an outcome fails the job instead of stopping the worker
+func (q *ActionJobQueue) handle(dbResource *DbResource, actionRequest ActionRequest, req api2go.Request) (responses []ActionResponse, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("action panicked: %v", r)
+		}
+	}()
+	return dbResource.HandleActionRequest(actionRequest, req)
+}
+
+// publish sends the changes of a job to the subscribers of the action_job topic
+func (q *ActionJobQueue) publish(referenceId string, userReferenceId string, changes map[string]interface{}) {
+	if q.topic == nil {
+		return
+	}
+	eventData := map[string]interface{}{
+		"__type":               ActionJobTableName,
+		"reference_id":         referenceId,
+		USER_ACCOUNT_ID_COLUMN: userReferenceId,
+	}
+	for key, value := range changes {
+		eventData[key] = value
+	}
+	err := q.topic.Publish(EventMessage{
+		MessageSource: "action",
+		EventType:     "update",
+		ObjectType:    ActionJobTableName,
+		EventData:     eventData,
+	})
+	CheckErr(err, "Failed to publish action job [%v]", referenceId)
+}
+
+func (dr *DbResource) updateActionJob(referenceId string, changes map[string]interface{}) error {
+
+	record := goqu.Record{
+		"updated_at": time.Now(),
+	}
+	for key, value := range changes {
+		record[key] = value
+	}
+	query, args, err := statementbuilder.Squirrel.Update(ActionJobTableName).Prepared(true).
+		Set(record).Where(goqu.Ex{"reference_id": referenceId}).ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = dr.db.Exec(query, args...)
+	return err
+}
+
+// claimActionJob moves a queued job to running, it is false when another node claimed the job first
+func (dr *DbResource) claimActionJob(referenceId string, startedAt time.Time) (bool, error) {
+
+	query, args, err := statementbuilder.Squirrel.Update(ActionJobTableName).Prepared(true).
+		Set(goqu.Record{
+			"status":     ActionJobRunning,
+			"started_at": startedAt,
+			"updated_at": startedAt,
+		}).Where(goqu.Ex{"reference_id": referenceId, "status": ActionJobQueued}).ToSQL()
+	if err != nil {
+		return false, err
+	}
+
+	result, err := dr.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated == 1, err
+}
+
+// failStaleActionJob marks a running job failed, unless it was refreshed since staleBefore
+func (dr *DbResource) failStaleActionJob(referenceId string, staleBefore time.Time) (bool, error) {
+
+	query, args, err := statementbuilder.Squirrel.Update(ActionJobTableName).Prepared(true).
+		Set(goqu.Record{
+			"status":      ActionJobFailed,
+			"error":       "the node running the job stopped",
+			"finished_at": time.Now(),
+			"updated_at":  time.Now(),
+		}).Where(goqu.Ex{"reference_id": referenceId, "status": ActionJobRunning}, goqu.C("updated_at").Lt(staleBefore)).
+		ToSQL()
+	if err != nil {
+		return false, err
+	}
+
+	result, err := dr.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated == 1, err
+}
+
+func (dr *DbResource) getStaleActionJobs(staleBefore time.Time) ([]string, error) {
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("reference_id")).From(ActionJobTableName).
+		Where(goqu.Ex{"status": ActionJobRunning}, goqu.C("updated_at").Lt(staleBefore)).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	referenceIds := make([]string, 0)
+	err = dr.connection.Select(&referenceIds, query, args...)
+	return referenceIds, err
+}
+
+func (dr *DbResource) getActionJobsByStatus(status string) ([]string, error) {
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("reference_id")).From(ActionJobTableName).
+		Where(goqu.Ex{"status": status}).Order(goqu.C("id").Asc()).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	referenceIds := make([]string, 0)
+	err = dr.connection.Select(&referenceIds, query, args...)
+	return referenceIds, err
+}
@@ -0,0 +1,36 @@
+package resource
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/artpar/api2go"
+)
+
+func TestReportActionProgress(t *testing.T) {
+
+	request := func(ctx context.Context) api2go.Request {
+		pr := &http.Request{Method: "POST"}
+		return api2go.Request{PlainRequest: pr.WithContext(ctx)}
+	}
+
+	// actions run over http have no reporter
+	reportActionProgress(request(context.Background()), 1, 2, "POST book")
+
+	reported := make([]int, 0)
+	var reporter ActionProgressReporter = func(done int, total int, message string) {
+		if total != 2 {
+			t.Errorf("Expected 2 outcomes, found %v", total)
+		}
+		reported = append(reported, done)
+	}
+	ctx := context.WithValue(context.Background(), "action_progress", reporter)
+
+	reportActionProgress(request(ctx), 1, 2, "POST book")
+	reportActionProgress(request(ctx), 2, 2, "EXECUTE mail.send")
+
+	if len(reported) != 2 || reported[0] != 1 || reported[1] != 2 {
+		t.Errorf("Unexpected progress %v", reported)
+	}
+}
@@ -0,0 +1,100 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/artpar/api2go"
+	log "github.com/sirupsen/logrus"
+)
+
+type mfaVerifyActionPerformer struct {
+	cruds            map[string]*DbResource
+	secondFactor     *secondFactor
+	encryptionSecret []byte
+}
+
+func (d *mfaVerifyActionPerformer) Name() string {
+	return "mfa.verify"
+}
+
+// DoAction finishes the sign in of a user with an mfa pending token, with a code of their otp account or one of
+// their recovery codes
+func (d *mfaVerifyActionPerformer) DoAction(request Outcome, inFieldMap map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	pendingToken, _ := inFieldMap["mfa_token"].(string)
+	user, err := d.secondFactor.pendingUser(pendingToken)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	userId, _ := user["id"].(int64)
+
+	if secondFactorLocked(user) {
+		return nil, nil, []error{errors.New("too many failed attempts, try again later")}
+	}
+
+	otpCode := ""
+	if inFieldMap["otp"] != nil {
+		otpCode = fmt.Sprintf("%v", inFieldMap["otp"])
+	}
+	recoveryCode, _ := inFieldMap["recovery_code"].(string)
+
+	verified := false
+	switch {
+	case otpCode != "":
+		if d.secondFactor.pendingFirstFactor(pendingToken) == SecondFactorOtp {
+			return nil, nil, []error{errors.New("the sign in started with an otp, present another second factor")}
+		}
+		otpAccount, err := d.cruds["user_otp_account"].GetObjectByWhereClause("user_otp_account", "otp_of_account", userId)
+		if err != nil {
+			return nil, nil, []error{errors.New("no otp account is set up")}
+		}
+		switch fmt.Sprintf("%v", otpAccount["verified"]) {
+		case "1", "true":
+		default:
+			return nil, nil, []error{errors.New("no otp account is set up")}
+		}
+		otpSecret, _ := otpAccount["otp_secret"].(string)
+		key, err := Decrypt(d.encryptionSecret, otpSecret)
+		if err != nil {
+			log.Errorf("Failed to decrypt the otp secret of [%v]: %v", user["email"], err)
+			return nil, nil, []error{errors.New("invalid code")}
+		}
+		verified = verifyTotp(otpCode, key)
+	case recoveryCode != "":
+		verified, err = d.cruds[RecoveryCodeTableName].RedeemRecoveryCode(userId, recoveryCode)
+		if err != nil {
+			log.Errorf("Failed to redeem a recovery code of [%v]: %v", user["email"], err)
+			return nil, nil, []error{errors.New("invalid code")}
+		}
+	default:
+		return nil, nil, []error{errors.New("otp or recovery_code is required")}
+	}
+
+	if !verified {
+		log.Warnf("Invalid second factor for [%v]", user["email"])
+		recordSecondFactorFailure(user)
+		return nil, nil, []error{errors.New("invalid code")}
+	}
+
+	responses, errs := d.secondFactor.signIn(user)
+	return nil, responses, errs
+}
+
+func NewMfaVerifyActionPerformer(cruds map[string]*DbResource, configStore *ConfigStore) (ActionPerformerInterface, error) {
+
+	encryptionSecret, _ := configStore.GetConfigValueFor("encryption.secret", "backend")
+
+	secondFactor, err := newSecondFactor(configStore, cruds)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := mfaVerifyActionPerformer{
+		cruds:            cruds,
+		secondFactor:     secondFactor,
+		encryptionSecret: []byte(encryptionSecret),
+	}
+
+	return &handler, nil
+}
@@ -13,8 +13,6 @@ import (
 
 	//"golang.org/x/oauth2"
 	"github.com/artpar/api2go"
-	"github.com/pquerna/otp"
-	"github.com/pquerna/otp/totp"
 	"time"
 )
 
@@ -28,6 +26,7 @@ type otpLoginVerifyActionPerformer struct {
 	otpKey           string
 	secret           []byte
 	totpSecret       string
+	secondFactor     *secondFactor
 }
 
 func (d *otpLoginVerifyActionPerformer) Name() string {
@@ -76,13 +75,7 @@ func (d *otpLoginVerifyActionPerformer) DoAction(request Outcome, inFieldMap map
 
 	key, _ := Decrypt(d.encryptionSecret, userOtpProfile["otp_secret"].(string))
 
-	ok, err = totp.ValidateCustom(state, key, time.Now().UTC(), totp.ValidateOpts{
-		Period:    300,
-		Skew:      1,
-		Digits:    4,
-		Algorithm: otp.AlgorithmSHA1,
-	})
-	if !ok {
+	if !verifyTotp(state, key) {
 		log.Errorf("Failed to validate otp key")
 		return nil, nil, []error{errors.New("Invalid OTP")}
 	}
@@ -124,6 +117,31 @@ func (d *otpLoginVerifyActionPerformer) DoAction(request Outcome, inFieldMap map
 
 	} else {
 
+		// the otp is the only factor of this sign in, users who have to present a second factor still present one
+		// other than the otp
+		userId, _ := userAccount["id"].(int64)
+		required, factors, err := d.cruds[USER_ACCOUNT_TABLE_NAME].RequiresSecondFactor(userId)
+		if err != nil {
+			log.Errorf("Failed to check the second factors of [%v]: %v", userAccount["email"], err)
+			return nil, nil, []error{err}
+		}
+		if required {
+			if d.secondFactor == nil {
+				return nil, nil, []error{fmt.Errorf("second factors are not set up")}
+			}
+			otherFactors := make([]string, 0)
+			for _, factor := range factors {
+				if factor != SecondFactorOtp {
+					otherFactors = append(otherFactors, factor)
+				}
+			}
+			pendingResponses, err := d.secondFactor.pendingResponses(userAccount, otherFactors, SecondFactorOtp)
+			if err != nil {
+				return nil, nil, []error{err}
+			}
+			return nil, pendingResponses, nil
+		}
+
 		u, _ := uuid.NewV4()
 		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 			"email":   userAccount["email"],
@@ -191,8 +209,12 @@ func NewOtpLoginVerifyActionPerformer(cruds map[string]*DbResource, configStore
 		err = configStore.SetConfigValueFor("jwt.token.issuer", jwtTokenIssuer, "backend")
 	}
 
+	secondFactor, err := newSecondFactor(configStore, cruds)
+	CheckErr(err, "Failed to set up second factors, users who need one cannot sign in with an otp")
+
 	handler := otpLoginVerifyActionPerformer{
 		cruds:            cruds,
+		secondFactor:     secondFactor,
 		tokenLifeTime:    tokenLifeTimeHours,
 		configStore:      configStore,
 		encryptionSecret: []byte(encryptionSecret),
@@ -0,0 +1,76 @@
+package resource
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/artpar/api2go"
+	log "github.com/sirupsen/logrus"
+)
+
+type pruneAuditLogActionPerformer struct {
+	cruds       map[string]*DbResource
+	configStore *ConfigStore
+}
+
+func (d *pruneAuditLogActionPerformer) Name() string {
+	return "audit.prune"
+}
+
+// retentionDays is how many days the audit rows of the table are kept, audit.retention_days.<table> overrides
+// audit.retention_days and 0 keeps them forever
+func (d *pruneAuditLogActionPerformer) retentionDays(tableName string) int {
+	days, err := d.configStore.GetConfigIntValueFor("audit.retention_days."+tableName, "backend")
+	if err == nil {
+		return days
+	}
+	days, err = d.configStore.GetConfigIntValueFor("audit.retention_days", "backend")
+	if err != nil {
+		days = 0
+		err = d.configStore.SetConfigIntValueFor("audit.retention_days", days, "backend")
+		CheckErr(err, "Failed to store default audit retention days")
+	}
+	return days
+}
+
+// DoAction deletes the audit rows older than the retention period of their table
+func (d *pruneAuditLogActionPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	errorList := make([]error, 0)
+	var pruned int64
+	for tableName, dbResource := range d.cruds {
+		if dbResource.TableInfo() == nil || !dbResource.TableInfo().IsAuditEnabled {
+			continue
+		}
+		days := d.retentionDays(tableName)
+		if days < 1 {
+			continue
+		}
+
+		count, err := dbResource.PruneAuditRows(time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			log.Errorf("Failed to prune audit rows of [%v]: %v", tableName, err)
+			errorList = append(errorList, err)
+			continue
+		}
+		if count > 0 {
+			log.Infof("Pruned %d audit rows of [%v] older than %d days", count, tableName, days)
+		}
+		pruned += count
+	}
+
+	return nil, []ActionResponse{
+		NewActionResponse("client.notify", NewClientNotification("message",
+			fmt.Sprintf("Pruned %d audit rows", pruned), "Success")),
+	}, errorList
+}
+
+func NewPruneAuditLogActionPerformer(cruds map[string]*DbResource, configStore *ConfigStore) (ActionPerformerInterface, error) {
+
+	handler := pruneAuditLogActionPerformer{
+		cruds:       cruds,
+		configStore: configStore,
+	}
+
+	return &handler, nil
+}
@@ -0,0 +1,57 @@
+package resource
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/artpar/api2go"
+	log "github.com/sirupsen/logrus"
+)
+
+type pruneServerFunctionLogActionPerformer struct {
+	cruds       map[string]*DbResource
+	configStore *ConfigStore
+}
+
+func (d *pruneServerFunctionLogActionPerformer) Name() string {
+	return "server_function_log.prune"
+}
+
+// DoAction deletes the lines logged by server functions before server_function.log_retention_days, 0 keeps them
+// forever
+func (d *pruneServerFunctionLogActionPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	days, err := d.configStore.GetConfigIntValueFor("server_function.log_retention_days", "backend")
+	if err != nil {
+		days = 30
+		err = d.configStore.SetConfigIntValueFor("server_function.log_retention_days", days, "backend")
+		CheckErr(err, "Failed to store default server function log retention days")
+	}
+	if days < 1 {
+		return nil, []ActionResponse{}, nil
+	}
+
+	pruned, err := d.cruds[ServerFunctionLogTableName].PruneServerFunctionLogs(time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		log.Errorf("Failed to prune server function logs: %v", err)
+		return nil, nil, []error{err}
+	}
+	if pruned > 0 {
+		log.Infof("Pruned %d server function log lines older than %d days", pruned, days)
+	}
+
+	return nil, []ActionResponse{
+		NewActionResponse("client.notify", NewClientNotification("message",
+			fmt.Sprintf("Pruned %d server function log lines", pruned), "Success")),
+	}, nil
+}
+
+func NewPruneServerFunctionLogActionPerformer(cruds map[string]*DbResource, configStore *ConfigStore) (ActionPerformerInterface, error) {
+
+	handler := pruneServerFunctionLogActionPerformer{
+		cruds:       cruds,
+		configStore: configStore,
+	}
+
+	return &handler, nil
+}
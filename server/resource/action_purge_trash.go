@@ -0,0 +1,97 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/artpar/api2go"
+	log "github.com/sirupsen/logrus"
+)
+
+type purgeTrashActionPerformer struct {
+	cruds       map[string]*DbResource
+	configStore *ConfigStore
+}
+
+func (d *purgeTrashActionPerformer) Name() string {
+	return "trash.purge"
+}
+
+// retentionDays is how many days rows stay in the trash of the table, trash.retention_days.<table> overrides
+// trash.retention_days and 0 keeps them until they are deleted from the trash
+func (d *purgeTrashActionPerformer) retentionDays(tableName string) int {
+	days, err := d.configStore.GetConfigIntValueFor("trash.retention_days."+tableName, "backend")
+	if err == nil {
+		return days
+	}
+	days, err = d.configStore.GetConfigIntValueFor("trash.retention_days", "backend")
+	if err != nil {
+		days = 30
+		err = d.configStore.SetConfigIntValueFor("trash.retention_days", days, "backend")
+		CheckErr(err, "Failed to store default trash retention days")
+	}
+	return days
+}
+
+// DoAction deletes the rows which have been in the trash for longer than the retention period of their table
+func (d *purgeTrashActionPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	httpRequest := &http.Request{
+		Method: "DELETE",
+	}
+	httpRequest = httpRequest.WithContext(context.WithValue(context.Background(), "user", request.Attributes["user"]))
+	req := api2go.Request{
+		PlainRequest: httpRequest,
+	}
+
+	errorList := make([]error, 0)
+	purged := 0
+	for tableName, dbResource := range d.cruds {
+		if dbResource.TableInfo() == nil || !dbResource.TableInfo().SoftDeleteEnabled {
+			continue
+		}
+		days := d.retentionDays(tableName)
+		if days < 1 {
+			continue
+		}
+
+		referenceIds, err := dbResource.GetTrashedBefore(time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			log.Errorf("Failed to list the trash of [%v]: %v", tableName, err)
+			errorList = append(errorList, err)
+			continue
+		}
+
+		tablePurged := 0
+		for _, referenceId := range referenceIds {
+			err = dbResource.DeleteWithoutFilters(referenceId, req)
+			if err != nil {
+				log.Errorf("Failed to purge [%v][%v] from the trash: %v", tableName, referenceId, err)
+				errorList = append(errorList, err)
+				continue
+			}
+			tablePurged++
+		}
+		if tablePurged > 0 {
+			log.Infof("Purged %d rows of [%v] trashed more than %d days ago", tablePurged, tableName, days)
+		}
+		purged += tablePurged
+	}
+
+	return nil, []ActionResponse{
+		NewActionResponse("client.notify", NewClientNotification("message",
+			fmt.Sprintf("Purged %d rows from the trash", purged), "Success")),
+	}, errorList
+}
+
+func NewPurgeTrashActionPerformer(cruds map[string]*DbResource, configStore *ConfigStore) (ActionPerformerInterface, error) {
+
+	handler := purgeTrashActionPerformer{
+		cruds:       cruds,
+		configStore: configStore,
+	}
+
+	return &handler, nil
+}
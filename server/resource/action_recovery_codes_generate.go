@@ -0,0 +1,113 @@
+package resource
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/doug-martin/goqu/v9"
+)
+
+type recoveryCodesGenerateActionPerformer struct {
+	secondFactor *secondFactor
+}
+
+func (d *recoveryCodesGenerateActionPerformer) Name() string {
+	return "mfa.recovery_codes.generate"
+}
+
+// DoAction replaces the recovery codes of the signed in user with new ones. The codes are only shown here, they are
+// stored as hashes
+func (d *recoveryCodesGenerateActionPerformer) DoAction(request Outcome, inFieldMap map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	sessionUser, ok := request.Attributes["user"].(*auth.SessionUser)
+	if !ok || sessionUser == nil || sessionUser.UserReferenceId == "" {
+		return nil, nil, []error{errors.New("sign in to generate recovery codes")}
+	}
+	user, err := d.secondFactor.cruds[USER_ACCOUNT_TABLE_NAME].GetReferenceIdToObject(USER_ACCOUNT_TABLE_NAME, sessionUser.UserReferenceId)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	// the old codes are replaced in one transaction, a failure keeps them usable
+	tx, err := d.secondFactor.cruds[RecoveryCodeTableName].connection.Beginx()
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	txSecondFactor := *d.secondFactor
+	txSecondFactor.cruds = NewCrudsWithTransaction(d.secondFactor.cruds, tx)
+
+	codes, err := txSecondFactor.replaceRecoveryCodes(user)
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		CheckErr(rollbackErr, "Failed to rollback the recovery codes of [%v]", user["email"])
+		return nil, nil, []error{err}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	RunAfterCommit(txSecondFactor.cruds)
+
+	responseAttrs := make(map[string]interface{})
+	responseAttrs["content"] = base64.StdEncoding.EncodeToString([]byte(strings.Join(codes, "\n") + "\n"))
+	responseAttrs["name"] = "daptin_recovery_codes.txt"
+	responseAttrs["contentType"] = "text/plain"
+	responseAttrs["message"] = "Downloading recovery codes"
+
+	return nil, []ActionResponse{
+		NewActionResponse("mfa.recovery_codes", map[string]interface{}{
+			"codes": codes,
+		}),
+		NewActionResponse("client.file.download", responseAttrs),
+		NewActionResponse("client.notify", NewClientNotification("success",
+			"Keep these codes somewhere safe, each can be used once to sign in without your second factor", "Recovery codes")),
+	}, nil
+}
+
+// replaceRecoveryCodes deletes the recovery codes of the user and stores new ones
+func (s *secondFactor) replaceRecoveryCodes(user map[string]interface{}) ([]string, error) {
+
+	query, args, err := statementbuilder.Squirrel.Delete(RecoveryCodeTableName).
+		Where(goqu.Ex{USER_ACCOUNT_ID_COLUMN: user["id"]}).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.cruds[RecoveryCodeTableName].db.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		err = s.createUserRow(RecoveryCodeTableName, user, map[string]interface{}{
+			"code_hash": hashRecoveryCode(code),
+		})
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+func NewRecoveryCodesGenerateActionPerformer(cruds map[string]*DbResource, configStore *ConfigStore) (ActionPerformerInterface, error) {
+
+	secondFactor, err := newSecondFactor(configStore, cruds)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := recoveryCodesGenerateActionPerformer{
+		secondFactor: secondFactor,
+	}
+
+	return &handler, nil
+}
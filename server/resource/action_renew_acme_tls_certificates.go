@@ -0,0 +1,33 @@
+package resource
+
+import (
+	"github.com/artpar/api2go"
+)
+
+type acmeTlsCertificateRenewActionPerformer struct {
+	certificateManager *CertificateManager
+}
+
+func (d *acmeTlsCertificateRenewActionPerformer) Name() string {
+	return "acme.tls.renew"
+}
+
+func (d *acmeTlsCertificateRenewActionPerformer) DoAction(request Outcome, inFieldMap map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	errs := d.certificateManager.RenewExpiringCertificates()
+	if len(errs) > 0 {
+		return nil, []ActionResponse{}, errs
+	}
+
+	return nil, []ActionResponse{}, nil
+}
+
+func NewAcmeTlsCertificateRenewActionPerformer(certificateManager *CertificateManager) (ActionPerformerInterface, error) {
+
+	handler := acmeTlsCertificateRenewActionPerformer{
+		certificateManager: certificateManager,
+	}
+
+	return &handler, nil
+
+}
@@ -0,0 +1,75 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+)
+
+type restoreFromTrashActionPerformer struct {
+	cruds map[string]*DbResource
+}
+
+func (d *restoreFromTrashActionPerformer) Name() string {
+	return "trash.restore"
+}
+
+// DoAction takes a row out of the trash of its table, the user needs to be allowed to update the row
+func (d *restoreFromTrashActionPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	tableName, _ := inFields["table_name"].(string)
+	referenceId, _ := inFields["reference_id"].(string)
+
+	dbResource, ok := d.cruds[tableName]
+	if !ok || dbResource.TableInfo() == nil || !dbResource.TableInfo().SoftDeleteEnabled {
+		return nil, nil, []error{fmt.Errorf("soft delete is not enabled for [%v]", tableName)}
+	}
+
+	row, err := dbResource.GetReferenceIdToObject(tableName, referenceId)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	if !IsTrashed(row) {
+		return nil, nil, []error{fmt.Errorf("[%v][%v] is not in the trash", tableName, referenceId)}
+	}
+
+	sessionUser, ok := request.Attributes["user"].(*auth.SessionUser)
+	if !ok {
+		sessionUser = &auth.SessionUser{}
+	}
+	if !dbResource.IsAdmin(sessionUser.UserReferenceId) && !d.cruds["world"].GetRowPermission(map[string]interface{}{
+		"__type":       tableName,
+		"reference_id": referenceId,
+	}).CanUpdate(sessionUser.UserReferenceId, sessionUser.Groups) {
+		return nil, nil, []error{errors.New("unauthorized")}
+	}
+
+	pr := &http.Request{
+		Method: "PATCH",
+	}
+	pr = pr.WithContext(context.WithValue(context.Background(), "user", sessionUser))
+	err = dbResource.RestoreFromTrash(referenceId, api2go.Request{
+		PlainRequest: pr,
+	})
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	return nil, []ActionResponse{
+		NewActionResponse("client.notify", NewClientNotification("message",
+			fmt.Sprintf("Restored [%v][%v] from the trash", tableName, referenceId), "Success")),
+	}, nil
+}
+
+func NewRestoreFromTrashActionPerformer(cruds map[string]*DbResource) (ActionPerformerInterface, error) {
+
+	handler := restoreFromTrashActionPerformer{
+		cruds: cruds,
+	}
+
+	return &handler, nil
+}
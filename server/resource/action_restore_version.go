@@ -0,0 +1,96 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	log "github.com/sirupsen/logrus"
+)
+
+type restoreVersionActionPerformer struct {
+	cruds map[string]*DbResource
+}
+
+func (d *restoreVersionActionPerformer) Name() string {
+	return "audit.version.restore"
+}
+
+// DoAction reverts an object to the values held in one of its audit rows. The object is updated, or created again
+// when it was deleted, as the user of the request so the permissions are checked and the restore is audited too.
+// Only administrators can create deleted objects again. Password and encrypted columns are left as they are
+func (d *restoreVersionActionPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	tableName, _ := inFields["table_name"].(string)
+	version, _ := inFields["version"].(string)
+
+	dbResource, ok := d.cruds[tableName]
+	if !ok || dbResource.TableInfo() == nil || !dbResource.TableInfo().IsAuditEnabled {
+		return nil, nil, []error{fmt.Errorf("audit is not enabled for [%v]", tableName)}
+	}
+
+	auditRow, err := dbResource.GetAuditRow(version)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	referenceId := valueToString(auditRow["source_reference_id"])
+	if referenceId == "" {
+		return nil, nil, []error{errors.New("the version is not linked to an object")}
+	}
+
+	values := make(map[string]interface{})
+	for _, column := range dbResource.AuditedColumns() {
+		if hiddenAuditColumnTypes[column.ColumnType] {
+			continue
+		}
+		values[column.ColumnName] = auditRow[column.ColumnName]
+	}
+	values["reference_id"] = referenceId
+
+	sessionUser, ok := request.Attributes["user"].(*auth.SessionUser)
+	if !ok {
+		sessionUser = &auth.SessionUser{}
+	}
+	httpRequest := &http.Request{
+		Method: "PATCH",
+	}
+	httpRequest = httpRequest.WithContext(context.WithValue(context.Background(), "user", sessionUser))
+	req := api2go.Request{
+		PlainRequest: httpRequest,
+	}
+
+	model := api2go.NewApi2GoModelWithData(tableName, nil, 0, nil, values)
+	_, err = dbResource.GetReferenceIdToId(tableName, referenceId)
+	if err == nil {
+		_, err = dbResource.Update(model, req)
+	} else {
+		// the history of a deleted object is only shown to administrators, the permission of the deleted row is
+		// not kept in the audit rows
+		if !dbResource.IsAdmin(sessionUser.UserReferenceId) {
+			return nil, nil, []error{api2go.NewHTTPError(nil, "only administrators can restore deleted objects", http.StatusForbidden)}
+		}
+		log.Infof("Object [%v][%v] was deleted, creating it again from version [%v]", tableName, referenceId, version)
+		httpRequest.Method = "POST"
+		_, err = dbResource.Create(model, req)
+	}
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	return nil, []ActionResponse{
+		NewActionResponse("client.notify", NewClientNotification("message",
+			fmt.Sprintf("Restored [%v][%v] to version [%v]", tableName, referenceId, version), "Success")),
+	}, nil
+}
+
+func NewRestoreVersionActionPerformer(cruds map[string]*DbResource) (ActionPerformerInterface, error) {
+
+	handler := restoreVersionActionPerformer{
+		cruds: cruds,
+	}
+
+	return &handler, nil
+}
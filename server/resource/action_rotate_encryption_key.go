@@ -0,0 +1,248 @@
+package resource
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/artpar/api2go"
+	"github.com/buraksezer/olric"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/doug-martin/goqu/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// encryptedConfigPrefixes are _config entries stored with Encrypt instead of an encrypted column
+var encryptedConfigPrefixes = []string{"encryption.private_key.", "oauth.signing_key"}
+
+type rotateEncryptionKeyActionPerformer struct {
+	cmsConfig   *CmsConfig
+	cruds       map[string]*DbResource
+	configStore *ConfigStore
+	topic       *olric.DTopic
+}
+
+func (d *rotateEncryptionKeyActionPerformer) Name() string {
+	return "encryption.key.rotate"
+}
+
+// DoAction adds a new key to the keyring and re-encrypts every encrypted column and config value with it
+func (d *rotateEncryptionKeyActionPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	legacySecret, err := d.configStore.GetConfigValueFor("encryption.secret", "backend")
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	batchSize, err := d.configStore.GetConfigIntValueFor("encryption.rotation.batch_size", "backend")
+	if err != nil || batchSize < 1 {
+		batchSize = 100
+		err = d.configStore.SetConfigIntValueFor("encryption.rotation.batch_size", batchSize, "backend")
+		CheckErr(err, "Failed to store default encryption rotation batch size")
+	}
+
+	keyId, err := RotateEncryptionKey(d.configStore)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	log.Infof("Rotated encryption key, new values are encrypted with key [%v]", keyId)
+	// the other nodes reload the keyring before the values encrypted with the new key are stored
+	if d.topic != nil {
+		err = d.topic.Publish(keyId)
+		CheckErr(err, "Failed to publish the encryption key rotation")
+	}
+
+	errorList := make([]error, 0)
+	reEncrypted := 0
+
+	for _, table := range d.cmsConfig.Tables {
+		columns := make([]string, 0)
+		for _, column := range table.Columns {
+			if column.ColumnType == "encrypted" {
+				columns = append(columns, column.ColumnName)
+			}
+		}
+		if len(columns) == 0 {
+			continue
+		}
+
+		count, err := d.reEncryptTable(table.TableName, columns, []byte(legacySecret), keyId, batchSize)
+		reEncrypted += count
+		if err != nil {
+			log.Errorf("Failed to re-encrypt [%v]: %v", table.TableName, err)
+			errorList = append(errorList, err)
+		}
+	}
+
+	for name, value := range d.configStore.GetAllConfig() {
+		if !isEncryptedConfig(name) || value == "" || EncryptionKeyId(value) == keyId {
+			continue
+		}
+		plainText, err := Decrypt([]byte(legacySecret), value)
+		if err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to decrypt config [%v]: %v", name, err))
+			continue
+		}
+		encrypted, err := Encrypt([]byte(legacySecret), plainText)
+		if err != nil {
+			errorList = append(errorList, err)
+			continue
+		}
+		err = d.configStore.SetConfigValueFor(name, encrypted, "backend")
+		if err != nil {
+			errorList = append(errorList, err)
+			continue
+		}
+		reEncrypted++
+	}
+
+	message := fmt.Sprintf("Encryption key rotated to [%v], re-encrypted %d values", keyId, reEncrypted)
+	notificationType := "success"
+	if len(errorList) > 0 {
+		message = fmt.Sprintf("%v, %d values failed", message, len(errorList))
+		notificationType = "warning"
+	}
+
+	return nil, []ActionResponse{
+		NewActionResponse("client.notify", NewClientNotification(notificationType, message, "Encryption key")),
+	}, errorList
+}
+
+// reEncryptTable re-encrypts the columns of the table in batches of rows, each batch in its own transaction
+func (d *rotateEncryptionKeyActionPerformer) reEncryptTable(tableName string, columns []string, legacySecret []byte, keyId string, batchSize int) (int, error) {
+
+	db := d.cruds["world"].connection
+	selectColumns := []interface{}{goqu.C("id")}
+	for _, column := range columns {
+		selectColumns = append(selectColumns, goqu.C(column))
+	}
+
+	reEncrypted := 0
+	lastId := int64(0)
+	for {
+		query, args, err := statementbuilder.Squirrel.Select(selectColumns...).From(tableName).
+			Where(goqu.C("id").Gt(lastId)).Order(goqu.C("id").Asc()).Limit(uint(batchSize)).ToSQL()
+		if err != nil {
+			return reEncrypted, err
+		}
+
+		rows, err := db.Queryx(query, args...)
+		if err != nil {
+			return reEncrypted, err
+		}
+		batch := make([]map[string]interface{}, 0)
+		for rows.Next() {
+			row := make(map[string]interface{})
+			err = rows.MapScan(row)
+			if err != nil {
+				break
+			}
+			batch = append(batch, row)
+		}
+		rows.Close()
+		if err != nil {
+			return reEncrypted, err
+		}
+		if len(batch) == 0 {
+			return reEncrypted, nil
+		}
+
+		transaction, err := db.Beginx()
+		if err != nil {
+			return reEncrypted, err
+		}
+
+		batchCount := 0
+		for _, row := range batch {
+			id, err := strconv.ParseInt(valueToString(row["id"]), 10, 64)
+			if err != nil {
+				transaction.Rollback()
+				return reEncrypted, err
+			}
+			lastId = id
+
+			updates := goqu.Record{}
+			for _, column := range columns {
+				value := valueToString(row[column])
+				if value == "" || EncryptionKeyId(value) == keyId {
+					continue
+				}
+				plainText, err := Decrypt(legacySecret, value)
+				if err != nil {
+					log.Errorf("Failed to decrypt [%v].[%v] of row [%v], leaving it as it is: %v", tableName, column, id, err)
+					continue
+				}
+				encrypted, err := Encrypt(legacySecret, plainText)
+				if err != nil {
+					transaction.Rollback()
+					return reEncrypted, err
+				}
+				updates[column] = encrypted
+			}
+			if len(updates) == 0 {
+				continue
+			}
+
+			query, args, err := statementbuilder.Squirrel.Update(tableName).Prepared(true).
+				Set(updates).Where(goqu.Ex{"id": id}).ToSQL()
+			if err != nil {
+				transaction.Rollback()
+				return reEncrypted, err
+			}
+			_, err = transaction.Exec(query, args...)
+			if err != nil {
+				transaction.Rollback()
+				return reEncrypted, err
+			}
+			batchCount += len(updates)
+		}
+
+		err = transaction.Commit()
+		if err != nil {
+			return reEncrypted, err
+		}
+		reEncrypted += batchCount
+
+		if len(batch) < batchSize {
+			return reEncrypted, nil
+		}
+	}
+}
+
+func isEncryptedConfig(name string) bool {
+	for _, prefix := range encryptedConfigPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func valueToString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case string:
+		return v
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func NewRotateEncryptionKeyActionPerformer(initConfig *CmsConfig, cruds map[string]*DbResource, configStore *ConfigStore) (ActionPerformerInterface, error) {
+
+	handler := rotateEncryptionKeyActionPerformer{
+		cmsConfig:   initConfig,
+		cruds:       cruds,
+		configStore: configStore,
+	}
+	if olricDb := cruds["world"].OlricDb; olricDb != nil {
+		topic, err := olricDb.NewDTopic(EncryptionKeyringTopic, 4, 1)
+		CheckErr(err, "Failed to open the encryption keyring topic")
+		handler.topic = topic
+	}
+
+	return &handler, nil
+
+}
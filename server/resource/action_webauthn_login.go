@@ -0,0 +1,164 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/duo-labs/webauthn/protocol"
+	"github.com/duo-labs/webauthn/webauthn"
+	log "github.com/sirupsen/logrus"
+)
+
+type webauthnLoginBeginActionPerformer struct {
+	secondFactor *secondFactor
+}
+
+func (d *webauthnLoginBeginActionPerformer) Name() string {
+	return "webauthn.login.begin"
+}
+
+// DoAction returns the options for navigator.credentials.get and the session to finish the sign in with. With an
+// mfa pending token the passkey is the second factor, with only an email it is the whole sign in and the
+// authenticator has to verify the user
+func (d *webauthnLoginBeginActionPerformer) DoAction(request Outcome, inFieldMap map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	var user map[string]interface{}
+	var err error
+	userVerification := protocol.VerificationPreferred
+
+	if pendingToken, _ := inFieldMap["mfa_token"].(string); pendingToken != "" {
+		user, err = d.secondFactor.pendingUser(pendingToken)
+	} else if email, _ := inFieldMap["email"].(string); email != "" {
+		user, err = d.secondFactor.cruds[USER_ACCOUNT_TABLE_NAME].GetUserAccountRowByEmail(email)
+		userVerification = protocol.VerificationRequired
+	} else {
+		err = errors.New("email or mfa_token is required")
+	}
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	if secondFactorLocked(user) {
+		return nil, nil, []error{errors.New("too many failed attempts, try again later")}
+	}
+
+	wUser, err := d.secondFactor.webauthnUserOf(user)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	if len(wUser.credentials) == 0 {
+		return nil, nil, []error{errors.New("no passkey is set up for this account")}
+	}
+
+	assertion, session, err := d.secondFactor.webAuthn.BeginLogin(wUser, webauthn.WithUserVerification(userVerification))
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	sessionToken, err := d.secondFactor.sessionToken("login", wUser.WebAuthnName(), session)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	return nil, []ActionResponse{
+		NewActionResponse("webauthn.login.options", map[string]interface{}{
+			"options": assertion,
+			"session": sessionToken,
+		}),
+	}, nil
+}
+
+type webauthnLoginFinishActionPerformer struct {
+	secondFactor *secondFactor
+}
+
+func (d *webauthnLoginFinishActionPerformer) Name() string {
+	return "webauthn.login.finish"
+}
+
+// DoAction verifies the assertion of the authenticator and signs the user in
+func (d *webauthnLoginFinishActionPerformer) DoAction(request Outcome, inFieldMap map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	sessionToken, _ := inFieldMap["session"].(string)
+	email, session, err := d.secondFactor.parseSessionToken("login", sessionToken)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	user, err := d.secondFactor.cruds[USER_ACCOUNT_TABLE_NAME].GetUserAccountRowByEmail(email)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	if secondFactorLocked(user) {
+		return nil, nil, []error{errors.New("too many failed attempts, try again later")}
+	}
+	wUser, err := d.secondFactor.webauthnUserOf(user)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	body, err := credentialBody(inFieldMap["credential"])
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	credential, err := d.secondFactor.webAuthn.ValidateLogin(wUser, session, parsed)
+	if err != nil {
+		log.Warnf("Failed to verify the passkey of [%v]: %v", email, err)
+		recordSecondFactorFailure(user)
+		return nil, nil, []error{errors.New("the passkey could not be verified")}
+	}
+	if credential.Authenticator.CloneWarning {
+		log.Warnf("The sign count of a passkey of [%v] went back, it may have been cloned", email)
+		return nil, nil, []error{errors.New("this passkey may have been copied, use another one")}
+	}
+
+	query, args, err := statementbuilder.Squirrel.Update(WebauthnCredentialTableName).Prepared(true).
+		Set(goqu.Record{
+			"sign_count":   credential.Authenticator.SignCount,
+			"last_used_at": time.Now(),
+		}).
+		Where(goqu.Ex{"credential_id": base64.RawURLEncoding.EncodeToString(credential.ID)}).ToSQL()
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	_, err = d.secondFactor.cruds[WebauthnCredentialTableName].db.Exec(query, args...)
+	CheckErr(err, "Failed to update the sign count of a passkey of [%v]", email)
+
+	responses, errs := d.secondFactor.signIn(user)
+	return nil, responses, errs
+}
+
+func NewWebauthnLoginBeginActionPerformer(cruds map[string]*DbResource, configStore *ConfigStore) (ActionPerformerInterface, error) {
+
+	secondFactor, err := newSecondFactor(configStore, cruds)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := webauthnLoginBeginActionPerformer{
+		secondFactor: secondFactor,
+	}
+
+	return &handler, nil
+}
+
+func NewWebauthnLoginFinishActionPerformer(cruds map[string]*DbResource, configStore *ConfigStore) (ActionPerformerInterface, error) {
+
+	secondFactor, err := newSecondFactor(configStore, cruds)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := webauthnLoginFinishActionPerformer{
+		secondFactor: secondFactor,
+	}
+
+	return &handler, nil
+}
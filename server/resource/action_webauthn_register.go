@@ -0,0 +1,190 @@
+package resource
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/duo-labs/webauthn/protocol"
+	"github.com/duo-labs/webauthn/webauthn"
+	log "github.com/sirupsen/logrus"
+)
+
+// registeringUser is the user adding a passkey, a signed in user or, with an mfa pending token, a user who is
+// required a second factor and has none yet
+func (s *secondFactor) registeringUser(request Outcome, inFieldMap map[string]interface{}) (map[string]interface{}, bool, error) {
+
+	if pendingToken, _ := inFieldMap["mfa_token"].(string); pendingToken != "" {
+		user, err := s.pendingUser(pendingToken)
+		if err != nil {
+			return nil, false, err
+		}
+		userId, _ := user["id"].(int64)
+		factors, err := s.cruds[USER_ACCOUNT_TABLE_NAME].GetUserSecondFactors(userId)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(factors) > 0 {
+			return nil, false, errors.New("finish signing in with your second factor to add a passkey")
+		}
+		return user, true, nil
+	}
+
+	sessionUser, ok := request.Attributes["user"].(*auth.SessionUser)
+	if !ok || sessionUser == nil || sessionUser.UserReferenceId == "" {
+		return nil, false, errors.New("sign in to add a passkey")
+	}
+	user, err := s.cruds[USER_ACCOUNT_TABLE_NAME].GetReferenceIdToObject(USER_ACCOUNT_TABLE_NAME, sessionUser.UserReferenceId)
+	return user, false, err
+}
+
+// webauthnUserOf loads the credentials of the user
+func (s *secondFactor) webauthnUserOf(user map[string]interface{}) (*webauthnUser, error) {
+	userId, _ := user["id"].(int64)
+	credentials, err := s.cruds[WebauthnCredentialTableName].GetUserWebauthnCredentials(userId)
+	if err != nil {
+		return nil, err
+	}
+	return &webauthnUser{
+		account:     user,
+		credentials: credentials,
+	}, nil
+}
+
+type webauthnRegisterBeginActionPerformer struct {
+	secondFactor *secondFactor
+}
+
+func (d *webauthnRegisterBeginActionPerformer) Name() string {
+	return "webauthn.register.begin"
+}
+
+// DoAction returns the options for navigator.credentials.create and the session to finish the registration with
+func (d *webauthnRegisterBeginActionPerformer) DoAction(request Outcome, inFieldMap map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	user, _, err := d.secondFactor.registeringUser(request, inFieldMap)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	wUser, err := d.secondFactor.webauthnUserOf(user)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	creation, session, err := d.secondFactor.webAuthn.BeginRegistration(wUser, webauthn.WithExclusions(wUser.credentialDescriptors()))
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	sessionToken, err := d.secondFactor.sessionToken("register", wUser.WebAuthnName(), session)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	return nil, []ActionResponse{
+		NewActionResponse("webauthn.register.options", map[string]interface{}{
+			"options": creation,
+			"session": sessionToken,
+		}),
+	}, nil
+}
+
+type webauthnRegisterFinishActionPerformer struct {
+	secondFactor *secondFactor
+}
+
+func (d *webauthnRegisterFinishActionPerformer) Name() string {
+	return "webauthn.register.finish"
+}
+
+// DoAction verifies the new credential and stores it for the user. Users adding their first passkey to finish a sign
+// in are signed in
+func (d *webauthnRegisterFinishActionPerformer) DoAction(request Outcome, inFieldMap map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	sessionToken, _ := inFieldMap["session"].(string)
+	email, session, err := d.secondFactor.parseSessionToken("register", sessionToken)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	user, enrolling, err := d.secondFactor.registeringUser(request, inFieldMap)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	wUser, err := d.secondFactor.webauthnUserOf(user)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	if wUser.WebAuthnName() != email {
+		return nil, nil, []error{errors.New("the passkey request was started by another user")}
+	}
+
+	body, err := credentialBody(inFieldMap["credential"])
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	credential, err := d.secondFactor.webAuthn.CreateCredential(wUser, session, parsed)
+	if err != nil {
+		log.Warnf("Failed to verify the new passkey of [%v]: %v", email, err)
+		return nil, nil, []error{errors.New("the passkey could not be verified")}
+	}
+
+	name, _ := inFieldMap["name"].(string)
+	if name == "" {
+		name = "Passkey"
+	}
+	err = d.secondFactor.createUserRow(WebauthnCredentialTableName, user, map[string]interface{}{
+		"name":             name,
+		"credential_id":    base64.RawURLEncoding.EncodeToString(credential.ID),
+		"public_key":       base64.RawURLEncoding.EncodeToString(credential.PublicKey),
+		"attestation_type": credential.AttestationType,
+		"aaguid":           hex.EncodeToString(credential.Authenticator.AAGUID),
+		"sign_count":       credential.Authenticator.SignCount,
+	})
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	log.Infof("Added passkey [%v] for [%v]", name, email)
+
+	if enrolling {
+		responses, errs := d.secondFactor.signIn(user)
+		return nil, responses, errs
+	}
+	return nil, []ActionResponse{
+		NewActionResponse("client.notify", NewClientNotification("success", "Passkey added", "Success")),
+	}, nil
+}
+
+func NewWebauthnRegisterBeginActionPerformer(cruds map[string]*DbResource, configStore *ConfigStore) (ActionPerformerInterface, error) {
+
+	secondFactor, err := newSecondFactor(configStore, cruds)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := webauthnRegisterBeginActionPerformer{
+		secondFactor: secondFactor,
+	}
+
+	return &handler, nil
+}
+
+func NewWebauthnRegisterFinishActionPerformer(cruds map[string]*DbResource, configStore *ConfigStore) (ActionPerformerInterface, error) {
+
+	secondFactor, err := newSecondFactor(configStore, cruds)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := webauthnRegisterFinishActionPerformer{
+		secondFactor: secondFactor,
+	}
+
+	return &handler, nil
+}
@@ -13,6 +13,7 @@ import (
 // Attributes is a map of string to interface{} which will be used by the action
 // The attributes are evaluated to generate the actual data to be sent to execution
 // JS scripting can be used to reference existing outcomes by reference names
+// Compensation is an outcome which undoes this one, it is run when a later outcome of the action fails
 type Outcome struct {
 	Type            string
 	Method          string // method name
@@ -21,11 +22,14 @@ type Outcome struct {
 	Condition       string
 	Attributes      map[string]interface{}
 	ContinueOnError bool
+	Compensation    *Outcome
 }
 
 // Action is a set of `Outcome` based on set of Input values on a particular data type
 // New actions can be defined and added using JSON or YAML files
 // Actions are stored and reloaded from the `action` table of the storage
+// Transactional actions run their database outcomes in one transaction which is rolled back when an outcome fails
+// EXECUTE outcomes of a transactional action are not part of the transaction and need a Compensation
 type Action struct {
 	Name                    string // Name of the action
 	Label                   string
@@ -37,6 +41,7 @@ type Action struct {
 	OutFields               []Outcome
 	Validations             []ColumnTag
 	Conformations           []ColumnTag
+	Transactional           bool
 }
 
 // ActionRow represents an action instance on the database
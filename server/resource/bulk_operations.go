@@ -0,0 +1,265 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/artpar/api2go"
+	log "github.com/sirupsen/logrus"
+)
+
+// BulkOperationsKey and BulkResultsKey are the members of a JSON:API atomic operations request and response
+const (
+	BulkOperationsKey = "atomic:operations"
+	BulkResultsKey    = "atomic:results"
+)
+
+// BulkResourceRef points to a row either by its reference id or by the local id it was created with in an
+// earlier operation of the same request
+type BulkResourceRef struct {
+	Type string `json:"type"`
+	Id   string `json:"id,omitempty"`
+	Lid  string `json:"lid,omitempty"`
+}
+
+type BulkRelationship struct {
+	Data *BulkResourceRef `json:"data"`
+}
+
+type BulkResourceObject struct {
+	Type          string                      `json:"type"`
+	Id            string                      `json:"id,omitempty"`
+	Lid           string                      `json:"lid,omitempty"`
+	Attributes    map[string]interface{}      `json:"attributes,omitempty"`
+	Relationships map[string]BulkRelationship `json:"relationships,omitempty"`
+}
+
+// BulkOperation is one add, update or remove operation of a bulk request
+type BulkOperation struct {
+	Op   string              `json:"op"`
+	Ref  *BulkResourceRef    `json:"ref,omitempty"`
+	Data *BulkResourceObject `json:"data,omitempty"`
+}
+
+// BulkOperationError is the error of the operation which failed and caused the bulk request to be rolled back
+type BulkOperationError struct {
+	Index int
+	Err   error
+}
+
+func (e BulkOperationError) Error() string {
+	return fmt.Sprintf("operation %d failed: %v", e.Index, e.Err)
+}
+
+// Status is the http status of the error of the operation, 400 unless the error carries one
+func (e BulkOperationError) Status() int {
+	if httpError, ok := e.Err.(api2go.HTTPError); ok && httpError.Status() > 0 {
+		return httpError.Status()
+	}
+	return http.StatusBadRequest
+}
+
+// bulkLocalIds maps the local ids of the rows created by a bulk request to their reference ids
+type bulkLocalIds map[string]string
+
+func (lids bulkLocalIds) key(typeName, lid string) string {
+	return typeName + "/" + lid
+}
+
+// resolve returns the reference id of the row the ref points to
+func (lids bulkLocalIds) resolve(ref BulkResourceRef) (string, error) {
+	if ref.Id != "" {
+		return ref.Id, nil
+	}
+	if ref.Lid == "" {
+		return "", fmt.Errorf("[%v] is referred to without an id or lid", ref.Type)
+	}
+	id, ok := lids[lids.key(ref.Type, ref.Lid)]
+	if !ok {
+		return "", fmt.Errorf("lid [%v] of [%v] is not created by an earlier operation", ref.Lid, ref.Type)
+	}
+	return id, nil
+}
+
+// attributes are the attributes of the resource object with its to-one relationships set to the reference ids of
+// the rows they point to
+func (lids bulkLocalIds) attributes(data *BulkResourceObject) (map[string]interface{}, error) {
+	attributes := make(map[string]interface{})
+	for name, value := range data.Attributes {
+		attributes[name] = value
+	}
+	for name, relationship := range data.Relationships {
+		if relationship.Data == nil {
+			attributes[name] = ""
+			continue
+		}
+		id, err := lids.resolve(*relationship.Data)
+		if err != nil {
+			return nil, err
+		}
+		attributes[name] = id
+	}
+	return attributes, nil
+}
+
+// ExecuteBulkOperations runs the operations in order inside one transaction, through the same create, update and
+// delete paths as the api so every middleware applies. Either all operations are committed or, on the first
+// failure, none of them are
+func ExecuteBulkOperations(cruds map[string]*DbResource, operations []BulkOperation, ctx context.Context) ([]map[string]interface{}, error) {
+
+	for i, operation := range operations {
+		if err := validateBulkOperation(cruds, operation); err != nil {
+			return nil, BulkOperationError{Index: i, Err: err}
+		}
+	}
+
+	tx, err := cruds["world"].connection.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	txCruds := NewCrudsWithTransaction(cruds, tx)
+
+	lids := make(bulkLocalIds)
+	results := make([]map[string]interface{}, 0, len(operations))
+	for i, operation := range operations {
+		result, err := executeBulkOperation(txCruds, lids, operation, ctx)
+		if err != nil {
+			rollbackErr := tx.Rollback()
+			CheckErr(rollbackErr, "Failed to rollback bulk operations")
+			return nil, BulkOperationError{Index: i, Err: err}
+		}
+		results = append(results, result)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		log.Errorf("Failed to commit %d bulk operations: %v", len(operations), err)
+		return nil, err
+	}
+	RunAfterCommit(txCruds)
+	return results, nil
+}
+
+func validateBulkOperation(cruds map[string]*DbResource, operation BulkOperation) error {
+	var typeName string
+	switch operation.Op {
+	case "add":
+		if operation.Data == nil {
+			return fmt.Errorf("add operation without data")
+		}
+		typeName = operation.Data.Type
+	case "update", "remove":
+		switch {
+		case operation.Ref != nil:
+			typeName = operation.Ref.Type
+		case operation.Data != nil:
+			typeName = operation.Data.Type
+		default:
+			return fmt.Errorf("%v operation without ref or data", operation.Op)
+		}
+		if operation.Op == "update" && operation.Data == nil {
+			return fmt.Errorf("update operation without data")
+		}
+	default:
+		return fmt.Errorf("unknown operation [%v]", operation.Op)
+	}
+	if _, ok := cruds[typeName]; !ok {
+		return fmt.Errorf("unknown type [%v]", typeName)
+	}
+	return nil
+}
+
+// target is the row an update or remove operation is made on
+func (operation BulkOperation) target() BulkResourceRef {
+	if operation.Ref != nil {
+		return *operation.Ref
+	}
+	return BulkResourceRef{
+		Type: operation.Data.Type,
+		Id:   operation.Data.Id,
+		Lid:  operation.Data.Lid,
+	}
+}
+
+func executeBulkOperation(cruds map[string]*DbResource, lids bulkLocalIds, operation BulkOperation, ctx context.Context) (map[string]interface{}, error) {
+
+	method := map[string]string{
+		"add":    "POST",
+		"update": "PATCH",
+		"remove": "DELETE",
+	}[operation.Op]
+	pr := &http.Request{
+		Method: method,
+	}
+	pr = pr.WithContext(ctx)
+	req := api2go.Request{
+		PlainRequest: pr,
+	}
+
+	switch operation.Op {
+	case "add":
+		attributes, err := lids.attributes(operation.Data)
+		if err != nil {
+			return nil, err
+		}
+		typeName := operation.Data.Type
+		if operation.Data.Id != "" {
+			attributes["reference_id"] = operation.Data.Id
+		}
+		obj := api2go.NewApi2GoModelWithData(typeName, nil, 0, nil, attributes)
+		created, err := cruds[typeName].Create(obj, req)
+		if err != nil {
+			return nil, err
+		}
+		model := created.Result().(*api2go.Api2GoModel)
+		if operation.Data.Lid != "" {
+			lids[lids.key(typeName, operation.Data.Lid)] = model.GetID()
+		}
+		return bulkResult(typeName, model), nil
+
+	case "update":
+		ref := operation.target()
+		referenceId, err := lids.resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		attributes, err := lids.attributes(operation.Data)
+		if err != nil {
+			return nil, err
+		}
+		existingObj, _, err := cruds[ref.Type].GetSingleRowByReferenceId(ref.Type, referenceId, nil)
+		if err != nil {
+			return nil, api2go.NewHTTPError(err, fmt.Sprintf("[%v][%v] not found", ref.Type, referenceId), http.StatusNotFound)
+		}
+		obj := api2go.NewApi2GoModelWithData(ref.Type, nil, 0, nil, existingObj)
+		obj.SetAttributes(attributes)
+		updated, err := cruds[ref.Type].Update(obj, req)
+		if err != nil {
+			return nil, err
+		}
+		return bulkResult(ref.Type, updated.Result().(*api2go.Api2GoModel)), nil
+
+	default:
+		ref := operation.target()
+		referenceId, err := lids.resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		_, err = cruds[ref.Type].Delete(referenceId, req)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{}, nil
+	}
+}
+
+func bulkResult(typeName string, model *api2go.Api2GoModel) map[string]interface{} {
+	return map[string]interface{}{
+		"data": map[string]interface{}{
+			"type":       typeName,
+			"id":         model.GetID(),
+			"attributes": model.GetAttributes(),
+		},
+	}
+}
@@ -0,0 +1,115 @@
+package resource
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/artpar/api2go"
+)
+
+func TestBulkLocalIds(t *testing.T) {
+
+	lids := make(bulkLocalIds)
+	lids[lids.key("author", "a1")] = "ref-author"
+
+	id, err := lids.resolve(BulkResourceRef{Type: "author", Lid: "a1"})
+	if err != nil || id != "ref-author" {
+		t.Errorf("Expected lid a1 to resolve to ref-author, found %v %v", id, err)
+	}
+
+	id, err = lids.resolve(BulkResourceRef{Type: "author", Id: "ref-other"})
+	if err != nil || id != "ref-other" {
+		t.Errorf("Expected an id to resolve to itself, found %v %v", id, err)
+	}
+
+	if _, err = lids.resolve(BulkResourceRef{Type: "book", Lid: "a1"}); err == nil {
+		t.Errorf("Expected a lid of another type to not resolve")
+	}
+
+	if _, err = lids.resolve(BulkResourceRef{Type: "author"}); err == nil {
+		t.Errorf("Expected a ref without an id or lid to fail")
+	}
+
+	attributes, err := lids.attributes(&BulkResourceObject{
+		Type:       "book",
+		Attributes: map[string]interface{}{"title": "Dune"},
+		Relationships: map[string]BulkRelationship{
+			"author_id": {Data: &BulkResourceRef{Type: "author", Lid: "a1"}},
+			"editor_id": {Data: nil},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to resolve attributes: %v", err)
+	}
+	if attributes["title"] != "Dune" || attributes["author_id"] != "ref-author" || attributes["editor_id"] != "" {
+		t.Errorf("Unexpected attributes %v", attributes)
+	}
+}
+
+func TestValidateBulkOperation(t *testing.T) {
+
+	cruds := map[string]*DbResource{"book": {}}
+
+	valid := []BulkOperation{
+		{Op: "add", Data: &BulkResourceObject{Type: "book"}},
+		{Op: "update", Ref: &BulkResourceRef{Type: "book", Id: "r1"}, Data: &BulkResourceObject{Type: "book"}},
+		{Op: "update", Data: &BulkResourceObject{Type: "book", Id: "r1"}},
+		{Op: "remove", Ref: &BulkResourceRef{Type: "book", Lid: "b1"}},
+	}
+	for i, operation := range valid {
+		if err := validateBulkOperation(cruds, operation); err != nil {
+			t.Errorf("Expected operation %d to be valid, found %v", i, err)
+		}
+	}
+
+	invalid := []BulkOperation{
+		{Op: "add"},
+		{Op: "add", Data: &BulkResourceObject{Type: "author"}},
+		{Op: "update", Ref: &BulkResourceRef{Type: "book", Id: "r1"}},
+		{Op: "remove"},
+		{Op: "replace", Data: &BulkResourceObject{Type: "book"}},
+	}
+	for i, operation := range invalid {
+		if err := validateBulkOperation(cruds, operation); err == nil {
+			t.Errorf("Expected operation %d to be invalid", i)
+		}
+	}
+}
+
+func TestBulkOperationErrorStatus(t *testing.T) {
+
+	if status := (BulkOperationError{Err: api2go.NewHTTPError(nil, "conflict", http.StatusConflict)}).Status(); status != http.StatusConflict {
+		t.Errorf("Expected the status of the http error, found %v", status)
+	}
+	if status := (BulkOperationError{Err: http.ErrNotSupported}).Status(); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a plain error, found %v", status)
+	}
+}
+
+func TestAfterCommit(t *testing.T) {
+
+	ran := 0
+	outside := &DbResource{}
+	outside.AfterCommit(func() { ran++ })
+	if ran != 1 {
+		t.Errorf("Expected a side effect outside a transaction to run right away")
+	}
+
+	queue := &afterCommitQueue{}
+	txCruds := map[string]*DbResource{
+		"world": {afterCommit: queue},
+		"book":  {afterCommit: queue},
+	}
+	order := make([]string, 0)
+	txCruds["book"].AfterCommit(func() { order = append(order, "book") })
+	txCruds["world"].AfterCommit(func() { order = append(order, "world") })
+	if len(order) != 0 {
+		t.Errorf("Expected side effects in a transaction to wait for the commit")
+	}
+
+	RunAfterCommit(txCruds)
+	RunAfterCommit(txCruds)
+	if len(order) != 2 || order[0] != "book" || order[1] != "world" {
+		t.Errorf("Expected held side effects to run once in order, found %v", order)
+	}
+}
@@ -2,13 +2,14 @@ package resource
 
 import (
 	"errors"
-	"fmt"
 	uuid "github.com/artpar/go.uuid"
 	"github.com/daptin/daptin/server/auth"
 	"github.com/daptin/daptin/server/statementbuilder"
 	"github.com/doug-martin/goqu/v9"
 	"github.com/jmoiron/sqlx"
 	log "github.com/sirupsen/logrus"
+	"sort"
+	"strconv"
 	"time"
 )
 
@@ -77,7 +78,7 @@ func (dr *DbResource) DeleteCalendarEvent(UserId int64, rPath string) error {
 func(dr *DbResource) GetModTime(rPath string, userId int64)(time.Time,error){
 	modified := time.Now()
 
-	cal, _, err := dr.Cruds["calendar"].GetRowsByWhereClause("calendar", nil, goqu.Ex{"id": userId},goqu.Ex{"rpath": rPath})
+	cal, _, err := dr.Cruds["calendar"].GetRowsByWhereClause("calendar", nil, goqu.Ex{"user_account_id": userId}, goqu.Ex{"rpath": rPath})
 	if err != nil {
 		return modified, err
 	}
@@ -94,7 +95,7 @@ func(dr *DbResource) GetModTime(rPath string, userId int64)(time.Time,error){
 func(dr *DbResource) GetContent(rPath string, userId int64)(string,error){
 	content := ""
 
-	cal, _, err := dr.Cruds["calendar"].GetRowsByWhereClause("calendar", nil, goqu.Ex{"id": userId},goqu.Ex{"rpath": rPath})
+	cal, _, err := dr.Cruds["calendar"].GetRowsByWhereClause("calendar", nil, goqu.Ex{"user_account_id": userId}, goqu.Ex{"rpath": rPath})
 	if err != nil {
 		return content, err
 	}
@@ -119,9 +120,13 @@ func (d *DbResource) UpdateResource(rPath, newContent string) error {
 		return errors.New("calendar Event does not exist")
 	}
 
+	record := calendarEventRecord(newContent)
+	record["content"] = newContent
+	record["updated_at"] = time.Now()
+
 	query, args, err := statementbuilder.Squirrel.
 		Update("calendar").
-		Set(goqu.Record{"content": newContent, "updated_at": time.Now()}).
+		Set(record).
 		Where(goqu.Ex{"id": cal[0]["id"]}).ToSQL()
 	if err != nil {
 		return err
@@ -137,11 +142,15 @@ func (dr *DbResource) InsertResource(rPath, content string, userId int64) error{
 	referenceId, _ := uuid.NewV4()
 	permission := dr.model.GetDefaultPermission()
 
-	fmt.Println("USERID", userId)
+	record := calendarEventRecord(content)
+	record["rpath"] = rPath
+	record["content"] = content
+	record["user_account_id"] = userId
+	record["reference_id"] = referenceId.String()
+	record["permission"] = permission
 
 	query, args, err := statementbuilder.Squirrel.Insert("calendar").
-		Cols("rpath", "content", "user_account_id", "reference_id", "permission").
-		Vals([]interface{}{rPath, content, userId, referenceId.String(), permission}).
+		Rows(record).
 		ToSQL()
 
 	if err != nil {
@@ -208,4 +217,171 @@ func(dr *DbResource) GetUserGroupById(typename string, userID int64, referenceId
 	}
 
 	return userGroups, nil
-}
\ No newline at end of file
+}
+// calendarEventRecord returns the structured columns parsed from the iCalendar content of a calendar row
+// content which cannot be parsed is still stored, with the structured columns cleared so an earlier
+// version of the event does not keep showing up in ranges and free/busy
+func calendarEventRecord(content string) goqu.Record {
+	event, err := ParseCalendarEvent(content)
+	if err != nil {
+		log.Warnf("Failed to parse calendar event, storing raw content only: %v", err)
+		record := goqu.Record{}
+		for _, column := range calendarEventColumns {
+			record[column] = nil
+		}
+		return record
+	}
+	return event.ToRecord()
+}
+
+// calendarBackfillBatch is the number of calendar rows parsed at a time by BackfillCalendarEvents
+const calendarBackfillBatch = 500
+
+// BackfillCalendarEvents parses the calendar rows stored before the structured columns existed. Rows without an
+// event_start_date are never returned by GetCalendarEventsInRange. Returns the number of rows filled
+func (dr *DbResource) BackfillCalendarEvents() (int, error) {
+
+	filled := 0
+	lastId := int64(0)
+	for {
+		query, args, err := statementbuilder.Squirrel.Select(goqu.C("id"), goqu.C("content")).From("calendar").
+			Where(goqu.C("event_start_date").IsNull(), goqu.C("id").Gt(lastId)).
+			Order(goqu.C("id").Asc()).Limit(calendarBackfillBatch).ToSQL()
+		if err != nil {
+			return filled, err
+		}
+		rows, err := dr.connection.Queryx(query, args...)
+		if err != nil {
+			return filled, err
+		}
+		batch, err := RowsToMap(rows, "calendar")
+		rows.Close()
+		if err != nil {
+			return filled, err
+		}
+
+		for _, row := range batch {
+			lastId, err = strconv.ParseInt(valueToString(row["id"]), 10, 64)
+			if err != nil {
+				return filled, err
+			}
+			content, _ := row["content"].(string)
+			record := calendarEventRecord(content)
+			if record["event_start_date"] == nil {
+				continue
+			}
+			query, args, err := statementbuilder.Squirrel.Update("calendar").Prepared(true).
+				Set(record).Where(goqu.Ex{"id": row["id"]}).ToSQL()
+			if err != nil {
+				return filled, err
+			}
+			_, err = dr.db.Exec(query, args...)
+			if err != nil {
+				return filled, err
+			}
+			filled++
+		}
+		if len(batch) < calendarBackfillBatch {
+			return filled, nil
+		}
+	}
+}
+
+// GetCalendarEventsInRange returns the calendar rows of the user which can have an occurrence in [start, end)
+// recurring events are returned until their last recurrence, expand them using CalendarEvent.Occurrences
+func (dr *DbResource) GetCalendarEventsInRange(userId int64, start time.Time, end time.Time) ([]map[string]interface{}, error) {
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.L("*")).From("calendar").Where(
+		goqu.Ex{"user_account_id": userId},
+		goqu.C("event_start_date").Lt(end),
+		goqu.Or(
+			goqu.C("recurrence_end_date").IsNull(),
+			goqu.C("recurrence_end_date").Gt(start),
+		),
+	).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	stmt1, err := dr.connection.Preparex(query)
+	if err != nil {
+		log.Errorf("[calendar] failed to prepare statment: %v", err)
+		return nil, err
+	}
+	defer func(stmt1 *sqlx.Stmt) {
+		err := stmt1.Close()
+		if err != nil {
+			log.Errorf("failed to close prepared statement: %v", err)
+		}
+	}(stmt1)
+
+	rows, err := stmt1.Queryx(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sqlx.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Errorf("failed to close calendar rows: %v", err)
+		}
+	}(rows)
+
+	return RowsToMap(rows, "calendar")
+}
+
+// GetCalendarOccurrences expands the events of the user into occurrences between start and end, ordered by start time
+func (dr *DbResource) GetCalendarOccurrences(userId int64, start time.Time, end time.Time) ([]CalendarEventOccurrence, error) {
+
+	rows, err := dr.GetCalendarEventsInRange(userId, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences := make([]CalendarEventOccurrence, 0)
+	for _, row := range rows {
+		content, ok := row["content"].(string)
+		if !ok {
+			continue
+		}
+		event, err := ParseCalendarEvent(content)
+		if err != nil {
+			log.Warnf("Skipping unparsable calendar event [%v]: %v", row["reference_id"], err)
+			continue
+		}
+		for _, occurrence := range event.Occurrences(start, end) {
+			occurrence.ReferenceId, _ = row["reference_id"].(string)
+			occurrences = append(occurrences, occurrence)
+		}
+	}
+
+	sort.Slice(occurrences, func(i, j int) bool {
+		return occurrences[i].Start.Before(occurrences[j].Start)
+	})
+
+	return occurrences, nil
+}
+
+// GetFreeBusy returns the merged busy periods of the user between start and end
+// events marked TRANSP:TRANSPARENT do not block time
+func (dr *DbResource) GetFreeBusy(userId int64, start time.Time, end time.Time) ([]BusyPeriod, error) {
+
+	rows, err := dr.GetCalendarEventsInRange(userId, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrences := make([]CalendarEventOccurrence, 0)
+	for _, row := range rows {
+		content, ok := row["content"].(string)
+		if !ok {
+			continue
+		}
+		event, err := ParseCalendarEvent(content)
+		if err != nil || event.Transparent {
+			continue
+		}
+		occurrences = append(occurrences, event.Occurrences(start, end)...)
+	}
+
+	return MergeBusyPeriods(occurrences), nil
+}
@@ -1,6 +1,7 @@
 package resource
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
 	"github.com/artpar/go-guerrilla"
@@ -9,6 +10,7 @@ import (
 	"github.com/samedi/caldav-go/data"
 	"github.com/samedi/caldav-go/errs"
 	log "github.com/sirupsen/logrus"
+	"io/ioutil"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -69,7 +71,7 @@ func (cs *CalDavStorage) CalDavHandler() http.Handler {
 				return
 			}
 
-			if !BcryptCheckStringHash(pair[1], pword) {
+			if !BcryptCheckStringHash(pair[1], pword) || !cs.cruds["user_account"].AllowsPasswordOnlySignInByEmail(pair[0]) {
 				http.Error(writer, "Unauthorized access", http.StatusUnauthorized)
 				return
 			}
@@ -96,6 +98,19 @@ func (cs *CalDavStorage) CalDavHandler() http.Handler {
 
 		}
 
+		if request.Method == "REPORT" && request.Body != nil {
+			body, err := ioutil.ReadAll(request.Body)
+			if err != nil {
+				http.Error(writer, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if strings.Contains(string(body), "free-busy-query") {
+				stg.freeBusyReport(writer, string(body))
+				return
+			}
+			request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
 		response := caldav.HandleRequestWithStorage(request, stg)
 		response.Write(writer)
 	})
@@ -211,9 +226,18 @@ func getCollection(rpath string) string {
 	return string(replace)
 }
 
+// GetResourcesByFilters answers calendar-query REPORTs
+// time-range filters are evaluated against the structured event columns with recurring events expanded,
+// the rest of the filter is matched by the caldav library
 func (cs *CalDavStorage) GetResourcesByFilters(rpath string, filters *data.ResourceFilter) ([]data.Resource, error) {
 	var result []data.Resource
 
+	if filters != nil {
+		if timeRange := filters.GetTimeRangeFilter(); timeRange != nil {
+			return cs.getResourcesInTimeRange(rpath, filters, timeRange)
+		}
+	}
+
 	res, err := cs.GetResources(rpath, true)
 	if err != nil {
 		return nil, err
@@ -227,6 +251,87 @@ func (cs *CalDavStorage) GetResourcesByFilters(rpath string, filters *data.Resou
 	return result, nil
 }
 
+func (cs *CalDavStorage) getResourcesInTimeRange(rpath string, filters *data.ResourceFilter, timeRange *data.ResourceFilter) ([]data.Resource, error) {
+	var result []data.Resource
+
+	rangeStart, rangeEnd := calendarFilterRange(timeRange)
+
+	rows, err := cs.cruds["calendar"].GetCalendarEventsInRange(cs.UserID, rangeStart, rangeEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		rowPath, ok := row["rpath"].(string)
+		if !ok || !strings.HasPrefix(rowPath, rpath) {
+			continue
+		}
+		content, _ := row["content"].(string)
+		event, err := ParseCalendarEvent(content)
+		if err != nil || len(event.Occurrences(rangeStart, rangeEnd)) == 0 {
+			continue
+		}
+
+		res := data.NewResource(rowPath, &PGResourceAdapter{db: cs.cruds, resourcePath: rowPath, UserID: cs.UserID, UserReferenceId: cs.UserReferenceID})
+		// the caldav library only checks the first instance of an event, so only non recurring events go through it
+		if event.RecurrenceRule == "" && !filters.Match(&res) {
+			continue
+		}
+		result = append(result, res)
+	}
+
+	return result, nil
+}
+
+// calendarFilterRange reads the start and end of a time-range filter, a missing side is open ended
+func calendarFilterRange(timeRange *data.ResourceFilter) (time.Time, time.Time) {
+	rangeStart := time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC)
+	rangeEnd := time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+	if start := timeRange.TimeAttr("start"); start != nil {
+		rangeStart = *start
+	}
+	if end := timeRange.TimeAttr("end"); end != nil {
+		rangeEnd = *end
+	}
+	return rangeStart, rangeEnd
+}
+
+var freeBusyTimeRangeRegex = regexp.MustCompile(`<[A-Za-z0-9]*:?time-range[^>]*>`)
+var freeBusyAttributeRegex = regexp.MustCompile(`(start|end)="([0-9TZ]+)"`)
+
+// freeBusyReport answers a free-busy-query REPORT (RFC4791-7.10) with a VFREEBUSY of the user's opaque events
+func (cs *CalDavStorage) freeBusyReport(writer http.ResponseWriter, body string) {
+
+	rangeStart := time.Now().UTC()
+	rangeEnd := rangeStart.AddDate(0, 0, 7)
+
+	timeRangeTag := freeBusyTimeRangeRegex.FindString(body)
+	for _, attribute := range freeBusyAttributeRegex.FindAllStringSubmatch(timeRangeTag, -1) {
+		value, err := time.Parse("20060102T150405Z", attribute[2])
+		if err != nil {
+			http.Error(writer, "invalid time-range", http.StatusBadRequest)
+			return
+		}
+		if attribute[1] == "start" {
+			rangeStart = value
+		} else {
+			rangeEnd = value
+		}
+	}
+
+	periods, err := cs.cruds["calendar"].GetFreeBusy(cs.UserID, rangeStart, rangeEnd)
+	if err != nil {
+		log.Errorf("Failed to query free busy: %v", err)
+		http.Error(writer, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	_, err = writer.Write([]byte(FreeBusyToIcal(periods, rangeStart, rangeEnd)))
+	CheckErr(err, "Failed to write free busy response")
+}
+
 func (cs *CalDavStorage) GetResource(rpath string) (*data.Resource, bool, error) {
 	return cs.GetShallowResource(rpath)
 }
@@ -406,7 +511,7 @@ func (pa *PGResourceAdapter) GetContent() string {
 		return ""
 	}
 
-	return content
+	return DecodeCalendarContent(content)
 }
 
 func (pa *PGResourceAdapter) GetContentSize() int64 {
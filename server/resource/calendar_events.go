@@ -0,0 +1,612 @@
+package resource
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/laurent22/ical-go/ical"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maximum number of recurrence iterations evaluated for a single event
+// protects the server from unbounded RRULEs (no COUNT and no UNTIL)
+const maxRecurrenceIterations = 5000
+
+// CalendarEvent is the structured form of the VEVENT stored as iCalendar text in the calendar table
+type CalendarEvent struct {
+	Uid            string
+	Title          string
+	Description    string
+	Location       string
+	Start          time.Time
+	End            time.Time
+	AllDay         bool
+	Timezone       string
+	Transparent    bool
+	RecurrenceRule string
+	ExceptionDates []time.Time
+}
+
+// CalendarEventOccurrence is a single instance of an event, recurring events expand into many of these
+type CalendarEventOccurrence struct {
+	ReferenceId string    `json:"reference_id"`
+	Uid         string    `json:"uid"`
+	Title       string    `json:"title"`
+	Location    string    `json:"location"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	AllDay      bool      `json:"all_day"`
+	Recurring   bool      `json:"recurring"`
+}
+
+// BusyPeriod is a merged time span during which the user has at least one opaque event
+type BusyPeriod struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// RecurrenceRule is the parsed form of an RFC 5545 RRULE
+// supports FREQ, INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY, BYMONTH and WKST
+type RecurrenceRule struct {
+	Frequency  string
+	Interval   int
+	Count      int
+	Until      time.Time
+	ByDay      []recurrenceWeekday
+	ByMonthDay []int
+	ByMonth    []time.Month
+	WeekStart  time.Weekday
+}
+
+type recurrenceWeekday struct {
+	Ordinal int
+	Weekday time.Weekday
+}
+
+var icalWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// DecodeCalendarContent returns the iCalendar text of a calendar row
+// rows written by the caldav storage are base64 encoded, plain text is returned as it is
+func DecodeCalendarContent(content string) string {
+	if strings.Contains(content, "BEGIN:VCALENDAR") {
+		return content
+	}
+	decoded, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return content
+	}
+	return string(decoded)
+}
+
+// ParseCalendarEvent reads the first VEVENT from an iCalendar document
+func ParseCalendarEvent(content string) (*CalendarEvent, error) {
+
+	calendarNode, err := ical.ParseCalendar(DecodeCalendarContent(content))
+	if err != nil {
+		return nil, err
+	}
+
+	eventNode := calendarNode.ChildByName("VEVENT")
+	if eventNode == nil {
+		return nil, errors.New("no VEVENT in calendar content")
+	}
+
+	event := &CalendarEvent{
+		Uid:            eventNode.PropString("UID", ""),
+		Title:          eventNode.PropString("SUMMARY", ""),
+		Description:    eventNode.PropString("DESCRIPTION", ""),
+		Location:       eventNode.PropString("LOCATION", ""),
+		Transparent:    eventNode.PropString("TRANSP", "") == "TRANSPARENT",
+		RecurrenceRule: eventNode.PropString("RRULE", ""),
+	}
+
+	startNode := eventNode.ChildByName("DTSTART")
+	if startNode == nil {
+		return nil, errors.New("event has no DTSTART")
+	}
+	event.Start, event.AllDay, err = parseIcalDateNode(startNode)
+	if err != nil {
+		return nil, err
+	}
+	event.Timezone = startNode.Parameter("TZID", "UTC")
+
+	endNode := eventNode.ChildByName("DTEND")
+	if endNode != nil {
+		event.End, _, err = parseIcalDateNode(endNode)
+		if err != nil {
+			return nil, err
+		}
+	} else if duration := eventNode.PropDuration("DURATION"); duration > 0 {
+		event.End = event.Start.Add(duration)
+	} else if event.AllDay {
+		event.End = event.Start.AddDate(0, 0, 1)
+	} else {
+		event.End = event.Start
+	}
+
+	for _, exdateNode := range eventNode.ChildrenByName("EXDATE") {
+		for _, value := range strings.Split(exdateNode.Value, ",") {
+			exdate, _, err := parseIcalDate(value, exdateNode.Parameter("TZID", ""), exdateNode.Parameter("VALUE", ""))
+			if err != nil {
+				return nil, err
+			}
+			event.ExceptionDates = append(event.ExceptionDates, exdate)
+		}
+	}
+
+	if event.RecurrenceRule != "" {
+		if _, err = ParseRecurrenceRule(event.RecurrenceRule); err != nil {
+			return nil, err
+		}
+	}
+
+	return event, nil
+}
+
+func parseIcalDateNode(node *ical.Node) (time.Time, bool, error) {
+	return parseIcalDate(node.Value, node.Parameter("TZID", ""), node.Parameter("VALUE", ""))
+}
+
+// parseIcalDate handles DATE, floating DATE-TIME, UTC DATE-TIME and TZID qualified DATE-TIME values
+// TZID qualified values stay in their location so recurrences keep the wall clock time across DST changes
+func parseIcalDate(value string, tzid string, valueType string) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+
+	location := time.UTC
+	if tzid != "" {
+		loc, err := time.LoadLocation(tzid)
+		if err == nil {
+			location = loc
+		}
+	}
+
+	if valueType == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, location)
+		return t, true, err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", value, location)
+	return t, false, err
+}
+
+// calendarEventColumns are the columns of the calendar table derived from the iCalendar content
+var calendarEventColumns = []string{
+	"event_uid", "event_title", "event_description", "event_location", "event_start_date",
+	"event_end_date", "all_day", "event_timezone", "recurrence_rule", "recurrence_end_date",
+}
+
+// ToRecord returns the structured calendar columns for this event
+func (ce *CalendarEvent) ToRecord() goqu.Record {
+	record := goqu.Record{
+		"event_uid":         ce.Uid,
+		"event_title":       ce.Title,
+		"event_description": ce.Description,
+		"event_location":    ce.Location,
+		"event_start_date":  ce.Start.UTC(),
+		"event_end_date":    ce.End.UTC(),
+		"all_day":           ce.AllDay,
+		"event_timezone":    ce.Timezone,
+		"recurrence_rule":   ce.RecurrenceRule,
+	}
+
+	record["recurrence_end_date"] = nil
+	if ce.RecurrenceRule == "" {
+		record["recurrence_end_date"] = ce.End.UTC()
+	} else if rule, err := ParseRecurrenceRule(ce.RecurrenceRule); err == nil && !rule.Until.IsZero() {
+		record["recurrence_end_date"] = rule.Until.Add(ce.End.Sub(ce.Start)).UTC()
+	}
+
+	return record
+}
+
+// Occurrences returns every instance of the event which overlaps [rangeStart, rangeEnd), in UTC
+// instances are expanded in the timezone of DTSTART and converted afterwards
+func (ce *CalendarEvent) Occurrences(rangeStart, rangeEnd time.Time) []CalendarEventOccurrence {
+	duration := ce.End.Sub(ce.Start)
+	occurrences := make([]CalendarEventOccurrence, 0)
+
+	starts := []time.Time{ce.Start}
+	if ce.RecurrenceRule != "" {
+		rule, err := ParseRecurrenceRule(ce.RecurrenceRule)
+		if err != nil {
+			CheckErr(err, "Failed to parse recurrence rule [%v]", ce.RecurrenceRule)
+		} else {
+			// instances starting before the range can still overlap it
+			starts = rule.Expand(ce.Start, rangeStart.Add(-duration), rangeEnd)
+		}
+	}
+
+	for _, start := range starts {
+		if ce.isException(start) {
+			continue
+		}
+		end := start.Add(duration)
+		if !overlapsRange(start, end, rangeStart, rangeEnd) {
+			continue
+		}
+		occurrences = append(occurrences, CalendarEventOccurrence{
+			Uid:       ce.Uid,
+			Title:     ce.Title,
+			Location:  ce.Location,
+			Start:     start.UTC(),
+			End:       end.UTC(),
+			AllDay:    ce.AllDay,
+			Recurring: ce.RecurrenceRule != "",
+		})
+	}
+
+	return occurrences
+}
+
+func (ce *CalendarEvent) isException(start time.Time) bool {
+	for _, exdate := range ce.ExceptionDates {
+		if exdate.Equal(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// same rules as RFC4791-9.9 for VEVENT components
+func overlapsRange(start, end, rangeStart, rangeEnd time.Time) bool {
+	if start.Equal(end) {
+		return !rangeStart.After(start) && rangeEnd.After(start)
+	}
+	return rangeStart.Before(end) && rangeEnd.After(start)
+}
+
+// ParseRecurrenceRule parses the value of an RRULE property, eg FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE
+func ParseRecurrenceRule(value string) (RecurrenceRule, error) {
+	rule := RecurrenceRule{
+		Interval:  1,
+		WeekStart: time.Monday,
+	}
+
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+		keyValue := strings.SplitN(part, "=", 2)
+		if len(keyValue) != 2 {
+			return rule, fmt.Errorf("invalid rrule part [%v]", part)
+		}
+		key, val := strings.ToUpper(keyValue[0]), keyValue[1]
+
+		switch key {
+		case "FREQ":
+			rule.Frequency = strings.ToUpper(val)
+		case "INTERVAL":
+			interval, err := strconv.Atoi(val)
+			if err != nil || interval < 1 {
+				return rule, fmt.Errorf("invalid rrule interval [%v]", val)
+			}
+			rule.Interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(val)
+			if err != nil || count < 1 {
+				return rule, fmt.Errorf("invalid rrule count [%v]", val)
+			}
+			rule.Count = count
+		case "UNTIL":
+			until, _, err := parseIcalDate(val, "", "")
+			if err != nil {
+				return rule, fmt.Errorf("invalid rrule until [%v]", val)
+			}
+			rule.Until = until
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				day = strings.ToUpper(strings.TrimSpace(day))
+				if len(day) < 2 {
+					return rule, fmt.Errorf("invalid rrule byday [%v]", day)
+				}
+				weekday, ok := icalWeekdays[day[len(day)-2:]]
+				if !ok {
+					return rule, fmt.Errorf("invalid rrule byday [%v]", day)
+				}
+				ordinal := 0
+				if len(day) > 2 {
+					o, err := strconv.Atoi(day[:len(day)-2])
+					if err != nil {
+						return rule, fmt.Errorf("invalid rrule byday [%v]", day)
+					}
+					ordinal = o
+				}
+				rule.ByDay = append(rule.ByDay, recurrenceWeekday{Ordinal: ordinal, Weekday: weekday})
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(val, ",") {
+				monthDay, err := strconv.Atoi(day)
+				if err != nil || monthDay == 0 || monthDay > 31 || monthDay < -31 {
+					return rule, fmt.Errorf("invalid rrule bymonthday [%v]", day)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, monthDay)
+			}
+		case "BYMONTH":
+			for _, month := range strings.Split(val, ",") {
+				m, err := strconv.Atoi(month)
+				if err != nil || m < 1 || m > 12 {
+					return rule, fmt.Errorf("invalid rrule bymonth [%v]", month)
+				}
+				rule.ByMonth = append(rule.ByMonth, time.Month(m))
+			}
+		case "WKST":
+			weekStart, ok := icalWeekdays[strings.ToUpper(strings.TrimSpace(val))]
+			if !ok {
+				return rule, fmt.Errorf("invalid rrule wkst [%v]", val)
+			}
+			rule.WeekStart = weekStart
+		default:
+			return rule, fmt.Errorf("unsupported rrule part [%v]", key)
+		}
+	}
+
+	switch rule.Frequency {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return rule, fmt.Errorf("unsupported rrule frequency [%v]", rule.Frequency)
+	}
+
+	return rule, nil
+}
+
+// Expand returns the start times of the instances generated by the rule from dtStart which start at or after
+// rangeStart, stops at COUNT, UNTIL or the first instance starting at or after rangeEnd
+func (rule RecurrenceRule) Expand(dtStart time.Time, rangeStart time.Time, rangeEnd time.Time) []time.Time {
+	starts := make([]time.Time, 0)
+
+	// COUNT is counted from DTSTART, without it the periods before the range are skipped so the
+	// iteration limit only applies to the range itself
+	first := 0
+	if rule.Count == 0 {
+		first = rule.firstPeriodBefore(dtStart, rangeStart)
+	}
+
+	count := 0
+	for i := first; i < first+maxRecurrenceIterations; i++ {
+		candidates := rule.periodCandidates(dtStart, i)
+
+		for _, candidate := range candidates {
+			if candidate.Before(dtStart) {
+				continue
+			}
+			if !rule.Until.IsZero() && candidate.After(rule.Until) {
+				return starts
+			}
+			if !candidate.Before(rangeEnd) {
+				return starts
+			}
+			if rule.Count > 0 && count >= rule.Count {
+				return starts
+			}
+			count++
+			if candidate.Before(rangeStart) {
+				continue
+			}
+			starts = append(starts, candidate)
+		}
+	}
+
+	return starts
+}
+
+// firstPeriodBefore returns the index of a period which starts before t, close enough to t to skip the periods
+// between dtStart and t without missing an instance
+func (rule RecurrenceRule) firstPeriodBefore(dtStart time.Time, t time.Time) int {
+	if !t.After(dtStart) {
+		return 0
+	}
+
+	t = t.In(dtStart.Location())
+	periods := 0
+	switch rule.Frequency {
+	case "DAILY":
+		periods = int(t.Sub(dtStart).Hours() / 24)
+	case "WEEKLY":
+		periods = int(t.Sub(dtStart).Hours() / (24 * 7))
+	case "MONTHLY":
+		periods = (t.Year()-dtStart.Year())*12 + int(t.Month()) - int(dtStart.Month())
+	case "YEARLY":
+		periods = t.Year() - dtStart.Year()
+	}
+
+	// one period of margin for daylight saving changes and week starts
+	index := periods/rule.Interval - 1
+	if index < 0 {
+		return 0
+	}
+	return index
+}
+
+// periodCandidates lists instances inside the index-th period (day/week/month/year) after dtStart, sorted
+func (rule RecurrenceRule) periodCandidates(dtStart time.Time, index int) []time.Time {
+	step := index * rule.Interval
+	candidates := make([]time.Time, 0)
+	hour, minute, second := dtStart.Clock()
+	atTime := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, minute, second, 0, dtStart.Location())
+	}
+
+	switch rule.Frequency {
+	case "DAILY":
+		candidate := dtStart.AddDate(0, 0, step)
+		if rule.matchesMonth(candidate) && rule.matchesWeekday(candidate) && rule.matchesMonthDay(candidate) {
+			candidates = append(candidates, candidate)
+		}
+	case "WEEKLY":
+		// weeks start on WKST, which decides the week of the instances when INTERVAL is more than 1
+		offset := (int(dtStart.Weekday()) - int(rule.WeekStart) + 7) % 7
+		weekStart := dtStart.AddDate(0, 0, step*7-offset)
+		if len(rule.ByDay) == 0 {
+			candidates = append(candidates, dtStart.AddDate(0, 0, step*7))
+			break
+		}
+		for d := 0; d < 7; d++ {
+			candidate := weekStart.AddDate(0, 0, d)
+			if rule.matchesMonth(candidate) && rule.matchesWeekday(candidate) {
+				candidates = append(candidates, candidate)
+			}
+		}
+	case "MONTHLY":
+		first := atTime(dtStart.Year(), dtStart.Month(), 1).AddDate(0, step, 0)
+		if !rule.matchesMonth(first) {
+			break
+		}
+		candidates = append(candidates, rule.monthCandidates(first, dtStart.Day())...)
+	case "YEARLY":
+		year := dtStart.Year() + step
+		months := rule.ByMonth
+		if len(months) == 0 {
+			months = []time.Month{dtStart.Month()}
+		}
+		for _, month := range months {
+			first := atTime(year, month, 1)
+			candidates = append(candidates, rule.monthCandidates(first, dtStart.Day())...)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Before(candidates[j])
+	})
+	return candidates
+}
+
+// monthCandidates lists instances in the month starting at first, defaulting to the day of month of dtStart
+func (rule RecurrenceRule) monthCandidates(first time.Time, defaultDay int) []time.Time {
+	candidates := make([]time.Time, 0)
+	daysInMonth := first.AddDate(0, 1, -1).Day()
+
+	if len(rule.ByDay) == 0 && len(rule.ByMonthDay) == 0 {
+		if defaultDay <= daysInMonth {
+			candidates = append(candidates, first.AddDate(0, 0, defaultDay-1))
+		}
+		return candidates
+	}
+
+	for day := 1; day <= daysInMonth; day++ {
+		candidate := first.AddDate(0, 0, day-1)
+		if len(rule.ByMonthDay) > 0 && !rule.matchesMonthDay(candidate) {
+			continue
+		}
+		if len(rule.ByDay) > 0 && !rule.matchesWeekdayInMonth(candidate, daysInMonth) {
+			continue
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+func (rule RecurrenceRule) matchesMonth(t time.Time) bool {
+	if len(rule.ByMonth) == 0 {
+		return true
+	}
+	for _, month := range rule.ByMonth {
+		if t.Month() == month {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule RecurrenceRule) matchesWeekday(t time.Time) bool {
+	if len(rule.ByDay) == 0 {
+		return true
+	}
+	for _, day := range rule.ByDay {
+		if t.Weekday() == day.Weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesWeekdayInMonth honours ordinals like 2MO (second monday) and -1FR (last friday)
+func (rule RecurrenceRule) matchesWeekdayInMonth(t time.Time, daysInMonth int) bool {
+	for _, day := range rule.ByDay {
+		if t.Weekday() != day.Weekday {
+			continue
+		}
+		if day.Ordinal == 0 {
+			return true
+		}
+		if day.Ordinal > 0 && (t.Day()-1)/7+1 == day.Ordinal {
+			return true
+		}
+		if day.Ordinal < 0 && (daysInMonth-t.Day())/7+1 == -day.Ordinal {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule RecurrenceRule) matchesMonthDay(t time.Time) bool {
+	if len(rule.ByMonthDay) == 0 {
+		return true
+	}
+	daysInMonth := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+	for _, monthDay := range rule.ByMonthDay {
+		if monthDay > 0 && t.Day() == monthDay {
+			return true
+		}
+		if monthDay < 0 && t.Day() == daysInMonth+monthDay+1 {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeBusyPeriods collapses overlapping occurrences of opaque events into busy periods
+func MergeBusyPeriods(occurrences []CalendarEventOccurrence) []BusyPeriod {
+	sort.Slice(occurrences, func(i, j int) bool {
+		return occurrences[i].Start.Before(occurrences[j].Start)
+	})
+
+	periods := make([]BusyPeriod, 0)
+	for _, occurrence := range occurrences {
+		last := len(periods) - 1
+		if last >= 0 && !occurrence.Start.After(periods[last].End) {
+			if occurrence.End.After(periods[last].End) {
+				periods[last].End = occurrence.End
+			}
+			continue
+		}
+		periods = append(periods, BusyPeriod{Start: occurrence.Start, End: occurrence.End})
+	}
+	return periods
+}
+
+// FreeBusyToIcal renders busy periods as a VFREEBUSY component, used as the response of a free-busy-query REPORT
+func FreeBusyToIcal(periods []BusyPeriod, rangeStart, rangeEnd time.Time) string {
+	const icalUtc = "20060102T150405Z"
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//daptin//caldav//EN",
+		"BEGIN:VFREEBUSY",
+		"DTSTAMP:" + time.Now().UTC().Format(icalUtc),
+		"DTSTART:" + rangeStart.UTC().Format(icalUtc),
+		"DTEND:" + rangeEnd.UTC().Format(icalUtc),
+	}
+	for _, period := range periods {
+		lines = append(lines, "FREEBUSY;FBTYPE=BUSY:"+period.Start.UTC().Format(icalUtc)+"/"+period.End.UTC().Format(icalUtc))
+	}
+	lines = append(lines, "END:VFREEBUSY", "END:VCALENDAR", "")
+	return strings.Join(lines, "\r\n")
+}
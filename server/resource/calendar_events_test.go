@@ -0,0 +1,204 @@
+package resource
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+const weeklyStandup = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:standup-1\r\n" +
+	"SUMMARY:Standup\r\n" +
+	"LOCATION:Room 1\r\n" +
+	"DTSTART:20210104T090000Z\r\n" +
+	"DTEND:20210104T091500Z\r\n" +
+	"RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=6\r\n" +
+	"EXDATE:20210106T090000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseCalendarEvent(t *testing.T) {
+
+	event, err := ParseCalendarEvent(base64.StdEncoding.EncodeToString([]byte(weeklyStandup)))
+	if err != nil {
+		t.Fatalf("Failed to parse event: %v", err)
+	}
+
+	if event.Uid != "standup-1" || event.Title != "Standup" || event.Location != "Room 1" {
+		t.Errorf("Unexpected event properties: %v", event)
+	}
+	if !event.Start.Equal(time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected start: %v", event.Start)
+	}
+	if event.End.Sub(event.Start) != 15*time.Minute {
+		t.Errorf("Unexpected duration: %v", event.End.Sub(event.Start))
+	}
+	if len(event.ExceptionDates) != 1 {
+		t.Errorf("Expected one exception date, found %v", len(event.ExceptionDates))
+	}
+
+}
+
+func TestCalendarEventOccurrences(t *testing.T) {
+
+	event, err := ParseCalendarEvent(weeklyStandup)
+	if err != nil {
+		t.Fatalf("Failed to parse event: %v", err)
+	}
+
+	occurrences := event.Occurrences(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC))
+
+	// COUNT=6 gives 4th, 6th, 11th, 13th, 18th and 20th, the 6th is excluded by EXDATE
+	expectedDays := []int{4, 11, 13, 18, 20}
+	if len(occurrences) != len(expectedDays) {
+		t.Fatalf("Expected %v occurrences, found %v", len(expectedDays), len(occurrences))
+	}
+	for i, day := range expectedDays {
+		if occurrences[i].Start.Day() != day {
+			t.Errorf("Expected occurrence %v on day %v, found %v", i, day, occurrences[i].Start)
+		}
+	}
+
+	occurrences = event.Occurrences(time.Date(2021, 1, 12, 0, 0, 0, 0, time.UTC), time.Date(2021, 1, 14, 0, 0, 0, 0, time.UTC))
+	if len(occurrences) != 1 || occurrences[0].Start.Day() != 13 {
+		t.Errorf("Expected only the occurrence on the 13th, found %v", occurrences)
+	}
+
+}
+
+func TestRecurrenceRuleMonthlyByDay(t *testing.T) {
+
+	rule, err := ParseRecurrenceRule("FREQ=MONTHLY;BYDAY=-1FR;UNTIL=20210430T235959Z")
+	if err != nil {
+		t.Fatalf("Failed to parse rule: %v", err)
+	}
+
+	dtStart := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	starts := rule.Expand(dtStart, dtStart, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	expected := []string{"2021-01-29", "2021-02-26", "2021-03-26", "2021-04-30"}
+	if len(starts) != len(expected) {
+		t.Fatalf("Expected %v instances, found %v", expected, starts)
+	}
+	for i, date := range expected {
+		if starts[i].Format("2006-01-02") != date {
+			t.Errorf("Expected %v, found %v", date, starts[i])
+		}
+	}
+
+	if _, err = ParseRecurrenceRule("FREQ=SECONDLY"); err == nil {
+		t.Errorf("Expected unsupported frequency to fail")
+	}
+
+}
+
+func TestMergeBusyPeriods(t *testing.T) {
+
+	base := time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC)
+	periods := MergeBusyPeriods([]CalendarEventOccurrence{
+		{Start: base.Add(2 * time.Hour), End: base.Add(3 * time.Hour)},
+		{Start: base, End: base.Add(time.Hour)},
+		{Start: base.Add(30 * time.Minute), End: base.Add(90 * time.Minute)},
+	})
+
+	if len(periods) != 2 {
+		t.Fatalf("Expected 2 busy periods, found %v", periods)
+	}
+	if !periods[0].End.Equal(base.Add(90 * time.Minute)) {
+		t.Errorf("Expected first period to end at 10:30, found %v", periods[0].End)
+	}
+
+}
+
+func TestRecurrenceKeepsLocalTimeAcrossDst(t *testing.T) {
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("No timezone data: %v", err)
+	}
+
+	event, err := ParseCalendarEvent("BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:weekly-berlin\r\n" +
+		"DTSTART;TZID=Europe/Berlin:20210322T090000\r\n" +
+		"DTEND;TZID=Europe/Berlin:20210322T093000\r\n" +
+		"RRULE:FREQ=WEEKLY;COUNT=3\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n")
+	if err != nil {
+		t.Fatalf("Failed to parse event: %v", err)
+	}
+
+	occurrences := event.Occurrences(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC))
+	if len(occurrences) != 3 {
+		t.Fatalf("Expected 3 occurrences, found %v", occurrences)
+	}
+	for _, occurrence := range occurrences {
+		if occurrence.Start.Location() != time.UTC {
+			t.Errorf("Expected occurrences in UTC, found %v", occurrence.Start)
+		}
+		if occurrence.Start.In(berlin).Hour() != 9 {
+			t.Errorf("Expected every occurrence at 09:00 in Berlin, found %v", occurrence.Start.In(berlin))
+		}
+	}
+	if occurrences[0].Start.Hour() != 8 || occurrences[1].Start.Hour() != 7 {
+		t.Errorf("Expected the UTC time to move with DST, found %v and %v", occurrences[0].Start, occurrences[1].Start)
+	}
+}
+
+func TestRecurrenceRuleWeekStart(t *testing.T) {
+
+	// the examples of WKST in RFC 5545 section 3.3.10
+	dtStart := time.Date(1997, 8, 5, 9, 0, 0, 0, time.UTC)
+	expectedDays := map[string][]int{
+		"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=MO": {5, 10, 19, 24},
+		"FREQ=WEEKLY;INTERVAL=2;COUNT=4;BYDAY=TU,SU;WKST=SU": {5, 17, 19, 31},
+	}
+	for value, days := range expectedDays {
+		rule, err := ParseRecurrenceRule(value)
+		if err != nil {
+			t.Fatalf("Failed to parse rule [%v]: %v", value, err)
+		}
+		starts := rule.Expand(dtStart, dtStart, time.Date(1998, 1, 1, 0, 0, 0, 0, time.UTC))
+		if len(starts) != len(days) {
+			t.Fatalf("Expected %v instances of [%v], found %v", len(days), value, starts)
+		}
+		for i, day := range days {
+			if starts[i].Day() != day {
+				t.Errorf("Expected instance %v of [%v] on day %v, found %v", i, value, day, starts[i])
+			}
+		}
+	}
+}
+
+func TestRecurrenceRuleSkipsPeriodsBeforeRange(t *testing.T) {
+
+	dtStart := time.Date(2000, 1, 3, 9, 0, 0, 0, time.UTC)
+	rangeStart := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	rangeEnd := time.Date(2021, 6, 8, 0, 0, 0, 0, time.UTC)
+
+	expectedCounts := map[string]int{
+		"FREQ=DAILY":                      7,
+		"FREQ=WEEKLY;BYDAY=MO,WE":         2,
+		"FREQ=MONTHLY;BYMONTHDAY=1,7":     2,
+		"FREQ=YEARLY;BYMONTH=6;BYDAY=1MO": 1,
+	}
+	for value, count := range expectedCounts {
+		rule, err := ParseRecurrenceRule(value)
+		if err != nil {
+			t.Fatalf("Failed to parse rule [%v]: %v", value, err)
+		}
+		starts := rule.Expand(dtStart, rangeStart, rangeEnd)
+		if len(starts) != count {
+			t.Errorf("Expected %v instances of [%v] in the range, found %v", count, value, starts)
+		}
+		for _, start := range starts {
+			if start.Before(rangeStart) || !start.Before(rangeEnd) || start.Hour() != 9 {
+				t.Errorf("Expected instances of [%v] at 09:00 inside the range, found %v", value, start)
+			}
+		}
+	}
+}
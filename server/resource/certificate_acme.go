@@ -0,0 +1,537 @@
+package resource
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/go-acme/lego/v3/certcrypto"
+	"github.com/go-acme/lego/v3/certificate"
+	"github.com/go-acme/lego/v3/challenge/dns01"
+	"github.com/go-acme/lego/v3/lego"
+	"github.com/go-acme/lego/v3/registration"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acmeHttpChallengeProvider keeps HTTP-01 key authorizations until the CA has validated them
+// they are served from /.well-known/acme-challenge/:token
+type acmeHttpChallengeProvider struct {
+	lock       sync.RWMutex
+	challenges map[string]string
+}
+
+func (p *acmeHttpChallengeProvider) Present(domain, token, keyAuth string) error {
+	log.Printf("Present acme http challenge for [%v]", domain)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.challenges[token] = keyAuth
+	return nil
+}
+
+func (p *acmeHttpChallengeProvider) CleanUp(domain, token, keyAuth string) error {
+	log.Printf("Clean up acme http challenge for [%v]", domain)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.challenges, token)
+	return nil
+}
+
+// AcmeChallengeResponse returns the key authorization for a pending HTTP-01 challenge token
+func (cm *CertificateManager) AcmeChallengeResponse(token string) (string, bool) {
+	cm.httpChallenge.lock.RLock()
+	defer cm.httpChallenge.lock.RUnlock()
+	keyAuth, ok := cm.httpChallenge.challenges[token]
+	return keyAuth, ok
+}
+
+func (cm *CertificateManager) configValue(key string, defaultValue string) string {
+	value, err := cm.configStore.GetConfigValueFor(key, "backend")
+	if err != nil || value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// loadAcmeUser loads the ACME account key of the email from _config, creating one on first use
+func (cm *CertificateManager) loadAcmeUser(email string) (*acmeUser, error) {
+
+	userPrivateKeyEncrypted, err := cm.configStore.GetConfigValueFor("encryption.private_key."+email, "backend")
+	if err != nil {
+		log.Printf("No existing private key for [%v]", email)
+
+		publicKeyPem, privateKeyPem, privateKey, err := GetPublicPrivateKeyPEMBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		encryptedPem, err := Encrypt([]byte(cm.encryptionSecret), string(privateKeyPem))
+		if err != nil {
+			return nil, err
+		}
+
+		err = cm.configStore.SetConfigValueFor("encryption.private_key."+email, encryptedPem, "backend")
+		if err != nil {
+			return nil, err
+		}
+		err = cm.configStore.SetConfigValueFor("encryption.public_key."+email, string(publicKeyPem), "backend")
+		if err != nil {
+			return nil, err
+		}
+
+		return &acmeUser{
+			Email: email,
+			key:   privateKey,
+		}, nil
+	}
+
+	privateKeyPem, err := Decrypt([]byte(cm.encryptionSecret), userPrivateKeyEncrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ParseRsaPrivateKeyFromPemStr(privateKeyPem)
+	if err != nil {
+		return nil, err
+	}
+
+	return &acmeUser{
+		Email: email,
+		key:   key,
+	}, nil
+}
+
+// newAcmeClient creates a lego client for the account of email
+// acme.directory_url selects the CA (a local pebble instance in tests), acme.challenge_type selects http-01 or dns-01
+func (cm *CertificateManager) newAcmeClient(email string) (*lego.Client, error) {
+
+	myUser, err := cm.loadAcmeUser(email)
+	if err != nil {
+		return nil, err
+	}
+
+	config := lego.NewConfig(myUser)
+	config.CADirURL = cm.configValue("acme.directory_url", lego.LEDirectoryProduction)
+	config.Certificate.KeyType = certcrypto.RSA2048
+	config.HTTPClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   15 * time.Second,
+			ResponseHeaderTimeout: 15 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+			},
+		},
+	}
+
+	client, err := lego.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	challengeType := cm.configValue("acme.challenge_type", "http-01")
+	switch challengeType {
+	case "http-01":
+		err = client.Challenge.SetHTTP01Provider(cm.httpChallenge)
+	case "dns-01":
+		providerName := cm.configValue("acme.dns_provider", "")
+		providerConfig := make(map[string]string)
+		for key, value := range cm.configStore.GetAllConfig() {
+			if strings.HasPrefix(key, "acme.dns.") {
+				providerConfig[strings.TrimPrefix(key, "acme.dns.")] = value
+			}
+		}
+		provider, providerErr := NewDnsChallengeProvider(providerName, providerConfig)
+		if providerErr != nil {
+			return nil, providerErr
+		}
+		var options []dns01.ChallengeOption
+		if resolvers := providerConfig["resolvers"]; resolvers != "" {
+			options = append(options, dns01.AddRecursiveNameservers(dns01.ParseNameservers(strings.Split(resolvers, ","))))
+		}
+		err = client.Challenge.SetDNS01Provider(provider, options...)
+	default:
+		err = fmt.Errorf("unknown acme.challenge_type [%v]", challengeType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := client.Registration.Register(registration.RegisterOptions{TermsOfServiceAgreed: true})
+	if err != nil {
+		log.Printf("Failed to register acme account [%v], trying to resolve existing account: %v", email, err)
+		reg, err = client.Registration.ResolveAccountByKey()
+		if err != nil {
+			return nil, err
+		}
+	}
+	myUser.Registration = reg
+
+	return client, nil
+}
+
+// acmeEmail is the account used for renewals and on demand certificates
+func (cm *CertificateManager) acmeEmail() string {
+	email := cm.configValue("acme.email", "")
+	if email == "" {
+		email = cm.cruds[USER_ACCOUNT_TABLE_NAME].GetAdminEmailId()
+	}
+	return email
+}
+
+// ObtainAcmeCertificate requests a certificate for hostname from the ACME CA and stores it in the certificate table
+// concurrent requests for the same hostname wait for the first one to finish
+func (cm *CertificateManager) ObtainAcmeCertificate(hostname string, email string) error {
+
+	hostname = strings.ToLower(strings.Split(hostname, ":")[0])
+	if email == "" {
+		return errors.New("no email for acme account")
+	}
+
+	hostLock := cm.hostnameLock(hostname)
+	hostLock.Lock()
+	defer hostLock.Unlock()
+
+	client, err := cm.newAcmeClient(email)
+	if err != nil {
+		log.Printf("Failed to create acme client: %v", err)
+		return err
+	}
+
+	certificates, err := client.Certificate.Obtain(certificate.ObtainRequest{
+		Domains: []string{hostname},
+		Bundle:  true,
+	})
+	if err != nil {
+		log.Printf("Failed to obtain certificate for [%v]: %v", hostname, err)
+		return err
+	}
+
+	certificateString := string(certificates.Certificate)
+	certificateString = strings.Split(certificateString, "-----END CERTIFICATE-----")[0] + "-----END CERTIFICATE-----"
+
+	publicKeyBytes := ""
+	privateKey, err := ParseRsaPrivateKeyFromPemStr(string(certificates.PrivateKey))
+	if err != nil {
+		log.Printf("Failed to parse value as private key: %v", err)
+	} else {
+		asn1Bytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+		CheckErr(err, "Failed to marshal key as pkix public key")
+		publicKeyBytes = string(pem.EncodeToMemory(&pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: asn1Bytes,
+		}))
+	}
+
+	newCertificate := map[string]interface{}{
+		"hostname":         hostname,
+		"issuer":           "acme",
+		"generated_at":     time.Now().Format(time.RFC3339),
+		"certificate_pem":  certificateString,
+		"private_key_pem":  string(certificates.PrivateKey),
+		"public_key_pem":   publicKeyBytes,
+		"root_certificate": string(certificates.IssuerCertificate),
+	}
+	if expiry, err := CertificateExpiry(certificateString); err == nil {
+		newCertificate["expires_at"] = expiry.Format(time.RFC3339)
+	}
+
+	err = cm.saveCertificate(hostname, newCertificate)
+	if err != nil {
+		return err
+	}
+	cm.forgetCertificate(hostname)
+	log.Printf("Stored acme certificate for [%v]", hostname)
+	return nil
+}
+
+// saveCertificate creates or updates the certificate row of hostname as the administrator
+func (cm *CertificateManager) saveCertificate(hostname string, newCertificate map[string]interface{}) error {
+
+	adminUserReferenceId := ""
+	adminId := int64(1)
+	for id := range cm.cruds["certificate"].GetAdminReferenceId() {
+		adminUserReferenceId = id
+		break
+	}
+	if adminUserReferenceId != "" {
+		id, err := cm.cruds[USER_ACCOUNT_TABLE_NAME].GetReferenceIdToId(USER_ACCOUNT_TABLE_NAME, adminUserReferenceId)
+		if err == nil {
+			adminId = id
+		}
+	}
+
+	request := &http.Request{
+		Method: "PUT",
+	}
+	request = request.WithContext(context.WithValue(context.Background(), "user", &auth.SessionUser{
+		UserReferenceId: adminUserReferenceId,
+		UserId:          adminId,
+	}))
+	req := api2go.Request{
+		PlainRequest: request,
+	}
+
+	data := api2go.NewApi2GoModelWithData("certificate", nil, 0, nil, newCertificate)
+
+	existing, err := cm.cruds["certificate"].GetObjectByWhereClause("certificate", "hostname", hostname)
+	if err == nil && existing != nil && existing["reference_id"] != nil {
+		data.Data["reference_id"] = existing["reference_id"]
+		_, err = cm.cruds["certificate"].UpdateWithoutFilters(data, req)
+		return err
+	}
+
+	request.Method = "POST"
+	_, err = cm.cruds["certificate"].CreateWithoutFilter(data, req)
+	return err
+}
+
+// CertificateExpiry returns NotAfter of the first certificate in the PEM
+func CertificateExpiry(certificatePem string) (time.Time, error) {
+	parsed, err := certcrypto.ParsePEMCertificate([]byte(certificatePem))
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parsed.NotAfter, nil
+}
+
+// RenewExpiringCertificates renews every acme issued certificate expiring within acme.renew_before_days (default 30)
+// rows without expires_at are backfilled from the stored certificate
+func (cm *CertificateManager) RenewExpiringCertificates() []error {
+
+	renewBeforeDays, err := strconv.Atoi(cm.configValue("acme.renew_before_days", "30"))
+	if err != nil {
+		renewBeforeDays = 30
+	}
+	renewBefore := time.Now().AddDate(0, 0, renewBeforeDays)
+
+	certificates, err := cm.cruds["certificate"].GetAllObjectsWithWhere("certificate", goqu.Ex{
+		"issuer": "acme",
+	})
+	if err != nil {
+		return []error{err}
+	}
+
+	email := cm.acmeEmail()
+	errs := make([]error, 0)
+	for _, cert := range certificates {
+		hostname, _ := cert["hostname"].(string)
+		expiry, err := CertificateExpiry(AsStringOrEmpty(cert["certificate_pem"]))
+		if err != nil {
+			log.Printf("Failed to read expiry of certificate for [%v], renewing: %v", hostname, err)
+		} else {
+			if cert["expires_at"] == nil {
+				cm.backfillCertificateExpiry(cert["id"], expiry)
+			}
+			if expiry.After(renewBefore) {
+				continue
+			}
+		}
+
+		log.Printf("Renewing acme certificate for [%v] expiring at %v", hostname, expiry)
+		err = cm.ObtainAcmeCertificate(hostname, email)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to renew certificate for [%v]: %v", hostname, err))
+		}
+	}
+
+	return errs
+}
+
+// backfillCertificateExpiry sets expires_at on certificate rows stored before the column was filled in
+func (cm *CertificateManager) backfillCertificateExpiry(id interface{}, expiry time.Time) {
+	query, args, err := statementbuilder.Squirrel.Update("certificate").Prepared(true).
+		Set(goqu.Record{"expires_at": expiry}).Where(goqu.Ex{"id": id}).ToSQL()
+	if err != nil {
+		CheckErr(err, "Failed to create certificate expiry update query")
+		return
+	}
+	_, err = cm.cruds["certificate"].db.Exec(query, args...)
+	CheckErr(err, "Failed to backfill expiry of certificate [%v]", id)
+}
+
+func (cm *CertificateManager) hostnameLock(hostname string) *sync.Mutex {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	hostLock, ok := cm.obtainLocks[hostname]
+	if !ok {
+		hostLock = &sync.Mutex{}
+		cm.obtainLocks[hostname] = hostLock
+	}
+	return hostLock
+}
+
+func (cm *CertificateManager) forgetCertificate(hostname string) {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	delete(cm.tlsCertificateCache, hostname)
+}
+
+// onDemandSettingsTtl is how long the site hostnames and settings read for handshakes are kept, site changes
+// reload them earlier through ReloadSiteHostnames
+const onDemandSettingsTtl = 5 * time.Minute
+
+// on demand obtains for a hostname which failed are retried after a backoff doubling from the first to the last
+const (
+	onDemandFirstBackoff = 5 * time.Minute
+	onDemandLastBackoff  = 24 * time.Hour
+)
+
+// onDemandSettings are the values GetCertificate needs for every handshake, kept in memory
+type onDemandSettings struct {
+	loadedAt      time.Time
+	mainHostname  string
+	onDemand      bool
+	siteHostnames map[string]bool
+}
+
+// onDemandObtain is the state of the on demand certificate of a hostname
+type onDemandObtain struct {
+	pending    bool
+	done       bool
+	failures   int
+	retryAfter time.Time
+}
+
+// ReloadSiteHostnames drops the site hostnames kept for handshakes, called when a site changes
+func (cm *CertificateManager) ReloadSiteHostnames() {
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	cm.onDemandSettings = nil
+}
+
+func (cm *CertificateManager) handshakeSettings() *onDemandSettings {
+	cm.lock.Lock()
+	settings := cm.onDemandSettings
+	cm.lock.Unlock()
+	if settings != nil && time.Since(settings.loadedAt) < onDemandSettingsTtl {
+		return settings
+	}
+
+	settings = &onDemandSettings{
+		loadedAt:      time.Now(),
+		mainHostname:  cm.configValue("hostname", "localhost"),
+		onDemand:      cm.configValue("acme.on_demand", "false") == "true",
+		siteHostnames: make(map[string]bool),
+	}
+	sites, err := cm.cruds["site"].GetAllSites()
+	CheckErr(err, "Failed to load site hostnames for certificates")
+	for _, site := range sites {
+		if site.Enable && site.EnableHttps {
+			settings.siteHostnames[strings.ToLower(site.Hostname)] = true
+		}
+	}
+
+	cm.lock.Lock()
+	cm.onDemandSettings = settings
+	cm.lock.Unlock()
+	return settings
+}
+
+// obtainOnDemand starts obtaining an acme certificate for the hostname in the background, unless one exists, an
+// obtain is already running or the last one failed within its backoff
+func (cm *CertificateManager) obtainOnDemand(hostname string) {
+
+	cm.lock.Lock()
+	state, ok := cm.onDemandObtains[hostname]
+	if !ok {
+		state = &onDemandObtain{}
+		cm.onDemandObtains[hostname] = state
+	}
+	if state.done || state.pending || time.Now().Before(state.retryAfter) {
+		cm.lock.Unlock()
+		return
+	}
+	state.pending = true
+	cm.lock.Unlock()
+
+	go func() {
+		var err error
+		existing, lookupErr := cm.cruds["certificate"].GetObjectByWhereClause("certificate", "hostname", hostname)
+		if lookupErr != nil || existing == nil || existing["issuer"] != "acme" {
+			err = cm.ObtainAcmeCertificate(hostname, cm.acmeEmail())
+		}
+
+		cm.lock.Lock()
+		defer cm.lock.Unlock()
+		state.pending = false
+		if err == nil {
+			state.done = true
+			return
+		}
+		backoff := onDemandFirstBackoff << uint(state.failures)
+		if backoff > onDemandLastBackoff || backoff <= 0 {
+			backoff = onDemandLastBackoff
+		}
+		state.failures++
+		state.retryAfter = time.Now().Add(backoff)
+		log.Errorf("Failed to obtain on demand certificate for [%v], retrying after %v: %v", hostname, backoff, err)
+	}()
+}
+
+// GetCertificate is used as tls.Config.GetCertificate by the https listener
+// with acme.on_demand enabled, the first handshake for a site hostname without an acme certificate starts obtaining
+// one in the background and is served the certificate the hostname has until then,
+// unknown hostnames are served the certificate of the main hostname
+func (cm *CertificateManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+
+	hostname := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	settings := cm.handshakeSettings()
+
+	knownSite := hostname != "" && settings.siteHostnames[hostname]
+	if !knownSite {
+		hostname = settings.mainHostname
+	}
+
+	if knownSite && settings.onDemand {
+		cm.obtainOnDemand(hostname)
+	}
+
+	cm.lock.Lock()
+	cached, ok := cm.tlsCertificateCache[hostname]
+	cm.lock.Unlock()
+	if ok && cached.Leaf != nil && time.Now().Before(cached.Leaf.NotAfter) {
+		return cached, nil
+	}
+
+	_, certPEM, keyPEM, _, rootCert, err := cm.GetTLSConfig(hostname, true)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := certPEM
+	if len(rootCert) > 0 && string(rootCert) != string(certPEM) {
+		chain = []byte(string(certPEM) + "\n" + string(rootCert))
+	}
+
+	cert, err := tls.X509KeyPair(chain, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+
+	cm.lock.Lock()
+	cm.tlsCertificateCache[hostname] = &cert
+	cm.lock.Unlock()
+
+	return &cert, nil
+}
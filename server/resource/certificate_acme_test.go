@@ -0,0 +1,66 @@
+package resource
+
+import (
+	"github.com/go-acme/lego/v3/challenge"
+	"testing"
+	"time"
+)
+
+type testDnsChallengeProvider struct {
+	records map[string]string
+}
+
+func (p *testDnsChallengeProvider) Present(domain, token, keyAuth string) error {
+	p.records[domain] = keyAuth
+	return nil
+}
+
+func (p *testDnsChallengeProvider) CleanUp(domain, token, keyAuth string) error {
+	delete(p.records, domain)
+	return nil
+}
+
+func TestDnsChallengeProviderRegistry(t *testing.T) {
+
+	RegisterDnsChallengeProvider("test", func(config map[string]string) (challenge.Provider, error) {
+		return &testDnsChallengeProvider{records: map[string]string{}}, nil
+	})
+
+	provider, err := NewDnsChallengeProvider("test", map[string]string{})
+	if err != nil {
+		t.Fatalf("Failed to create registered provider: %v", err)
+	}
+	if _, ok := provider.(*testDnsChallengeProvider); !ok {
+		t.Errorf("Expected the registered provider, found %T", provider)
+	}
+
+	if _, err = NewDnsChallengeProvider("not-registered", map[string]string{}); err == nil {
+		t.Errorf("Expected unknown provider to fail")
+	}
+
+	if _, err = NewDnsChallengeProvider("httpreq", map[string]string{}); err == nil {
+		t.Errorf("Expected httpreq provider without endpoint to fail")
+	}
+
+}
+
+func TestCertificateExpiry(t *testing.T) {
+
+	_, _, key, err := GetPublicPrivateKeyPEMBytes()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	certPem, err := GenerateCertPEMWithKey("site.example.com", key)
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+
+	expiry, err := CertificateExpiry(string(certPem))
+	if err != nil {
+		t.Fatalf("Failed to read expiry: %v", err)
+	}
+	if expiry.Before(time.Now().AddDate(0, 0, 364)) {
+		t.Errorf("Expected self signed certificate to be valid for a year, expires at %v", expiry)
+	}
+
+}
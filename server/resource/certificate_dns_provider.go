@@ -0,0 +1,94 @@
+package resource
+
+import (
+	"fmt"
+	"github.com/go-acme/lego/v3/challenge"
+	"github.com/go-acme/lego/v3/providers/dns/exec"
+	"github.com/go-acme/lego/v3/providers/dns/httpreq"
+	"github.com/go-acme/lego/v3/providers/dns/rfc2136"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DnsChallengeProviderConstructor creates a DNS-01 challenge provider from the acme.dns.* values in _config
+// the keys in config are without the "acme.dns." prefix
+type DnsChallengeProviderConstructor func(config map[string]string) (challenge.Provider, error)
+
+var dnsChallengeProviderLock sync.RWMutex
+var dnsChallengeProviders = map[string]DnsChallengeProviderConstructor{
+	"httpreq": newHttpReqDnsChallengeProvider,
+	"exec":    newExecDnsChallengeProvider,
+	"rfc2136": newRfc2136DnsChallengeProvider,
+}
+
+// RegisterDnsChallengeProvider makes a DNS-01 provider available by name for acme.dns_provider
+func RegisterDnsChallengeProvider(name string, constructor DnsChallengeProviderConstructor) {
+	dnsChallengeProviderLock.Lock()
+	defer dnsChallengeProviderLock.Unlock()
+	dnsChallengeProviders[name] = constructor
+}
+
+// NewDnsChallengeProvider creates the registered DNS-01 provider by name
+func NewDnsChallengeProvider(name string, config map[string]string) (challenge.Provider, error) {
+	dnsChallengeProviderLock.RLock()
+	constructor, ok := dnsChallengeProviders[name]
+	dnsChallengeProviderLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown dns challenge provider [%v]", name)
+	}
+	return constructor(config)
+}
+
+func dnsProviderDuration(config map[string]string, key string, defaultValue time.Duration) time.Duration {
+	value, ok := config[key]
+	if !ok {
+		return defaultValue
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// acme.dns.endpoint, acme.dns.mode, acme.dns.username, acme.dns.password
+func newHttpReqDnsChallengeProvider(config map[string]string) (challenge.Provider, error) {
+	providerConfig := httpreq.NewDefaultConfig()
+	endpoint, err := url.Parse(config["endpoint"])
+	if err != nil || config["endpoint"] == "" {
+		return nil, fmt.Errorf("httpreq dns provider needs a valid acme.dns.endpoint: %v", err)
+	}
+	providerConfig.Endpoint = endpoint
+	providerConfig.Mode = config["mode"]
+	providerConfig.Username = config["username"]
+	providerConfig.Password = config["password"]
+	providerConfig.PropagationTimeout = dnsProviderDuration(config, "propagation_timeout", providerConfig.PropagationTimeout)
+	providerConfig.PollingInterval = dnsProviderDuration(config, "polling_interval", providerConfig.PollingInterval)
+	return httpreq.NewDNSProviderConfig(providerConfig)
+}
+
+// acme.dns.program, acme.dns.mode
+func newExecDnsChallengeProvider(config map[string]string) (challenge.Provider, error) {
+	providerConfig := exec.NewDefaultConfig()
+	providerConfig.Program = config["program"]
+	providerConfig.Mode = config["mode"]
+	providerConfig.PropagationTimeout = dnsProviderDuration(config, "propagation_timeout", providerConfig.PropagationTimeout)
+	providerConfig.PollingInterval = dnsProviderDuration(config, "polling_interval", providerConfig.PollingInterval)
+	return exec.NewDNSProviderConfig(providerConfig)
+}
+
+// acme.dns.nameserver, acme.dns.tsig_algorithm, acme.dns.tsig_key, acme.dns.tsig_secret
+func newRfc2136DnsChallengeProvider(config map[string]string) (challenge.Provider, error) {
+	providerConfig := rfc2136.NewDefaultConfig()
+	providerConfig.Nameserver = config["nameserver"]
+	if algorithm, ok := config["tsig_algorithm"]; ok {
+		providerConfig.TSIGAlgorithm = algorithm
+	}
+	providerConfig.TSIGKey = config["tsig_key"]
+	providerConfig.TSIGSecret = config["tsig_secret"]
+	providerConfig.PropagationTimeout = dnsProviderDuration(config, "propagation_timeout", providerConfig.PropagationTimeout)
+	providerConfig.PollingInterval = dnsProviderDuration(config, "polling_interval", providerConfig.PollingInterval)
+	return rfc2136.NewDNSProviderConfig(providerConfig)
+}
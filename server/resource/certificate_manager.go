@@ -16,13 +16,20 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
 type CertificateManager struct {
-	cruds            map[string]*DbResource
-	configStore      *ConfigStore
-	encryptionSecret string
+	cruds               map[string]*DbResource
+	configStore         *ConfigStore
+	encryptionSecret    string
+	httpChallenge       *acmeHttpChallengeProvider
+	lock                sync.Mutex
+	obtainLocks         map[string]*sync.Mutex
+	tlsCertificateCache map[string]*tls.Certificate
+	onDemandSettings    *onDemandSettings
+	onDemandObtains     map[string]*onDemandObtain
 }
 
 func NewCertificateManager(cruds map[string]*DbResource, configStore *ConfigStore) (*CertificateManager, error) {
@@ -36,6 +43,12 @@ func NewCertificateManager(cruds map[string]*DbResource, configStore *ConfigStor
 		cruds:            cruds,
 		configStore:      configStore,
 		encryptionSecret: secret,
+		httpChallenge: &acmeHttpChallengeProvider{
+			challenges: make(map[string]string),
+		},
+		obtainLocks:         make(map[string]*sync.Mutex),
+		tlsCertificateCache: make(map[string]*tls.Certificate),
+		onDemandObtains:     make(map[string]*onDemandObtain),
 	}, nil
 }
 
@@ -184,6 +197,9 @@ func (cm *CertificateManager) GetTLSConfig(hostname string, createIfNotFound boo
 			"root_certificate": string(certBytesPEM),
 			"public_key_pem":   string(publicKeyPem),
 		}
+		if expiry, err := CertificateExpiry(string(certBytesPEM)); err == nil {
+			newCertificate["expires_at"] = expiry.Format(time.RFC3339)
+		}
 		request := &http.Request{
 			Method: "PUT",
 		}
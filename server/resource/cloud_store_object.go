@@ -0,0 +1,148 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/artpar/rclone/fs"
+	"github.com/artpar/rclone/fs/config"
+	"github.com/artpar/rclone/fs/operations"
+)
+
+// configureCloudStore sets the rclone remote configuration for the provider of the cloud store
+func (res *DbResource) configureCloudStore(cloudStore CloudStore) {
+
+	token, oauthConf, err := res.GetTokenByTokenReferenceId(cloudStore.OAutoTokenId)
+	if err != nil && cloudStore.StoreProvider != "local" {
+		CheckErr(err, "Failed to get oauth2 token for cloud store [%v]", cloudStore.Name)
+	}
+
+	jsonToken, err := json.Marshal(token)
+	CheckErr(err, "Failed to convert token to json")
+	config.FileSet(cloudStore.StoreProvider, "client_id", oauthConf.ClientID)
+	config.FileSet(cloudStore.StoreProvider, "type", cloudStore.StoreProvider)
+	config.FileSet(cloudStore.StoreProvider, "client_secret", oauthConf.ClientSecret)
+	config.FileSet(cloudStore.StoreProvider, "token", string(jsonToken))
+	config.FileSet(cloudStore.StoreProvider, "client_scopes", strings.Join(oauthConf.Scopes, ","))
+	config.FileSet(cloudStore.StoreProvider, "redirect_url", oauthConf.RedirectURL)
+}
+
+// cloudStoreFilePath cleans a path given by a user for a file inside a cloud store, paths leaving the root path of the
+// store are rejected
+func cloudStoreFilePath(filePath string) (string, error) {
+	for _, part := range strings.Split(filePath, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("path [%v] leaves the cloud store", filePath)
+		}
+	}
+	return strings.TrimPrefix(path.Clean("/"+filePath), "/"), nil
+}
+
+// OpenCloudStoreObject returns a seekable reader for a file in the cloud store, keyName is the folder
+// of the asset column inside the store root and filePath the path of the file inside that folder
+// Data is fetched from the backend with ranged reads only when it is read
+func (res *DbResource) OpenCloudStoreObject(ctx context.Context, cloudStore CloudStore, keyName string, filePath string) (*CloudStoreObjectReader, error) {
+
+	res.configureCloudStore(cloudStore)
+
+	rootPath := strings.TrimSuffix(cloudStore.RootPath, "/")
+	if keyName != "" {
+		rootPath = rootPath + "/" + strings.Trim(keyName, "/")
+	}
+
+	storeFs, err := fs.NewFs(ctx, rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := storeFs.NewObject(ctx, strings.TrimPrefix(filePath, "/"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &CloudStoreObjectReader{
+		ctx:    ctx,
+		Object: object,
+	}, nil
+}
+
+// WriteCloudStoreObject streams the reader into the file at filePath inside the keyName folder of the cloud store,
+// without holding the contents in memory
+func (res *DbResource) WriteCloudStoreObject(ctx context.Context, cloudStore CloudStore, keyName string, filePath string, in io.Reader) error {
+
+	res.configureCloudStore(cloudStore)
+
+	folder, fileName := path.Split(strings.TrimPrefix(filePath, "/"))
+	rootPath := strings.TrimSuffix(cloudStore.RootPath, "/")
+	if keyName != "" {
+		rootPath = rootPath + "/" + strings.Trim(keyName, "/")
+	}
+	if folder != "" {
+		rootPath = rootPath + "/" + strings.TrimSuffix(folder, "/")
+	}
+
+	storeFs, err := fs.NewFs(ctx, rootPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = operations.Rcat(ctx, storeFs, fileName, ioutil.NopCloser(in), time.Now())
+	return err
+}
+
+// CloudStoreObjectReader is an io.ReadSeeker over a cloud store object, suitable for http.ServeContent
+type CloudStoreObjectReader struct {
+	ctx    context.Context
+	Object fs.Object
+	offset int64
+	reader io.ReadCloser
+}
+
+func (r *CloudStoreObjectReader) Read(p []byte) (int, error) {
+	if r.reader == nil {
+		if r.offset >= r.Object.Size() {
+			return 0, io.EOF
+		}
+		reader, err := r.Object.Open(r.ctx, &fs.SeekOption{Offset: r.offset})
+		if err != nil {
+			return 0, err
+		}
+		r.reader = reader
+	}
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Seek only moves the offset, the backend stream is reopened at the new offset on the next Read
+func (r *CloudStoreObjectReader) Seek(offset int64, whence int) (int64, error) {
+	newOffset := offset
+	switch whence {
+	case io.SeekCurrent:
+		newOffset = r.offset + offset
+	case io.SeekEnd:
+		newOffset = r.Object.Size() + offset
+	}
+	if newOffset < 0 {
+		return r.offset, errors.New("seek before start of object")
+	}
+	if newOffset != r.offset && r.reader != nil {
+		_ = r.reader.Close()
+		r.reader = nil
+	}
+	r.offset = newOffset
+	return r.offset, nil
+}
+
+func (r *CloudStoreObjectReader) Close() error {
+	if r.reader == nil {
+		return nil
+	}
+	return r.reader.Close()
+}
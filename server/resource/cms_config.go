@@ -350,6 +350,36 @@ func (c *ConfigStore) SetConfigValueFor(key string, val interface{}, configtype
 
 }
 
+// CompareAndSetConfigValueFor replaces the value of the config only if it is still previousValue, reports if it
+// was replaced
+func (c *ConfigStore) CompareAndSetConfigValueFor(key string, previousValue string, val string, configtype string) (bool, error) {
+
+	s, v, err := statementbuilder.Squirrel.Update(settingsTableName).Prepared(true).
+		Set(goqu.Record{
+			"value":         val,
+			"updated_at":    time.Now(),
+			"previousvalue": previousValue,
+		}).
+		Where(goqu.Ex{"name": key}).
+		Where(goqu.Ex{"value": previousValue}).
+		Where(goqu.Ex{"configstate": "enabled"}).
+		Where(goqu.Ex{"configtype": configtype}).
+		Where(goqu.Ex{"configenv": c.defaultEnv}).ToSQL()
+	if err != nil {
+		return false, err
+	}
+
+	result, err := c.db.Exec(s, v...)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return updated == 1, nil
+}
+
 func (c *ConfigStore) SetConfigIntValueFor(key string, val int, configtype string) error {
 	var previousValue string
 
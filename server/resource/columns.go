@@ -14,6 +14,10 @@ func IsStandardColumn(colName string) bool {
 		}
 	}
 
+	if colName == SoftDeleteColumn.ColumnName {
+		return true
+	}
+
 	return false
 }
 
@@ -69,6 +73,17 @@ var StandardColumns = []api2go.ColumnInfo{
 	},
 }
 
+// SoftDeleteColumn is added to the tables with SoftDeleteEnabled, rows are trashed by setting it instead of
+// being deleted
+var SoftDeleteColumn = api2go.ColumnInfo{
+	Name:       "deleted_at",
+	ColumnName: "deleted_at",
+	DataType:   "timestamp",
+	IsIndexed:  true,
+	IsNullable: true,
+	ColumnType: "datetime",
+}
+
 var StandardRelations = []api2go.TableRelation{
 	api2go.NewTableRelation("action", "belongs_to", "world"),
 	api2go.NewTableRelation("feed", "belongs_to", "stream"),
@@ -187,6 +202,20 @@ var SystemActions = []Action{
 			},
 		},
 	},
+	{
+		Name:             "renew_acme_certificates",
+		Label:            "Renew expiring ACME certificates",
+		OnType:           "certificate",
+		InstanceOptional: true,
+		InFields:         []api2go.ColumnInfo{},
+		OutFields: []Outcome{
+			{
+				Type:       "acme.tls.renew",
+				Method:     "EXECUTE",
+				Attributes: map[string]interface{}{},
+			},
+		},
+	},
 	{
 		Name:             "generate_self_certificate",
 		Label:            "Generate Self certificate",
@@ -490,6 +519,138 @@ var SystemActions = []Action{
 			},
 		},
 	},
+	{
+		Name:             "rotate_encryption_key",
+		Label:            "Rotate encryption key",
+		OnType:           "world",
+		InstanceOptional: true,
+		InFields:         []api2go.ColumnInfo{},
+		OutFields: []Outcome{
+			{
+				Type:       "encryption.key.rotate",
+				Method:     "EXECUTE",
+				Attributes: map[string]interface{}{},
+			},
+		},
+	},
+	{
+		Name:             "restore_version",
+		Label:            "Restore a previous version",
+		OnType:           "world",
+		InstanceOptional: true,
+		InFields: []api2go.ColumnInfo{
+			{
+				Name:       "Table name",
+				ColumnName: "table_name",
+				ColumnType: "label",
+				IsNullable: false,
+			},
+			{
+				Name:       "Version",
+				ColumnName: "version",
+				ColumnType: "label",
+				IsNullable: false,
+			},
+		},
+		OutFields: []Outcome{
+			{
+				Type:   "audit.version.restore",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"table_name": "~table_name",
+					"version":    "~version",
+				},
+			},
+		},
+	},
+	{
+		Name:             "sync_data_exchange",
+		Label:            "Sync from the source",
+		OnType:           "data_exchange",
+		InstanceOptional: false,
+		InFields:         []api2go.ColumnInfo{},
+		OutFields: []Outcome{
+			{
+				Type:   "data_exchange.sync",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"reference_id": "$.reference_id",
+				},
+			},
+		},
+	},
+	{
+		Name:             "prune_audit_log",
+		Label:            "Prune audit log",
+		OnType:           "world",
+		InstanceOptional: true,
+		InFields:         []api2go.ColumnInfo{},
+		OutFields: []Outcome{
+			{
+				Type:       "audit.prune",
+				Method:     "EXECUTE",
+				Attributes: map[string]interface{}{},
+			},
+		},
+	},
+	{
+		Name:             "prune_server_function_log",
+		Label:            "Prune server function log",
+		OnType:           "world",
+		InstanceOptional: true,
+		InFields:         []api2go.ColumnInfo{},
+		OutFields: []Outcome{
+			{
+				Type:       "server_function_log.prune",
+				Method:     "EXECUTE",
+				Attributes: map[string]interface{}{},
+			},
+		},
+	},
+	{
+		Name:             "restore",
+		Label:            "Restore from trash",
+		OnType:           "world",
+		InstanceOptional: true,
+		InFields: []api2go.ColumnInfo{
+			{
+				Name:       "Table name",
+				ColumnName: "table_name",
+				ColumnType: "label",
+				IsNullable: false,
+			},
+			{
+				Name:       "Reference id",
+				ColumnName: "reference_id",
+				ColumnType: "label",
+				IsNullable: false,
+			},
+		},
+		OutFields: []Outcome{
+			{
+				Type:   "trash.restore",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"table_name":   "~table_name",
+					"reference_id": "~reference_id",
+				},
+			},
+		},
+	},
+	{
+		Name:             "purge_trash",
+		Label:            "Purge trash",
+		OnType:           "world",
+		InstanceOptional: true,
+		InFields:         []api2go.ColumnInfo{},
+		OutFields: []Outcome{
+			{
+				Type:       "trash.purge",
+				Method:     "EXECUTE",
+				Attributes: map[string]interface{}{},
+			},
+		},
+	},
 	{
 		Name:             "generate_random_data",
 		Label:            "Generate random data",
@@ -537,13 +698,56 @@ var SystemActions = []Action{
 				Name:       "table_name",
 				ColumnType: "label",
 			},
+			{
+				Name:         "Format",
+				ColumnName:   "format",
+				ColumnType:   "label",
+				IsNullable:   true,
+				DefaultValue: "json",
+			},
+			{
+				Name:       "Columns",
+				ColumnName: "columns",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "Query",
+				ColumnName: "query",
+				ColumnType: "json",
+				IsNullable: true,
+			},
+			{
+				Name:       "Cloud store name",
+				ColumnName: "cloud_store_name",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "Path",
+				ColumnName: "path",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "Trashed",
+				ColumnName: "trashed",
+				ColumnType: "label",
+				IsNullable: true,
+			},
 		},
 		OutFields: []Outcome{
 			{
 				Type:   "__data_export",
 				Method: "EXECUTE",
 				Attributes: map[string]interface{}{
-					"table_name": "~table_name",
+					"table_name":       "~table_name",
+					"format":           "~format",
+					"columns":          "~columns",
+					"query":            "~query",
+					"cloud_store_name": "~cloud_store_name",
+					"path":             "~path",
+					"trashed":          "~trashed",
 				},
 			},
 		},
@@ -577,10 +781,41 @@ var SystemActions = []Action{
 		InstanceOptional: false,
 		InFields: []api2go.ColumnInfo{
 			{
-				Name:       "JSON Dump file",
+				Name:       "Dump file",
 				ColumnName: "dump_file",
-				ColumnType: "file.json|yaml|toml|hcl",
-				IsNullable: false,
+				ColumnType: "file.json|csv|ndjson|jsonl|xlsx|parquet",
+				IsNullable: true,
+			},
+			{
+				Name:       "Format",
+				ColumnName: "format",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "Cloud store name",
+				ColumnName: "cloud_store_name",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "Path",
+				ColumnName: "path",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "Key column",
+				ColumnName: "key_column",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:         "Batch size",
+				ColumnName:   "batch_size",
+				ColumnType:   "measurement",
+				IsNullable:   true,
+				DefaultValue: "500",
 			},
 			{
 				Name:       "truncate_before_insert",
@@ -596,6 +831,11 @@ var SystemActions = []Action{
 					"world_reference_id":     "$.reference_id",
 					"truncate_before_insert": "~truncate_before_insert",
 					"dump_file":              "~dump_file",
+					"format":                 "~format",
+					"cloud_store_name":       "~cloud_store_name",
+					"path":                   "~path",
+					"key_column":             "~key_column",
+					"batch_size":             "~batch_size",
 					"table_name":             "$.table_name",
 					"user":                   "~user",
 				},
@@ -1280,77 +1520,250 @@ var SystemActions = []Action{
 		},
 	},
 	{
-		Name:     "oauth_login_begin",
-		Label:    "Authenticate via OAuth",
-		OnType:   "oauth_connect",
-		InFields: []api2go.ColumnInfo{},
+		Name:             "mfa_verify",
+		Label:            "Verify second factor",
+		InstanceOptional: true,
+		OnType:           USER_ACCOUNT_TABLE_NAME,
+		InFields: []api2go.ColumnInfo{
+			{
+				Name:       "mfa_token",
+				ColumnName: "mfa_token",
+				ColumnType: "label",
+			},
+			{
+				Name:       "otp",
+				ColumnName: "otp",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "recovery_code",
+				ColumnName: "recovery_code",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+		},
 		OutFields: []Outcome{
 			{
-				Type:   "oauth.client.redirect",
+				Type:   "mfa.verify",
 				Method: "EXECUTE",
 				Attributes: map[string]interface{}{
-					"authenticator": "$.name",
-					"scope":         "$.scope",
+					"mfa_token":     "~mfa_token",
+					"otp":           "~otp",
+					"recovery_code": "~recovery_code",
 				},
 			},
 		},
 	},
 	{
-		Name:             "oauth.login.response",
-		Label:            "Handle OAuth login response code and state",
+		Name:             "webauthn_login_begin",
+		Label:            "Sign in with a passkey",
 		InstanceOptional: true,
-		OnType:           "oauth_token",
+		OnType:           USER_ACCOUNT_TABLE_NAME,
 		InFields: []api2go.ColumnInfo{
 			{
-				Name:       "code",
-				ColumnName: "code",
-				ColumnType: "hidden",
-				IsNullable: false,
-			},
-			{
-				Name:       "state",
-				ColumnName: "state",
-				ColumnType: "hidden",
-				IsNullable: false,
+				Name:       "email",
+				ColumnName: "email",
+				ColumnType: "email",
+				IsNullable: true,
 			},
 			{
-				Name:       "authenticator",
-				ColumnName: "authenticator",
-				ColumnType: "hidden",
-				IsNullable: false,
+				Name:       "mfa_token",
+				ColumnName: "mfa_token",
+				ColumnType: "label",
+				IsNullable: true,
 			},
 		},
 		OutFields: []Outcome{
 			{
-				Type:           "oauth_connect",
-				Method:         "GET",
-				SkipInResponse: true,
-				Reference:      "connection",
+				Type:   "webauthn.login.begin",
+				Method: "EXECUTE",
 				Attributes: map[string]interface{}{
-					"filter":       "~authenticator",
-					"page[number]": "1",
-					"page[size]":   "1",
+					"email":     "~email",
+					"mfa_token": "~mfa_token",
 				},
 			},
+		},
+	},
+	{
+		Name:             "webauthn_login_finish",
+		Label:            "Finish passkey sign in",
+		InstanceOptional: true,
+		OnType:           USER_ACCOUNT_TABLE_NAME,
+		InFields: []api2go.ColumnInfo{
 			{
-				Type:           "oauth.login.response",
-				Method:         "EXECUTE",
-				SkipInResponse: true,
-				Reference:      "auth",
-				Attributes: map[string]interface{}{
-					"authenticator":     "~authenticator",
-					"user_account_id":   "~user.id",
-					"user_reference_id": "~user.reference_id",
-					"state":             "~state",
-					"code":              "~code",
-				},
+				Name:       "session",
+				ColumnName: "session",
+				ColumnType: "label",
 			},
 			{
-				Type:           "oauth.profile.exchange",
-				Method:         "EXECUTE",
-				Reference:      "profile",
-				SkipInResponse: true,
-				Condition:      "$connection[0].allow_login",
+				Name:       "credential",
+				ColumnName: "credential",
+				ColumnType: "json",
+			},
+		},
+		OutFields: []Outcome{
+			{
+				Type:   "webauthn.login.finish",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"session":    "~session",
+					"credential": "~credential",
+				},
+			},
+		},
+	},
+	{
+		Name:             "webauthn_register_begin",
+		Label:            "Add a passkey",
+		InstanceOptional: true,
+		OnType:           USER_ACCOUNT_TABLE_NAME,
+		InFields: []api2go.ColumnInfo{
+			{
+				Name:       "mfa_token",
+				ColumnName: "mfa_token",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+		},
+		OutFields: []Outcome{
+			{
+				Type:   "webauthn.register.begin",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"mfa_token": "~mfa_token",
+				},
+			},
+		},
+	},
+	{
+		Name:             "webauthn_register_finish",
+		Label:            "Save the passkey",
+		InstanceOptional: true,
+		OnType:           USER_ACCOUNT_TABLE_NAME,
+		InFields: []api2go.ColumnInfo{
+			{
+				Name:       "session",
+				ColumnName: "session",
+				ColumnType: "label",
+			},
+			{
+				Name:       "credential",
+				ColumnName: "credential",
+				ColumnType: "json",
+			},
+			{
+				Name:       "name",
+				ColumnName: "name",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "mfa_token",
+				ColumnName: "mfa_token",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+		},
+		OutFields: []Outcome{
+			{
+				Type:   "webauthn.register.finish",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"session":    "~session",
+					"credential": "~credential",
+					"name":       "~name",
+					"mfa_token":  "~mfa_token",
+				},
+			},
+		},
+	},
+	{
+		Name:             "generate_recovery_codes",
+		Label:            "Generate recovery codes",
+		InstanceOptional: true,
+		OnType:           USER_ACCOUNT_TABLE_NAME,
+		InFields:         []api2go.ColumnInfo{},
+		OutFields: []Outcome{
+			{
+				Type:       "mfa.recovery_codes.generate",
+				Method:     "EXECUTE",
+				Attributes: map[string]interface{}{},
+			},
+		},
+	},
+	{
+		Name:     "oauth_login_begin",
+		Label:    "Authenticate via OAuth",
+		OnType:   "oauth_connect",
+		InFields: []api2go.ColumnInfo{},
+		OutFields: []Outcome{
+			{
+				Type:   "oauth.client.redirect",
+				Method: "EXECUTE",
+				Attributes: map[string]interface{}{
+					"authenticator": "$.name",
+					"scope":         "$.scope",
+				},
+			},
+		},
+	},
+	{
+		Name:             "oauth.login.response",
+		Label:            "Handle OAuth login response code and state",
+		InstanceOptional: true,
+		OnType:           "oauth_token",
+		InFields: []api2go.ColumnInfo{
+			{
+				Name:       "code",
+				ColumnName: "code",
+				ColumnType: "hidden",
+				IsNullable: false,
+			},
+			{
+				Name:       "state",
+				ColumnName: "state",
+				ColumnType: "hidden",
+				IsNullable: false,
+			},
+			{
+				Name:       "authenticator",
+				ColumnName: "authenticator",
+				ColumnType: "hidden",
+				IsNullable: false,
+			},
+		},
+		OutFields: []Outcome{
+			{
+				Type:           "oauth_connect",
+				Method:         "GET",
+				SkipInResponse: true,
+				Reference:      "connection",
+				Attributes: map[string]interface{}{
+					"filter":       "~authenticator",
+					"page[number]": "1",
+					"page[size]":   "1",
+				},
+			},
+			{
+				Type:           "oauth.login.response",
+				Method:         "EXECUTE",
+				SkipInResponse: true,
+				Reference:      "auth",
+				Attributes: map[string]interface{}{
+					"authenticator":     "~authenticator",
+					"user_account_id":   "~user.id",
+					"user_reference_id": "~user.reference_id",
+					"state":             "~state",
+					"code":              "~code",
+				},
+			},
+			{
+				Type:           "oauth.profile.exchange",
+				Method:         "EXECUTE",
+				Reference:      "profile",
+				SkipInResponse: true,
+				Condition:      "$connection[0].allow_login",
 				Attributes: map[string]interface{}{
 					"authenticator": "~authenticator",
 					"token":         "$auth.access_token",
@@ -1540,109 +1953,81 @@ var StandardTables = []TableInfo{
 				DataType:   "text",
 				IsNullable: false,
 			},
-			//{
-			//	ColumnName: "event_title",
-			//	Name:       "event_title",
-			//	ColumnType: "label",
-			//	DataType:   "varchar(100)",
-			//	IsNullable: false,
-			//	IsIndexed:  true,
-			//},
-			//{
-			//	ColumnName: "event_url",
-			//	Name:       "event_url",
-			//	ColumnType: "label",
-			//	DataType:   "varchar(500)",
-			//	IsNullable: true,
-			//},
-			//{
-			//	ColumnName:   "event_type",
-			//	Name:         "event_type",
-			//	ColumnType:   "label",
-			//	DataType:     "varchar(50)",
-			//	IsIndexed:    true,
-			//	IsNullable:   false,
-			//	DefaultValue: "'event'",
-			//},
-			//{
-			//	ColumnName:   "all_day",
-			//	Name:         "all_day",
-			//	ColumnType:   "truefalse",
-			//	DataType:     "bool",
-			//	IsNullable:   false,
-			//	DefaultValue: "false",
-			//},
-			//{
-			//	ColumnName: "event_location",
-			//	Name:       "event_location",
-			//	IsIndexed:  true,
-			//	ColumnType: "label",
-			//	DataType:   "varchar(500)",
-			//	IsNullable: true,
-			//},
-			//{
-			//	ColumnName: "event_end_date",
-			//	Name:       "event_end_date",
-			//	ColumnType: "datetime",
-			//	IsIndexed:  true,
-			//	DataType:   "timestamp",
-			//	IsNullable: true,
-			//},
-			//{
-			//	ColumnName:   "event_timezone",
-			//	Name:         "event_timezone",
-			//	ColumnType:   "label",
-			//	DataType:     "varchar(50)",
-			//	IsNullable:   false,
-			//	DefaultValue: "'local'",
-			//},
-			//{
-			//	ColumnName: "event_start_date",
-			//	Name:       "event_start_date",
-			//	ColumnType: "datetime",
-			//	IsIndexed:  true,
-			//	DataType:   "timestamp",
-			//	IsNullable: false,
-			//},
-			//{
-			//	ColumnName: "start_time",
-			//	Name:       "start_time",
-			//	ColumnType: "label",
-			//	IsIndexed:  true,
-			//	DataType:   "varchar(50)",
-			//	IsNullable: true,
-			//},
-			//{
-			//	ColumnName: "end_time",
-			//	Name:       "end_time",
-			//	IsIndexed:  true,
-			//	ColumnType: "label",
-			//	DataType:   "varchar(50)",
-			//	IsNullable: true,
-			//},
-			//{
-			//	ColumnName: "start_recur",
-			//	Name:       "start_recur",
-			//	ColumnType: "label",
-			//	DataType:   "varchar(50)",
-			//	IsNullable: true,
-			//},
-			//{
-			//	ColumnName: "days_of_week",
-			//	Name:       "days_of_week",
-			//	IsIndexed:  true,
-			//	ColumnType: "label",
-			//	IsNullable: true,
-			//	DataType:   "varchar(100)",
-			//},
-			//{
-			//	ColumnName: "event_description",
-			//	Name:       "event_description",
-			//	ColumnType: "content",
-			//	DataType:   "text",
-			//	IsIndexed:  false,
-			//	IsNullable: true,
-			//},
+			{
+				ColumnName: "event_uid",
+				Name:       "event_uid",
+				ColumnType: "label",
+				DataType:   "varchar(255)",
+				IsIndexed:  true,
+				IsNullable: true,
+			},
+			{
+				ColumnName: "event_title",
+				Name:       "event_title",
+				ColumnType: "label",
+				DataType:   "varchar(500)",
+				IsNullable: true,
+			},
+			{
+				ColumnName: "event_description",
+				Name:       "event_description",
+				ColumnType: "content",
+				DataType:   "text",
+				IsNullable: true,
+			},
+			{
+				ColumnName: "event_location",
+				Name:       "event_location",
+				ColumnType: "label",
+				DataType:   "varchar(500)",
+				IsNullable: true,
+			},
+			{
+				ColumnName: "event_start_date",
+				Name:       "event_start_date",
+				ColumnType: "datetime",
+				DataType:   "timestamp",
+				IsIndexed:  true,
+				IsNullable: true,
+			},
+			{
+				ColumnName: "event_end_date",
+				Name:       "event_end_date",
+				ColumnType: "datetime",
+				DataType:   "timestamp",
+				IsIndexed:  true,
+				IsNullable: true,
+			},
+			{
+				ColumnName:   "all_day",
+				Name:         "all_day",
+				ColumnType:   "truefalse",
+				DataType:     "bool",
+				IsNullable:   true,
+				DefaultValue: "false",
+			},
+			{
+				ColumnName: "event_timezone",
+				Name:       "event_timezone",
+				ColumnType: "label",
+				DataType:   "varchar(50)",
+				IsNullable: true,
+			},
+			{
+				ColumnName: "recurrence_rule",
+				Name:       "recurrence_rule",
+				ColumnType: "label",
+				DataType:   "varchar(500)",
+				IsNullable: true,
+			},
+			{
+				ColumnName: "recurrence_end_date",
+				Name:       "recurrence_end_date",
+				ColumnType: "datetime",
+				DataType:   "timestamp",
+				IsIndexed:  true,
+				IsNullable: true,
+			},
 		},
 	},
 	{
@@ -1727,6 +2112,14 @@ var StandardTables = []TableInfo{
 				DataType:   "text",
 				IsNullable: true,
 			},
+			{
+				Name:       "expires_at",
+				ColumnName: "expires_at",
+				ColumnType: "datetime",
+				DataType:   "timestamp",
+				IsIndexed:  true,
+				IsNullable: true,
+			},
 		},
 	},
 	{
@@ -2162,45 +2555,154 @@ var StandardTables = []TableInfo{
 		},
 	},
 	{
-		TableName:     USER_ACCOUNT_TABLE_NAME,
-		Icon:          "fa-user",
-		DefaultGroups: []string{"users"},
+		TableName:     WebauthnCredentialTableName,
+		Icon:          "fa-fingerprint",
+		IsHidden:      true,
+		DefaultGroups: []string{},
 		Columns: []api2go.ColumnInfo{
 			{
 				Name:       "name",
 				ColumnName: "name",
-				IsIndexed:  true,
-				DataType:   "varchar(80)",
+				DataType:   "varchar(100)",
+				IsNullable: true,
 				ColumnType: "label",
 			},
 			{
-				Name:       "email",
-				ColumnName: "email",
-				DataType:   "varchar(80)",
+				Name:       "credential_id",
+				ColumnName: "credential_id",
+				DataType:   "varchar(1400)",
 				IsIndexed:  true,
 				IsUnique:   true,
-				ColumnType: "email",
+				ColumnType: "label",
 			},
-
 			{
-				Name:       "password",
-				ColumnName: "password",
-				DataType:   "varchar(100)",
-				ColumnType: "password",
+				Name:           "public_key",
+				ColumnName:     "public_key",
+				DataType:       "text",
+				ExcludeFromApi: true,
+				ColumnType:     "content",
+			},
+			{
+				Name:       "attestation_type",
+				ColumnName: "attestation_type",
+				DataType:   "varchar(50)",
 				IsNullable: true,
+				ColumnType: "label",
 			},
 			{
-				Name:         "confirmed",
-				ColumnName:   "confirmed",
-				DataType:     "bool",
-				ColumnType:   "truefalse",
-				IsNullable:   false,
-				DefaultValue: "false",
+				Name:       "aaguid",
+				ColumnName: "aaguid",
+				DataType:   "varchar(50)",
+				IsNullable: true,
+				ColumnType: "label",
 			},
-		},
-		Validations: []ColumnTag{
 			{
-				ColumnName: "email",
+				Name:         "sign_count",
+				ColumnName:   "sign_count",
+				DataType:     "int(11)",
+				DefaultValue: "0",
+				ColumnType:   "measurement",
+			},
+			{
+				Name:       "last_used_at",
+				ColumnName: "last_used_at",
+				DataType:   "timestamp",
+				IsNullable: true,
+				ColumnType: "datetime",
+			},
+		},
+	},
+	{
+		TableName:     RecoveryCodeTableName,
+		Icon:          "fa-life-ring",
+		IsHidden:      true,
+		DefaultGroups: []string{},
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:           "code_hash",
+				ColumnName:     "code_hash",
+				DataType:       "varchar(64)",
+				IsIndexed:      true,
+				IsUnique:       true,
+				ExcludeFromApi: true,
+				ColumnType:     "label",
+			},
+			{
+				Name:       "used_at",
+				ColumnName: "used_at",
+				DataType:   "timestamp",
+				IsNullable: true,
+				ColumnType: "datetime",
+			},
+		},
+	},
+	{
+		TableName:     "user_ssh_key",
+		Icon:          "fa-key",
+		IsHidden:      true,
+		DefaultGroups: []string{},
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "name",
+				ColumnName: "name",
+				IsIndexed:  true,
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "public_key",
+				ColumnName: "public_key",
+				DataType:   "text",
+				ColumnType: "content",
+			},
+		},
+		Validations: []ColumnTag{
+			{
+				ColumnName: "public_key",
+				Tags:       "required",
+			},
+		},
+	},
+	{
+		TableName:     USER_ACCOUNT_TABLE_NAME,
+		Icon:          "fa-user",
+		DefaultGroups: []string{"users"},
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "name",
+				ColumnName: "name",
+				IsIndexed:  true,
+				DataType:   "varchar(80)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "email",
+				ColumnName: "email",
+				DataType:   "varchar(80)",
+				IsIndexed:  true,
+				IsUnique:   true,
+				ColumnType: "email",
+			},
+
+			{
+				Name:       "password",
+				ColumnName: "password",
+				DataType:   "varchar(100)",
+				ColumnType: "password",
+				IsNullable: true,
+			},
+			{
+				Name:         "confirmed",
+				ColumnName:   "confirmed",
+				DataType:     "bool",
+				ColumnType:   "truefalse",
+				IsNullable:   false,
+				DefaultValue: "false",
+			},
+		},
+		Validations: []ColumnTag{
+			{
+				ColumnName: "email",
 				Tags:       "email",
 			},
 			{
@@ -2232,6 +2734,13 @@ var StandardTables = []TableInfo{
 				DataType:   "varchar(80)",
 				ColumnType: "label",
 			},
+			{
+				Name:         "require_second_factor",
+				ColumnName:   "require_second_factor",
+				DataType:     "bool",
+				DefaultValue: "false",
+				ColumnType:   "truefalse",
+			},
 		},
 	},
 	{
@@ -2445,6 +2954,27 @@ var StandardTables = []TableInfo{
 				ColumnType: "json",
 				DataType:   "text",
 			},
+			{
+				Name:       "schedule",
+				ColumnName: "schedule",
+				ColumnType: "label",
+				DataType:   "varchar(100)",
+				IsNullable: true,
+			},
+			{
+				Name:       "watermark",
+				ColumnName: "watermark",
+				ColumnType: "label",
+				DataType:   "varchar(200)",
+				IsNullable: true,
+			},
+			{
+				Name:       "last_synced_at",
+				ColumnName: "last_synced_at",
+				ColumnType: "datetime",
+				DataType:   "timestamp",
+				IsNullable: true,
+			},
 		},
 	},
 	{
@@ -2908,6 +3438,573 @@ var StandardTables = []TableInfo{
 			},
 		},
 	},
+	{
+		TableName:     ActionJobTableName,
+		IsHidden:      true,
+		Icon:          "fa-tasks",
+		DefaultGroups: adminsGroup,
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "action_name",
+				ColumnName: "action_name",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "on_type",
+				ColumnName: "on_type",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+			},
+			{
+				Name:         "status",
+				ColumnName:   "status",
+				DataType:     "varchar(20)",
+				ColumnType:   "label",
+				IsIndexed:    true,
+				DefaultValue: "'" + ActionJobQueued + "'",
+			},
+			{
+				Name:         "progress",
+				ColumnName:   "progress",
+				DataType:     "int(11)",
+				ColumnType:   "value",
+				DefaultValue: "0",
+			},
+			{
+				Name:       "progress_message",
+				ColumnName: "progress_message",
+				DataType:   "varchar(500)",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "action_request",
+				ColumnName: "action_request",
+				DataType:   "text",
+				ColumnType: "json",
+			},
+			{
+				Name:       "responses",
+				ColumnName: "responses",
+				DataType:   "text",
+				ColumnType: "json",
+				IsNullable: true,
+			},
+			{
+				Name:       "error",
+				ColumnName: "error",
+				DataType:   "text",
+				ColumnType: "content",
+				IsNullable: true,
+			},
+			{
+				Name:       "started_at",
+				ColumnName: "started_at",
+				DataType:   "timestamp",
+				ColumnType: "datetime",
+				IsNullable: true,
+			},
+			{
+				Name:       "finished_at",
+				ColumnName: "finished_at",
+				DataType:   "timestamp",
+				ColumnType: "datetime",
+				IsNullable: true,
+			},
+		},
+	},
+	{
+		TableName:     ServerFunctionTableName,
+		IsHidden:      true,
+		Icon:          "fa-code",
+		DefaultGroups: adminsGroup,
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "name",
+				ColumnName: "name",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+				IsIndexed:  true,
+				IsUnique:   true,
+			},
+			{
+				Name:       "source",
+				ColumnName: "source",
+				DataType:   "text",
+				ColumnType: "content",
+			},
+			{
+				Name:         "enable",
+				ColumnName:   "enable",
+				DataType:     "bool",
+				ColumnType:   "truefalse",
+				DefaultValue: "true",
+			},
+		},
+	},
+	{
+		TableName:     ServerFunctionLogTableName,
+		IsHidden:      true,
+		Icon:          "fa-list",
+		DefaultGroups: adminsGroup,
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "function_name",
+				ColumnName: "function_name",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "invocation_id",
+				ColumnName: "invocation_id",
+				DataType:   "varchar(64)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "level",
+				ColumnName: "level",
+				DataType:   "varchar(10)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "message",
+				ColumnName: "message",
+				DataType:   "text",
+				ColumnType: "content",
+			},
+		},
+	},
+	{
+		TableName:     WebhookTableName,
+		IsHidden:      true,
+		Icon:          "fa-paper-plane",
+		DefaultGroups: adminsGroup,
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "name",
+				ColumnName: "name",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "url",
+				ColumnName: "url",
+				DataType:   "varchar(500)",
+				ColumnType: "url",
+			},
+			{
+				Name:       "table_name",
+				ColumnName: "table_name",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:         "events",
+				ColumnName:   "events",
+				DataType:     "varchar(100)",
+				ColumnType:   "label",
+				DefaultValue: "'create,update,delete'",
+			},
+			{
+				Name:       "filter",
+				ColumnName: "filter",
+				DataType:   "text",
+				ColumnType: "content",
+				IsNullable: true,
+			},
+			{
+				Name:       "secret",
+				ColumnName: "secret",
+				DataType:   "varchar(500)",
+				ColumnType: "encrypted",
+				IsNullable: true,
+			},
+			{
+				Name:         "enable",
+				ColumnName:   "enable",
+				DataType:     "bool",
+				ColumnType:   "truefalse",
+				DefaultValue: "true",
+			},
+		},
+	},
+	{
+		TableName:     WebhookDeliveryTableName,
+		IsHidden:      true,
+		Icon:          "fa-inbox",
+		DefaultGroups: adminsGroup,
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "webhook_id",
+				ColumnName: "webhook_id",
+				DataType:   "varchar(64)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "event",
+				ColumnName: "event",
+				DataType:   "varchar(20)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "table_name",
+				ColumnName: "table_name",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "payload",
+				ColumnName: "payload",
+				DataType:   "text",
+				ColumnType: "json",
+			},
+			{
+				Name:         "status",
+				ColumnName:   "status",
+				DataType:     "varchar(20)",
+				ColumnType:   "label",
+				IsIndexed:    true,
+				DefaultValue: "'" + WebhookDeliveryPending + "'",
+			},
+			{
+				Name:         "attempts",
+				ColumnName:   "attempts",
+				DataType:     "int(11)",
+				ColumnType:   "value",
+				DefaultValue: "0",
+			},
+			{
+				Name:       "next_attempt_at",
+				ColumnName: "next_attempt_at",
+				DataType:   "timestamp",
+				ColumnType: "datetime",
+				IsNullable: true,
+				IsIndexed:  true,
+			},
+			{
+				Name:       "response_code",
+				ColumnName: "response_code",
+				DataType:   "int(11)",
+				ColumnType: "value",
+				IsNullable: true,
+			},
+			{
+				Name:       "response_body",
+				ColumnName: "response_body",
+				DataType:   "text",
+				ColumnType: "content",
+				IsNullable: true,
+			},
+			{
+				Name:       "error",
+				ColumnName: "error",
+				DataType:   "text",
+				ColumnType: "content",
+				IsNullable: true,
+			},
+			{
+				Name:       "delivered_at",
+				ColumnName: "delivered_at",
+				DataType:   "timestamp",
+				ColumnType: "datetime",
+				IsNullable: true,
+			},
+		},
+	},
+	{
+		TableName:     InboundHookTableName,
+		IsHidden:      true,
+		Icon:          "fa-download",
+		DefaultGroups: adminsGroup,
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "name",
+				ColumnName: "name",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "target_table",
+				ColumnName: "target_table",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "target_action",
+				ColumnName: "target_action",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "column_mapping",
+				ColumnName: "column_mapping",
+				DataType:   "text",
+				ColumnType: "json",
+				IsNullable: true,
+			},
+			{
+				Name:         "signature_scheme",
+				ColumnName:   "signature_scheme",
+				DataType:     "varchar(20)",
+				ColumnType:   "label",
+				DefaultValue: "'" + InboundHookSignatureHmac + "'",
+			},
+			{
+				Name:       "signature_header",
+				ColumnName: "signature_header",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "secret",
+				ColumnName: "secret",
+				DataType:   "varchar(500)",
+				ColumnType: "encrypted",
+				IsNullable: true,
+			},
+			{
+				Name:         "enable",
+				ColumnName:   "enable",
+				DataType:     "bool",
+				ColumnType:   "truefalse",
+				DefaultValue: "true",
+			},
+		},
+	},
+	{
+		TableName:     InboundHookReceiptTableName,
+		IsHidden:      true,
+		Icon:          "fa-list",
+		DefaultGroups: adminsGroup,
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "hook_id",
+				ColumnName: "hook_id",
+				DataType:   "varchar(64)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "status",
+				ColumnName: "status",
+				DataType:   "varchar(20)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "headers",
+				ColumnName: "headers",
+				DataType:   "text",
+				ColumnType: "json",
+				IsNullable: true,
+			},
+			{
+				Name:       "body",
+				ColumnName: "body",
+				DataType:   "text",
+				ColumnType: "content",
+				IsNullable: true,
+			},
+			{
+				Name:       "result",
+				ColumnName: "result",
+				DataType:   "text",
+				ColumnType: "json",
+				IsNullable: true,
+			},
+			{
+				Name:       "error",
+				ColumnName: "error",
+				DataType:   "text",
+				ColumnType: "content",
+				IsNullable: true,
+			},
+		},
+	},
+	{
+		TableName:     OAuthClientTableName,
+		IsHidden:      true,
+		Icon:          "fa-id-card",
+		DefaultGroups: adminsGroup,
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "name",
+				ColumnName: "name",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "client_id",
+				ColumnName: "client_id",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+				IsIndexed:  true,
+				IsUnique:   true,
+			},
+			{
+				Name:       "client_secret",
+				ColumnName: "client_secret",
+				DataType:   "varchar(500)",
+				ColumnType: "encrypted",
+				IsNullable: true,
+			},
+			{
+				Name:       "redirect_uris",
+				ColumnName: "redirect_uris",
+				DataType:   "text",
+				ColumnType: "content",
+				IsNullable: true,
+			},
+			{
+				Name:         "grant_types",
+				ColumnName:   "grant_types",
+				DataType:     "varchar(200)",
+				ColumnType:   "label",
+				DefaultValue: "'authorization_code,refresh_token'",
+			},
+			{
+				Name:         "scopes",
+				ColumnName:   "scopes",
+				DataType:     "varchar(200)",
+				ColumnType:   "label",
+				DefaultValue: "'openid,profile,email'",
+			},
+			{
+				Name:         "skip_consent",
+				ColumnName:   "skip_consent",
+				DataType:     "bool",
+				ColumnType:   "truefalse",
+				DefaultValue: "false",
+			},
+			{
+				Name:         "enable",
+				ColumnName:   "enable",
+				DataType:     "bool",
+				ColumnType:   "truefalse",
+				DefaultValue: "true",
+			},
+		},
+	},
+	{
+		TableName:     OAuthGrantTableName,
+		IsHidden:      true,
+		Icon:          "fa-key",
+		DefaultGroups: adminsGroup,
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "kind",
+				ColumnName: "kind",
+				DataType:   "varchar(20)",
+				ColumnType: "label",
+			},
+			{
+				Name:       "token_hash",
+				ColumnName: "token_hash",
+				DataType:   "varchar(64)",
+				ColumnType: "label",
+				IsIndexed:  true,
+				IsUnique:   true,
+			},
+			{
+				Name:       "client_id",
+				ColumnName: "client_id",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "user_reference_id",
+				ColumnName: "user_reference_id",
+				DataType:   "varchar(64)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "scope",
+				ColumnName: "scope",
+				DataType:   "varchar(200)",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "redirect_uri",
+				ColumnName: "redirect_uri",
+				DataType:   "varchar(500)",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "code_challenge",
+				ColumnName: "code_challenge",
+				DataType:   "varchar(200)",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "code_challenge_method",
+				ColumnName: "code_challenge_method",
+				DataType:   "varchar(10)",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "nonce",
+				ColumnName: "nonce",
+				DataType:   "varchar(200)",
+				ColumnType: "label",
+				IsNullable: true,
+			},
+			{
+				Name:       "expires_at",
+				ColumnName: "expires_at",
+				DataType:   "timestamp",
+				ColumnType: "datetime",
+			},
+			{
+				Name:       "used_at",
+				ColumnName: "used_at",
+				DataType:   "timestamp",
+				ColumnType: "datetime",
+				IsNullable: true,
+			},
+		},
+	},
+	{
+		TableName:     OAuthConsentTableName,
+		IsHidden:      true,
+		Icon:          "fa-check-square",
+		DefaultGroups: adminsGroup,
+		Columns: []api2go.ColumnInfo{
+			{
+				Name:       "client_id",
+				ColumnName: "client_id",
+				DataType:   "varchar(100)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "user_reference_id",
+				ColumnName: "user_reference_id",
+				DataType:   "varchar(64)",
+				ColumnType: "label",
+				IsIndexed:  true,
+			},
+			{
+				Name:       "scope",
+				ColumnName: "scope",
+				DataType:   "varchar(200)",
+				ColumnType: "label",
+			},
+		},
+	},
 }
 
 //var StandardMarketplaces = []Marketplace{
@@ -2995,6 +4092,7 @@ type TableInfo struct {
 	IsStateTrackingEnabled bool     `db:"is_state_tracking_enabled"`
 	IsAuditEnabled         bool     `db:"is_audit_enabled"`
 	TranslationsEnabled    bool     `db:"translation_enabled"`
+	SoftDeleteEnabled      bool     `db:"soft_delete_enabled"`
 	DefaultGroups          []string `db:"default_groups"`
 	Validations            []ColumnTag
 	Conformations          []ColumnTag
@@ -0,0 +1,610 @@
+package resource
+
+import (
+	"encoding/csv"
+	json1 "encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artpar/api2go"
+	"github.com/artpar/xlsx/v2"
+	"github.com/xitongsys/parquet-go-source/local"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Formats of table data exports and imports
+const (
+	DataFormatJson    = "json"
+	DataFormatCsv     = "csv"
+	DataFormatNdjson  = "ndjson"
+	DataFormatXlsx    = "xlsx"
+	DataFormatParquet = "parquet"
+)
+
+// DataFormatContentTypes is the content type of a file of each data format
+var DataFormatContentTypes = map[string]string{
+	DataFormatJson:    "application/json",
+	DataFormatCsv:     "text/csv",
+	DataFormatNdjson:  "application/x-ndjson",
+	DataFormatXlsx:    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	DataFormatParquet: "application/vnd.apache.parquet",
+}
+
+// DataFormatOfFileName is the data format of a file by its extension, empty when the extension is not known
+func DataFormatOfFileName(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json":
+		return DataFormatJson
+	case ".csv":
+		return DataFormatCsv
+	case ".ndjson", ".jsonl":
+		return DataFormatNdjson
+	case ".xlsx":
+		return DataFormatXlsx
+	case ".parquet":
+		return DataFormatParquet
+	}
+	return ""
+}
+
+// DataWriter writes the rows of tables to a file of one of the data formats one row at a time, so exports do not
+// hold a table in memory. Only the json dump takes more than one table
+type DataWriter interface {
+	StartTable(tableName string, columns []api2go.ColumnInfo) error
+	WriteRow(row map[string]interface{}) error
+	Close() error
+}
+
+// NewDataWriter returns the DataWriter of the format writing to out
+func NewDataWriter(format string, out io.Writer) (DataWriter, error) {
+	switch format {
+	case DataFormatJson:
+		return &jsonDumpWriter{out: out}, nil
+	case DataFormatCsv:
+		return &csvDataWriter{out: csv.NewWriter(out)}, nil
+	case DataFormatNdjson:
+		return &ndjsonDataWriter{out: json1.NewEncoder(out)}, nil
+	case DataFormatXlsx:
+		return &xlsxDataWriter{builder: xlsx.NewStreamFileBuilder(out)}, nil
+	case DataFormatParquet:
+		return &parquetDataWriter{out: out}, nil
+	}
+	return nil, fmt.Errorf("unknown data format [%v]", format)
+}
+
+// dataCellString is the text of a value in the csv and xlsx formats
+func dataCellString(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return valueToString(value)
+}
+
+// selectColumns is the row with only the columns
+func selectColumns(row map[string]interface{}, columns []api2go.ColumnInfo) map[string]interface{} {
+	selected := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		selected[column.ColumnName] = row[column.ColumnName]
+	}
+	return selected
+}
+
+// jsonDumpWriter writes the daptin dump, an object of table names to their rows, which import_data restores
+type jsonDumpWriter struct {
+	out      io.Writer
+	columns  []api2go.ColumnInfo
+	started  bool
+	inTable  bool
+	firstRow bool
+}
+
+func (w *jsonDumpWriter) StartTable(tableName string, columns []api2go.ColumnInfo) error {
+	prefix := ","
+	if !w.started {
+		prefix = "{"
+		w.started = true
+	}
+	if w.inTable {
+		prefix = "]" + prefix
+	}
+	name, err := json1.Marshal(tableName)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w.out, prefix+string(name)+":[")
+	w.columns = columns
+	w.inTable = true
+	w.firstRow = true
+	return err
+}
+
+func (w *jsonDumpWriter) WriteRow(row map[string]interface{}) error {
+	data, err := json1.Marshal(selectColumns(row, w.columns))
+	if err != nil {
+		return err
+	}
+	if !w.firstRow {
+		data = append([]byte(","), data...)
+	}
+	w.firstRow = false
+	_, err = w.out.Write(data)
+	return err
+}
+
+func (w *jsonDumpWriter) Close() error {
+	suffix := "}"
+	if !w.started {
+		suffix = "{}"
+	} else if w.inTable {
+		suffix = "]}"
+	}
+	_, err := io.WriteString(w.out, suffix)
+	return err
+}
+
+// csvDataWriter writes a header line of the column names and then a line for each row
+type csvDataWriter struct {
+	out     *csv.Writer
+	columns []api2go.ColumnInfo
+}
+
+func (w *csvDataWriter) StartTable(tableName string, columns []api2go.ColumnInfo) error {
+	if w.columns != nil {
+		return errors.New("csv files take the rows of a single table")
+	}
+	w.columns = columns
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.ColumnName
+	}
+	return w.out.Write(header)
+}
+
+func (w *csvDataWriter) WriteRow(row map[string]interface{}) error {
+	record := make([]string, len(w.columns))
+	for i, column := range w.columns {
+		record[i] = dataCellString(row[column.ColumnName])
+	}
+	return w.out.Write(record)
+}
+
+func (w *csvDataWriter) Close() error {
+	w.out.Flush()
+	return w.out.Error()
+}
+
+// ndjsonDataWriter writes each row as a json object on its own line
+type ndjsonDataWriter struct {
+	out     *json1.Encoder
+	columns []api2go.ColumnInfo
+}
+
+func (w *ndjsonDataWriter) StartTable(tableName string, columns []api2go.ColumnInfo) error {
+	if w.columns != nil {
+		return errors.New("ndjson files take the rows of a single table")
+	}
+	w.columns = columns
+	return nil
+}
+
+func (w *ndjsonDataWriter) WriteRow(row map[string]interface{}) error {
+	return w.out.Encode(selectColumns(row, w.columns))
+}
+
+func (w *ndjsonDataWriter) Close() error {
+	return nil
+}
+
+// xlsxDataWriter writes a sheet named after the table with a header row, the rows are streamed to the zip
+type xlsxDataWriter struct {
+	builder *xlsx.StreamFileBuilder
+	file    *xlsx.StreamFile
+	columns []api2go.ColumnInfo
+}
+
+func (w *xlsxDataWriter) StartTable(tableName string, columns []api2go.ColumnInfo) error {
+	if w.file != nil {
+		return errors.New("xlsx files take the rows of a single table")
+	}
+	// sheet names are limited to 31 characters
+	sheetName := tableName
+	if len(sheetName) > 31 {
+		sheetName = sheetName[:31]
+	}
+	err := w.builder.AddSheet(sheetName, nil)
+	if err != nil {
+		return err
+	}
+	w.file, err = w.builder.Build()
+	if err != nil {
+		return err
+	}
+	w.columns = columns
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.ColumnName
+	}
+	return w.file.Write(header)
+}
+
+func (w *xlsxDataWriter) WriteRow(row map[string]interface{}) error {
+	cells := make([]string, len(w.columns))
+	for i, column := range w.columns {
+		cells[i] = dataCellString(row[column.ColumnName])
+	}
+	return w.file.Write(cells)
+}
+
+func (w *xlsxDataWriter) Close() error {
+	if w.file == nil {
+		return errors.New("no table was written to the xlsx file")
+	}
+	return w.file.Close()
+}
+
+// parquet types of the columns, by the start of their data type
+const (
+	parquetInt64   = "INT64"
+	parquetDouble  = "DOUBLE"
+	parquetBoolean = "BOOLEAN"
+	parquetString  = "UTF8"
+)
+
+func parquetTypeOf(column api2go.ColumnInfo) string {
+	dataType := strings.ToLower(column.DataType)
+	switch {
+	case strings.HasPrefix(dataType, "int"), strings.HasPrefix(dataType, "bigint"),
+		strings.HasPrefix(dataType, "smallint"), strings.HasPrefix(dataType, "tinyint"):
+		return parquetInt64
+	case strings.HasPrefix(dataType, "float"), strings.HasPrefix(dataType, "double"),
+		strings.HasPrefix(dataType, "real"), strings.HasPrefix(dataType, "decimal"),
+		strings.HasPrefix(dataType, "numeric"):
+		return parquetDouble
+	case strings.HasPrefix(dataType, "bool"):
+		return parquetBoolean
+	}
+	return parquetString
+}
+
+// parquetDataWriter writes the rows with a schema made from the data types of the columns, every column is optional.
+// Rows are held until a row group is full
+type parquetDataWriter struct {
+	out     io.Writer
+	writer  *writer.JSONWriter
+	columns []api2go.ColumnInfo
+	types   []string
+}
+
+// parquetRowGroupSize keeps the rows held by the writer small next to the default of 128M
+const parquetRowGroupSize = 16 * 1024 * 1024
+
+func (w *parquetDataWriter) StartTable(tableName string, columns []api2go.ColumnInfo) error {
+	if w.writer != nil {
+		return errors.New("parquet files take the rows of a single table")
+	}
+
+	fields := make([]map[string]interface{}, 0, len(columns))
+	w.types = make([]string, len(columns))
+	for i, column := range columns {
+		w.types[i] = parquetTypeOf(column)
+		fields = append(fields, map[string]interface{}{
+			"Tag": fmt.Sprintf("name=%v, type=%v, repetitiontype=OPTIONAL", column.ColumnName, w.types[i]),
+		})
+	}
+	schema, err := json1.Marshal(map[string]interface{}{
+		"Tag":    "name=parquet_go_root, repetitiontype=REQUIRED",
+		"Fields": fields,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.writer, err = writer.NewJSONWriterFromWriter(string(schema), w.out, 1)
+	if err != nil {
+		return err
+	}
+	w.writer.RowGroupSize = parquetRowGroupSize
+	w.columns = columns
+	return nil
+}
+
+func (w *parquetDataWriter) WriteRow(row map[string]interface{}) error {
+	values := make(map[string]interface{}, len(w.columns))
+	for i, column := range w.columns {
+		value := row[column.ColumnName]
+		if value == nil {
+			continue
+		}
+		text := dataCellString(value)
+		var err error
+		switch w.types[i] {
+		case parquetInt64:
+			values[column.ColumnName], err = strconv.ParseInt(text, 10, 64)
+		case parquetDouble:
+			values[column.ColumnName], err = strconv.ParseFloat(text, 64)
+		case parquetBoolean:
+			switch text {
+			case "1", "true":
+				values[column.ColumnName] = true
+			default:
+				values[column.ColumnName] = false
+			}
+		default:
+			values[column.ColumnName] = text
+		}
+		if err != nil {
+			return fmt.Errorf("value [%v] of column [%v] is not a number", text, column.ColumnName)
+		}
+	}
+	data, err := json1.Marshal(values)
+	if err != nil {
+		return err
+	}
+	return w.writer.Write(string(data))
+}
+
+func (w *parquetDataWriter) Close() error {
+	if w.writer == nil {
+		return errors.New("no table was written to the parquet file")
+	}
+	return w.writer.WriteStop()
+}
+
+// ReadDataRows reads the rows of a file of one of the data formats and calls each with every row, one row at a time.
+// Rows of the csv, ndjson, xlsx and parquet formats are of the tableName, a json dump names the table of its rows and
+// only the rows of the tableName are read from it when it is set. Empty csv and xlsx cells are read as nil
+func ReadDataRows(format string, in io.Reader, tableName string, each func(tableName string, row map[string]interface{}) error) error {
+	switch format {
+	case DataFormatJson:
+		return readJsonDumpRows(in, tableName, each)
+	case DataFormatCsv:
+		return readCsvRows(in, tableName, each)
+	case DataFormatNdjson:
+		return readNdjsonRows(in, tableName, each)
+	case DataFormatXlsx, DataFormatParquet:
+		// both are read from the end of the file, so they are spooled to disk first
+		spool, err := ioutil.TempFile("", "daptin-import-*."+format)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(spool.Name())
+		_, err = io.Copy(spool, in)
+		spool.Close()
+		if err != nil {
+			return err
+		}
+		if format == DataFormatXlsx {
+			return readXlsxRows(spool.Name(), tableName, each)
+		}
+		return readParquetRows(spool.Name(), tableName, each)
+	}
+	return fmt.Errorf("unknown data format [%v]", format)
+}
+
+// jsonNumbers replaces the json.Number values of the row with int64 or float64 values
+func jsonNumbers(row map[string]interface{}) map[string]interface{} {
+	for key, value := range row {
+		number, ok := value.(json1.Number)
+		if !ok {
+			continue
+		}
+		if intValue, err := number.Int64(); err == nil {
+			row[key] = intValue
+		} else if floatValue, err := number.Float64(); err == nil {
+			row[key] = floatValue
+		} else {
+			row[key] = number.String()
+		}
+	}
+	return row
+}
+
+func expectJsonDelim(decoder *json1.Decoder, delim json1.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected [%v] in the json dump, found [%v]", delim, token)
+	}
+	return nil
+}
+
+func readJsonDumpRows(in io.Reader, tableName string, each func(tableName string, row map[string]interface{}) error) error {
+	decoder := json1.NewDecoder(in)
+	decoder.UseNumber()
+
+	err := expectJsonDelim(decoder, json1.Delim('{'))
+	if err != nil {
+		return err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		dumpTable, _ := token.(string)
+		err = expectJsonDelim(decoder, json1.Delim('['))
+		if err != nil {
+			return err
+		}
+		for decoder.More() {
+			if tableName != "" && dumpTable != tableName {
+				var skip json1.RawMessage
+				if err = decoder.Decode(&skip); err != nil {
+					return err
+				}
+				continue
+			}
+			row := make(map[string]interface{})
+			if err = decoder.Decode(&row); err != nil {
+				return err
+			}
+			if err = each(dumpTable, jsonNumbers(row)); err != nil {
+				return err
+			}
+		}
+		err = expectJsonDelim(decoder, json1.Delim(']'))
+		if err != nil {
+			return err
+		}
+	}
+	return expectJsonDelim(decoder, json1.Delim('}'))
+}
+
+func readNdjsonRows(in io.Reader, tableName string, each func(tableName string, row map[string]interface{}) error) error {
+	decoder := json1.NewDecoder(in)
+	decoder.UseNumber()
+	for {
+		row := make(map[string]interface{})
+		err := decoder.Decode(&row)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = each(tableName, jsonNumbers(row)); err != nil {
+			return err
+		}
+	}
+}
+
+// cellsToRow is the row of the cells under the header, empty cells are nil
+func cellsToRow(header []string, cells []string) map[string]interface{} {
+	row := make(map[string]interface{}, len(header))
+	for i, column := range header {
+		if i < len(cells) && cells[i] != "" {
+			row[column] = cells[i]
+		} else {
+			row[column] = nil
+		}
+	}
+	return row
+}
+
+func readCsvRows(in io.Reader, tableName string, each func(tableName string, row map[string]interface{}) error) error {
+	csvReader := csv.NewReader(in)
+	csvReader.FieldsPerRecord = -1
+
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	header = append([]string{}, header...)
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = each(tableName, cellsToRow(header, record)); err != nil {
+			return err
+		}
+	}
+}
+
+// readXlsxRows reads the first sheet, the first row of which is the header. Cells are kept on disk while reading
+func readXlsxRows(filePath string, tableName string, each func(tableName string, row map[string]interface{}) error) error {
+	file, err := xlsx.OpenFile(filePath, xlsx.UseDiskVCellStore)
+	if err != nil {
+		return err
+	}
+	if len(file.Sheets) == 0 {
+		return nil
+	}
+
+	var header []string
+	return file.Sheets[0].ForEachRow(func(r *xlsx.Row) error {
+		cells := make([]string, 0)
+		err := r.ForEachCell(func(c *xlsx.Cell) error {
+			value, err := c.FormattedValue()
+			if err != nil {
+				value = c.String()
+			}
+			cells = append(cells, value)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if header == nil {
+			header = cells
+			return nil
+		}
+		return each(tableName, cellsToRow(header, cells))
+	})
+}
+
+// parquetReadBatch is the number of rows read from a parquet file at a time
+const parquetReadBatch = 1000
+
+func readParquetRows(filePath string, tableName string, each func(tableName string, row map[string]interface{}) error) error {
+	file, err := local.NewLocalFileReader(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	parquetReader, err := reader.NewParquetReader(file, nil, 1)
+	if err != nil {
+		return err
+	}
+	defer parquetReader.ReadStop()
+
+	// rows are read into structs with a field for each column, named by the in-name of the column
+	columnNames := make(map[string]string)
+	for _, info := range parquetReader.SchemaHandler.Infos {
+		columnNames[info.InName] = info.ExName
+	}
+
+	remaining := int(parquetReader.GetNumRows())
+	for remaining > 0 {
+		count := parquetReadBatch
+		if remaining < count {
+			count = remaining
+		}
+		records, err := parquetReader.ReadByNumber(count)
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		remaining -= len(records)
+
+		for _, record := range records {
+			value := reflect.ValueOf(record)
+			row := make(map[string]interface{}, value.NumField())
+			for i := 0; i < value.NumField(); i++ {
+				field := value.Field(i)
+				if field.Kind() == reflect.Ptr {
+					if field.IsNil() {
+						row[columnNames[value.Type().Field(i).Name]] = nil
+						continue
+					}
+					field = field.Elem()
+				}
+				row[columnNames[value.Type().Field(i).Name]] = field.Interface()
+			}
+			if err = each(tableName, row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
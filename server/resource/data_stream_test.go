@@ -0,0 +1,115 @@
+package resource
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/artpar/api2go"
+)
+
+func TestDataFormatOfFileName(t *testing.T) {
+
+	formats := map[string]string{
+		"dump.json":         DataFormatJson,
+		"rows.CSV":          DataFormatCsv,
+		"rows.jsonl":        DataFormatNdjson,
+		"exports/rows.xlsx": DataFormatXlsx,
+		"rows.parquet":      DataFormatParquet,
+		"rows.yaml":         "",
+	}
+	for fileName, format := range formats {
+		if found := DataFormatOfFileName(fileName); found != format {
+			t.Errorf("Expected [%v] to be [%v], found [%v]", fileName, format, found)
+		}
+	}
+}
+
+func TestDataRowsRoundTrip(t *testing.T) {
+
+	columns := []api2go.ColumnInfo{
+		{ColumnName: "id", DataType: "INTEGER"},
+		{ColumnName: "name", DataType: "varchar(100)"},
+		{ColumnName: "score", DataType: "float"},
+		{ColumnName: "active", DataType: "bool"},
+	}
+	rows := []map[string]interface{}{
+		{"id": int64(1), "name": "first, with a comma", "score": 1.5, "active": true, "hidden": "left out"},
+		{"id": int64(2), "name": nil, "score": int64(3), "active": int64(0)},
+	}
+
+	for _, format := range []string{DataFormatJson, DataFormatCsv, DataFormatNdjson, DataFormatXlsx, DataFormatParquet} {
+		var out bytes.Buffer
+		dataWriter, err := NewDataWriter(format, &out)
+		if err != nil {
+			t.Fatalf("Failed to create a [%v] writer: %v", format, err)
+		}
+		if err = dataWriter.StartTable("item", columns); err != nil {
+			t.Fatalf("Failed to start a [%v] table: %v", format, err)
+		}
+		for _, row := range rows {
+			if err = dataWriter.WriteRow(row); err != nil {
+				t.Fatalf("Failed to write a [%v] row: %v", format, err)
+			}
+		}
+		if err = dataWriter.Close(); err != nil {
+			t.Fatalf("Failed to close the [%v] writer: %v", format, err)
+		}
+
+		read := make([]map[string]interface{}, 0)
+		err = ReadDataRows(format, &out, "item", func(tableName string, row map[string]interface{}) error {
+			if tableName != "item" {
+				t.Errorf("Expected the [%v] rows to be of item, found [%v]", format, tableName)
+			}
+			read = append(read, row)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Failed to read the [%v] rows: %v", format, err)
+		}
+		if len(read) != 2 {
+			t.Fatalf("Expected 2 [%v] rows, found %d", format, len(read))
+		}
+		if _, ok := read[0]["hidden"]; ok {
+			t.Errorf("Expected the [%v] rows to have only the selected columns", format)
+		}
+		if fmt.Sprintf("%v", read[0]["id"]) != "1" || fmt.Sprintf("%v", read[0]["name"]) != "first, with a comma" ||
+			fmt.Sprintf("%v", read[0]["score"]) != "1.5" || read[1]["name"] != nil {
+			t.Errorf("Unexpected [%v] rows %v", format, read)
+		}
+	}
+}
+
+func TestJsonDumpTables(t *testing.T) {
+
+	var out bytes.Buffer
+	dataWriter, _ := NewDataWriter(DataFormatJson, &out)
+	columns := []api2go.ColumnInfo{{ColumnName: "name"}}
+	for _, tableName := range []string{"first", "second"} {
+		if err := dataWriter.StartTable(tableName, columns); err != nil {
+			t.Fatalf("Failed to start table [%v]: %v", tableName, err)
+		}
+		dataWriter.WriteRow(map[string]interface{}{"name": tableName + "-1"})
+		dataWriter.WriteRow(map[string]interface{}{"name": tableName + "-2"})
+	}
+	dataWriter.Close()
+
+	if out.String() != `{"first":[{"name":"first-1"},{"name":"first-2"}],"second":[{"name":"second-1"},{"name":"second-2"}]}` {
+		t.Fatalf("Unexpected dump %v", out.String())
+	}
+
+	names := make([]string, 0)
+	err := ReadDataRows(DataFormatJson, bytes.NewReader(out.Bytes()), "second", func(tableName string, row map[string]interface{}) error {
+		names = append(names, tableName+":"+row["name"].(string))
+		return nil
+	})
+	if err != nil || fmt.Sprintf("%v", names) != "[second:second-1 second:second-2]" {
+		t.Errorf("Expected only the rows of the second table, found %v %v", names, err)
+	}
+
+	csvWriter, _ := NewDataWriter(DataFormatCsv, &out)
+	csvWriter.StartTable("first", columns)
+	if err = csvWriter.StartTable("second", columns); err == nil {
+		t.Errorf("Expected a csv file to take a single table")
+	}
+}
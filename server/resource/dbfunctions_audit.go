@@ -0,0 +1,284 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/doug-martin/goqu/v9"
+)
+
+// AuditFieldChange is the change of a single field of an object
+type AuditFieldChange struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+// AuditChange is a change made to an object. Version is the reference id of the audit row, which holds the object
+// as it was before the change, and can be passed to restore_version
+type AuditChange struct {
+	Version   string                 `json:"version"`
+	Action    string                 `json:"action"`
+	ChangedAt interface{}            `json:"changed_at"`
+	Actor     map[string]interface{} `json:"actor"`
+	Changes   []AuditFieldChange     `json:"changes"`
+}
+
+// hiddenAuditColumnTypes are the column types whose values are not shown in the history, only that they changed
+var hiddenAuditColumnTypes = map[string]bool{
+	"password":  true,
+	"encrypted": true,
+}
+
+// AuditedColumns returns the columns of the table which are compared and restored from audit rows. The standard
+// columns are left out, and so is the user_account_id since audit rows hold the user who made the change in it
+func (dr *DbResource) AuditedColumns() []api2go.ColumnInfo {
+	columns := make([]api2go.ColumnInfo, 0)
+	if dr.tableInfo == nil {
+		return columns
+	}
+	for _, column := range dr.tableInfo.Columns {
+		if IsStandardColumn(column.ColumnName) || column.ColumnName == USER_ACCOUNT_ID_COLUMN {
+			continue
+		}
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+// comparableAuditValue turns a value read from the table or its audit table into a value which compares equal
+// when the stored data is the same, whichever way the driver returned it
+func comparableAuditValue(column api2go.ColumnInfo, value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case []byte:
+		value = string(v)
+	}
+
+	stringValue := valueToString(value)
+	switch column.ColumnType {
+	case "datetime", "date", "time", "timestamp":
+		if stringValue == "" {
+			return nil
+		}
+		if parsed, err := dateparse.ParseAny(stringValue); err == nil {
+			return parsed.UTC().Format(time.RFC3339)
+		}
+	}
+	return stringValue
+}
+
+// DiffAuditValues returns the fields which differ between two versions of an object, in the order of the columns
+func DiffAuditValues(columns []api2go.ColumnInfo, from map[string]interface{}, to map[string]interface{}) []AuditFieldChange {
+	changes := make([]AuditFieldChange, 0)
+	for _, column := range columns {
+		fromValue := comparableAuditValue(column, from[column.ColumnName])
+		toValue := comparableAuditValue(column, to[column.ColumnName])
+		if fromValue == toValue {
+			continue
+		}
+		change := AuditFieldChange{
+			Field: column.ColumnName,
+			From:  fromValue,
+			To:    toValue,
+		}
+		if hiddenAuditColumnTypes[column.ColumnType] {
+			change.From = nil
+			change.To = nil
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// GetAuditRows returns the audit rows of an object, oldest first
+func (dr *DbResource) GetAuditRows(referenceId string) ([]map[string]interface{}, error) {
+
+	if dr.tableInfo == nil || !dr.tableInfo.IsAuditEnabled {
+		return nil, errors.New("audit is not enabled for this table")
+	}
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("*")).From(dr.tableInfo.TableName + "_audit").
+		Where(goqu.Ex{"source_reference_id": referenceId}).Order(goqu.C("id").Asc()).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := dr.connection.Queryx(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	auditRows := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		row := make(map[string]interface{})
+		err = rows.MapScan(row)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range row {
+			if bytes, ok := value.([]byte); ok {
+				row[key] = string(bytes)
+			}
+		}
+		auditRows = append(auditRows, row)
+	}
+
+	return auditRows, rows.Err()
+}
+
+// GetAuditRow returns an audit row of the table by its reference id
+func (dr *DbResource) GetAuditRow(version string) (map[string]interface{}, error) {
+
+	if dr.tableInfo == nil || !dr.tableInfo.IsAuditEnabled {
+		return nil, errors.New("audit is not enabled for this table")
+	}
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("*")).From(dr.tableInfo.TableName + "_audit").
+		Where(goqu.Ex{"reference_id": version}).Limit(1).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := dr.connection.Queryx(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, fmt.Errorf("no such version [%v] of [%v]", version, dr.tableInfo.TableName)
+	}
+	row := make(map[string]interface{})
+	err = rows.MapScan(row)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range row {
+		if bytes, ok := value.([]byte); ok {
+			row[key] = string(bytes)
+		}
+	}
+	return row, nil
+}
+
+// GetAuditHistory returns the changes made to an object, oldest first. Every audit row is compared with the next
+// one, and the last with the object as it is now. When the object does not exist anymore the last change is its
+// deletion
+func (dr *DbResource) GetAuditHistory(referenceId string) ([]AuditChange, error) {
+
+	auditRows, err := dr.GetAuditRows(referenceId)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := dr.GetReferenceIdToObject(dr.tableInfo.TableName, referenceId)
+	if err != nil {
+		current = nil
+	}
+
+	actors, err := dr.getAuditActors(auditRows)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := dr.AuditedColumns()
+	history := make([]AuditChange, 0, len(auditRows))
+	for i, auditRow := range auditRows {
+
+		change := AuditChange{
+			Version:   valueToString(auditRow["reference_id"]),
+			Action:    "update",
+			ChangedAt: auditRow["created_at"],
+			Actor:     actors[valueToString(auditRow[USER_ACCOUNT_ID_COLUMN])],
+		}
+
+		var next map[string]interface{}
+		if i+1 < len(auditRows) {
+			next = auditRows[i+1]
+		} else {
+			next = current
+		}
+
+		if next == nil {
+			change.Action = "delete"
+			change.Changes = make([]AuditFieldChange, 0)
+		} else {
+			change.Changes = DiffAuditValues(columns, auditRow, next)
+		}
+		history = append(history, change)
+	}
+
+	return history, nil
+}
+
+// getAuditActors maps the user account ids of the audit rows to the reference id and email of the user
+func (dr *DbResource) getAuditActors(auditRows []map[string]interface{}) (map[string]map[string]interface{}, error) {
+
+	actors := make(map[string]map[string]interface{})
+	userIds := make([]interface{}, 0)
+	for _, auditRow := range auditRows {
+		userId := auditRow[USER_ACCOUNT_ID_COLUMN]
+		if userId == nil {
+			continue
+		}
+		userIds = append(userIds, userId)
+	}
+	if len(userIds) == 0 {
+		return actors, nil
+	}
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("id"), goqu.C("reference_id"), goqu.C("email")).
+		From(USER_ACCOUNT_TABLE_NAME).Where(goqu.Ex{"id": userIds}).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := dr.connection.Queryx(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		row := make(map[string]interface{})
+		err = rows.MapScan(row)
+		if err != nil {
+			return nil, err
+		}
+		actors[valueToString(row["id"])] = map[string]interface{}{
+			"reference_id": valueToString(row["reference_id"]),
+			"email":        valueToString(row["email"]),
+		}
+	}
+
+	return actors, rows.Err()
+}
+
+// PruneAuditRows deletes the audit rows of the table created before the time, and returns how many were deleted
+func (dr *DbResource) PruneAuditRows(before time.Time) (int64, error) {
+
+	if dr.tableInfo == nil || !dr.tableInfo.IsAuditEnabled {
+		return 0, nil
+	}
+
+	query, args, err := statementbuilder.Squirrel.Delete(dr.tableInfo.TableName + "_audit").
+		Where(goqu.C("created_at").Lt(before)).ToSQL()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := dr.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
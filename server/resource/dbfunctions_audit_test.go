@@ -0,0 +1,50 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/artpar/api2go"
+)
+
+func TestDiffAuditValues(t *testing.T) {
+
+	columns := []api2go.ColumnInfo{
+		{ColumnName: "title", ColumnType: "label"},
+		{ColumnName: "pages", ColumnType: "measurement"},
+		{ColumnName: "published_at", ColumnType: "datetime"},
+		{ColumnName: "secret", ColumnType: "password"},
+		{ColumnName: "summary", ColumnType: "content"},
+	}
+
+	publishedAt := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	from := map[string]interface{}{
+		"title":        []byte("Old title"),
+		"pages":        int64(120),
+		"published_at": "2020-03-04 05:06:07",
+		"secret":       "hash-one",
+		"summary":      nil,
+	}
+	to := map[string]interface{}{
+		"title":        "New title",
+		"pages":        "120",
+		"published_at": publishedAt,
+		"secret":       "hash-two",
+		"summary":      "added",
+	}
+
+	changes := DiffAuditValues(columns, from, to)
+	expected := []AuditFieldChange{
+		{Field: "title", From: "Old title", To: "New title"},
+		{Field: "secret", From: nil, To: nil},
+		{Field: "summary", From: nil, To: "added"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected changes %v, found %v", expected, changes)
+	}
+
+	if changes = DiffAuditValues(columns, to, to); len(changes) != 0 {
+		t.Errorf("Expected no changes between equal versions, found %v", changes)
+	}
+}
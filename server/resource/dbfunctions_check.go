@@ -337,6 +337,14 @@ func CreateAMapOfColumnsWeWantInTheFinalTable(tableInfo *TableInfo) (map[string]
 		}
 	}
 
+	if tableInfo.SoftDeleteEnabled {
+		if _, ok := colInfoMap[SoftDeleteColumn.ColumnName]; !ok {
+			colInfoMap[SoftDeleteColumn.ColumnName] = SoftDeleteColumn
+			columnsWeWant[SoftDeleteColumn.ColumnName] = false
+			finalColumnList = append(finalColumnList, SoftDeleteColumn)
+		}
+	}
+
 	// first fist column names for each column, if they were initially left blank.
 	for _, c := range tableInfo.Columns {
 		_, ok := colInfoMap[c.ColumnName]
@@ -1,10 +1,13 @@
 package resource
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/artpar/api2go"
 	"github.com/daptin/daptin/server/auth"
 	"github.com/daptin/daptin/server/database"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/doug-martin/goqu/v9"
 	"github.com/jinzhu/copier"
 	"github.com/jmoiron/sqlx"
 	log "github.com/sirupsen/logrus"
@@ -439,7 +442,7 @@ func CheckAuditTables(config *CmsConfig) {
 			Name:       "source_reference_id",
 			ColumnName: "source_reference_id",
 			ColumnType: "label",
-			DataType:   "varchar(30)",
+			DataType:   "varchar(64)",
 			IsNullable: false,
 		})
 
@@ -512,6 +515,48 @@ func CheckAuditTables(config *CmsConfig) {
 
 }
 
+// WidenAuditSourceReferenceIds alters source_reference_id of audit tables created when it was a varchar(30) to a
+// varchar(64), as new audit tables have it. SQLite does not enforce the length of a varchar and is left as it is
+func WidenAuditSourceReferenceIds(config *CmsConfig, db database.DatabaseConnection) {
+
+	var alterQuery, currentSchema string
+	switch db.DriverName() {
+	case "mysql":
+		alterQuery = "alter table %v modify source_reference_id varchar(64) not null"
+		currentSchema = "database()"
+	case "postgres":
+		alterQuery = "alter table %v alter column source_reference_id type varchar(64)"
+		currentSchema = "current_schema()"
+	default:
+		return
+	}
+
+	for _, table := range config.Tables {
+		if !EndsWithCheck(table.TableName, "_audit") {
+			continue
+		}
+
+		var length sql.NullInt64
+		query, args, err := statementbuilder.Squirrel.Select(goqu.C("character_maximum_length")).
+			From(goqu.S("information_schema").Table("columns")).Where(goqu.Ex{
+			"table_name":  table.TableName,
+			"column_name": "source_reference_id",
+		}, goqu.C("table_schema").Eq(goqu.L(currentSchema))).ToSQL()
+		if err != nil {
+			CheckErr(err, "Failed to create audit column length query")
+			return
+		}
+		err = db.QueryRowx(query, args...).Scan(&length)
+		if err != nil || !length.Valid || length.Int64 >= 64 {
+			continue
+		}
+
+		log.Printf("Widening source_reference_id of [%v] from varchar(%d) to varchar(64)", table.TableName, length.Int64)
+		_, err = db.Exec(fmt.Sprintf(alterQuery, table.TableName))
+		CheckErr(err, "Failed to widen source_reference_id of [%v]", table.TableName)
+	}
+}
+
 func convertRelationsToColumns(relations []api2go.TableRelation, config *CmsConfig) {
 	existingRelationMap := make(map[string]bool)
 
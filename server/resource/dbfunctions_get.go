@@ -152,6 +152,7 @@ type SubSite struct {
 	UserId       *int64 `db:"user_account_id"`
 	ReferenceId  string `db:"reference_id"`
 	Enable       bool   `db:"enable"`
+	EnableHttps  bool   `db:"enable_https"`
 }
 
 type CloudStore struct {
@@ -413,7 +414,7 @@ func (resource *DbResource) GetAllSites() ([]SubSite, error) {
 		goqu.I("s.cloud_store_id"),
 		goqu.I("s."+USER_ACCOUNT_ID_COLUMN), goqu.I("s.path"),
 		goqu.I("s.reference_id"), goqu.I("s.id"), goqu.I("s.enable"),
-		goqu.I("s.site_type"), goqu.I("s.ftp_enabled")).
+		goqu.I("s.site_type"), goqu.I("s.ftp_enabled"), goqu.I("s.enable_https")).
 		From(goqu.T("site").As("s")).ToSQL()
 	if err != nil {
 		return sites, err
@@ -0,0 +1,286 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	uuid "github.com/artpar/go.uuid"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/daptin/daptin/server/translation"
+	"github.com/doug-martin/goqu/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// TranslatableColumnTypes are the column types whose values are sent to translators
+var TranslatableColumnTypes = map[string]bool{
+	"label":    true,
+	"name":     true,
+	"content":  true,
+	"html":     true,
+	"markdown": true,
+}
+
+// TranslationCoverage is how much of a table is translated into a language
+type TranslationCoverage struct {
+	Language         string  `json:"language"`
+	Rows             int     `json:"rows"`
+	TranslatedRows   int     `json:"translated_rows"`
+	Fields           int     `json:"fields"`
+	TranslatedFields int     `json:"translated_fields"`
+	Coverage         float64 `json:"coverage"`
+}
+
+// TranslatableColumns returns the columns of the table which are copied to its translation table and hold text
+func (dr *DbResource) TranslatableColumns() []string {
+	columns := make([]string, 0)
+	if dr.tableInfo == nil {
+		return columns
+	}
+	for _, column := range dr.tableInfo.Columns {
+		if column.ExcludeFromApi || column.IsForeignKey || IsStandardColumn(column.ColumnName) {
+			continue
+		}
+		if TranslatableColumnTypes[column.ColumnType] {
+			columns = append(columns, column.ColumnName)
+		}
+	}
+	return columns
+}
+
+// GetTranslationUnits returns a unit for every non empty translatable field of the table, with its translation
+// into the language as the target, untranslated fields have an empty target
+func (dr *DbResource) GetTranslationUnits(language string) ([]translation.Unit, error) {
+
+	if dr.tableInfo == nil || !dr.tableInfo.TranslationsEnabled {
+		return nil, errors.New("translations are not enabled for this table")
+	}
+
+	tableName := dr.tableInfo.TableName
+	columns := dr.TranslatableColumns()
+	units := make([]translation.Unit, 0)
+	if len(columns) == 0 {
+		return units, nil
+	}
+
+	selectColumns := []interface{}{goqu.I("t.reference_id").As("row_reference_id")}
+	for i, column := range columns {
+		selectColumns = append(selectColumns,
+			goqu.I("t."+column).As(fmt.Sprintf("source_%d", i)),
+			goqu.I("i."+column).As(fmt.Sprintf("target_%d", i)))
+	}
+
+	query, args, err := statementbuilder.Squirrel.Select(selectColumns...).
+		From(goqu.T(tableName).As("t")).
+		LeftJoin(goqu.T(tableName+"_i18n").As("i"), goqu.On(
+			goqu.I("i.translation_reference_id").Eq(goqu.I("t.id")),
+			goqu.I("i.language_id").Eq(language),
+		)).
+		Order(goqu.I("t.id").Asc()).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := dr.connection.Queryx(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seenRows := make(map[string]bool)
+	for rows.Next() {
+		row := make(map[string]interface{})
+		err = rows.MapScan(row)
+		if err != nil {
+			return nil, err
+		}
+		referenceId := valueToString(row["row_reference_id"])
+		if seenRows[referenceId] {
+			continue
+		}
+		seenRows[referenceId] = true
+
+		for i, column := range columns {
+			source := valueToString(row[fmt.Sprintf("source_%d", i)])
+			if source == "" {
+				continue
+			}
+			units = append(units, translation.Unit{
+				ReferenceId: referenceId,
+				Column:      column,
+				Source:      source,
+				Target:      valueToString(row[fmt.Sprintf("target_%d", i)]),
+			})
+		}
+	}
+
+	return units, rows.Err()
+}
+
+// GetTranslationLanguages returns the languages the table has translations for
+func (dr *DbResource) GetTranslationLanguages() ([]string, error) {
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("language_id")).Distinct().
+		From(dr.tableInfo.TableName + "_i18n").ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	languages := make([]string, 0)
+	err = dr.connection.Select(&languages, query, args...)
+	sort.Strings(languages)
+	return languages, err
+}
+
+// GetTranslationCoverage counts the rows and fields of the table translated into each of the languages
+func (dr *DbResource) GetTranslationCoverage(languages []string) ([]TranslationCoverage, error) {
+
+	coverageList := make([]TranslationCoverage, 0, len(languages))
+	for _, language := range languages {
+		units, err := dr.GetTranslationUnits(language)
+		if err != nil {
+			return nil, err
+		}
+
+		coverage := TranslationCoverage{
+			Language: language,
+		}
+		rows := make(map[string]bool)
+		translatedRows := make(map[string]bool)
+		for _, unit := range units {
+			rows[unit.ReferenceId] = true
+			coverage.Fields++
+			if unit.Target != "" {
+				coverage.TranslatedFields++
+				translatedRows[unit.ReferenceId] = true
+			}
+		}
+		coverage.Rows = len(rows)
+		coverage.TranslatedRows = len(translatedRows)
+		if coverage.Fields > 0 {
+			coverage.Coverage = float64(coverage.TranslatedFields) * 100 / float64(coverage.Fields)
+		}
+		coverageList = append(coverageList, coverage)
+	}
+
+	return coverageList, nil
+}
+
+// SaveTranslations writes the targets of the units into the translation rows of the language, creating the rows
+// which do not exist yet. It returns the number of fields written, units with an empty target are skipped
+func (dr *DbResource) SaveTranslations(language string, units []translation.Unit) (int, error) {
+
+	if dr.tableInfo == nil || !dr.tableInfo.TranslationsEnabled {
+		return 0, errors.New("translations are not enabled for this table")
+	}
+	if language == "" {
+		return 0, errors.New("no language for the translations")
+	}
+
+	tableName := dr.tableInfo.TableName
+	translatable := make(map[string]bool)
+	for _, column := range dr.TranslatableColumns() {
+		translatable[column] = true
+	}
+
+	valuesByRow := make(map[string]map[string]interface{})
+	referenceIds := make([]string, 0)
+	for _, unit := range units {
+		if unit.Target == "" {
+			continue
+		}
+		if !translatable[unit.Column] {
+			return 0, fmt.Errorf("column [%v] of [%v] is not translatable", unit.Column, tableName)
+		}
+		values, ok := valuesByRow[unit.ReferenceId]
+		if !ok {
+			values = make(map[string]interface{})
+			valuesByRow[unit.ReferenceId] = values
+			referenceIds = append(referenceIds, unit.ReferenceId)
+		}
+		values[unit.Column] = unit.Target
+	}
+	if len(referenceIds) == 0 {
+		return 0, nil
+	}
+
+	idMap, err := dr.GetReferenceIdListToIdList(tableName, referenceIds)
+	if err != nil {
+		return 0, err
+	}
+
+	transaction, err := dr.connection.Beginx()
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for _, referenceId := range referenceIds {
+		id, ok := idMap[referenceId]
+		if !ok {
+			log.Warnf("Skipping translations for unknown row [%v][%v]", tableName, referenceId)
+			continue
+		}
+		values := valuesByRow[referenceId]
+
+		query, args, err := statementbuilder.Squirrel.Select(goqu.C("id")).From(tableName + "_i18n").
+			Where(goqu.Ex{"translation_reference_id": id, "language_id": language}).Limit(1).ToSQL()
+		if err != nil {
+			transaction.Rollback()
+			return 0, err
+		}
+		var translationIds []int64
+		err = transaction.Select(&translationIds, query, args...)
+		if err != nil {
+			transaction.Rollback()
+			return 0, err
+		}
+
+		record := goqu.Record{}
+		for column, value := range values {
+			record[column] = value
+		}
+		record["updated_at"] = time.Now()
+
+		if len(translationIds) > 0 {
+			query, args, err = statementbuilder.Squirrel.Update(tableName + "_i18n").Prepared(true).
+				Set(record).Where(goqu.Ex{"id": translationIds[0]}).ToSQL()
+		} else {
+			u, _ := uuid.NewV4()
+			record["reference_id"] = u.String()
+			record["language_id"] = language
+			record["translation_reference_id"] = id
+			record["permission"] = dr.model.GetDefaultPermission()
+			record["created_at"] = time.Now()
+			query, args, err = statementbuilder.Squirrel.Insert(tableName + "_i18n").Prepared(true).
+				Rows(record).ToSQL()
+		}
+		if err != nil {
+			transaction.Rollback()
+			return 0, err
+		}
+
+		_, err = transaction.Exec(query, args...)
+		if err != nil {
+			transaction.Rollback()
+			return 0, err
+		}
+		written += len(values)
+	}
+
+	return written, transaction.Commit()
+}
+
+// LanguageChain returns the languages to read translations in, most preferred first. It is the language
+// preference of the request followed by the configured fallback languages
+func LanguageChain(ctx context.Context) []string {
+	if chain, ok := ctx.Value("language_chain").([]string); ok {
+		return chain
+	}
+	if preference, ok := ctx.Value("language_preference").([]string); ok {
+		return preference
+	}
+	return []string{}
+}
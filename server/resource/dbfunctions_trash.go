@@ -0,0 +1,166 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/doug-martin/goqu/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// TrashedQueryParameter selects the trashed rows of a soft delete table in find requests, "with" lists them along
+// with the other rows and "only" lists nothing else. Trashed rows are left out by default
+const TrashedQueryParameter = "trashed"
+
+// IsTrashed tells if a row of a soft delete table is in the trash
+func IsTrashed(row map[string]interface{}) bool {
+	deletedAt, ok := row[SoftDeleteColumn.ColumnName]
+	if !ok || deletedAt == nil {
+		return false
+	}
+	if value, ok := deletedAt.(string); ok && value == "" {
+		return false
+	}
+	return true
+}
+
+// trashedParameter returns the value of the trashed query parameter of the request
+func trashedParameter(req api2go.Request) string {
+	values := req.QueryParams[TrashedQueryParameter]
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// TrashCondition returns the condition which selects the rows asked for by the trashed query parameter of the
+// request, nil when the table does not have soft delete or all rows are asked for
+func (dr *DbResource) TrashCondition(req api2go.Request) goqu.Expression {
+	if dr.tableInfo == nil || !dr.tableInfo.SoftDeleteEnabled {
+		return nil
+	}
+	column := goqu.I(dr.tableInfo.TableName + "." + SoftDeleteColumn.ColumnName)
+	switch trashedParameter(req) {
+	case "with":
+		return nil
+	case "only":
+		return column.IsNotNull()
+	}
+	return column.IsNull()
+}
+
+// HidesTrashedRow tells if a trashed row is left out of the response to the request
+func (dr *DbResource) HidesTrashedRow(req api2go.Request, row map[string]interface{}) bool {
+	if dr.tableInfo == nil || !dr.tableInfo.SoftDeleteEnabled {
+		return false
+	}
+	trashed := IsTrashed(row)
+	switch trashedParameter(req) {
+	case "with":
+		return false
+	case "only":
+		return !trashed
+	}
+	return trashed
+}
+
+// withoutTrashedRows drops the rows of soft delete tables which are in the trash, rows are typed by __type
+func (dr *DbResource) withoutTrashedRows(rows []map[string]interface{}) []map[string]interface{} {
+	kept := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		typeName, _ := row["__type"].(string)
+		if rowResource, ok := dr.Cruds[typeName]; ok && rowResource.HidesTrashedRow(api2go.Request{}, row) {
+			continue
+		}
+		kept = append(kept, row)
+	}
+	return kept
+}
+
+// setDeletedAt moves a row to the trash, or out of it when deletedAt is nil. The row as it was before is stored
+// in the audit table, as updates do
+func (dr *DbResource) setDeletedAt(referenceId string, deletedAt interface{}, req api2go.Request) error {
+
+	if dr.tableInfo == nil || !dr.tableInfo.SoftDeleteEnabled {
+		return errors.New("soft delete is not enabled for this table")
+	}
+
+	if dr.tableInfo.IsAuditEnabled {
+		row, err := dr.GetReferenceIdToObject(dr.tableInfo.TableName, referenceId)
+		if err != nil {
+			return err
+		}
+		dr.createAuditRow(row, req)
+	}
+
+	query, args, err := statementbuilder.Squirrel.Update(dr.tableInfo.TableName).Prepared(true).
+		Set(goqu.Record{
+			SoftDeleteColumn.ColumnName: deletedAt,
+			"updated_at":                time.Now(),
+		}).Where(goqu.Ex{"reference_id": referenceId}).ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = dr.db.Exec(query, args...)
+	return err
+}
+
+// createAuditRow stores a copy of the row in the audit table of the table
+func (dr *DbResource) createAuditRow(row map[string]interface{}, req api2go.Request) {
+
+	auditModel := api2go.NewApi2GoModelWithData(dr.tableInfo.TableName, nil, 0, nil, row).GetAuditModel()
+	auditModel.Data["source_reference_id"] = row["reference_id"]
+	creator, ok := dr.Cruds[auditModel.GetTableName()]
+	if !ok {
+		log.Errorf("No creator for audit type: %v", auditModel.GetTableName())
+		return
+	}
+
+	pr := &http.Request{
+		Method: "POST",
+	}
+	ctx := context.Background()
+	if req.PlainRequest != nil {
+		ctx = req.PlainRequest.Context()
+	}
+	pr = pr.WithContext(ctx)
+	_, err := creator.Create(auditModel, api2go.Request{
+		PlainRequest: pr,
+	})
+	if err != nil {
+		log.Errorf("Failed to create audit entry: %v", err)
+	}
+}
+
+// TrashRow moves a row of a soft delete table to the trash
+func (dr *DbResource) TrashRow(referenceId string, req api2go.Request) error {
+	return dr.setDeletedAt(referenceId, time.Now(), req)
+}
+
+// RestoreFromTrash takes a row of a soft delete table out of the trash
+func (dr *DbResource) RestoreFromTrash(referenceId string, req api2go.Request) error {
+	return dr.setDeletedAt(referenceId, nil, req)
+}
+
+// GetTrashedBefore returns the reference ids of the rows moved to the trash before the time
+func (dr *DbResource) GetTrashedBefore(before time.Time) ([]string, error) {
+
+	referenceIds := make([]string, 0)
+	if dr.tableInfo == nil || !dr.tableInfo.SoftDeleteEnabled {
+		return referenceIds, nil
+	}
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("reference_id")).From(dr.tableInfo.TableName).
+		Where(goqu.C(SoftDeleteColumn.ColumnName).Lt(before)).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	err = dr.connection.Select(&referenceIds, query, args...)
+	return referenceIds, err
+}
@@ -0,0 +1,68 @@
+package resource
+
+import (
+	"testing"
+	"time"
+
+	"github.com/artpar/api2go"
+)
+
+func TestHidesTrashedRow(t *testing.T) {
+
+	dr := &DbResource{
+		tableInfo: &TableInfo{
+			TableName:         "note",
+			SoftDeleteEnabled: true,
+		},
+	}
+
+	trashed := map[string]interface{}{"deleted_at": time.Now()}
+	kept := map[string]interface{}{"deleted_at": nil}
+
+	cases := []struct {
+		trashed     string
+		hideTrashed bool
+		hideKept    bool
+	}{
+		{"", true, false},
+		{"with", false, false},
+		{"only", false, true},
+	}
+
+	for _, testCase := range cases {
+		req := api2go.Request{QueryParams: map[string][]string{}}
+		if testCase.trashed != "" {
+			req.QueryParams[TrashedQueryParameter] = []string{testCase.trashed}
+		}
+		if dr.HidesTrashedRow(req, trashed) != testCase.hideTrashed || dr.HidesTrashedRow(req, kept) != testCase.hideKept {
+			t.Errorf("Unexpected rows hidden for trashed=%v", testCase.trashed)
+		}
+		if (dr.TrashCondition(req) == nil) != (testCase.trashed == "with") {
+			t.Errorf("Unexpected condition for trashed=%v", testCase.trashed)
+		}
+	}
+
+	dr.tableInfo.SoftDeleteEnabled = false
+	if dr.HidesTrashedRow(api2go.Request{}, trashed) || dr.TrashCondition(api2go.Request{}) != nil {
+		t.Errorf("Expected rows of tables without soft delete to be listed")
+	}
+}
+
+func TestWithoutTrashedRows(t *testing.T) {
+
+	cruds := map[string]*DbResource{
+		"note":    {tableInfo: &TableInfo{TableName: "note", SoftDeleteEnabled: true}},
+		"comment": {tableInfo: &TableInfo{TableName: "comment"}},
+	}
+	dr := &DbResource{Cruds: cruds}
+
+	rows := dr.withoutTrashedRows([]map[string]interface{}{
+		{"__type": "note", "reference_id": "kept", "deleted_at": nil},
+		{"__type": "note", "reference_id": "trashed", "deleted_at": time.Now()},
+		{"__type": "comment", "reference_id": "no soft delete", "deleted_at": time.Now()},
+		{"__type": "file.image", "reference_id": "file"},
+	})
+	if len(rows) != 3 || rows[0]["reference_id"] != "kept" || rows[1]["reference_id"] != "no soft delete" {
+		t.Errorf("Expected only the trashed note to be left out, found %v", rows)
+	}
+}
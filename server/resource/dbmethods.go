@@ -1,6 +1,7 @@
 package resource
 
 import (
+	"database/sql"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -596,6 +597,85 @@ func (d *DbResource) GetUserPassword(email string) (string, error) {
 	return passwordHash, err
 }
 
+// GetUserGroupsByUserId Returns the group permissions of a user, same as the groups loaded in the session user by the auth middleware
+func (dr *DbResource) GetUserGroupsByUserId(userId int64, userReferenceId string) ([]auth.GroupPermission, error) {
+
+	query, args, err := auth.UserGroupSelectQuery.Where(goqu.Ex{"uug.user_account_id": userId}).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := dr.connection.Preparex(query)
+	if err != nil {
+		log.Errorf("[604] failed to prepare statment: %v", err)
+		return nil, err
+	}
+	defer func(stmt1 *sqlx.Stmt) {
+		err := stmt1.Close()
+		if err != nil {
+			log.Errorf("failed to close prepared statement: %v", err)
+		}
+	}(stmt)
+
+	rows, err := stmt.Queryx(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	userGroups := make([]auth.GroupPermission, 0)
+	for rows.Next() {
+		var p auth.GroupPermission
+		err = rows.StructScan(&p)
+		if err != nil {
+			log.Errorf("failed to scan group permission struct: %v", err)
+			continue
+		}
+		p.ObjectReferenceId = userReferenceId
+		userGroups = append(userGroups, p)
+	}
+
+	return userGroups, nil
+}
+
+// GetUserSshPublicKeys Returns the authorized_keys formatted public keys uploaded by a user in user_ssh_key
+func (dr *DbResource) GetUserSshPublicKeys(userId int64) ([]string, error) {
+
+	query, args, err := statementbuilder.Squirrel.Select("public_key").From("user_ssh_key").
+		Where(goqu.Ex{USER_ACCOUNT_ID_COLUMN: userId}).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := dr.connection.Preparex(query)
+	if err != nil {
+		log.Errorf("[642] failed to prepare statment: %v", err)
+		return nil, err
+	}
+	defer func(stmt1 *sqlx.Stmt) {
+		err := stmt1.Close()
+		if err != nil {
+			log.Errorf("failed to close prepared statement: %v", err)
+		}
+	}(stmt)
+
+	rows, err := stmt.Queryx(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]string, 0)
+	for rows.Next() {
+		var key string
+		err = rows.Scan(&key)
+		if err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
 // UserGroupNameToId Converts group name to the internal integer id
 func (dr *DbResource) UserGroupNameToId(groupName string) (uint64, error) {
 
@@ -725,7 +805,7 @@ func (dbResource *DbResource) BecomeAdmin(userId int64) bool {
 	query, args, err = statementbuilder.Squirrel.Update("action").
 		Set(goqu.Record{"permission": int64(auth.GuestPeek | auth.GuestExecute | auth.UserRead | auth.UserExecute | auth.GroupRead | auth.GroupExecute)}).
 		Where(goqu.Ex{
-			"action_name": "signin",
+			"action_name": GuestSigninActions,
 		}).
 		ToSQL()
 	if err != nil {
@@ -1325,6 +1405,66 @@ func (dr *DbResource) DirectInsert(typeName string, data map[string]interface{})
 	return err
 }
 
+// DirectUpsert updates the row having the value of keyColumn in data, without an validation or transformations, or
+// inserts it using DirectInsert when there is none. The id, reference id and permission of an existing row are kept
+// Returns true when the row was inserted
+// Invoked by data import action
+func (dr *DbResource) DirectUpsert(typeName string, keyColumn string, data map[string]interface{}) (bool, error) {
+
+	keyValue := data[keyColumn]
+	if keyValue == nil {
+		return false, fmt.Errorf("row without a value for the key column [%v]", keyColumn)
+	}
+
+	s, q, err := statementbuilder.Squirrel.Select(goqu.C("id")).From(typeName).
+		Where(goqu.Ex{keyColumn: keyValue}).Limit(1).ToSQL()
+	if err != nil {
+		return false, err
+	}
+	var id int64
+	err = dr.db.QueryRowx(s, q...).Scan(&id)
+	if err == sql.ErrNoRows {
+		delete(data, "id")
+		return true, dr.DirectInsert(typeName, data)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	updates := goqu.Record{}
+	for columnName, value := range data {
+		colInfo, ok := dr.tableInfo.GetColumnByName(columnName)
+		if !ok {
+			continue
+		}
+		switch columnName {
+		case "id", "reference_id", "permission", keyColumn:
+			continue
+		}
+		if valStr, ok := value.(string); ok && colInfo.ColumnType == "datetime" {
+			value, err = dateparse.ParseLocal(valStr)
+			if err != nil {
+				log.Errorf("Failed to parse value as time, update will fail [%v][%v]: %v", columnName, valStr, err)
+				continue
+			}
+		}
+		updates[columnName] = value
+	}
+	if len(updates) == 0 {
+		return false, nil
+	}
+
+	s, q, err = statementbuilder.Squirrel.Update(typeName).Set(updates).Where(goqu.Ex{"id": id}).ToSQL()
+	if err != nil {
+		return false, err
+	}
+	_, err = dr.db.Exec(s, q...)
+	if err != nil {
+		log.Errorf("Failed SQL  [%v] [%v]", s, q)
+	}
+	return false, err
+}
+
 // GetAllObjects Gets all rows from the table `typeName`
 // Returns an array of Map object, each object has the column name to value mapping
 // Utility method for loading all objects having low count
@@ -1805,6 +1945,74 @@ func (dr *DbResource) GetIdListToReferenceIdList(typeName string, ids []int64) (
 	return idMap, err
 }
 
+// GetJoinTableIdMap returns the ids in toColumn of the rows of a join table for each of the ids in fromColumn
+// Used to fetch the has_many relations of a list of objects in a single query. When limit is more than 0 only
+// limit ids after the first offset ids, in the order of the join rows, are returned for each id in fromColumn
+func (dr *DbResource) GetJoinTableIdMap(joinTableName string, fromColumn string, toColumn string, fromIds []int64, offset int, limit int) (map[int64][]int64, error) {
+
+	idMap := make(map[int64][]int64)
+	if len(fromIds) == 0 {
+		return idMap, nil
+	}
+
+	query := statementbuilder.Squirrel.Select(goqu.C(fromColumn), goqu.C(toColumn)).
+		From(joinTableName).Where(goqu.Ex{fromColumn: fromIds})
+	if limit > 0 {
+		// one page for every id, the pages are combined into a single query
+		for i, fromId := range fromIds {
+			page := statementbuilder.Squirrel.Select(goqu.C(fromColumn), goqu.C(toColumn)).
+				From(joinTableName).Where(goqu.Ex{fromColumn: fromId}).
+				Order(goqu.C("id").Asc()).Limit(uint(limit)).Offset(uint(offset))
+			if i == 0 {
+				query = page
+			} else {
+				query = query.UnionAll(page)
+			}
+		}
+	}
+
+	s, q, err := query.Prepared(true).ToSQL()
+	if err != nil {
+		return idMap, err
+	}
+
+	stmt1, err := dr.connection.Preparex(s)
+	if err != nil {
+		log.Errorf("[1873] failed to prepare statment: %v", err)
+		return nil, err
+	}
+
+	defer func(stmt1 *sqlx.Stmt) {
+		err := stmt1.Close()
+		if err != nil {
+			log.Errorf("failed to close prepared statement: %v", err)
+		}
+	}(stmt1)
+
+	rows, err := stmt1.Queryx(q...)
+	if err != nil {
+		return idMap, err
+	}
+	defer func(rows *sqlx.Rows) {
+		err := rows.Close()
+		if err != nil {
+			log.Errorf("[1890] failed to close rows after scanning values in defer")
+		}
+	}(rows)
+
+	for rows.Next() {
+		var fromId int64
+		var toId int64
+		err = rows.Scan(&fromId, &toId)
+		if err != nil {
+			return idMap, err
+		}
+		idMap[fromId] = append(idMap[fromId], toId)
+	}
+
+	return idMap, rows.Err()
+}
+
 // GetSingleColumnValueByReferenceId select "column" from "typeName" where matchColumn in (values)
 // returns list of values of the column
 func (dr *DbResource) GetSingleColumnValueByReferenceId(
@@ -2271,7 +2479,7 @@ func (dr *DbResource) ResultToArrayOfMap(rows *sqlx.Rows, columnMap map[string]a
 
 		}
 
-		includes = append(includes, localInclude)
+		includes = append(includes, dr.withoutTrashedRows(localInclude))
 
 	}
 
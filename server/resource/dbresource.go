@@ -37,6 +37,7 @@ type DbResource struct {
 	AssetFolderCache   map[string]map[string]*AssetFolderCache
 	SubsiteFolderCache map[string]*AssetFolderCache
 	MailSender         func(e *mail.Envelope, task backends.SelectTask) (backends.Result, error)
+	afterCommit        *afterCommitQueue
 }
 
 type AssetFolderCache struct {
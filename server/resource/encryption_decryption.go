@@ -8,35 +8,119 @@ import (
 	"fmt"
 	"github.com/pkg/errors"
 	"io"
+	"strings"
 )
 
-// Encrypt string to base64 crypto using AES
+// encryptedValuePrefix marks values sealed with AES-GCM, the prefix is followed by the key id and a colon
+// values without the prefix were encrypted with AES-CFB before the keyring existed
+const encryptedValuePrefix = "gcm:"
+
+// Encrypt string to base64 crypto using AES-GCM with the active key of the keyring
+// key is used as the key with id 0 when no keyring has been loaded
 func Encrypt(key []byte, text string) (string, error) {
-	// key := []byte(keyText)
-	plaintext := []byte(text)
 
-	block, err := aes.NewCipher(key)
+	keyId, activeKey := "0", key
+	if keyring := GetEncryptionKeyring(); keyring != nil {
+		keyId, activeKey = keyring.Active()
+	}
+
+	sealed, err := sealGcm(activeKey, []byte(keyId), []byte(text))
 	if err != nil {
 		return "", err
 	}
 
-	// The IV needs to be unique, but not secure. Therefore it's common to
-	// include it at the beginning of the ciphertext.
-	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+	return encryptedValuePrefix + keyId + ":" + base64.URLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt from base64 to decrypted string, using the key id in the value to pick the key from the keyring
+// key is used for the key with id 0 when it is not in the keyring and for values encrypted with AES-CFB
+func Decrypt(key []byte, cryptoText string) (string, error) {
+
+	if !strings.HasPrefix(cryptoText, encryptedValuePrefix) {
+		return decryptCfb(key, cryptoText)
+	}
+
+	keyId := EncryptionKeyId(cryptoText)
+	if keyId == "" {
+		return "", errors.New("encrypted value has no key id")
+	}
+	encoded := cryptoText[len(encryptedValuePrefix)+len(keyId)+1:]
+
+	decryptionKey, ok := []byte(nil), false
+	if keyring := GetEncryptionKeyring(); keyring != nil {
+		decryptionKey, ok = keyring.Key(keyId)
+	}
+	if !ok {
+		if keyId != "0" {
+			return "", fmt.Errorf("unknown encryption key [%v]", keyId)
+		}
+		decryptionKey = key
+	}
+
+	sealed, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := openGcm(decryptionKey, []byte(keyId), sealed)
+	if err != nil {
 		return "", err
 	}
+	return string(plaintext), nil
+}
+
+// EncryptionKeyId returns the id of the key a value was encrypted with, empty for AES-CFB values
+func EncryptionKeyId(cryptoText string) string {
+	if !strings.HasPrefix(cryptoText, encryptedValuePrefix) {
+		return ""
+	}
+	rest := cryptoText[len(encryptedValuePrefix):]
+	separator := strings.Index(rest, ":")
+	if separator < 0 {
+		return ""
+	}
+	return rest[:separator]
+}
+
+// sealGcm encrypts and authenticates plaintext, the nonce is put at the beginning of the result
+func sealGcm(key []byte, additionalData []byte, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
 
-	stream := cipher.NewCFBEncrypter(block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
 
-	// convert to base64
-	return base64.URLEncoding.EncodeToString(ciphertext), nil
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
 }
 
-// Decrypt from base64 to decrypted string
-func Decrypt(key []byte, cryptoText string) (string, error) {
+// openGcm reverses sealGcm and fails when the value or the additional data was changed
+func openGcm(key []byte, additionalData []byte, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("Chipher text too short")
+	}
+
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additionalData)
+}
+
+// decryptCfb decrypts values written with AES-CFB
+func decryptCfb(key []byte, cryptoText string) (string, error) {
 	ciphertext, _ := base64.URLEncoding.DecodeString(cryptoText)
 
 	block, err := aes.NewCipher(key)
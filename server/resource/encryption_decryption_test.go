@@ -0,0 +1,140 @@
+package resource
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func encryptCfbForTest(key []byte, text string) string {
+	block, _ := aes.NewCipher(key)
+	ciphertext := make([]byte, aes.BlockSize+len(text))
+	stream := cipher.NewCFBEncrypter(block, ciphertext[:aes.BlockSize])
+	stream.XORKeyStream(ciphertext[aes.BlockSize:], []byte(text))
+	return base64.URLEncoding.EncodeToString(ciphertext)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+
+	SetEncryptionKeyring(nil)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	encrypted, err := Encrypt(secret, "client secret")
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	if EncryptionKeyId(encrypted) != "0" {
+		t.Errorf("Expected key id 0 without a keyring, found [%v]", encrypted)
+	}
+
+	decrypted, err := Decrypt(secret, encrypted)
+	if err != nil || decrypted != "client secret" {
+		t.Errorf("Unexpected decryption [%v] %v", decrypted, err)
+	}
+
+	tampered := []byte(encrypted)
+	tampered[len(tampered)-3] ^= 1
+	if _, err = Decrypt(secret, string(tampered)); err == nil {
+		t.Errorf("Expected a changed value to fail authentication")
+	}
+
+	legacy := encryptCfbForTest(secret, "old value")
+	decrypted, err = Decrypt(secret, legacy)
+	if err != nil || decrypted != "old value" {
+		t.Errorf("Expected values encrypted with AES-CFB to be readable, found [%v] %v", decrypted, err)
+	}
+}
+
+func TestEncryptionKeyringRotation(t *testing.T) {
+
+	defer SetEncryptionKeyring(nil)
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	keyring := &EncryptionKeyring{
+		ActiveKeyId: "0",
+		Keys:        map[string][]byte{"0": secret},
+		masterKey:   deriveMasterKey("master"),
+	}
+	SetEncryptionKeyring(keyring)
+
+	before, _ := Encrypt(secret, "token")
+
+	keyId, err := keyring.AddKey()
+	if err != nil || keyId != "1" {
+		t.Fatalf("Expected new key 1, found [%v] %v", keyId, err)
+	}
+
+	after, _ := Encrypt(secret, "token")
+	if !strings.HasPrefix(after, encryptedValuePrefix+"1:") {
+		t.Errorf("Expected value encrypted with the new key, found [%v]", after)
+	}
+
+	for _, value := range []string{before, after} {
+		decrypted, err := Decrypt(nil, value)
+		if err != nil || decrypted != "token" {
+			t.Errorf("Expected [%v] to decrypt with the keyring, found [%v] %v", value, decrypted, err)
+		}
+	}
+
+	if _, err = Decrypt(secret, strings.Replace(after, "gcm:1:", "gcm:7:", 1)); err == nil {
+		t.Errorf("Expected an error for an unknown key id")
+	}
+	if _, err = Decrypt(secret, strings.Replace(after, "gcm:1:", "gcm:0:", 1)); err == nil {
+		t.Errorf("Expected a value moved to another key id to fail authentication")
+	}
+}
+
+func TestLoadMasterKeyInDataDirectory(t *testing.T) {
+
+	if _, err := os.Stat(DefaultMasterKeyFile); err == nil {
+		t.Skip("a master key file exists in the working directory")
+	}
+	os.Unsetenv(MasterKeyEnv)
+	os.Unsetenv(MasterKeyFileEnv)
+
+	if _, err := LoadMasterKey(";"); err == nil {
+		t.Errorf("Expected a missing master key to fail without a data directory")
+	}
+
+	dataDirectory, _ := ioutil.TempDir("", "master-key")
+	defer os.RemoveAll(dataDirectory)
+
+	generated, err := LoadMasterKey(dataDirectory)
+	if err != nil || len(generated) != 32 {
+		t.Fatalf("Failed to generate a master key: %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dataDirectory, DefaultMasterKeyFile)); err != nil {
+		t.Errorf("Expected the master key in the data directory: %v", err)
+	}
+	loaded, err := LoadMasterKey(dataDirectory)
+	if err != nil || string(loaded) != string(generated) {
+		t.Errorf("Expected the generated master key to be read again, found %v", err)
+	}
+}
+
+func TestEncryptionKeyringSealRoundTrip(t *testing.T) {
+
+	keyring := &EncryptionKeyring{
+		ActiveKeyId: "0",
+		Keys:        map[string][]byte{"0": []byte("0123456789abcdef0123456789abcdef")},
+		masterKey:   deriveMasterKey("master"),
+	}
+	keyId, _ := keyring.AddKey()
+
+	sealed, err := keyring.seal()
+	if err != nil {
+		t.Fatalf("Failed to seal keyring: %v", err)
+	}
+	opened, err := openEncryptionKeyring(sealed, deriveMasterKey("master"))
+	if err != nil || opened.ActiveKeyId != keyId || len(opened.Keys) != 2 {
+		t.Errorf("Expected the sealed keyring with active key [%v], found %v %v", keyId, opened, err)
+	}
+	if _, err = openEncryptionKeyring(sealed, deriveMasterKey("other")); err == nil {
+		t.Errorf("Expected the keyring not to open with another master key")
+	}
+}
@@ -0,0 +1,295 @@
+package resource
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	json1 "encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// EncryptionKeyringConfigKey is the _config entry holding the keyring, encrypted under the master key
+	EncryptionKeyringConfigKey = "encryption.keyring"
+	// MasterKeyEnv is the environment variable which can hold the master key
+	MasterKeyEnv = "DAPTIN_MASTER_KEY"
+	// MasterKeyFileEnv is the environment variable which can hold the path of the file with the master key
+	MasterKeyFileEnv = "DAPTIN_MASTER_KEY_FILE"
+	// DefaultMasterKeyFile is created with a random master key in the data directory when neither variable is set
+	DefaultMasterKeyFile = "daptin.master.key"
+	// EncryptionKeyringTopic is published to when the keyring changes, every node reloads the keyring
+	EncryptionKeyringTopic = "encryption.keyring"
+)
+
+// EncryptionKeyring holds every key used to encrypt column values, new values are encrypted with the active key
+type EncryptionKeyring struct {
+	ActiveKeyId string
+	Keys        map[string][]byte
+	masterKey   []byte
+	lock        sync.RWMutex
+}
+
+var encryptionKeyring *EncryptionKeyring
+var encryptionKeyringLock sync.RWMutex
+
+// GetEncryptionKeyring returns the keyring used by Encrypt and Decrypt, nil until one is loaded
+func GetEncryptionKeyring() *EncryptionKeyring {
+	encryptionKeyringLock.RLock()
+	defer encryptionKeyringLock.RUnlock()
+	return encryptionKeyring
+}
+
+// SetEncryptionKeyring replaces the keyring used by Encrypt and Decrypt
+func SetEncryptionKeyring(keyring *EncryptionKeyring) {
+	encryptionKeyringLock.Lock()
+	defer encryptionKeyringLock.Unlock()
+	encryptionKeyring = keyring
+}
+
+// LoadMasterKey reads the master key from DAPTIN_MASTER_KEY, or the file named in DAPTIN_MASTER_KEY_FILE,
+// or daptin.master.key in the data directory, which is generated on the first start. A daptin.master.key in the
+// working directory, where older versions generated it, is still read
+func LoadMasterKey(dataDirectory string) ([]byte, error) {
+
+	if masterKey := os.Getenv(MasterKeyEnv); masterKey != "" {
+		return deriveMasterKey(masterKey), nil
+	}
+
+	masterKeyFile := os.Getenv(MasterKeyFileEnv)
+	if masterKeyFile == "" {
+		masterKeyFile = DefaultMasterKeyFile
+		if _, err := os.Stat(masterKeyFile); err == nil {
+			log.Warnf("Reading the master key from [%v] in the working directory, move it out of the working directory "+
+				"and set %v to its path", masterKeyFile, MasterKeyFileEnv)
+		} else {
+			if dataDirectory == "" || dataDirectory == ";" {
+				return nil, errors.New("no master key configured, set " + MasterKeyEnv + " or " + MasterKeyFileEnv +
+					", or a local storage path for the key to be generated in")
+			}
+			masterKeyFile = filepath.Join(dataDirectory, DefaultMasterKeyFile)
+			if _, err := os.Stat(masterKeyFile); os.IsNotExist(err) {
+				randomKey := make([]byte, 32)
+				if _, err := io.ReadFull(rand.Reader, randomKey); err != nil {
+					return nil, err
+				}
+				err = ioutil.WriteFile(masterKeyFile, []byte(base64.StdEncoding.EncodeToString(randomKey)), 0600)
+				if err != nil {
+					return nil, err
+				}
+				log.Errorf("==================================================================")
+				log.Errorf("No master key configured, generated a new master key in [%v]", masterKeyFile)
+				log.Errorf("Encrypted values cannot be read without it, back it up and keep it out of the")
+				log.Errorf("storage which is synced or served, or set %v instead", MasterKeyEnv)
+				log.Errorf("Every node of a cluster needs the same master key")
+				log.Errorf("==================================================================")
+			}
+		}
+	}
+
+	contents, err := ioutil.ReadFile(masterKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	masterKey := strings.TrimSpace(string(contents))
+	if masterKey == "" {
+		return nil, errors.New("master key file " + masterKeyFile + " is empty")
+	}
+	return deriveMasterKey(masterKey), nil
+}
+
+// deriveMasterKey turns a master key of any length into an AES-256 key
+func deriveMasterKey(masterKey string) []byte {
+	sum := sha256.Sum256([]byte(masterKey))
+	return sum[:]
+}
+
+// InitialiseEncryptionKeyring loads the keyring from the config store, on the first start the keyring is
+// created with encryption.secret as key 0 so existing values stay readable
+func InitialiseEncryptionKeyring(configStore *ConfigStore, masterKey []byte) (*EncryptionKeyring, error) {
+
+	keyring := &EncryptionKeyring{
+		Keys:      make(map[string][]byte),
+		masterKey: masterKey,
+	}
+
+	storedKeyring, err := configStore.GetConfigValueFor(EncryptionKeyringConfigKey, "backend")
+	if err != nil || storedKeyring == "" {
+		encryptionSecret, err := configStore.GetConfigValueFor("encryption.secret", "backend")
+		if err != nil {
+			return nil, err
+		}
+		keyring.ActiveKeyId = "0"
+		keyring.Keys["0"] = []byte(encryptionSecret)
+		err = keyring.Save(configStore)
+		if err != nil {
+			return nil, err
+		}
+		SetEncryptionKeyring(keyring)
+		return keyring, nil
+	}
+
+	keyring, err = openEncryptionKeyring(storedKeyring, masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	SetEncryptionKeyring(keyring)
+	return keyring, nil
+}
+
+// openEncryptionKeyring reads a keyring stored by Save
+func openEncryptionKeyring(storedKeyring string, masterKey []byte) (*EncryptionKeyring, error) {
+
+	keyring := &EncryptionKeyring{
+		Keys:      make(map[string][]byte),
+		masterKey: masterKey,
+	}
+
+	sealed, err := base64.URLEncoding.DecodeString(storedKeyring)
+	if err != nil {
+		return nil, err
+	}
+	keyringJson, err := openGcm(masterKey, []byte(EncryptionKeyringConfigKey), sealed)
+	if err != nil {
+		return nil, errors.New("failed to open the encryption keyring, is the master key correct: " + err.Error())
+	}
+	err = json1.Unmarshal(keyringJson, keyring)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := keyring.Keys[keyring.ActiveKeyId]; !ok {
+		return nil, errors.New("active encryption key [" + keyring.ActiveKeyId + "] is missing from the keyring")
+	}
+	return keyring, nil
+}
+
+// encryptionKeyRotationLock keeps two rotations on the same node from reading the same stored keyring
+var encryptionKeyRotationLock sync.Mutex
+
+// RotateEncryptionKey adds a new active key to a copy of the stored keyring and stores it, the keyring in use is
+// replaced only after that. The stored keyring is only replaced when no other node changed it since it was
+// read, so two nodes rotating at the same time cannot add two different keys with the same id
+func RotateEncryptionKey(configStore *ConfigStore) (string, error) {
+
+	encryptionKeyRotationLock.Lock()
+	defer encryptionKeyRotationLock.Unlock()
+
+	current := GetEncryptionKeyring()
+	if current == nil {
+		return "", errors.New("encryption keyring is not loaded")
+	}
+
+	storedKeyring, err := configStore.GetConfigValueFor(EncryptionKeyringConfigKey, "backend")
+	if err != nil {
+		return "", err
+	}
+	keyring, err := openEncryptionKeyring(storedKeyring, current.masterKey)
+	if err != nil {
+		return "", err
+	}
+
+	keyId, err := keyring.AddKey()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := keyring.seal()
+	if err != nil {
+		return "", err
+	}
+
+	stored, err := configStore.CompareAndSetConfigValueFor(EncryptionKeyringConfigKey, storedKeyring, sealed, "backend")
+	if err != nil {
+		return "", err
+	}
+	if !stored {
+		return "", errors.New("the encryption keyring was changed by another node during the rotation, try again")
+	}
+
+	SetEncryptionKeyring(keyring)
+	return keyId, nil
+}
+
+// ReloadEncryptionKeyring reads the keyring from the config store again, called on every node when the keyring
+// is rotated on one of them
+func ReloadEncryptionKeyring(configStore *ConfigStore) error {
+	keyring := GetEncryptionKeyring()
+	if keyring == nil {
+		return nil
+	}
+	_, err := InitialiseEncryptionKeyring(configStore, keyring.masterKey)
+	return err
+}
+
+// Save stores the keyring encrypted under the master key
+func (k *EncryptionKeyring) Save(configStore *ConfigStore) error {
+	sealed, err := k.seal()
+	if err != nil {
+		return err
+	}
+	return configStore.SetConfigValueFor(EncryptionKeyringConfigKey, sealed, "backend")
+}
+
+// seal returns the keyring encrypted under the master key, as it is stored in the config
+func (k *EncryptionKeyring) seal() (string, error) {
+	k.lock.RLock()
+	keyringJson, err := json1.Marshal(k)
+	k.lock.RUnlock()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := sealGcm(k.masterKey, []byte(EncryptionKeyringConfigKey), keyringJson)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(sealed), nil
+}
+
+// Active returns the id and the key new values are encrypted with
+func (k *EncryptionKeyring) Active() (string, []byte) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return k.ActiveKeyId, k.Keys[k.ActiveKeyId]
+}
+
+// Key returns the key with the id
+func (k *EncryptionKeyring) Key(keyId string) ([]byte, bool) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	key, ok := k.Keys[keyId]
+	return key, ok
+}
+
+// AddKey generates a new random key and makes it the active key, older keys are kept to read existing values
+func (k *EncryptionKeyring) AddKey() (string, error) {
+
+	newKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, newKey); err != nil {
+		return "", err
+	}
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	nextId := 0
+	for keyId := range k.Keys {
+		id, err := strconv.Atoi(keyId)
+		if err == nil && id >= nextId {
+			nextId = id + 1
+		}
+	}
+
+	keyId := strconv.Itoa(nextId)
+	k.Keys[keyId] = newKey
+	k.ActiveKeyId = keyId
+	return keyId, nil
+}
@@ -42,13 +42,34 @@ var objectSuffix = []byte("{")
 var arraySuffix = []byte("[")
 var stringSuffix = []byte(`"`)
 
+// UnmarshalJSON reads a list of column maps, or an object of source columns to target columns
 func (c *ColumnMapping) UnmarshalJSON(payload []byte) error {
+	payload = bytes.TrimSpace(payload)
 	if bytes.HasPrefix(payload, objectSuffix) {
-		return json.Unmarshal(payload, &c)
+		columns := make(map[string]string)
+		err := json.Unmarshal(payload, &columns)
+		if err != nil {
+			return err
+		}
+		mapping := make(ColumnMapping, 0)
+		for source, target := range columns {
+			mapping = append(mapping, ColumnMap{
+				SourceColumn: source,
+				TargetColumn: target,
+			})
+		}
+		*c = mapping
+		return nil
 	}
 
 	if bytes.HasPrefix(payload, arraySuffix) {
-		return json.Unmarshal(payload, &c)
+		mapping := make([]ColumnMap, 0)
+		err := json.Unmarshal(payload, &mapping)
+		if err != nil {
+			return err
+		}
+		*c = mapping
+		return nil
 	}
 
 	return errors.New("expected a JSON encoded object or array")
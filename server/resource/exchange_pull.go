@@ -0,0 +1,283 @@
+package resource
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/araddon/dateparse"
+)
+
+// Pagination strategies of a rest source
+const (
+	PaginationNone   = "none"
+	PaginationOffset = "offset"
+	PaginationPage   = "page"
+	PaginationCursor = "cursor"
+)
+
+// restPullResponseLimit is the largest page a rest source can respond with
+const restPullResponseLimit = 32 << 20
+
+// RestPagination is how a rest source pages through its items
+// offset sends the number of items already read in OffsetParam, page sends the page number from StartPage in
+// PageParam, both stop at the first page with fewer than PageSize items. cursor sends the cursor read at CursorPath
+// of the previous page in CursorParam and stops when the response has no cursor
+type RestPagination struct {
+	Strategy    string `json:"strategy"`
+	PageSize    int    `json:"page_size"`
+	LimitParam  string `json:"limit_param"`
+	OffsetParam string `json:"offset_param"`
+	PageParam   string `json:"page_param"`
+	StartPage   int    `json:"start_page"`
+	CursorParam string `json:"cursor_param"`
+	CursorPath  string `json:"cursor_path"`
+}
+
+// RestPullSource is the source_attributes of an exchange with the rest source type, a REST API listing items
+// ItemsPath is the path of the list of items in a response, empty when the response is the list. When the exchange
+// has a watermark it is sent in WatermarkParam, and the latest value at WatermarkPath of the items read becomes the
+// next watermark
+type RestPullSource struct {
+	Url            string            `json:"url"`
+	Method         string            `json:"method"`
+	Headers        map[string]string `json:"headers"`
+	QueryParams    map[string]string `json:"query_params"`
+	ItemsPath      string            `json:"items_path"`
+	Pagination     RestPagination    `json:"pagination"`
+	WatermarkParam string            `json:"watermark_param"`
+	WatermarkPath  string            `json:"watermark_path"`
+	MaxPages       int               `json:"max_pages"`
+}
+
+// NewRestPullSource reads the source attributes of an exchange and fills in the defaults
+func NewRestPullSource(sourceAttributes string) (RestPullSource, error) {
+
+	var source RestPullSource
+	err := json.Unmarshal([]byte(sourceAttributes), &source)
+	if err != nil {
+		return source, fmt.Errorf("invalid source attributes: %v", err)
+	}
+	if source.Url == "" {
+		return source, errors.New("the source has no url")
+	}
+
+	pagination := &source.Pagination
+	if pagination.Strategy == "" {
+		pagination.Strategy = PaginationNone
+	}
+	if pagination.PageSize < 1 {
+		pagination.PageSize = 100
+	}
+	if pagination.LimitParam == "" {
+		pagination.LimitParam = "limit"
+	}
+	if pagination.OffsetParam == "" {
+		pagination.OffsetParam = "offset"
+	}
+	if pagination.PageParam == "" {
+		pagination.PageParam = "page"
+	}
+	if pagination.StartPage == 0 {
+		pagination.StartPage = 1
+	}
+	if pagination.CursorParam == "" {
+		pagination.CursorParam = "cursor"
+	}
+	switch pagination.Strategy {
+	case PaginationNone, PaginationOffset, PaginationPage:
+	case PaginationCursor:
+		if pagination.CursorPath == "" {
+			return source, errors.New("cursor pagination needs the cursor_path of the next cursor")
+		}
+	default:
+		return source, fmt.Errorf("unknown pagination strategy [%v]", pagination.Strategy)
+	}
+
+	if source.Method == "" {
+		source.Method = "GET"
+	}
+	if source.MaxPages < 1 {
+		source.MaxPages = 1000
+	}
+	return source, nil
+}
+
+// Fetch calls each with every item of every page, the items changed since the watermark when there is one, and
+// returns the next watermark and the number of pages read
+func (s RestPullSource) Fetch(client *http.Client, watermark string, each func(item map[string]interface{}) error) (string, int, error) {
+
+	nextWatermark := watermark
+	offset := 0
+	page := s.Pagination.StartPage
+	cursor := ""
+
+	for pages := 0; pages < s.MaxPages; pages++ {
+
+		query := url.Values{}
+		for key, value := range s.QueryParams {
+			query.Set(key, value)
+		}
+		if watermark != "" && s.WatermarkParam != "" {
+			query.Set(s.WatermarkParam, watermark)
+		}
+		switch s.Pagination.Strategy {
+		case PaginationOffset:
+			query.Set(s.Pagination.LimitParam, strconv.Itoa(s.Pagination.PageSize))
+			query.Set(s.Pagination.OffsetParam, strconv.Itoa(offset))
+		case PaginationPage:
+			query.Set(s.Pagination.LimitParam, strconv.Itoa(s.Pagination.PageSize))
+			query.Set(s.Pagination.PageParam, strconv.Itoa(page))
+		case PaginationCursor:
+			query.Set(s.Pagination.LimitParam, strconv.Itoa(s.Pagination.PageSize))
+			if cursor != "" {
+				query.Set(s.Pagination.CursorParam, cursor)
+			}
+		}
+
+		response, err := s.request(client, query)
+		if err != nil {
+			return watermark, pages, err
+		}
+
+		var items interface{} = response
+		if s.ItemsPath != "" {
+			responseMap, ok := response.(map[string]interface{})
+			if !ok {
+				return watermark, pages, errors.New("expected an object in the response")
+			}
+			items, ok = valueAtPath(responseMap, s.ItemsPath)
+			if !ok {
+				items = []interface{}{}
+			}
+		}
+		itemList, ok := items.([]interface{})
+		if !ok {
+			return watermark, pages, fmt.Errorf("expected a list of items at [%v]", s.ItemsPath)
+		}
+
+		for _, item := range itemList {
+			row, ok := item.(map[string]interface{})
+			if !ok {
+				return watermark, pages, errors.New("expected the items to be objects")
+			}
+			err = each(row)
+			if err != nil {
+				return watermark, pages, err
+			}
+			if s.WatermarkPath != "" {
+				if value, ok := valueAtPath(row, s.WatermarkPath); ok && value != nil {
+					candidate := watermarkString(value)
+					if laterWatermark(candidate, nextWatermark) {
+						nextWatermark = candidate
+					}
+				}
+			}
+		}
+
+		switch s.Pagination.Strategy {
+		case PaginationOffset:
+			offset += len(itemList)
+			if len(itemList) < s.Pagination.PageSize {
+				return nextWatermark, pages + 1, nil
+			}
+		case PaginationPage:
+			page += 1
+			if len(itemList) < s.Pagination.PageSize {
+				return nextWatermark, pages + 1, nil
+			}
+		case PaginationCursor:
+			responseMap, _ := response.(map[string]interface{})
+			next, ok := valueAtPath(responseMap, s.Pagination.CursorPath)
+			if !ok || next == nil || fmt.Sprintf("%v", next) == "" || len(itemList) == 0 {
+				return nextWatermark, pages + 1, nil
+			}
+			cursor = fmt.Sprintf("%v", next)
+		default:
+			return nextWatermark, pages + 1, nil
+		}
+	}
+
+	return watermark, s.MaxPages, fmt.Errorf("stopped after %d pages", s.MaxPages)
+}
+
+func (s RestPullSource) request(client *http.Client, query url.Values) (interface{}, error) {
+
+	requestUrl, err := url.Parse(s.Url)
+	if err != nil {
+		return nil, err
+	}
+	values := requestUrl.Query()
+	for key := range query {
+		values.Set(key, query.Get(key))
+	}
+	requestUrl.RawQuery = values.Encode()
+
+	request, err := http.NewRequest(s.Method, requestUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	for key, value := range s.Headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = response.Body.Close()
+		CheckErr(err, "Failed to close the response of [%v]", s.Url)
+	}()
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, restPullResponseLimit))
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, fmt.Errorf("[%v] responded with status %d", s.Url, response.StatusCode)
+	}
+
+	var payload interface{}
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON from [%v]: %v", s.Url, err)
+	}
+	return payload, nil
+}
+
+func watermarkString(value interface{}) string {
+	if number, ok := value.(float64); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// laterWatermark is true when the candidate is after the current watermark, watermarks are compared as numbers,
+// as dates or else as strings
+func laterWatermark(candidate string, current string) bool {
+
+	if current == "" {
+		return candidate != ""
+	}
+
+	candidateNumber, err1 := strconv.ParseFloat(candidate, 64)
+	currentNumber, err2 := strconv.ParseFloat(current, 64)
+	if err1 == nil && err2 == nil {
+		return candidateNumber > currentNumber
+	}
+
+	candidateTime, err1 := dateparse.ParseAny(candidate)
+	currentTime, err2 := dateparse.ParseAny(current)
+	if err1 == nil && err2 == nil {
+		return candidateTime.After(currentTime)
+	}
+
+	return strings.Compare(candidate, current) > 0
+}
@@ -0,0 +1,129 @@
+package resource
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestRestPullSourceOffset(t *testing.T) {
+
+	total := 5
+	var since string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		since = r.URL.Query().Get("updated_since")
+		items := ""
+		for i := offset; i < offset+limit && i < total; i++ {
+			if items != "" {
+				items += ","
+			}
+			items += fmt.Sprintf(`{"id": %d, "updated_at": "2020-01-0%dT00:00:00Z"}`, i, i+1)
+		}
+		_, _ = w.Write([]byte(`{"data": {"items": [` + items + `]}}`))
+	}))
+	defer server.Close()
+
+	source, err := NewRestPullSource(`{
+		"url": "` + server.URL + `/items",
+		"items_path": "data.items",
+		"pagination": {"strategy": "offset", "page_size": 2},
+		"watermark_param": "updated_since",
+		"watermark_path": "updated_at"
+	}`)
+	if err != nil {
+		t.Fatalf("Failed to read source: %v", err)
+	}
+
+	ids := make([]interface{}, 0)
+	watermark, pages, err := source.Fetch(server.Client(), "2019-12-31T00:00:00Z", func(item map[string]interface{}) error {
+		ids = append(ids, item["id"])
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to fetch: %v", err)
+	}
+	if len(ids) != 5 || pages != 3 {
+		t.Errorf("Expected 5 items from 3 pages, found %v from %v", ids, pages)
+	}
+	if since != "2019-12-31T00:00:00Z" {
+		t.Errorf("Expected the watermark to be sent, found [%v]", since)
+	}
+	if watermark != "2020-01-05T00:00:00Z" {
+		t.Errorf("Expected the latest updated_at as the watermark, found [%v]", watermark)
+	}
+}
+
+func TestRestPullSourceCursor(t *testing.T) {
+
+	pages := map[string]string{
+		"":   `{"items": [{"id": 1}, {"id": 2}], "next": "c2"}`,
+		"c2": `{"items": [{"id": 3}], "next": null}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(pages[r.URL.Query().Get("after")]))
+	}))
+	defer server.Close()
+
+	source, err := NewRestPullSource(`{
+		"url": "` + server.URL + `",
+		"items_path": "items",
+		"pagination": {"strategy": "cursor", "cursor_param": "after", "cursor_path": "next"}
+	}`)
+	if err != nil {
+		t.Fatalf("Failed to read source: %v", err)
+	}
+
+	count := 0
+	watermark, read, err := source.Fetch(server.Client(), "", func(item map[string]interface{}) error {
+		count += 1
+		return nil
+	})
+	if err != nil || count != 3 || read != 2 || watermark != "" {
+		t.Errorf("Expected 3 items from 2 pages, found %v from %v, %v %v", count, read, watermark, err)
+	}
+}
+
+func TestRestPullSourceErrors(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	}))
+	defer server.Close()
+
+	source, _ := NewRestPullSource(`{"url": "` + server.URL + `"}`)
+	watermark, _, err := source.Fetch(server.Client(), "10", func(item map[string]interface{}) error {
+		return nil
+	})
+	if err == nil || watermark != "10" {
+		t.Errorf("Expected a failed fetch to keep the watermark, found %v %v", watermark, err)
+	}
+
+	_, err = NewRestPullSource(`{"url": "http://example.com", "pagination": {"strategy": "cursor"}}`)
+	if err == nil {
+		t.Errorf("Expected cursor pagination without a cursor path to be rejected")
+	}
+}
+
+func TestLaterWatermark(t *testing.T) {
+	cases := []struct {
+		candidate string
+		current   string
+		later     bool
+	}{
+		{"5", "", true},
+		{"10", "9", true},
+		{"9", "10", false},
+		{"2020-01-02T00:00:00+05:00", "2020-01-01T20:00:00Z", false},
+		{"2020-01-02T00:00:00Z", "2020-01-01T23:00:00Z", true},
+		{"b", "a", true},
+	}
+	for _, c := range cases {
+		if laterWatermark(c.candidate, c.current) != c.later {
+			t.Errorf("Expected [%v] after [%v] to be %v", c.candidate, c.current, c.later)
+		}
+	}
+}
@@ -1,16 +1,14 @@
 package resource
 
 import (
-	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
 
 	"github.com/artpar/api2go"
-	uuid "github.com/artpar/go.uuid"
 	"github.com/daptin/daptin/server/auth"
-	"github.com/dop251/goja"
 	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
 	log "github.com/sirupsen/logrus"
 
 	//"io"
@@ -42,6 +40,9 @@ func CreateGuestActionListHandler(initConfig *CmsConfig) func(*gin.Context) {
 
 	guestActions["user:signup"] = actionMap["user_account:signup"]
 	guestActions["user:signin"] = actionMap["user_account:signin"]
+	guestActions["user:mfa_verify"] = actionMap["user_account:mfa_verify"]
+	guestActions["user:webauthn_login_begin"] = actionMap["user_account:webauthn_login_begin"]
+	guestActions["user:webauthn_login_finish"] = actionMap["user_account:webauthn_login_finish"]
 
 	return func(c *gin.Context) {
 
@@ -70,8 +71,10 @@ func NewDaptinError(str string, code string) *DaptinError {
 	}
 }
 
+// CreatePostActionHandler runs action requests, with ?async=true the request is queued on the job queue and the id of
+// the job is returned right away
 func CreatePostActionHandler(initConfig *CmsConfig,
-	cruds map[string]*DbResource, actionPerformers []ActionPerformerInterface) func(*gin.Context) {
+	cruds map[string]*DbResource, actionPerformers []ActionPerformerInterface, jobQueue *ActionJobQueue) func(*gin.Context) {
 
 	actionMap := make(map[string]Action)
 
@@ -115,6 +118,32 @@ func CreatePostActionHandler(initConfig *CmsConfig,
 			actionCrudResource = cruds["world"]
 		}
 
+		if async, _ := strconv.ParseBool(ginContext.Query("async")); async && jobQueue != nil {
+			delete(actionRequest.Attributes, "async")
+			_, err = actionCrudResource.GetActionByName(actionType, actionName)
+			if err != nil {
+				ginContext.AbortWithStatusJSON(400, []ActionResponse{
+					NewActionResponse("client.notify", NewClientNotification("error", "no such action", "failed")),
+				})
+				return
+			}
+			sessionUser, _ := ginContext.Request.Context().Value("user").(*auth.SessionUser)
+			jobId, err := jobQueue.Enqueue(actionRequest, sessionUser)
+			if err != nil {
+				ginContext.AbortWithStatusJSON(400, []ActionResponse{
+					NewActionResponse("client.notify", NewClientNotification("error", err.Error(), "failed")),
+				})
+				return
+			}
+			ginContext.JSON(202, []ActionResponse{
+				NewActionResponse("action.job", map[string]interface{}{
+					"job_id": jobId,
+					"status": ActionJobQueued,
+				}),
+			})
+			return
+		}
+
 		responses, err := actionCrudResource.HandleActionRequest(actionRequest, req)
 
 		responseStatus := 200
@@ -299,8 +328,32 @@ func (db *DbResource) HandleActionRequest(actionRequest ActionRequest, req api2g
 
 	responses := make([]ActionResponse, 0)
 
+	cruds := db.Cruds
+	var transaction *sqlx.Tx
+	if action.Transactional {
+		err = checkTransactionalOutcomes(action)
+		if err != nil {
+			return nil, api2go.NewHTTPError(err, "transactional action cannot be rolled back", 500)
+		}
+		transaction, err = db.connection.Beginx()
+		if err != nil {
+			return nil, api2go.NewHTTPError(err, "failed to begin transaction", 500)
+		}
+		cruds = NewCrudsWithTransaction(db.Cruds, transaction)
+	}
+
+	// until the action completes, returning rolls back its transaction and compensates the outcomes done so far
+	compensations := make([]Outcome, 0)
+	completed := false
+	defer func() {
+		if !completed {
+			db.abortAction(transaction, compensations, inFieldMap, req)
+		}
+	}()
+	failed := false
+
 OutFields:
-	for _, outcome := range action.OutFields {
+	for i, outcome := range action.OutFields {
 		var responseObjects interface{}
 		responseObjects = nil
 		var responses1 []ActionResponse
@@ -355,21 +408,8 @@ OutFields:
 			}
 		}
 
-		requestContext := req.PlainRequest.Context()
-		var adminUserReferenceId string
-		adminUserReferenceIds := db.GetAdminReferenceId()
-		for id, _ := range adminUserReferenceIds {
-			adminUserReferenceId = id
-			break
-		}
-
-		if len(adminUserReferenceId) > 0 {
-			requestContext = context.WithValue(requestContext, "user", &auth.SessionUser{
-				UserReferenceId: adminUserReferenceId,
-			})
-		}
-		request.PlainRequest = request.PlainRequest.WithContext(requestContext)
-		dbResource, _ := db.Cruds[outcome.Type]
+		request.PlainRequest = request.PlainRequest.WithContext(db.outcomeContext(req.PlainRequest.Context()))
+		dbResource, _ := cruds[outcome.Type]
 
 		actionResponses := make([]ActionResponse, 0)
 		//log.Printf("Next outcome method: [%v][%v]", outcome.Method, outcome.Type)
@@ -381,6 +421,7 @@ OutFields:
 
 				actionResponse = NewActionResponse("client.notify", NewClientNotification("error", "Failed to create "+model.GetName()+". "+err.Error(), "Failed"))
 				responses = append(responses, actionResponse)
+				failed = true
 				break OutFields
 			} else {
 				createdRow := responseObjects.(api2go.Response).Result().(*api2go.Api2GoModel).Data
@@ -405,6 +446,7 @@ OutFields:
 				actionResponse = NewActionResponse("client.notify",
 					NewClientNotification("error", "Failed to get "+model.GetName()+". "+err.Error(), "Failed"))
 				responses = append(responses, actionResponse)
+				failed = true
 				break OutFields
 			} else {
 				actionResponse = NewActionResponse(actionRequest.Type, responseObjects)
@@ -436,6 +478,7 @@ OutFields:
 				actionResponse = NewActionResponse("client.notify",
 					NewClientNotification("error", "Failed to create "+model.GetName()+". "+err.Error(), "Failed"))
 				responses = append(responses, actionResponse)
+				failed = true
 				break OutFields
 			} else {
 				actionResponse = NewActionResponse(actionRequest.Type, responseObjects)
@@ -444,9 +487,16 @@ OutFields:
 		case "PATCH":
 			responseObjects, err = dbResource.Update(model, request)
 			CheckErr(err, "Failed to update inside action")
+			if conflict, ok := GetVersionConflict(err); ok {
+				return []ActionResponse{
+					NewActionResponse("version.conflict", conflict),
+					NewActionResponse("client.notify", NewClientNotification("error", conflict.Message(), "Conflict")),
+				}, err
+			}
 			if err != nil {
 				actionResponse = NewActionResponse("client.notify", NewClientNotification("error", "Failed to update "+model.GetName()+". "+err.Error(), "Failed"))
 				responses = append(responses, actionResponse)
+				failed = true
 				break OutFields
 			} else {
 				createdRow := responseObjects.(api2go.Response).Result().(*api2go.Api2GoModel).Data
@@ -459,6 +509,7 @@ OutFields:
 			if err != nil {
 				actionResponse = NewActionResponse("client.notify", NewClientNotification("error", "Failed to delete "+model.GetName(), "Failed"))
 				responses = append(responses, actionResponse)
+				failed = true
 				break OutFields
 			} else {
 				actionResponse = NewActionResponse("client.notify", NewClientNotification("success", "Deleted "+model.GetName(), "Success"))
@@ -468,7 +519,7 @@ OutFields:
 			//res, err = Cruds[outcome.Type].Create(model, actionRequest)
 
 			actionName := model.GetName()
-			performer, ok := db.ActionHandlerMap[actionName]
+			performer, ok := db.GetActionPerformer(actionName)
 			if !ok {
 				log.Errorf("Invalid outcome method: [%v]%v", outcome.Method, model.GetName())
 				//return ginContext.AbortWithError(500, errors.New("Invalid outcome"))
@@ -492,7 +543,7 @@ OutFields:
 			actionResponse = NewActionResponse(model.GetName(), model.Data)
 			actionResponses = append(actionResponses, actionResponse)
 		default:
-			handler, ok := db.ActionHandlerMap[outcome.Type]
+			handler, ok := db.GetActionPerformer(outcome.Type)
 
 			if !ok {
 				log.Errorf("Unknown method invoked onn %v: %v", outcome.Type, outcome.Method)
@@ -550,7 +601,27 @@ OutFields:
 		if err != nil {
 			return responses, err
 		}
+
+		if outcome.Compensation != nil && !(transaction != nil && isDatabaseOutcome(outcome)) {
+			compensations = append(compensations, *outcome.Compensation)
+		}
+
+		reportActionProgress(req, i+1, len(action.OutFields), fmt.Sprintf("%v %v", outcome.Method, outcome.Type))
+	}
+
+	if failed {
+		return responses, nil
+	}
+
+	if transaction != nil {
+		err = transaction.Commit()
+		if err != nil {
+			log.Errorf("Failed to commit action [%v][%v]: %v", actionRequest.Type, actionRequest.Action, err)
+			return responses, err
+		}
+		RunAfterCommit(cruds)
 	}
+	completed = true
 
 	return responses, nil
 }
@@ -771,29 +842,7 @@ func BuildOutcome(inFieldMap map[string]interface{}, outcome Outcome) (*api2go.A
 }
 
 func runUnsafeJavascript(unsafe string, contextMap map[string]interface{}) (interface{}, error) {
-
-	vm := goja.New()
-
-	//vm.ToValue(contextMap)
-	for key, val := range contextMap {
-		vm.Set(key, val)
-	}
-
-	vm.Set("btoa", func(data []byte) string {
-		return base64.StdEncoding.EncodeToString(data)
-	})
-
-	vm.Set("uuid", func() string {
-		u, _ := uuid.NewV4()
-		return u.String()
-	})
-	v, err := vm.RunString(unsafe) // Here be dragons (risky code)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return v.Export(), nil
+	return javascriptRuntime.Run(unsafe, contextMap)
 }
 
 func BuildActionContext(outcomeAttributes interface{}, inFieldMap map[string]interface{}) (interface{}, error) {
@@ -60,7 +60,7 @@ func (be *DaptinImapBackend) Login(conn *imap.ConnInfo, username, password strin
 		Groups:          groups,
 	}
 
-	if BcryptCheckStringHash(password, userMailAccount["password"].(string)) {
+	if BcryptCheckStringHash(password, userMailAccount["password"].(string)) && be.cruds[USER_ACCOUNT_TABLE_NAME].AllowsPasswordOnlySignIn(userId) {
 
 		return &DaptinImapUser{
 			username:               username,
@@ -0,0 +1,461 @@
+package resource
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+)
+
+// InboundHookTableName holds the hooks third party systems post to at /hook/<reference_id>, the reference id is the
+// secret part of the url. InboundHookReceiptTableName logs every request received by a hook
+const (
+	InboundHookTableName        = "inbound_hook"
+	InboundHookReceiptTableName = "inbound_hook_receipt"
+)
+
+// Signature schemes an inbound hook can verify requests with, hmac-sha256 is the default and none accepts
+// requests from anyone who knows the url
+// hmac-sha256 is the hex or base64 HMAC-SHA256 of the body in the signature header of the hook, X-Signature when
+// it is not set, github is the X-Hub-Signature-256 header, stripe the Stripe-Signature header and daptin the
+// X-Daptin-Signature header sent by webhooks
+const (
+	InboundHookSignatureNone   = "none"
+	InboundHookSignatureHmac   = "hmac-sha256"
+	InboundHookSignatureGithub = "github"
+	InboundHookSignatureStripe = "stripe"
+	InboundHookSignatureDaptin = "daptin"
+)
+
+// Statuses of a receipt
+const (
+	InboundHookAccepted = "accepted"
+	InboundHookRejected = "rejected"
+	InboundHookFailed   = "failed"
+)
+
+// inboundHookMaxAge is how old the timestamp of a signed request can be, for the schemes which sign a timestamp
+const inboundHookMaxAge = 5 * time.Minute
+
+// inboundHookBodyLimit is how much of a request body is kept on its receipt
+const inboundHookBodyLimit = 64 << 10
+
+// InboundHookError is a request a hook did not accept, with the status to respond with
+type InboundHookError struct {
+	Status int
+	Err    error
+}
+
+func (e InboundHookError) Error() string {
+	return e.Err.Error()
+}
+
+// ReceiveInboundHook verifies a request posted to a hook, maps its body with the column mapping of the hook and
+// creates rows in the target table, or runs the target action on it, as the owner of the hook. Every request is
+// logged as a receipt
+func ReceiveInboundHook(cruds map[string]*DbResource, hookId string, header http.Header, body []byte) (interface{}, error) {
+
+	dbResource := cruds[InboundHookTableName]
+	hook, _, err := dbResource.GetSingleRowByReferenceId(InboundHookTableName, hookId, nil)
+	if err != nil {
+		return nil, InboundHookError{Status: http.StatusNotFound, Err: fmt.Errorf("no such hook [%v]", hookId)}
+	}
+	// drivers return booleans as numbers, strings or booleans
+	switch fmt.Sprintf("%v", hook["enable"]) {
+	case "1", "true":
+	default:
+		return nil, InboundHookError{Status: http.StatusNotFound, Err: fmt.Errorf("no such hook [%v]", hookId)}
+	}
+
+	result, err := receiveInboundHook(cruds, hook, header, body)
+
+	receipt := map[string]interface{}{
+		"hook_id": hookId,
+		"status":  InboundHookAccepted,
+		"headers": toJson(receiptHeaders(header)),
+		"body":    receiptBody(body),
+		"result":  toJson(result),
+	}
+	if err != nil {
+		receipt["status"] = InboundHookFailed
+		if hookError, ok := err.(InboundHookError); ok && hookError.Status < http.StatusInternalServerError {
+			receipt["status"] = InboundHookRejected
+		}
+		receipt["error"] = err.Error()
+		log.Errorf("Inbound hook [%v] did not accept a request: %v", hookId, err)
+	}
+
+	pr := &http.Request{
+		Method: "POST",
+	}
+	req := api2go.Request{
+		PlainRequest: pr.WithContext(context.Background()),
+	}
+	_, receiptErr := cruds[InboundHookReceiptTableName].CreateWithoutFilter(api2go.NewApi2GoModelWithData(InboundHookReceiptTableName, nil, 0, nil, receipt), req)
+	CheckErr(receiptErr, "Failed to log the receipt of inbound hook [%v]", hookId)
+
+	return result, err
+}
+
+func receiveInboundHook(cruds map[string]*DbResource, hook map[string]interface{}, header http.Header, body []byte) (interface{}, error) {
+
+	dbResource := cruds[InboundHookTableName]
+
+	scheme, _ := hook["signature_scheme"].(string)
+	signatureHeader, _ := hook["signature_header"].(string)
+	secret, _ := hook["secret"].(string)
+	if secret != "" {
+		encryptionSecret, _ := dbResource.configStore.GetConfigValueFor("encryption.secret", "backend")
+		decrypted, err := Decrypt([]byte(encryptionSecret), secret)
+		if err != nil {
+			return nil, InboundHookError{Status: http.StatusInternalServerError, Err: errors.New("failed to read the secret of the hook")}
+		}
+		secret = decrypted
+	}
+	if scheme != InboundHookSignatureNone && secret == "" {
+		return nil, InboundHookError{Status: http.StatusInternalServerError, Err: errors.New("the hook has no secret to verify signatures with")}
+	}
+	err := verifyInboundHookSignature(scheme, signatureHeader, secret, header, body, time.Now())
+	if err != nil {
+		return nil, InboundHookError{Status: http.StatusUnauthorized, Err: err}
+	}
+
+	rows, err := inboundHookRows(header.Get("Content-Type"), body)
+	if err != nil {
+		return nil, InboundHookError{Status: http.StatusBadRequest, Err: err}
+	}
+
+	var mapping ColumnMapping
+	if mappingJson := toJson(hook["column_mapping"]); mappingJson != "" && mappingJson != "null" {
+		err = json.Unmarshal([]byte(mappingJson), &mapping)
+		if err != nil {
+			return nil, InboundHookError{Status: http.StatusInternalServerError, Err: fmt.Errorf("invalid column mapping: %v", err)}
+		}
+	}
+
+	targetTable, _ := hook["target_table"].(string)
+	targetAction, _ := hook["target_action"].(string)
+	targetResource, ok := cruds[targetTable]
+	if !ok {
+		return nil, InboundHookError{Status: http.StatusInternalServerError, Err: fmt.Errorf("no such table [%v]", targetTable)}
+	}
+
+	sessionUser := &auth.SessionUser{}
+	if userReferenceId, ok := hook[USER_ACCOUNT_ID_COLUMN].(string); ok && userReferenceId != "" {
+		user, err := dbResource.GetReferenceIdToObject(USER_ACCOUNT_TABLE_NAME, userReferenceId)
+		if err == nil {
+			sessionUser.UserReferenceId = userReferenceId
+			sessionUser.UserId, _ = user["id"].(int64)
+			sessionUser.Groups = dbResource.GetObjectUserGroupsByWhere(USER_ACCOUNT_TABLE_NAME, "reference_id", userReferenceId)
+		}
+	}
+	pr := &http.Request{
+		Method: "POST",
+	}
+	req := api2go.Request{
+		PlainRequest: pr.WithContext(context.WithValue(context.Background(), "user", sessionUser)),
+	}
+
+	// the rows of a body are created together or not at all
+	var transaction *sqlx.Tx
+	if targetAction == "" {
+		transaction, err = dbResource.connection.Beginx()
+		if err != nil {
+			return nil, InboundHookError{Status: http.StatusInternalServerError, Err: err}
+		}
+		defer func() {
+			if transaction != nil {
+				CheckErr(transaction.Rollback(), "Failed to roll back the rows of inbound hook [%v]", hook["reference_id"])
+			}
+		}()
+		txCruds := NewCrudsWithTransaction(cruds, transaction)
+		targetResource = txCruds[targetTable]
+	}
+
+	results := make([]interface{}, 0)
+	for _, row := range rows {
+		attributes, err := mapping.Apply(row)
+		if err != nil {
+			return results, InboundHookError{Status: http.StatusBadRequest, Err: err}
+		}
+
+		if targetAction != "" {
+			responses, err := targetResource.HandleActionRequest(ActionRequest{
+				Type:       targetTable,
+				Action:     targetAction,
+				Attributes: attributes,
+			}, req)
+			if err != nil {
+				return results, InboundHookError{Status: http.StatusBadRequest, Err: err}
+			}
+			results = append(results, responses)
+			continue
+		}
+
+		created, err := targetResource.Create(api2go.NewApi2GoModelWithData(targetTable, nil, 0, nil, attributes), req)
+		if err != nil {
+			return results, InboundHookError{Status: http.StatusBadRequest, Err: err}
+		}
+		results = append(results, map[string]interface{}{
+			"type": targetTable,
+			"id":   created.Result().(*api2go.Api2GoModel).GetID(),
+		})
+	}
+
+	if transaction != nil {
+		err = transaction.Commit()
+		transaction = nil
+		if err != nil {
+			return nil, InboundHookError{Status: http.StatusInternalServerError, Err: err}
+		}
+		RunAfterCommit(targetResource.Cruds)
+	}
+	return results, nil
+}
+
+// setInboundHookSecret generates the secret of a hook created without one
+func setInboundHookSecret(attributes map[string]interface{}) {
+	if secret, _ := attributes["secret"].(string); secret != "" {
+		return
+	}
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	CheckErr(err, "Failed to generate the secret of an inbound hook")
+	attributes["secret"] = hex.EncodeToString(secret)
+}
+
+// inboundHookRows reads the rows posted to a hook, a JSON object, a JSON array of objects or a form
+func inboundHookRows(contentType string, body []byte) ([]map[string]interface{}, error) {
+
+	if strings.HasPrefix(strings.ToLower(contentType), "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{})
+		for key, value := range values {
+			row[key] = value[0]
+		}
+		return []map[string]interface{}{row}, nil
+	}
+
+	var payload interface{}
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON body: %v", err)
+	}
+	switch value := payload.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{value}, nil
+	case []interface{}:
+		rows := make([]map[string]interface{}, 0)
+		for _, item := range value {
+			row, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("expected an array of objects")
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	}
+	return nil, errors.New("expected a JSON object or an array of objects")
+}
+
+// Apply maps the source row to the attributes of the target. Source columns are paths into the row, with the keys
+// of nested objects and the indexes of arrays separated by dots, like data.items.0.price. Source columns missing in
+// the row are left out. Without any column maps the row is used as is
+func (c ColumnMapping) Apply(source map[string]interface{}) (map[string]interface{}, error) {
+
+	if len(c) == 0 {
+		return source, nil
+	}
+
+	target := make(map[string]interface{})
+	for _, columnMap := range c {
+		value, ok := valueAtPath(source, columnMap.SourceColumn)
+		if !ok {
+			continue
+		}
+		converted, err := convertMappedValue(value, columnMap.TargetColumnType)
+		if err != nil {
+			return nil, fmt.Errorf("column [%v]: %v", columnMap.SourceColumn, err)
+		}
+		targetColumn := columnMap.TargetColumn
+		if targetColumn == "" {
+			targetColumn = columnMap.SourceColumn
+		}
+		target[targetColumn] = converted
+	}
+	return target, nil
+}
+
+func valueAtPath(source map[string]interface{}, path string) (interface{}, bool) {
+
+	var current interface{} = source
+	for _, key := range strings.Split(path, ".") {
+		switch value := current.(type) {
+		case map[string]interface{}:
+			next, ok := value[key]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil, false
+			}
+			current = value[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// convertMappedValue converts a mapped value to the target column type, string, int, float, bool or json, other
+// types leave the value as it is
+func convertMappedValue(value interface{}, columnType string) (interface{}, error) {
+
+	if value == nil {
+		return nil, nil
+	}
+	text := fmt.Sprintf("%v", value)
+	if number, ok := value.(float64); ok {
+		text = strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	switch strings.ToLower(columnType) {
+	case "string":
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return toJson(value), nil
+		}
+		return text, nil
+	case "int":
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, err
+		}
+		return int64(number), nil
+	case "float":
+		return strconv.ParseFloat(text, 64)
+	case "bool":
+		return strconv.ParseBool(text)
+	case "json":
+		return toJson(value), nil
+	}
+	return value, nil
+}
+
+// verifyInboundHookSignature checks the signature of a request with the scheme of the hook
+func verifyInboundHookSignature(scheme string, signatureHeader string, secret string, header http.Header, body []byte, now time.Time) error {
+
+	sign := func(data string) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(data))
+		return mac.Sum(nil)
+	}
+
+	switch scheme {
+	case InboundHookSignatureNone:
+		return nil
+	case "", InboundHookSignatureHmac:
+		if signatureHeader == "" {
+			signatureHeader = "X-Signature"
+		}
+		signature := strings.TrimPrefix(header.Get(signatureHeader), "sha256=")
+		expected := sign(string(body))
+		if hmac.Equal([]byte(signature), []byte(hex.EncodeToString(expected))) ||
+			hmac.Equal([]byte(signature), []byte(base64.StdEncoding.EncodeToString(expected))) {
+			return nil
+		}
+	case InboundHookSignatureGithub:
+		signature := header.Get("X-Hub-Signature-256")
+		if hmac.Equal([]byte(signature), []byte("sha256="+hex.EncodeToString(sign(string(body))))) {
+			return nil
+		}
+	case InboundHookSignatureStripe:
+		var timestamp string
+		signatures := make([]string, 0)
+		for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+			keyValue := strings.SplitN(strings.TrimSpace(part), "=", 2)
+			if len(keyValue) != 2 {
+				continue
+			}
+			switch keyValue[0] {
+			case "t":
+				timestamp = keyValue[1]
+			case "v1":
+				signatures = append(signatures, keyValue[1])
+			}
+		}
+		if err := checkSignatureTimestamp(timestamp, now); err != nil {
+			return err
+		}
+		expected := hex.EncodeToString(sign(timestamp + "." + string(body)))
+		for _, signature := range signatures {
+			if hmac.Equal([]byte(signature), []byte(expected)) {
+				return nil
+			}
+		}
+	case InboundHookSignatureDaptin:
+		timestamp := header.Get("X-Daptin-Timestamp")
+		if err := checkSignatureTimestamp(timestamp, now); err != nil {
+			return err
+		}
+		expected := SignWebhookPayload(secret, timestamp, string(body))
+		if hmac.Equal([]byte(header.Get("X-Daptin-Signature")), []byte(expected)) {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown signature scheme [%v]", scheme)
+	}
+	return errors.New("invalid signature")
+}
+
+// checkSignatureTimestamp rejects signed requests with timestamps too far from now, so they cannot be replayed
+func checkSignatureTimestamp(timestamp string, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid signature timestamp")
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > inboundHookMaxAge || age < -inboundHookMaxAge {
+		return errors.New("signature timestamp is too old")
+	}
+	return nil
+}
+
+// receiptHeaders are the headers logged on a receipt, credentials are left out
+func receiptHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string)
+	for name := range header {
+		switch strings.ToLower(name) {
+		case "authorization", "cookie":
+			continue
+		}
+		headers[name] = header.Get(name)
+	}
+	return headers
+}
+
+func receiptBody(body []byte) string {
+	if len(body) > inboundHookBodyLimit {
+		return string(body[:inboundHookBodyLimit])
+	}
+	return string(body)
+}
@@ -0,0 +1,145 @@
+package resource
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestColumnMappingApply(t *testing.T) {
+
+	var mapping ColumnMapping
+	err := json.Unmarshal([]byte(`[
+		{"SourceColumn": "data.object.amount", "TargetColumn": "amount", "TargetColumnType": "int"},
+		{"SourceColumn": "data.object.items.1.name", "TargetColumn": "second_item"},
+		{"SourceColumn": "data.object.metadata.order", "TargetColumn": "order_id", "TargetColumnType": "string"},
+		{"SourceColumn": "missing.path", "TargetColumn": "missing"}
+	]`), &mapping)
+	if err != nil {
+		t.Fatalf("Failed to read mapping: %v", err)
+	}
+
+	source := map[string]interface{}{
+		"data": map[string]interface{}{
+			"object": map[string]interface{}{
+				"amount":   float64(1250),
+				"items":    []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}},
+				"metadata": map[string]interface{}{"order": float64(42)},
+			},
+		},
+	}
+	target, err := mapping.Apply(source)
+	if err != nil {
+		t.Fatalf("Failed to apply mapping: %v", err)
+	}
+	if target["amount"] != int64(1250) || target["second_item"] != "b" || target["order_id"] != "42" {
+		t.Errorf("Unexpected mapped row %v", target)
+	}
+	if _, ok := target["missing"]; ok {
+		t.Errorf("Expected a missing source column to be left out")
+	}
+
+	err = json.Unmarshal([]byte(`{"email": "email_address"}`), &mapping)
+	if err != nil || len(mapping) != 1 || mapping[0].TargetColumn != "email_address" {
+		t.Errorf("Expected an object of columns to be read as one column map, found %v %v", mapping, err)
+	}
+
+	var empty ColumnMapping
+	target, _ = empty.Apply(map[string]interface{}{"title": "Dune"})
+	if target["title"] != "Dune" {
+		t.Errorf("Expected the row as is without a mapping, found %v", target)
+	}
+}
+
+func TestInboundHookRows(t *testing.T) {
+
+	rows, err := inboundHookRows("application/x-www-form-urlencoded", []byte("name=Ada&email=ada%40example.com"))
+	if err != nil || len(rows) != 1 || rows[0]["email"] != "ada@example.com" {
+		t.Errorf("Unexpected form rows %v %v", rows, err)
+	}
+
+	rows, err = inboundHookRows("application/json", []byte(`[{"name": "a"}, {"name": "b"}]`))
+	if err != nil || len(rows) != 2 {
+		t.Errorf("Unexpected array rows %v %v", rows, err)
+	}
+
+	_, err = inboundHookRows("application/json", []byte(`"text"`))
+	if err == nil {
+		t.Errorf("Expected a string body to be rejected")
+	}
+}
+
+func TestVerifyInboundHookSignature(t *testing.T) {
+
+	secret := "whsec"
+	body := []byte(`{"id":"evt_1"}`)
+	now := time.Now()
+	timestamp := fmt.Sprintf("%d", now.Unix())
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	bodySignature := mac.Sum(nil)
+
+	mac = hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	stripeSignature := hex.EncodeToString(mac.Sum(nil))
+
+	cases := []struct {
+		name    string
+		scheme  string
+		header  string
+		headers map[string]string
+		valid   bool
+	}{
+		{"none", InboundHookSignatureNone, "", nil, true},
+		{"default unsigned", "", "", nil, false},
+		{"default", "", "", map[string]string{"X-Signature": hex.EncodeToString(bodySignature)}, true},
+		{"hmac hex", InboundHookSignatureHmac, "X-Signature", map[string]string{"X-Signature": hex.EncodeToString(bodySignature)}, true},
+		{"hmac base64", InboundHookSignatureHmac, "X-Custom", map[string]string{"X-Custom": base64.StdEncoding.EncodeToString(bodySignature)}, true},
+		{"hmac wrong header", InboundHookSignatureHmac, "X-Custom", map[string]string{"X-Signature": hex.EncodeToString(bodySignature)}, false},
+		{"github", InboundHookSignatureGithub, "", map[string]string{"X-Hub-Signature-256": "sha256=" + hex.EncodeToString(bodySignature)}, true},
+		{"github forged", InboundHookSignatureGithub, "", map[string]string{"X-Hub-Signature-256": "sha256=00"}, false},
+		{"stripe", InboundHookSignatureStripe, "", map[string]string{"Stripe-Signature": "t=" + timestamp + ",v1=" + stripeSignature}, true},
+		{"stripe replayed", InboundHookSignatureStripe, "", map[string]string{"Stripe-Signature": "t=1000,v1=" + stripeSignature}, false},
+		{"daptin", InboundHookSignatureDaptin, "", map[string]string{
+			"X-Daptin-Timestamp": timestamp,
+			"X-Daptin-Signature": SignWebhookPayload(secret, timestamp, string(body)),
+		}, true},
+		{"unknown", "md5", "", nil, false},
+	}
+
+	for _, c := range cases {
+		header := http.Header{}
+		for name, value := range c.headers {
+			header.Set(name, value)
+		}
+		err := verifyInboundHookSignature(c.scheme, c.header, secret, header, body, now)
+		if c.valid && err != nil {
+			t.Errorf("[%v] expected a valid signature: %v", c.name, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("[%v] expected the signature to be rejected", c.name)
+		}
+	}
+}
+
+func TestSetInboundHookSecret(t *testing.T) {
+
+	attributes := map[string]interface{}{"name": "stripe"}
+	setInboundHookSecret(attributes)
+	secret, _ := attributes["secret"].(string)
+	if len(secret) != 64 {
+		t.Errorf("Expected a generated secret, found [%v]", secret)
+	}
+
+	attributes = map[string]interface{}{"secret": "chosen"}
+	setInboundHookSecret(attributes)
+	if attributes["secret"] != "chosen" {
+		t.Errorf("Expected the secret of the hook to be kept, found [%v]", attributes["secret"])
+	}
+}
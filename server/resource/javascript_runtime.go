@@ -0,0 +1,355 @@
+package resource
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/araddon/dateparse"
+	"github.com/artpar/api2go"
+	uuid "github.com/artpar/go.uuid"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/dop251/goja"
+)
+
+// JavascriptLimits bound the javascript expressions evaluated in actions
+// MaxCallDepth is how deep the calls of a script may nest, runaway recursion fails instead of growing the stack
+// QueryTables are the tables scripts can read with query(), "*" allows every table
+type JavascriptLimits struct {
+	Timeout         time.Duration
+	MaxCallDepth    int
+	MaxSourceLength int
+	QueryTables     []string
+	MaxQueryRows    int
+}
+
+var DefaultJavascriptLimits = JavascriptLimits{
+	Timeout:         2 * time.Second,
+	MaxCallDepth:    1024,
+	MaxSourceLength: 64 << 10,
+	QueryTables:     []string{"*"},
+	MaxQueryRows:    100,
+}
+
+// maxCachedPrograms is the number of compiled expressions kept, the cache is emptied when it is full
+const maxCachedPrograms = 1024
+
+// JavascriptRuntime evaluates javascript expressions in a fresh VM each, with a curated library and within limits.
+// Compiled expressions are cached and shared between VMs
+type JavascriptRuntime struct {
+	cruds        map[string]*DbResource
+	limits       JavascriptLimits
+	programs     map[string]*goja.Program
+	programsLock sync.RWMutex
+}
+
+func NewJavascriptRuntime(cruds map[string]*DbResource, limits JavascriptLimits) *JavascriptRuntime {
+	return &JavascriptRuntime{
+		cruds:    cruds,
+		limits:   limits,
+		programs: make(map[string]*goja.Program),
+	}
+}
+
+var javascriptRuntime = NewJavascriptRuntime(nil, DefaultJavascriptLimits)
+
+// ConfigureJavascriptRuntime sets the limits of the expressions evaluated in actions, and the tables they can query
+func ConfigureJavascriptRuntime(cruds map[string]*DbResource, limits JavascriptLimits) {
+	javascriptRuntime = NewJavascriptRuntime(cruds, limits)
+}
+
+// compile returns the compiled program of the source, from the cache when it was compiled before
+func (jr *JavascriptRuntime) compile(source string) (*goja.Program, error) {
+
+	jr.programsLock.RLock()
+	program, ok := jr.programs[source]
+	jr.programsLock.RUnlock()
+	if ok {
+		return program, nil
+	}
+
+	program, err := goja.Compile("expression", source, false)
+	if err != nil {
+		return nil, err
+	}
+
+	jr.programsLock.Lock()
+	if len(jr.programs) >= maxCachedPrograms {
+		jr.programs = make(map[string]*goja.Program)
+	}
+	jr.programs[source] = program
+	jr.programsLock.Unlock()
+	return program, nil
+}
+
+// Run evaluates the source with the values of contextMap as globals and returns the exported result
+func (jr *JavascriptRuntime) Run(source string, contextMap map[string]interface{}) (interface{}, error) {
+
+	if jr.limits.MaxSourceLength > 0 && len(source) > jr.limits.MaxSourceLength {
+		return nil, fmt.Errorf("script is longer than %d characters", jr.limits.MaxSourceLength)
+	}
+
+	program, err := jr.compile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	vm := jr.newVM(contextMap)
+
+	stop := jr.watch(vm)
+	v, err := vm.RunProgram(program) // Here be dragons (risky code)
+	stop()
+
+	if err != nil {
+		return nil, jr.scriptError(err)
+	}
+
+	return v.Export(), nil
+}
+
+// newVM creates a runtime limited to the max call depth, with the values of contextMap as globals and the helper
+// library set
+func (jr *JavascriptRuntime) newVM(contextMap map[string]interface{}) *goja.Runtime {
+	vm := goja.New()
+	if jr.limits.MaxCallDepth > 0 {
+		vm.SetMaxCallStackSize(jr.limits.MaxCallDepth)
+	}
+	for key, val := range contextMap {
+		vm.Set(key, val)
+	}
+	jr.setLibrary(vm, contextMap)
+	return vm
+}
+
+// scriptError describes why a script was stopped by the limits, other errors are returned as they are
+func (jr *JavascriptRuntime) scriptError(err error) error {
+	if interrupted, ok := err.(*goja.InterruptedError); ok {
+		return fmt.Errorf("script stopped: %v", interrupted.Value())
+	}
+	if _, ok := err.(*goja.StackOverflowError); ok {
+		return fmt.Errorf("script stopped: calls nested deeper than %d", jr.limits.MaxCallDepth)
+	}
+	return err
+}
+
+// watch interrupts the script when it runs past the deadline, the returned function stops watching
+func (jr *JavascriptRuntime) watch(vm *goja.Runtime) func() {
+
+	if jr.limits.Timeout <= 0 {
+		return func() {}
+	}
+
+	timer := time.AfterFunc(jr.limits.Timeout, func() {
+		vm.Interrupt(fmt.Sprintf("ran for more than %v", jr.limits.Timeout))
+	})
+	return func() {
+		timer.Stop()
+	}
+}
+
+// setLibrary sets the helper functions scripts can use
+func (jr *JavascriptRuntime) setLibrary(vm *goja.Runtime, contextMap map[string]interface{}) {
+
+	throw := func(err error) {
+		panic(vm.NewGoError(err))
+	}
+
+	vm.Set("btoa", func(data []byte) string {
+		return base64.StdEncoding.EncodeToString(data)
+	})
+
+	vm.Set("atob", func(data string) string {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			throw(err)
+		}
+		return string(decoded)
+	})
+
+	vm.Set("uuid", func() string {
+		u, _ := uuid.NewV4()
+		return u.String()
+	})
+
+	vm.Set("formatDate", func(value interface{}, layout string) string {
+		t, err := scriptTime(value)
+		if err != nil {
+			throw(err)
+		}
+		return t.Format(scriptTimeLayout(layout))
+	})
+
+	vm.Set("parseDate", func(value string) int64 {
+		t, err := dateparse.ParseAny(value)
+		if err != nil {
+			throw(err)
+		}
+		return t.UnixNano() / int64(time.Millisecond)
+	})
+
+	hashFunctions := map[string]func() hash.Hash{
+		"md5":    md5.New,
+		"sha1":   sha1.New,
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+	}
+	for name, newHash := range hashFunctions {
+		newHash := newHash
+		vm.Set(name, func(data string) string {
+			h := newHash()
+			h.Write([]byte(data))
+			return hex.EncodeToString(h.Sum(nil))
+		})
+	}
+
+	vm.Set("hmacSha256", func(key string, data string) string {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(data))
+		return hex.EncodeToString(mac.Sum(nil))
+	})
+
+	vm.Set("query", func(tableName string, filters interface{}, limit int) []map[string]interface{} {
+		rows, err := jr.query(contextMap, tableName, filters, limit)
+		if err != nil {
+			throw(err)
+		}
+		return rows
+	})
+}
+
+// scriptTime reads a time passed by a script as a Date, milliseconds since the epoch or a date string
+func scriptTime(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case int64:
+		return time.Unix(0, v*int64(time.Millisecond)), nil
+	case float64:
+		return time.Unix(0, int64(v)*int64(time.Millisecond)), nil
+	case string:
+		return dateparse.ParseAny(v)
+	case nil:
+		return time.Now(), nil
+	}
+	return time.Time{}, fmt.Errorf("not a date: %v", value)
+}
+
+// scriptTimeLayout is the go layout of the layout passed by a script, which can also name one of the standard ones
+func scriptTimeLayout(layout string) string {
+	switch strings.ToUpper(layout) {
+	case "", "RFC3339", "ISO":
+		return time.RFC3339
+	case "RFC1123":
+		return time.RFC1123
+	case "DATE":
+		return "2006-01-02"
+	case "DATETIME":
+		return "2006-01-02 15:04:05"
+	}
+	return layout
+}
+
+// scriptQueries are the filters passed by a script, either a list of queries or an object of column values
+func scriptQueries(filters interface{}) ([]Query, error) {
+	queries := make([]Query, 0)
+	switch f := filters.(type) {
+	case nil:
+	case map[string]interface{}:
+		for column, value := range f {
+			queries = append(queries, Query{ColumnName: column, Operator: "is", Value: value})
+		}
+	case []interface{}:
+		for _, item := range f {
+			queryMap, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid query: %v", item)
+			}
+			column, _ := queryMap["column"].(string)
+			operator, _ := queryMap["operator"].(string)
+			if operator == "" {
+				operator = "is"
+			}
+			queries = append(queries, Query{ColumnName: column, Operator: operator, Value: queryMap["value"]})
+		}
+	default:
+		return nil, fmt.Errorf("invalid filters: %v", filters)
+	}
+	return queries, nil
+}
+
+func (jr *JavascriptRuntime) canQuery(tableName string) bool {
+	for _, allowed := range jr.limits.QueryTables {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == "*" || allowed == tableName {
+			return true
+		}
+	}
+	return false
+}
+
+// query reads rows of a table with the permissions of the user the script runs for, as the api would
+func (jr *JavascriptRuntime) query(contextMap map[string]interface{}, tableName string, filters interface{}, limit int) ([]map[string]interface{}, error) {
+
+	if jr.cruds == nil || !jr.canQuery(tableName) {
+		return nil, fmt.Errorf("scripts cannot query [%v]", tableName)
+	}
+	dbResource, ok := jr.cruds[tableName]
+	if !ok {
+		return nil, fmt.Errorf("no such table [%v]", tableName)
+	}
+
+	queries, err := scriptQueries(filters)
+	if err != nil {
+		return nil, err
+	}
+	if limit < 1 || (jr.limits.MaxQueryRows > 0 && limit > jr.limits.MaxQueryRows) {
+		limit = jr.limits.MaxQueryRows
+	}
+
+	sessionUser := &auth.SessionUser{}
+	if user, ok := contextMap["user"].(map[string]interface{}); ok {
+		if userReferenceId, ok := user["reference_id"].(string); ok {
+			sessionUser.UserReferenceId = userReferenceId
+			sessionUser.UserId, _ = user["id"].(int64)
+			sessionUser.Groups = dbResource.GetObjectUserGroupsByWhere(USER_ACCOUNT_TABLE_NAME, "reference_id", userReferenceId)
+		}
+	}
+
+	pr := &http.Request{
+		Method: "GET",
+	}
+	pr = pr.WithContext(context.WithValue(context.Background(), "user", sessionUser))
+	req := api2go.Request{
+		PlainRequest: pr,
+		QueryParams: map[string][]string{
+			"query":      {toJson(queries)},
+			"page[size]": {fmt.Sprintf("%d", limit)},
+		},
+	}
+
+	_, result, err := dbResource.PaginatedFindAll(req)
+	if err != nil {
+		return nil, err
+	}
+	models, ok := result.Result().([]*api2go.Api2GoModel)
+	if !ok {
+		return nil, errors.New("unexpected query result")
+	}
+	rows := make([]map[string]interface{}, 0)
+	for _, model := range models {
+		rows = append(rows, model.GetAttributes())
+	}
+	return rows, nil
+}
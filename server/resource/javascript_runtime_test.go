@@ -0,0 +1,79 @@
+package resource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJavascriptRuntimeLibrary(t *testing.T) {
+
+	jr := NewJavascriptRuntime(nil, DefaultJavascriptLimits)
+
+	sha256Digest := sha256.Sum256([]byte("daptin"))
+	cases := map[string]interface{}{
+		`sha256("daptin")`:                                     hex.EncodeToString(sha256Digest[:]),
+		`md5("daptin")`:                                        GetMD5HashString("daptin"),
+		`atob(btoa("daptin"))`:                                 "daptin",
+		`formatDate("2020-02-03T04:05:06Z", "DATE")`:           "2020-02-03",
+		`formatDate(parseDate("2020-02-03 04:05:06"), "2006")`: "2020",
+		`JSON.parse('{"a": [1, 2]}').a.length`:                 int64(2),
+		`name + "!"`:                                           "book!",
+	}
+	for source, expected := range cases {
+		value, err := jr.Run(source, map[string]interface{}{"name": "book"})
+		if err != nil {
+			t.Errorf("Failed to run [%v]: %v", source, err)
+			continue
+		}
+		if value != expected {
+			t.Errorf("Expected [%v] to be %v, found %v", source, expected, value)
+		}
+	}
+
+	if _, err := jr.Run(`query("user_account", {}, 10)`, map[string]interface{}{}); err == nil {
+		t.Errorf("Expected query to fail without tables to query")
+	}
+}
+
+func TestJavascriptRuntimeLimits(t *testing.T) {
+
+	limits := DefaultJavascriptLimits
+	limits.Timeout = 50 * time.Millisecond
+	limits.MaxSourceLength = 100
+	jr := NewJavascriptRuntime(nil, limits)
+
+	started := time.Now()
+	_, err := jr.Run(`while (true) {}`, nil)
+	if err == nil || !strings.Contains(err.Error(), "script stopped") {
+		t.Errorf("Expected an endless loop to be stopped, found %v", err)
+	}
+	if time.Since(started) > 2*time.Second {
+		t.Errorf("Expected the loop to be stopped at the deadline, it ran for %v", time.Since(started))
+	}
+
+	if _, err = jr.Run(strings.Repeat("1;", 100), nil); err == nil {
+		t.Errorf("Expected a script over the length limit to be rejected")
+	}
+
+	if _, err = jr.Run(`1 +`, nil); err == nil {
+		t.Errorf("Expected a syntax error")
+	}
+
+	for i := 0; i < 2; i++ {
+		value, err := jr.Run(`1 + 1`, nil)
+		if err != nil || value != int64(2) {
+			t.Errorf("Expected 2 from a cached program, found %v %v", value, err)
+		}
+	}
+	if len(jr.programs) != 2 {
+		t.Errorf("Expected the loop and the sum to be cached, found %d programs", len(jr.programs))
+	}
+
+	_, err = jr.Run(`function f(n) { return f(n + 1) }; f(0)`, nil)
+	if err == nil || !strings.Contains(err.Error(), "calls nested deeper than") {
+		t.Errorf("Expected runaway recursion to be stopped, found %v", err)
+	}
+}
@@ -0,0 +1,574 @@
+package resource
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artpar/api2go"
+	"github.com/buraksezer/olric"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/duo-labs/webauthn/protocol"
+	"github.com/duo-labs/webauthn/webauthn"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+	log "github.com/sirupsen/logrus"
+)
+
+// WebauthnCredentialTableName holds the passkeys and security keys of the users
+const WebauthnCredentialTableName = "user_webauthn_credential"
+
+// RecoveryCodeTableName holds the hashes of the one time recovery codes of the users
+const RecoveryCodeTableName = "user_recovery_code"
+
+// the second factors a user can present
+const (
+	SecondFactorWebauthn     = "webauthn"
+	SecondFactorOtp          = "otp"
+	SecondFactorRecoveryCode = "recovery_code"
+)
+
+// GuestSigninActions are the actions guests can run to sign in
+var GuestSigninActions = []string{"signin", "mfa_verify", "webauthn_login_begin", "webauthn_login_finish"}
+
+const mfaPendingAudience = "daptin-mfa"
+
+// mfaFirstFactorClaim of a pending token is how the user started the sign in, a password or an otp. A sign in
+// started with an otp is finished with a factor other than the otp
+const mfaFirstFactorClaim = "first_factor"
+const firstFactorPassword = "password"
+const mfaPendingLifetime = 5 * time.Minute
+const recoveryCodeCount = 10
+
+// failed second factors of a user are counted for this long, after too many the user has to wait it out
+const secondFactorLockout = 15 * time.Minute
+const maxSecondFactorFailures = 5
+
+// secondFactor issues the tokens of the sign in, a limited mfa pending token to users who have to present a second
+// factor and a full token after they do
+type secondFactor struct {
+	cruds          map[string]*DbResource
+	secret         []byte
+	tokenLifeTime  int
+	jwtTokenIssuer string
+	webAuthn       *webauthn.WebAuthn
+}
+
+func newSecondFactor(configStore *ConfigStore, cruds map[string]*DbResource) (*secondFactor, error) {
+
+	secret, err := configStore.GetConfigValueFor("jwt.secret", "backend")
+	if err != nil {
+		return nil, err
+	}
+
+	tokenLifeTimeHours, err := configStore.GetConfigIntValueFor("jwt.token.life.hours", "backend")
+	if err != nil {
+		tokenLifeTimeHours = 24 * 3
+	}
+	jwtTokenIssuer, _ := configStore.GetConfigValueFor("jwt.token.issuer", "backend")
+
+	rpId, err := configStore.GetConfigValueFor("webauthn.rp_id", "backend")
+	if err != nil {
+		rpId = "localhost"
+		err = configStore.SetConfigValueFor("webauthn.rp_id", rpId, "backend")
+		CheckErr(err, "Failed to store default value for webauthn.rp_id")
+	}
+	rpOrigin, err := configStore.GetConfigValueFor("webauthn.rp_origin", "backend")
+	if err != nil {
+		rpOrigin = "http://localhost:6336"
+		err = configStore.SetConfigValueFor("webauthn.rp_origin", rpOrigin, "backend")
+		CheckErr(err, "Failed to store default value for webauthn.rp_origin")
+	}
+	rpName, err := configStore.GetConfigValueFor("webauthn.rp_name", "backend")
+	if err != nil {
+		rpName = "Daptin"
+		err = configStore.SetConfigValueFor("webauthn.rp_name", rpName, "backend")
+		CheckErr(err, "Failed to store default value for webauthn.rp_name")
+	}
+
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPDisplayName: rpName,
+		RPID:          rpId,
+		RPOrigin:      rpOrigin,
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			UserVerification: protocol.VerificationPreferred,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &secondFactor{
+		cruds:          cruds,
+		secret:         []byte(secret),
+		tokenLifeTime:  tokenLifeTimeHours,
+		jwtTokenIssuer: jwtTokenIssuer,
+		webAuthn:       webAuthn,
+	}, nil
+}
+
+// signIn are the responses of a complete sign in of the user
+func (s *secondFactor) signIn(user map[string]interface{}) ([]ActionResponse, []error) {
+	tokenString, err := newUserToken(user, s.secret, s.jwtTokenIssuer, s.tokenLifeTime)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return newSigninResponses(tokenString), nil
+}
+
+// pendingToken proves the first factor of the user was checked, it is only accepted by the second factor actions
+func (s *secondFactor) pendingToken(user map[string]interface{}, firstFactor string) (string, error) {
+	now := time.Now()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"email":              user["email"],
+		"sub":                user["reference_id"],
+		"aud":                mfaPendingAudience,
+		"exp":                now.Add(mfaPendingLifetime).Unix(),
+		"iat":                now.Unix(),
+		"iss":                s.jwtTokenIssuer,
+		auth.MfaPendingClaim: true,
+		mfaFirstFactorClaim:  firstFactor,
+	}).SignedString(s.secret)
+}
+
+// pendingUser returns the user of an mfa pending token
+func (s *secondFactor) pendingUser(pendingToken string) (map[string]interface{}, error) {
+	claims, err := s.pendingClaims(pendingToken)
+	if err != nil {
+		return nil, err
+	}
+	email, _ := claims["email"].(string)
+	return s.cruds[USER_ACCOUNT_TABLE_NAME].GetUserAccountRowByEmail(email)
+}
+
+// pendingFirstFactor returns the factor the sign in of an mfa pending token was started with
+func (s *secondFactor) pendingFirstFactor(pendingToken string) string {
+	claims, err := s.pendingClaims(pendingToken)
+	if err != nil {
+		return ""
+	}
+	firstFactor, _ := claims[mfaFirstFactorClaim].(string)
+	return firstFactor
+}
+
+// pendingClaims returns the claims of a valid mfa pending token
+func (s *secondFactor) pendingClaims(pendingToken string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(pendingToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return s.secret, nil
+	})
+	if err != nil || !claims.VerifyAudience(mfaPendingAudience, true) || claims[auth.MfaPendingClaim] != true {
+		return nil, errors.New("the sign in expired, sign in again")
+	}
+	return claims, nil
+}
+
+// pendingResponses ask the client for a second factor. Users who have none yet but are required one get to add a
+// passkey with the pending token
+func (s *secondFactor) pendingResponses(user map[string]interface{}, factors []string, firstFactor string) ([]ActionResponse, error) {
+
+	pendingToken, err := s.pendingToken(user, firstFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	message := "Enter your second factor to finish signing in"
+	if len(factors) == 0 {
+		message = "Add a passkey to finish signing in"
+	}
+	return []ActionResponse{
+		NewActionResponse("client.store.set", map[string]interface{}{
+			"key":   "mfa_token",
+			"value": pendingToken,
+		}),
+		NewActionResponse("mfa.required", map[string]interface{}{
+			"mfa_token": pendingToken,
+			"factors":   factors,
+			"enroll":    len(factors) == 0,
+		}),
+		NewActionResponse("client.notify", NewClientNotification("message", message, "Second factor required")),
+	}, nil
+}
+
+// sessionUserOf is the session user of a user row, to run actions as the user before they are signed in
+func sessionUserOf(user map[string]interface{}) *auth.SessionUser {
+	userId, _ := user["id"].(int64)
+	userReferenceId, _ := user["reference_id"].(string)
+	return &auth.SessionUser{
+		UserId:          userId,
+		UserReferenceId: userReferenceId,
+	}
+}
+
+// createUserRow stores a row owned by the user
+func (s *secondFactor) createUserRow(tableName string, user map[string]interface{}, data map[string]interface{}) error {
+	pr := &http.Request{
+		Method: "POST",
+	}
+	req := api2go.Request{
+		PlainRequest: pr.WithContext(context.WithValue(context.Background(), "user", sessionUserOf(user))),
+	}
+	_, err := s.cruds[tableName].CreateWithoutFilter(api2go.NewApi2GoModelWithData(tableName, nil, 0, nil, data), req)
+	return err
+}
+
+// GetUserSecondFactors returns the kinds of second factor the user has set up
+func (dr *DbResource) GetUserSecondFactors(userId int64) ([]string, error) {
+
+	factors := make([]string, 0)
+	counts := []struct {
+		factor string
+		table  string
+		where  goqu.Ex
+	}{
+		{SecondFactorWebauthn, WebauthnCredentialTableName, goqu.Ex{USER_ACCOUNT_ID_COLUMN: userId}},
+		{SecondFactorRecoveryCode, RecoveryCodeTableName, goqu.Ex{USER_ACCOUNT_ID_COLUMN: userId, "used_at": nil}},
+	}
+
+	otpAccount, err := dr.Cruds["user_otp_account"].GetObjectByWhereClause("user_otp_account", "otp_of_account", userId)
+	if err == nil {
+		switch fmt.Sprintf("%v", otpAccount["verified"]) {
+		case "1", "true":
+			factors = append(factors, SecondFactorOtp)
+		}
+	}
+
+	for _, count := range counts {
+		query, args, err := statementbuilder.Squirrel.Select(goqu.COUNT("*")).From(count.table).Where(count.where).ToSQL()
+		if err != nil {
+			return nil, err
+		}
+		var n int
+		err = dr.connection.QueryRowx(query, args...).Scan(&n)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			factors = append(factors, count.factor)
+		}
+	}
+	return factors, nil
+}
+
+// UserGroupsRequireSecondFactor is true when a group of the user requires a second factor at sign in
+func (dr *DbResource) UserGroupsRequireSecondFactor(userId int64) (bool, error) {
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.I("ug.require_second_factor")).
+		From(goqu.T("usergroup").As("ug")).
+		Join(goqu.T("user_account_user_account_id_has_usergroup_usergroup_id").As("uug"),
+			goqu.On(goqu.Ex{"uug.usergroup_id": goqu.I("ug.id")})).
+		Where(goqu.Ex{"uug." + USER_ACCOUNT_ID_COLUMN: userId}).ToSQL()
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := dr.connection.Queryx(query, args...)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		err = rows.Close()
+		CheckErr(err, "Failed to close usergroup rows")
+	}()
+
+	for rows.Next() {
+		var required interface{}
+		err = rows.Scan(&required)
+		if err != nil {
+			return false, err
+		}
+		switch fmt.Sprintf("%v", required) {
+		case "1", "true":
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RequiresSecondFactor tells if the user has to present a second factor to sign in, which is when they have set
+// one up or a group of theirs requires one, along with the factors they can present
+func (dr *DbResource) RequiresSecondFactor(userId int64) (bool, []string, error) {
+	factors, err := dr.GetUserSecondFactors(userId)
+	if err != nil {
+		return false, nil, err
+	}
+	if len(factors) > 0 {
+		return true, factors, nil
+	}
+	required, err := dr.UserGroupsRequireSecondFactor(userId)
+	return required, factors, err
+}
+
+// AllowsPasswordOnlySignIn is false for users who have to present a second factor, the protocols which only take a
+// password, basic auth, webdav, ftp, sftp, caldav and imap, cannot sign them in. It fails closed
+func (dr *DbResource) AllowsPasswordOnlySignIn(userId int64) bool {
+	required, _, err := dr.RequiresSecondFactor(userId)
+	if err != nil {
+		log.Errorf("Failed to check the second factors of user [%v]: %v", userId, err)
+		return false
+	}
+	if required {
+		log.Infof("User [%v] has to present a second factor, a password alone does not sign them in", userId)
+	}
+	return !required
+}
+
+// AllowsPasswordOnlySignInByEmail is AllowsPasswordOnlySignIn for the user with the email
+func (dr *DbResource) AllowsPasswordOnlySignInByEmail(email string) bool {
+	userAccount, err := dr.GetUserAccountRowByEmail(email)
+	if err != nil {
+		return false
+	}
+	userId, _ := userAccount["id"].(int64)
+	return dr.AllowsPasswordOnlySignIn(userId)
+}
+
+// webauthnUser is a user account as the webauthn relying party sees it
+type webauthnUser struct {
+	account     map[string]interface{}
+	credentials []webauthn.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte {
+	referenceId, _ := u.account["reference_id"].(string)
+	return []byte(referenceId)
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	email, _ := u.account["email"].(string)
+	return email
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	name, _ := u.account["name"].(string)
+	if name == "" {
+		return u.WebAuthnName()
+	}
+	return name
+}
+
+func (u *webauthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// credentialDescriptors lists the credentials of the user, to exclude them from registration
+func (u *webauthnUser) credentialDescriptors() []protocol.CredentialDescriptor {
+	descriptors := make([]protocol.CredentialDescriptor, 0)
+	for _, credential := range u.credentials {
+		descriptors = append(descriptors, protocol.CredentialDescriptor{
+			Type:         protocol.PublicKeyCredentialType,
+			CredentialID: credential.ID,
+		})
+	}
+	return descriptors
+}
+
+// GetUserWebauthnCredentials returns the credentials registered by the user
+func (dr *DbResource) GetUserWebauthnCredentials(userId int64) ([]webauthn.Credential, error) {
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("credential_id"), goqu.C("public_key"),
+		goqu.C("attestation_type"), goqu.C("aaguid"), goqu.C("sign_count")).
+		From(WebauthnCredentialTableName).Where(goqu.Ex{USER_ACCOUNT_ID_COLUMN: userId}).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := dr.connection.Queryx(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = rows.Close()
+		CheckErr(err, "Failed to close webauthn credential rows")
+	}()
+
+	credentials := make([]webauthn.Credential, 0)
+	for rows.Next() {
+		var credentialId, publicKey string
+		var attestationType, aaguid *string
+		var signCount int64
+		err = rows.Scan(&credentialId, &publicKey, &attestationType, &aaguid, &signCount)
+		if err != nil {
+			return nil, err
+		}
+		credential := webauthn.Credential{
+			Authenticator: webauthn.Authenticator{
+				SignCount: uint32(signCount),
+			},
+		}
+		credential.ID, err = base64.RawURLEncoding.DecodeString(credentialId)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential id [%v]: %v", credentialId, err)
+		}
+		credential.PublicKey, err = base64.RawURLEncoding.DecodeString(publicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key of [%v]: %v", credentialId, err)
+		}
+		if attestationType != nil {
+			credential.AttestationType = *attestationType
+		}
+		if aaguid != nil {
+			credential.Authenticator.AAGUID, _ = hex.DecodeString(*aaguid)
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, nil
+}
+
+// webauthnSessionClaims carry the challenge of a webauthn ceremony from its begin to its finish action
+type webauthnSessionClaims struct {
+	Email   string               `json:"email"`
+	Session webauthn.SessionData `json:"session"`
+	jwt.StandardClaims
+}
+
+func (s *secondFactor) sessionToken(ceremony string, email string, session *webauthn.SessionData) (string, error) {
+	now := time.Now()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, webauthnSessionClaims{
+		Email:   email,
+		Session: *session,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  "webauthn-" + ceremony,
+			ExpiresAt: now.Add(mfaPendingLifetime).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+	}).SignedString(s.secret)
+}
+
+// parseSessionToken returns the email and the session of a ceremony, each session can be finished once
+func (s *secondFactor) parseSessionToken(ceremony string, sessionToken string) (string, webauthn.SessionData, error) {
+	claims := &webauthnSessionClaims{}
+	_, err := jwt.ParseWithClaims(sessionToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return s.secret, nil
+	})
+	if err != nil || !claims.VerifyAudience("webauthn-"+ceremony, true) {
+		return "", webauthn.SessionData{}, errors.New("the passkey request expired, try again")
+	}
+	if OlricCache != nil {
+		err = OlricCache.PutIfEx("webauthn-challenge-"+claims.Session.Challenge, true, mfaPendingLifetime, olric.IfNotFound)
+		if err != nil {
+			return "", webauthn.SessionData{}, errors.New("the passkey request was already used, try again")
+		}
+	}
+	return claims.Email, claims.Session, nil
+}
+
+// credentialBody is the PublicKeyCredential sent by the browser, as a json string or an object
+func credentialBody(credential interface{}) ([]byte, error) {
+	switch value := credential.(type) {
+	case nil:
+		return nil, errors.New("credential is missing")
+	case string:
+		return []byte(value), nil
+	case []byte:
+		return value, nil
+	default:
+		return json.Marshal(value)
+	}
+}
+
+// verifyTotp checks a code of the user otp account
+func verifyTotp(code string, secret string) bool {
+	ok, _ := totp.ValidateCustom(code, secret, time.Now().UTC(), totp.ValidateOpts{
+		Period:    300,
+		Skew:      1,
+		Digits:    4,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	return ok
+}
+
+func secondFactorFailureKey(user map[string]interface{}) string {
+	return fmt.Sprintf("mfa-failures-%v", user["reference_id"])
+}
+
+// secondFactorLocked is true when the user failed their second factor too many times lately
+func secondFactorLocked(user map[string]interface{}) bool {
+	if OlricCache == nil {
+		return false
+	}
+	failures, err := OlricCache.Get(secondFactorFailureKey(user))
+	if err != nil {
+		return false
+	}
+	count, _ := strconv.Atoi(fmt.Sprintf("%v", failures))
+	return count >= maxSecondFactorFailures
+}
+
+// recordSecondFactorFailure counts a failed second factor of the user
+func recordSecondFactorFailure(user map[string]interface{}) {
+	if OlricCache == nil {
+		return
+	}
+	key := secondFactorFailureKey(user)
+	count, err := OlricCache.Incr(key, 1)
+	if err != nil {
+		CheckErr(err, "Failed to count a failed second factor")
+		return
+	}
+	if count == 1 {
+		err = OlricCache.Expire(key, secondFactorLockout)
+		CheckErr(err, "Failed to set the expiry of the second factor failures")
+	}
+}
+
+// newRecoveryCode is a random code of ten letters and digits, written as two groups of five
+func newRecoveryCode() (string, error) {
+	random := make([]byte, 10)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(random))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// hashRecoveryCode is what recovery codes are stored as, ignoring case, spaces and dashes
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// RedeemRecoveryCode marks an unused recovery code of the user as used, and tells if there was one
+func (dr *DbResource) RedeemRecoveryCode(userId int64, code string) (bool, error) {
+
+	query, args, err := statementbuilder.Squirrel.Update(RecoveryCodeTableName).Prepared(true).
+		Set(goqu.Record{"used_at": time.Now()}).
+		Where(goqu.Ex{
+			"code_hash":            hashRecoveryCode(code),
+			USER_ACCOUNT_ID_COLUMN: userId,
+			"used_at":              nil,
+		}).ToSQL()
+	if err != nil {
+		return false, err
+	}
+	result, err := dr.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected == 1, err
+}
@@ -0,0 +1,113 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/daptin/daptin/server/auth"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/duo-labs/webauthn/webauthn"
+)
+
+func TestMfaPendingToken(t *testing.T) {
+
+	s := &secondFactor{secret: []byte("secret"), jwtTokenIssuer: "daptin-test"}
+	pendingToken, err := s.pendingToken(map[string]interface{}{
+		"email":        "user@example.com",
+		"reference_id": "user-1",
+	}, SecondFactorOtp)
+	if err != nil {
+		t.Fatalf("Failed to create a pending token: %v", err)
+	}
+	if firstFactor := s.pendingFirstFactor(pendingToken); firstFactor != SecondFactorOtp {
+		t.Errorf("Expected the pending token to carry the first factor, found [%v]", firstFactor)
+	}
+
+	token, err := jwt.Parse(pendingToken, func(token *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse the pending token: %v", err)
+	}
+	if auth.IsSessionToken(token) {
+		t.Errorf("Expected a pending token not to sign the user in")
+	}
+
+	fullToken, err := newUserToken(map[string]interface{}{
+		"email":        "user@example.com",
+		"name":         "user",
+		"reference_id": "user-1",
+	}, s.secret, s.jwtTokenIssuer, 1)
+	if err != nil {
+		t.Fatalf("Failed to create a token: %v", err)
+	}
+	token, err = jwt.Parse(fullToken, func(token *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	})
+	if err != nil || !auth.IsSessionToken(token) {
+		t.Errorf("Expected the full token to sign the user in: %v", err)
+	}
+}
+
+func TestWebauthnSessionToken(t *testing.T) {
+
+	s := &secondFactor{secret: []byte("secret")}
+	session := &webauthn.SessionData{
+		Challenge:            "challenge",
+		UserID:               []byte("user-1"),
+		AllowedCredentialIDs: [][]byte{[]byte("credential")},
+		UserVerification:     "required",
+	}
+
+	sessionToken, err := s.sessionToken("login", "user@example.com", session)
+	if err != nil {
+		t.Fatalf("Failed to create a session token: %v", err)
+	}
+	email, parsed, err := s.parseSessionToken("login", sessionToken)
+	if err != nil || email != "user@example.com" {
+		t.Fatalf("Expected the session back, found [%v] %v", email, err)
+	}
+	if parsed.Challenge != "challenge" || string(parsed.UserID) != "user-1" ||
+		len(parsed.AllowedCredentialIDs) != 1 || parsed.UserVerification != "required" {
+		t.Errorf("Unexpected session %v", parsed)
+	}
+
+	_, _, err = s.parseSessionToken("register", sessionToken)
+	if err == nil {
+		t.Errorf("Expected a login session to be rejected for a registration")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+
+	seen := make(map[string]bool)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			t.Fatalf("Failed to generate a recovery code: %v", err)
+		}
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("Unexpected recovery code [%v]", code)
+		}
+		if seen[code] {
+			t.Errorf("Recovery code [%v] generated twice", code)
+		}
+		seen[code] = true
+
+		if hashRecoveryCode(code) != hashRecoveryCode(strings.ToUpper(strings.Replace(code, "-", " ", 1))) {
+			t.Errorf("Expected the hash to ignore case and separators for [%v]", code)
+		}
+	}
+}
+
+func TestCredentialBody(t *testing.T) {
+
+	body, err := credentialBody(`{"id": "abc"}`)
+	if err != nil || string(body) != `{"id": "abc"}` {
+		t.Errorf("Expected a string credential as it is, found [%s] %v", body, err)
+	}
+	_, err = credentialBody(nil)
+	if err == nil {
+		t.Errorf("Expected a missing credential to be rejected")
+	}
+}
@@ -23,6 +23,7 @@ type EventMessage struct {
 	EventData     map[string]interface{}
 }
 
+// InterceptAfter publishes the change on the topic of the table, once the transaction of the change is committed
 func (pc *eventHandlerMiddleware) InterceptAfter(dr *DbResource, req *api2go.Request, results []map[string]interface{}) ([]map[string]interface{}, error) {
 
 	topic := (*pc.dtopicMap)[dr.model.GetTableName()]
@@ -34,38 +35,43 @@ func (pc *eventHandlerMiddleware) InterceptAfter(dr *DbResource, req *api2go.Req
 	case "get":
 		break
 	case "post":
-		go func() {
-			err := topic.Publish(EventMessage{
-				MessageSource: "database",
-				EventType:     "create",
-				ObjectType:    dr.model.GetTableName(),
-				EventData:     results[0],
-			})
-			CheckErr(err, "Failed to publish create message")
-		}()
+		dr.AfterCommit(func() {
+			go func() {
+				err := topic.Publish(EventMessage{
+					MessageSource: "database",
+					EventType:     "create",
+					ObjectType:    dr.model.GetTableName(),
+					EventData:     results[0],
+				})
+				CheckErr(err, "Failed to publish create message")
+			}()
+		})
 		break
 	case "delete":
-		go func() {
-			err := topic.Publish(EventMessage{
-				MessageSource: "database",
-				EventType:     "delete",
-				ObjectType:    dr.model.GetTableName(),
-				EventData:     results[0],
-			})
-			CheckErr(err, "Failed to delete create message")
-
-		}()
+		dr.AfterCommit(func() {
+			go func() {
+				err := topic.Publish(EventMessage{
+					MessageSource: "database",
+					EventType:     "delete",
+					ObjectType:    dr.model.GetTableName(),
+					EventData:     results[0],
+				})
+				CheckErr(err, "Failed to delete create message")
+			}()
+		})
 		break
 	case "patch":
-		go func() {
-			err := topic.Publish(EventMessage{
-				MessageSource: "database",
-				EventType:     "update",
-				ObjectType:    dr.model.GetTableName(),
-				EventData:     results[0],
-			})
-			CheckErr(err, "Failed to update create message")
-		}()
+		dr.AfterCommit(func() {
+			go func() {
+				err := topic.Publish(EventMessage{
+					MessageSource: "database",
+					EventType:     "update",
+					ObjectType:    dr.model.GetTableName(),
+					EventData:     results[0],
+				})
+				CheckErr(err, "Failed to update create message")
+			}()
+		})
 		break
 	default:
 		log.Errorf("Invalid method: %v", req.PlainRequest.Method)
@@ -181,26 +181,30 @@ func (em *exchangeMiddleware) InterceptAfter(dr *DbResource, req *api2go.Request
 
 			//client := oauthDesc.Client(ctx, token)
 
-			log.Printf("executing exchange in routine: %v -> %v", exchange.SourceType, exchange.TargetType)
-			exchangeExecution := NewExchangeExecution(exchange, em.cruds)
-
-			exchangeResult, err := exchangeExecution.Execute([]map[string]interface{}{resultRow})
-			if err != nil {
-				log.Errorf("Failed to execute exchange: %v", err)
-				//errors = append(errors, err)
-			} else {
-
-				if exchange.Attributes != nil && len(exchange.Attributes) > 0 {
-					resultValue, err := BuildActionContext(exchange.Attributes, exchangeResult)
-					if err != nil {
-						resultMap := resultValue.(map[string]interface{})
-						for key, val := range resultMap {
-							exchangeResult[key] = val
+			// the exchange calls out of daptin, it runs once the transaction of the change is committed
+			exchange, resultRow := exchange, resultRow
+			dr.AfterCommit(func() {
+				log.Printf("executing exchange in routine: %v -> %v", exchange.SourceType, exchange.TargetType)
+				exchangeExecution := NewExchangeExecution(exchange, em.cruds)
+
+				exchangeResult, err := exchangeExecution.Execute([]map[string]interface{}{resultRow})
+				if err != nil {
+					log.Errorf("Failed to execute exchange: %v", err)
+					//errors = append(errors, err)
+				} else {
+
+					if exchange.Attributes != nil && len(exchange.Attributes) > 0 {
+						resultValue, err := BuildActionContext(exchange.Attributes, exchangeResult)
+						if err != nil {
+							resultMap := resultValue.(map[string]interface{})
+							for key, val := range resultMap {
+								exchangeResult[key] = val
+							}
 						}
 					}
-				}
 
-			}
+				}
+			})
 		}
 	}
 
@@ -0,0 +1,66 @@
+package resource
+
+import (
+	"github.com/artpar/api2go"
+	log "github.com/sirupsen/logrus"
+)
+
+type inboundHookSecretMiddleware struct {
+}
+
+func (im inboundHookSecretMiddleware) String() string {
+	return "InboundHookSecretGenerator"
+}
+
+// NewInboundHookSecretMiddleware generates the secret of an inbound hook created without one and returns the
+// secret in plain text in the response to the create request, the only time it can be read back
+func NewInboundHookSecretMiddleware() DatabaseRequestInterceptor {
+	return &inboundHookSecretMiddleware{}
+}
+
+func (im *inboundHookSecretMiddleware) InterceptBefore(dr *DbResource, req *api2go.Request, objects []map[string]interface{}) ([]map[string]interface{}, error) {
+
+	if dr.model.GetName() != InboundHookTableName {
+		return objects, nil
+	}
+
+	for _, object := range objects {
+		setInboundHookSecret(object)
+	}
+
+	return objects, nil
+}
+
+func (im *inboundHookSecretMiddleware) InterceptAfter(dr *DbResource, req *api2go.Request, results []map[string]interface{}) ([]map[string]interface{}, error) {
+
+	if dr.model.GetName() != InboundHookTableName {
+		return results, nil
+	}
+
+	encryptionSecret, err := dr.configStore.GetConfigValueFor("encryption.secret", "backend")
+	if err != nil {
+		return results, err
+	}
+
+	for i, result := range results {
+		secret, ok := result["secret"].(string)
+		if !ok || secret == "" {
+			continue
+		}
+		plainSecret, err := Decrypt([]byte(encryptionSecret), secret)
+		if err != nil {
+			log.Errorf("Failed to decrypt the secret of inbound hook [%v]: %v", result["reference_id"], err)
+			continue
+		}
+
+		// other middlewares hold on to the created row, only the response carries the plain text secret
+		row := make(map[string]interface{}, len(result))
+		for key, value := range result {
+			row[key] = value
+		}
+		row["secret"] = plainSecret
+		results[i] = row
+	}
+
+	return results, nil
+}
@@ -0,0 +1,51 @@
+package resource
+
+import (
+	"strings"
+
+	"github.com/artpar/api2go"
+)
+
+type webhookMiddleware struct {
+}
+
+func (wm webhookMiddleware) String() string {
+	return "WebhookGenerator"
+}
+
+// NewWebhookMiddleware queues the webhook deliveries of the rows created, updated and deleted
+func NewWebhookMiddleware() DatabaseRequestInterceptor {
+	return &webhookMiddleware{}
+}
+
+func (wm *webhookMiddleware) InterceptAfter(dr *DbResource, req *api2go.Request, results []map[string]interface{}) ([]map[string]interface{}, error) {
+
+	dispatcher := webhookDispatcher
+	if dispatcher == nil || len(results) == 0 {
+		return results, nil
+	}
+
+	var event string
+	switch strings.ToLower(req.PlainRequest.Method) {
+	case "post":
+		event = "create"
+	case "patch":
+		event = "update"
+	case "delete":
+		event = "delete"
+	default:
+		return results, nil
+	}
+
+	tableName := dr.model.GetTableName()
+	row := results[0]
+	dr.AfterCommit(func() {
+		go dispatcher.Enqueue(tableName, event, row)
+	})
+
+	return results, nil
+}
+
+func (wm *webhookMiddleware) InterceptBefore(dr *DbResource, req *api2go.Request, objects []map[string]interface{}) ([]map[string]interface{}, error) {
+	return objects, nil
+}
@@ -1 +1,845 @@
 package resource
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/artpar/api2go"
+	uuid "github.com/artpar/go.uuid"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/doug-martin/goqu/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// Tables of the OAuth2 provider. Clients are the apps which can ask for tokens, grants hold the authorization
+// codes and refresh tokens issued to them and consents the scopes users allowed a client
+const (
+	OAuthClientTableName  = "oauth_client"
+	OAuthGrantTableName   = "oauth_grant"
+	OAuthConsentTableName = "oauth_consent"
+)
+
+// Kinds of grants
+const (
+	oauthGrantCode         = "code"
+	oauthGrantRefreshToken = "refresh_token"
+)
+
+// oauthCodeLifetime is how long an authorization code can be exchanged for tokens
+const oauthCodeLifetime = 10 * time.Minute
+
+// oauthConsentAudience is the audience of the tokens which carry an authorization request through the consent form
+const oauthConsentAudience = "oauth-consent"
+
+// OAuthScopes are the scopes the provider supports, profile and email add the name and email of the user to the id
+// token and the userinfo
+var OAuthScopes = []string{"openid", "profile", "email", "offline_access"}
+
+// OAuthError is an error response of the OAuth2 endpoints
+type OAuthError struct {
+	Code        string
+	Description string
+	Status      int
+}
+
+func (e OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newOAuthError(code string, description string) OAuthError {
+	status := http.StatusBadRequest
+	switch code {
+	case "invalid_client":
+		status = http.StatusUnauthorized
+	case "server_error":
+		status = http.StatusInternalServerError
+	}
+	return OAuthError{Code: code, Description: description, Status: status}
+}
+
+// OAuthClient is an app registered to get tokens from daptin. Clients without a secret are public and must use
+// PKCE, tokens of the client credentials grant are issued to the client itself and carry no user
+type OAuthClient struct {
+	ReferenceId      string
+	ClientId         string
+	Name             string
+	Secret           string
+	RedirectUris     []string
+	GrantTypes       []string
+	Scopes           []string
+	SkipConsent      bool
+	OwnerReferenceId string
+}
+
+func (c OAuthClient) allowsGrant(grantType string) bool {
+	return containsString(c.GrantTypes, grantType)
+}
+
+// AuthorizationRequest is a validated request to the authorization endpoint
+type AuthorizationRequest struct {
+	ClientId            string `json:"client_id"`
+	RedirectUri         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	Nonce               string `json:"nonce"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+// RedirectError is the redirect to the client with the error, for errors found after the redirect uri was validated
+func (r AuthorizationRequest) RedirectError(err OAuthError) string {
+	return r.redirect(url.Values{
+		"error":             {err.Code},
+		"error_description": {err.Description},
+	})
+}
+
+func (r AuthorizationRequest) redirect(values url.Values) string {
+	if r.State != "" {
+		values.Set("state", r.State)
+	}
+	separator := "?"
+	if strings.Contains(r.RedirectUri, "?") {
+		separator = "&"
+	}
+	return r.RedirectUri + separator + values.Encode()
+}
+
+// OAuthServer issues tokens to the registered clients. Access tokens are signed with a key derived from the jwt
+// secret and typed as oauth access tokens, so they are not sessions and are only accepted by the userinfo endpoint,
+// for the scopes the client still has. Id tokens are signed with an RSA key
+// published at the jwks endpoint
+type OAuthServer struct {
+	cruds                map[string]*DbResource
+	configStore          *ConfigStore
+	jwtSecret            []byte
+	accessTokenKey       []byte
+	jwtIssuer            string
+	signingKey           *rsa.PrivateKey
+	keyId                string
+	accessTokenLifetime  time.Duration
+	refreshTokenLifetime time.Duration
+}
+
+func NewOAuthServer(cruds map[string]*DbResource, configStore *ConfigStore) (*OAuthServer, error) {
+
+	jwtSecret, err := configStore.GetConfigValueFor("jwt.secret", "backend")
+	if err != nil {
+		return nil, err
+	}
+	jwtIssuer, err := configStore.GetConfigValueFor("jwt.token.issuer", "backend")
+	if err != nil {
+		return nil, err
+	}
+
+	accessTokenMinutes, err := configStore.GetConfigIntValueFor("oauth.access_token_minutes", "backend")
+	if err != nil {
+		accessTokenMinutes = 60
+		err = configStore.SetConfigIntValueFor("oauth.access_token_minutes", accessTokenMinutes, "backend")
+		CheckErr(err, "Failed to store default value for oauth.access_token_minutes")
+	}
+	refreshTokenDays, err := configStore.GetConfigIntValueFor("oauth.refresh_token_days", "backend")
+	if err != nil {
+		refreshTokenDays = 30
+		err = configStore.SetConfigIntValueFor("oauth.refresh_token_days", refreshTokenDays, "backend")
+		CheckErr(err, "Failed to store default value for oauth.refresh_token_days")
+	}
+
+	signingKey, err := loadOAuthSigningKey(configStore)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&signingKey.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	keyHash := sha256.Sum256(publicKey)
+
+	return &OAuthServer{
+		cruds:                cruds,
+		configStore:          configStore,
+		jwtSecret:            []byte(jwtSecret),
+		accessTokenKey:       oauthAccessTokenKey([]byte(jwtSecret)),
+		jwtIssuer:            jwtIssuer,
+		signingKey:           signingKey,
+		keyId:                hex.EncodeToString(keyHash[:8]),
+		accessTokenLifetime:  time.Duration(accessTokenMinutes) * time.Minute,
+		refreshTokenLifetime: time.Duration(refreshTokenDays) * 24 * time.Hour,
+	}, nil
+}
+
+// loadOAuthSigningKey reads the key id tokens are signed with, a new one is made and stored encrypted the first time
+func loadOAuthSigningKey(configStore *ConfigStore) (*rsa.PrivateKey, error) {
+
+	encryptionSecret, err := configStore.GetConfigValueFor("encryption.secret", "backend")
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := configStore.GetConfigValueFor("oauth.signing_key", "backend")
+	if err == nil {
+		keyPem, err := Decrypt([]byte(encryptionSecret), encryptedKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt the oauth signing key: %v", err)
+		}
+		block, _ := pem.Decode([]byte(keyPem))
+		if block == nil {
+			return nil, errors.New("invalid oauth signing key")
+		}
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	log.Infof("Generating the oauth signing key")
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	encryptedKey, err = Encrypt([]byte(encryptionSecret), string(keyPem))
+	if err != nil {
+		return nil, err
+	}
+	err = configStore.SetConfigValueFor("oauth.signing_key", encryptedKey, "backend")
+	return key, err
+}
+
+// Discovery is the openid configuration of the provider at the issuer url
+func (s *OAuthServer) Discovery(issuer string) map[string]interface{} {
+	return map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/oauth/userinfo",
+		"revocation_endpoint":                   issuer + "/oauth/revoke",
+		"jwks_uri":                              issuer + "/oauth/jwks",
+		"scopes_supported":                      OAuthScopes,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "client_credentials", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "nonce", "name", "email", "email_verified"},
+	}
+}
+
+// Jwks is the public key set id tokens can be verified with
+func (s *OAuthServer) Jwks() map[string]interface{} {
+	publicKey := s.signingKey.PublicKey
+	return map[string]interface{}{
+		"keys": []map[string]interface{}{
+			{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": s.keyId,
+				"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			},
+		},
+	}
+}
+
+// GetClient returns the enabled client with the client id
+func (s *OAuthServer) GetClient(clientId string) (OAuthClient, error) {
+
+	client := OAuthClient{}
+	if clientId == "" {
+		return client, newOAuthError("invalid_client", "no client_id")
+	}
+	row, err := s.cruds[OAuthClientTableName].GetObjectByWhereClause(OAuthClientTableName, "client_id", clientId)
+	if err != nil {
+		return client, newOAuthError("invalid_client", "unknown client")
+	}
+	// drivers return booleans as numbers, strings or booleans
+	switch fmt.Sprintf("%v", row["enable"]) {
+	case "1", "true":
+	default:
+		return client, newOAuthError("invalid_client", "unknown client")
+	}
+
+	client.ReferenceId, _ = row["reference_id"].(string)
+	client.ClientId = clientId
+	client.Name, _ = row["name"].(string)
+	client.OwnerReferenceId, _ = row[USER_ACCOUNT_ID_COLUMN].(string)
+	redirectUris, _ := row["redirect_uris"].(string)
+	client.RedirectUris = splitList(redirectUris)
+	grantTypes, _ := row["grant_types"].(string)
+	client.GrantTypes = splitList(grantTypes)
+	scopes, _ := row["scopes"].(string)
+	client.Scopes = splitList(scopes)
+	switch fmt.Sprintf("%v", row["skip_consent"]) {
+	case "1", "true":
+		client.SkipConsent = true
+	}
+
+	if secret, ok := row["client_secret"].(string); ok && secret != "" {
+		encryptionSecret, _ := s.configStore.GetConfigValueFor("encryption.secret", "backend")
+		client.Secret, err = Decrypt([]byte(encryptionSecret), secret)
+		if err != nil {
+			log.Errorf("Failed to decrypt the secret of oauth client [%v]: %v", clientId, err)
+			return client, newOAuthError("server_error", "failed to read the client")
+		}
+	}
+	return client, nil
+}
+
+// AuthenticateClient returns the client when the secret is right, public clients have no secret to send
+func (s *OAuthServer) AuthenticateClient(clientId string, clientSecret string) (OAuthClient, error) {
+	client, err := s.GetClient(clientId)
+	if err != nil {
+		return client, err
+	}
+	if client.Secret != "" && !hmac.Equal([]byte(client.Secret), []byte(clientSecret)) {
+		return client, newOAuthError("invalid_client", "client authentication failed")
+	}
+	return client, nil
+}
+
+// ValidateAuthorization checks a request to the authorization endpoint. Errors about the client or the redirect uri
+// must be shown to the user, the others can be sent to the redirect uri, which the returned bool tells
+func (s *OAuthServer) ValidateAuthorization(params url.Values) (AuthorizationRequest, OAuthClient, bool, error) {
+
+	request := AuthorizationRequest{
+		ClientId:            params.Get("client_id"),
+		RedirectUri:         params.Get("redirect_uri"),
+		State:               params.Get("state"),
+		Nonce:               params.Get("nonce"),
+		CodeChallenge:       params.Get("code_challenge"),
+		CodeChallengeMethod: params.Get("code_challenge_method"),
+	}
+
+	client, err := s.GetClient(request.ClientId)
+	if err != nil {
+		return request, client, false, err
+	}
+	if request.RedirectUri == "" && len(client.RedirectUris) == 1 {
+		request.RedirectUri = client.RedirectUris[0]
+	}
+	if !containsString(client.RedirectUris, request.RedirectUri) {
+		return request, client, false, newOAuthError("invalid_request", "redirect_uri is not registered for the client")
+	}
+
+	if params.Get("response_type") != "code" {
+		return request, client, true, newOAuthError("unsupported_response_type", "only the code response type is supported")
+	}
+	if !client.allowsGrant("authorization_code") {
+		return request, client, true, newOAuthError("unauthorized_client", "the client cannot use the authorization code grant")
+	}
+
+	scope, err := allowedScope(params.Get("scope"), client)
+	if err != nil {
+		return request, client, true, err
+	}
+	request.Scope = scope
+
+	switch request.CodeChallengeMethod {
+	case "":
+		if request.CodeChallenge != "" {
+			request.CodeChallengeMethod = "plain"
+		}
+	case "S256", "plain":
+	default:
+		return request, client, true, newOAuthError("invalid_request", "unsupported code_challenge_method")
+	}
+	if client.Secret == "" && request.CodeChallenge == "" {
+		return request, client, true, newOAuthError("invalid_request", "public clients must send a code_challenge")
+	}
+
+	return request, client, true, nil
+}
+
+// allowedScope is the requested scope when the client can ask for all of it, or the scopes of the client when
+// nothing was requested
+func allowedScope(requested string, client OAuthClient) (string, error) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return strings.Join(client.Scopes, " "), nil
+	}
+	for _, scope := range scopes {
+		if !containsString(client.Scopes, scope) {
+			return "", newOAuthError("invalid_scope", fmt.Sprintf("the client cannot ask for [%v]", scope))
+		}
+	}
+	return strings.Join(scopes, " "), nil
+}
+
+// NeedsConsent is true unless the client skips consent or the user already allowed it every scope requested
+func (s *OAuthServer) NeedsConsent(sessionUser *auth.SessionUser, request AuthorizationRequest, client OAuthClient) bool {
+
+	if client.SkipConsent {
+		return false
+	}
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("scope")).From(OAuthConsentTableName).
+		Where(goqu.Ex{"client_id": client.ClientId, "user_reference_id": sessionUser.UserReferenceId}).ToSQL()
+	if err != nil {
+		return true
+	}
+	consents := make([]string, 0)
+	err = s.cruds[OAuthConsentTableName].connection.Select(&consents, query, args...)
+	if err != nil {
+		return true
+	}
+
+	allowed := make([]string, 0)
+	for _, consent := range consents {
+		allowed = append(allowed, strings.Fields(consent)...)
+	}
+	for _, scope := range strings.Fields(request.Scope) {
+		if !containsString(allowed, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConsentToken carries the authorization request through the consent form, it is only accepted from the same user
+func (s *OAuthServer) ConsentToken(sessionUser *auth.SessionUser, request AuthorizationRequest) (string, error) {
+	now := time.Now()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"aud":                   oauthConsentAudience,
+		"sub":                   sessionUser.UserReferenceId,
+		"exp":                   now.Add(oauthCodeLifetime).Unix(),
+		"iat":                   now.Unix(),
+		"client_id":             request.ClientId,
+		"redirect_uri":          request.RedirectUri,
+		"scope":                 request.Scope,
+		"state":                 request.State,
+		"nonce":                 request.Nonce,
+		"code_challenge":        request.CodeChallenge,
+		"code_challenge_method": request.CodeChallengeMethod,
+	}).SignedString(s.jwtSecret)
+}
+
+// ParseConsentToken returns the authorization request the user answered in the consent form
+func (s *OAuthServer) ParseConsentToken(sessionUser *auth.SessionUser, consentToken string) (AuthorizationRequest, error) {
+
+	request := AuthorizationRequest{}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(consentToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return s.jwtSecret, nil
+	})
+	if err != nil || !claims.VerifyAudience(oauthConsentAudience, true) || claims["sub"] != sessionUser.UserReferenceId {
+		return request, newOAuthError("invalid_request", "the consent form expired, sign in again")
+	}
+
+	request.ClientId, _ = claims["client_id"].(string)
+	request.RedirectUri, _ = claims["redirect_uri"].(string)
+	request.Scope, _ = claims["scope"].(string)
+	request.State, _ = claims["state"].(string)
+	request.Nonce, _ = claims["nonce"].(string)
+	request.CodeChallenge, _ = claims["code_challenge"].(string)
+	request.CodeChallengeMethod, _ = claims["code_challenge_method"].(string)
+	return request, nil
+}
+
+// SaveConsent remembers that the user allowed the client the scopes of the request
+func (s *OAuthServer) SaveConsent(sessionUser *auth.SessionUser, request AuthorizationRequest) error {
+	return s.createRow(OAuthConsentTableName, sessionUser, map[string]interface{}{
+		"client_id":         request.ClientId,
+		"user_reference_id": sessionUser.UserReferenceId,
+		"scope":             request.Scope,
+	})
+}
+
+// IssueCode stores an authorization code for the request and returns the redirect to the client with it
+func (s *OAuthServer) IssueCode(sessionUser *auth.SessionUser, request AuthorizationRequest) (string, error) {
+
+	code, err := randomOAuthToken()
+	if err != nil {
+		return "", err
+	}
+	err = s.createRow(OAuthGrantTableName, sessionUser, map[string]interface{}{
+		"kind":                  oauthGrantCode,
+		"token_hash":            hashOAuthToken(code),
+		"client_id":             request.ClientId,
+		"user_reference_id":     sessionUser.UserReferenceId,
+		"scope":                 request.Scope,
+		"redirect_uri":          request.RedirectUri,
+		"code_challenge":        request.CodeChallenge,
+		"code_challenge_method": request.CodeChallengeMethod,
+		"nonce":                 request.Nonce,
+		"expires_at":            time.Now().UTC().Add(oauthCodeLifetime),
+	})
+	if err != nil {
+		return "", err
+	}
+	return request.redirect(url.Values{"code": {code}}), nil
+}
+
+// Token runs the token endpoint for the authenticated client
+func (s *OAuthServer) Token(client OAuthClient, params url.Values, issuer string) (map[string]interface{}, error) {
+
+	grantType := params.Get("grant_type")
+	if !client.allowsGrant(grantType) {
+		return nil, newOAuthError("unauthorized_client", fmt.Sprintf("the client cannot use the [%v] grant", grantType))
+	}
+
+	switch grantType {
+	case "authorization_code":
+		grant, err := s.redeemGrant(oauthGrantCode, params.Get("code"), client)
+		if err != nil {
+			return nil, err
+		}
+		if grant["redirect_uri"] != params.Get("redirect_uri") {
+			return nil, newOAuthError("invalid_grant", "redirect_uri does not match the authorization request")
+		}
+		challenge, _ := grant["code_challenge"].(string)
+		method, _ := grant["code_challenge_method"].(string)
+		if !verifyCodeChallenge(challenge, method, params.Get("code_verifier")) {
+			return nil, newOAuthError("invalid_grant", "code_verifier does not match the code_challenge")
+		}
+		userReferenceId, _ := grant["user_reference_id"].(string)
+		scope, _ := grant["scope"].(string)
+		nonce, _ := grant["nonce"].(string)
+		return s.issueTokens(client, userReferenceId, scope, nonce, issuer)
+
+	case "refresh_token":
+		grant, err := s.redeemGrant(oauthGrantRefreshToken, params.Get("refresh_token"), client)
+		if err != nil {
+			return nil, err
+		}
+		userReferenceId, _ := grant["user_reference_id"].(string)
+		scope, _ := grant["scope"].(string)
+		if requested := params.Get("scope"); requested != "" {
+			for _, requestedScope := range strings.Fields(requested) {
+				if !containsString(strings.Fields(scope), requestedScope) {
+					return nil, newOAuthError("invalid_scope", fmt.Sprintf("[%v] was not granted", requestedScope))
+				}
+			}
+			scope = requested
+		}
+		return s.issueTokens(client, userReferenceId, scope, "", issuer)
+
+	case "client_credentials":
+		if client.Secret == "" {
+			return nil, newOAuthError("unauthorized_client", "public clients cannot use client credentials")
+		}
+		scope, err := allowedScope(params.Get("scope"), client)
+		if err != nil {
+			return nil, err
+		}
+		scopes := make([]string, 0)
+		for _, s := range strings.Fields(scope) {
+			if s != "openid" && s != "offline_access" {
+				scopes = append(scopes, s)
+			}
+		}
+		accessToken, err := s.accessToken(client, client.ClientId, strings.Join(scopes, " "))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"access_token": accessToken,
+			"token_type":   "Bearer",
+			"expires_in":   int64(s.accessTokenLifetime / time.Second),
+			"scope":        strings.Join(scopes, " "),
+		}, nil
+	}
+
+	return nil, newOAuthError("unsupported_grant_type", fmt.Sprintf("unsupported grant type [%v]", grantType))
+}
+
+// issueTokens returns an access token for the user, a refresh token when the client can refresh and an id token when
+// the openid scope was granted
+func (s *OAuthServer) issueTokens(client OAuthClient, userReferenceId string, scope string, nonce string, issuer string) (map[string]interface{}, error) {
+
+	_, err := s.cruds[USER_ACCOUNT_TABLE_NAME].GetReferenceIdToObject(USER_ACCOUNT_TABLE_NAME, userReferenceId)
+	if err != nil {
+		return nil, newOAuthError("invalid_grant", "the user no longer exists")
+	}
+	accessToken, err := s.accessToken(client, userReferenceId, scope)
+	if err != nil {
+		return nil, err
+	}
+	response := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int64(s.accessTokenLifetime / time.Second),
+		"scope":        scope,
+	}
+
+	if client.allowsGrant("refresh_token") {
+		refreshToken, err := randomOAuthToken()
+		if err != nil {
+			return nil, err
+		}
+		err = s.createRow(OAuthGrantTableName, nil, map[string]interface{}{
+			"kind":              oauthGrantRefreshToken,
+			"token_hash":        hashOAuthToken(refreshToken),
+			"client_id":         client.ClientId,
+			"user_reference_id": userReferenceId,
+			"scope":             scope,
+			"expires_at":        time.Now().UTC().Add(s.refreshTokenLifetime),
+		})
+		if err != nil {
+			return nil, err
+		}
+		response["refresh_token"] = refreshToken
+	}
+
+	if containsString(strings.Fields(scope), "openid") {
+		idToken, err := s.idToken(client, userReferenceId, scope, nonce, issuer)
+		if err != nil {
+			return nil, err
+		}
+		response["id_token"] = idToken
+	}
+	return response, nil
+}
+
+// accessToken is the token of the subject, a user or the client itself, for the scope. It carries no email and is
+// typed as an oauth access token, so the session middleware does not accept it
+func (s *OAuthServer) accessToken(client OAuthClient, subject string, scope string) (string, error) {
+
+	u, _ := uuid.NewV4()
+	now := time.Now()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":       auth.OAuthAccessTokenType,
+		"aud":       client.ClientId,
+		"sub":       subject,
+		"nbf":       now.Unix(),
+		"exp":       now.Add(s.accessTokenLifetime).Unix(),
+		"iss":       s.jwtIssuer,
+		"iat":       now.Unix(),
+		"jti":       u.String(),
+		"scope":     scope,
+		"client_id": client.ClientId,
+	}).SignedString(s.accessTokenKey)
+}
+
+// parseAccessToken returns the claims of an access token issued by the provider, to a client which is still
+// enabled and still has every scope of the token
+func (s *OAuthServer) parseAccessToken(accessToken string) (jwt.MapClaims, error) {
+
+	invalid := OAuthError{Code: "invalid_token", Description: "the access token is invalid or expired", Status: http.StatusUnauthorized}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(accessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method")
+		}
+		return s.accessTokenKey, nil
+	})
+	if err != nil || claims["iss"] != s.jwtIssuer || claims["typ"] != auth.OAuthAccessTokenType {
+		return nil, invalid
+	}
+	clientId, _ := claims["client_id"].(string)
+	if !claims.VerifyAudience(clientId, true) {
+		return nil, invalid
+	}
+	client, err := s.GetClient(clientId)
+	if err != nil {
+		return nil, invalid
+	}
+	scope, _ := claims["scope"].(string)
+	for _, tokenScope := range strings.Fields(scope) {
+		if !containsString(client.Scopes, tokenScope) {
+			return nil, OAuthError{Code: "insufficient_scope", Description: fmt.Sprintf("the client no longer has the [%v] scope", tokenScope), Status: http.StatusForbidden}
+		}
+	}
+	return claims, nil
+}
+
+// oauthAccessTokenKey is the key access tokens are signed with, derived from the jwt secret so a session token
+// cannot be passed as an access token and the other way round
+func oauthAccessTokenKey(jwtSecret []byte) []byte {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte(auth.OAuthAccessTokenType))
+	return mac.Sum(nil)
+}
+
+// idToken is the openid id token of the user for the client, signed with the RSA key
+func (s *OAuthServer) idToken(client OAuthClient, userReferenceId string, scope string, nonce string, issuer string) (string, error) {
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": issuer,
+		"sub": userReferenceId,
+		"aud": client.ClientId,
+		"azp": client.ClientId,
+		"exp": now.Add(s.accessTokenLifetime).Unix(),
+		"iat": now.Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	userClaims, err := s.userClaims(userReferenceId, scope)
+	if err != nil {
+		return "", err
+	}
+	for key, value := range userClaims {
+		claims[key] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.keyId
+	return token.SignedString(s.signingKey)
+}
+
+// userClaims are the claims about the user the scope allows, from the user account
+func (s *OAuthServer) userClaims(userReferenceId string, scope string) (map[string]interface{}, error) {
+
+	user, err := s.cruds[USER_ACCOUNT_TABLE_NAME].GetReferenceIdToObject(USER_ACCOUNT_TABLE_NAME, userReferenceId)
+	if err != nil {
+		return nil, newOAuthError("invalid_grant", "the user no longer exists")
+	}
+
+	claims := map[string]interface{}{
+		"sub": userReferenceId,
+	}
+	scopes := strings.Fields(scope)
+	if containsString(scopes, "profile") {
+		claims["name"] = user["name"]
+	}
+	if containsString(scopes, "email") {
+		claims["email"] = user["email"]
+		switch fmt.Sprintf("%v", user["confirmed"]) {
+		case "1", "true":
+			claims["email_verified"] = true
+		default:
+			claims["email_verified"] = false
+		}
+	}
+	return claims, nil
+}
+
+// UserInfo returns the claims about the user of an access token issued with the openid scope
+func (s *OAuthServer) UserInfo(accessToken string) (map[string]interface{}, error) {
+
+	claims, err := s.parseAccessToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+	scope, _ := claims["scope"].(string)
+	if !containsString(strings.Fields(scope), "openid") {
+		return nil, OAuthError{Code: "insufficient_scope", Description: "the access token was not issued with the openid scope", Status: http.StatusForbidden}
+	}
+	userReferenceId, _ := claims["sub"].(string)
+	return s.userClaims(userReferenceId, scope)
+}
+
+// Revoke revokes a refresh token of the client, unknown tokens are ignored as the revocation spec asks
+func (s *OAuthServer) Revoke(client OAuthClient, token string) error {
+	_, err := s.redeemGrant(oauthGrantRefreshToken, token, client)
+	if oauthError, ok := err.(OAuthError); ok && oauthError.Code == "invalid_grant" {
+		return nil
+	}
+	return err
+}
+
+// redeemGrant marks an unused and unexpired grant of the client used and returns it, so a code or a refresh token
+// is only ever exchanged once
+func (s *OAuthServer) redeemGrant(kind string, token string, client OAuthClient) (map[string]interface{}, error) {
+
+	if token == "" {
+		return nil, newOAuthError("invalid_request", "no "+kind)
+	}
+	tokenHash := hashOAuthToken(token)
+	now := time.Now().UTC()
+
+	query, args, err := statementbuilder.Squirrel.Update(OAuthGrantTableName).Prepared(true).
+		Set(goqu.Record{"used_at": now}).
+		Where(goqu.Ex{"token_hash": tokenHash, "kind": kind, "client_id": client.ClientId, "used_at": nil},
+			goqu.C("expires_at").Gt(now)).ToSQL()
+	if err != nil {
+		return nil, newOAuthError("server_error", err.Error())
+	}
+	dbResource := s.cruds[OAuthGrantTableName]
+	result, err := dbResource.db.Exec(query, args...)
+	if err != nil {
+		return nil, newOAuthError("server_error", err.Error())
+	}
+	if updated, _ := result.RowsAffected(); updated != 1 {
+		return nil, newOAuthError("invalid_grant", "the "+kind+" is invalid, expired or was already used")
+	}
+
+	row, err := dbResource.GetObjectByWhereClause(OAuthGrantTableName, "token_hash", tokenHash)
+	if err != nil {
+		return nil, newOAuthError("server_error", err.Error())
+	}
+	return row, nil
+}
+
+// createRow stores a row of the provider, owned by the user when there is one
+func (s *OAuthServer) createRow(tableName string, sessionUser *auth.SessionUser, data map[string]interface{}) error {
+	if sessionUser == nil {
+		sessionUser = &auth.SessionUser{}
+	}
+	pr := &http.Request{
+		Method: "POST",
+	}
+	req := api2go.Request{
+		PlainRequest: pr.WithContext(context.WithValue(context.Background(), "user", sessionUser)),
+	}
+	_, err := s.cruds[tableName].CreateWithoutFilter(api2go.NewApi2GoModelWithData(tableName, nil, 0, nil, data), req)
+	return err
+}
+
+// verifyCodeChallenge checks the PKCE verifier against the challenge of the authorization request
+func verifyCodeChallenge(challenge string, method string, verifier string) bool {
+	if challenge == "" {
+		return true
+	}
+	if verifier == "" {
+		return false
+	}
+	if method == "S256" {
+		sum := sha256.Sum256([]byte(verifier))
+		verifier = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	return hmac.Equal([]byte(challenge), []byte(verifier))
+}
+
+func randomOAuthToken() (string, error) {
+	token := make([]byte, 32)
+	_, err := rand.Read(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// hashOAuthToken is what codes and refresh tokens are stored as
+func hashOAuthToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// splitList reads a list stored as text, separated by commas, spaces or lines
+func splitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+package resource
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/daptin/daptin/server/auth"
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestVerifyCodeChallenge(t *testing.T) {
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	if !verifyCodeChallenge(challenge, "S256", verifier) {
+		t.Errorf("Expected the S256 verifier to match")
+	}
+	if verifyCodeChallenge(challenge, "S256", "wrong") {
+		t.Errorf("Expected a wrong verifier to be rejected")
+	}
+	if !verifyCodeChallenge("plain-value", "plain", "plain-value") {
+		t.Errorf("Expected the plain verifier to match")
+	}
+	if verifyCodeChallenge(challenge, "S256", "") {
+		t.Errorf("Expected a missing verifier to be rejected")
+	}
+	if !verifyCodeChallenge("", "", "") {
+		t.Errorf("Expected requests without a challenge to need no verifier")
+	}
+}
+
+func TestAllowedScope(t *testing.T) {
+
+	client := OAuthClient{Scopes: splitList("openid, profile,email")}
+
+	scope, err := allowedScope("", client)
+	if err != nil || scope != "openid profile email" {
+		t.Errorf("Expected the scopes of the client, found [%v] %v", scope, err)
+	}
+	scope, err = allowedScope("openid email", client)
+	if err != nil || scope != "openid email" {
+		t.Errorf("Expected the requested scopes, found [%v] %v", scope, err)
+	}
+	_, err = allowedScope("openid admin", client)
+	if oauthError, ok := err.(OAuthError); !ok || oauthError.Code != "invalid_scope" {
+		t.Errorf("Expected an invalid_scope error, found %v", err)
+	}
+}
+
+func TestAuthorizationRequestRedirect(t *testing.T) {
+
+	request := AuthorizationRequest{RedirectUri: "https://app.example.com/cb?tenant=1", State: "xyz"}
+	redirect, err := url.Parse(request.RedirectError(newOAuthError("access_denied", "denied")))
+	if err != nil {
+		t.Fatalf("Failed to parse the redirect: %v", err)
+	}
+	query := redirect.Query()
+	if query.Get("tenant") != "1" || query.Get("error") != "access_denied" || query.Get("state") != "xyz" {
+		t.Errorf("Unexpected redirect [%v]", redirect)
+	}
+}
+
+func TestOAuthConsentToken(t *testing.T) {
+
+	server := &OAuthServer{jwtSecret: []byte("secret")}
+	user := &auth.SessionUser{UserReferenceId: "user-1"}
+	request := AuthorizationRequest{
+		ClientId:            "client",
+		RedirectUri:         "https://app.example.com/cb",
+		Scope:               "openid email",
+		State:               "state",
+		CodeChallenge:       "challenge",
+		CodeChallengeMethod: "S256",
+	}
+
+	consentToken, err := server.ConsentToken(user, request)
+	if err != nil {
+		t.Fatalf("Failed to create a consent token: %v", err)
+	}
+	parsed, err := server.ParseConsentToken(user, consentToken)
+	if err != nil || parsed != request {
+		t.Errorf("Expected the request back, found %v %v", parsed, err)
+	}
+	_, err = server.ParseConsentToken(&auth.SessionUser{UserReferenceId: "user-2"}, consentToken)
+	if err == nil {
+		t.Errorf("Expected the consent token of another user to be rejected")
+	}
+}
+
+func TestOAuthJwks(t *testing.T) {
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("Failed to generate a key: %v", err)
+	}
+	server := &OAuthServer{signingKey: key, keyId: "kid-1"}
+
+	keys := server.Jwks()["keys"].([]map[string]interface{})
+	if len(keys) != 1 || keys[0]["kid"] != "kid-1" || keys[0]["e"] != "AQAB" {
+		t.Errorf("Unexpected key set %v", keys)
+	}
+}
+
+func TestOAuthAccessTokenIsNotASession(t *testing.T) {
+
+	server := &OAuthServer{
+		jwtSecret:           []byte("secret"),
+		accessTokenKey:      oauthAccessTokenKey([]byte("secret")),
+		jwtIssuer:           "daptin",
+		accessTokenLifetime: time.Hour,
+	}
+	accessToken, err := server.accessToken(OAuthClient{ClientId: "client"}, "user-1", "openid email")
+	if err != nil {
+		t.Fatalf("Failed to issue an access token: %v", err)
+	}
+
+	_, err = jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
+		return server.jwtSecret, nil
+	})
+	if err == nil {
+		t.Errorf("Expected the access token to not verify with the session key")
+	}
+
+	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (interface{}, error) {
+		return server.accessTokenKey, nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse the access token: %v", err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	if claims["typ"] != auth.OAuthAccessTokenType || claims["client_id"] != "client" || claims["email"] != nil {
+		t.Errorf("Unexpected access token claims %v", claims)
+	}
+	claims["email"] = "user@example.com"
+	if auth.IsSessionToken(token) {
+		t.Errorf("Expected an oauth access token to not be a session")
+	}
+}
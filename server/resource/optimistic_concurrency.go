@@ -0,0 +1,144 @@
+package resource
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/doug-martin/goqu/v9"
+)
+
+// VersionConflict describes an update which was made against an older version of the row than the stored one
+type VersionConflict struct {
+	Type            string `json:"type"`
+	ReferenceId     string `json:"reference_id"`
+	ExpectedVersion int64  `json:"expected_version"`
+	CurrentVersion  int64  `json:"current_version"`
+}
+
+func (conflict VersionConflict) Message() string {
+	return fmt.Sprintf("[%v][%v] was changed, the update was made on version %d but the current version is %d",
+		conflict.Type, conflict.ReferenceId, conflict.ExpectedVersion, conflict.CurrentVersion)
+}
+
+// NewVersionConflictError is the 409 error returned for a stale update, the conflict is in the meta of the error
+func NewVersionConflictError(conflict VersionConflict) error {
+	message := conflict.Message()
+	httpError := api2go.NewHTTPError(nil, message, http.StatusConflict)
+	httpError.Errors = []api2go.Error{
+		{
+			Status: strconv.Itoa(http.StatusConflict),
+			Code:   "version_conflict",
+			Title:  "Version conflict",
+			Detail: message,
+			Meta:   conflict,
+		},
+	}
+	return httpError
+}
+
+// GetVersionConflict returns the conflict of an error made by NewVersionConflictError
+func GetVersionConflict(err error) (VersionConflict, bool) {
+	httpError, ok := err.(api2go.HTTPError)
+	if !ok || len(httpError.Errors) == 0 {
+		return VersionConflict{}, false
+	}
+	conflict, ok := httpError.Errors[0].Meta.(VersionConflict)
+	return conflict, ok
+}
+
+// VersionETag is the ETag of a row at a version
+func VersionETag(version int64) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+// ParseVersionETag reads the version out of an ETag made by VersionETag, weak ETags are accepted as well
+func ParseVersionETag(etag string) (int64, bool) {
+	etag = strings.TrimSpace(etag)
+	etag = strings.TrimPrefix(etag, "W/")
+	etag = strings.Trim(etag, "\"")
+	version, err := strconv.ParseInt(etag, 10, 64)
+	return version, err == nil
+}
+
+// versionToInt64 reads a version as it is found in rows, JSON and GraphQL arguments
+func versionToInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case float64:
+		return int64(v), float64(int64(v)) == v
+	case []byte:
+		return versionToInt64(string(v))
+	case string:
+		version, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return version, err == nil
+	}
+	return 0, false
+}
+
+// ExpectedVersion returns the version of the row the update was made against. It is taken from the If-Match
+// header when the request was made for the row itself, or else from a version supplied along with the changes.
+// Updates without either are not checked
+func ExpectedVersion(req api2go.Request, referenceId string, changes map[string]api2go.Change) (int64, bool, error) {
+
+	header := req.Header
+	if header == nil && req.PlainRequest != nil {
+		header = req.PlainRequest.Header
+	}
+	// related rows are updated with the request of the row they are related to, which the header is not meant for
+	forRow := req.PlainRequest != nil && req.PlainRequest.URL != nil &&
+		strings.HasSuffix(req.PlainRequest.URL.Path, "/"+referenceId)
+	if ifMatch := header.Get("If-Match"); forRow && ifMatch != "" && strings.TrimSpace(ifMatch) != "*" {
+		version, ok := ParseVersionETag(ifMatch)
+		if !ok {
+			return 0, false, api2go.NewHTTPError(nil, fmt.Sprintf("invalid If-Match header [%v]", ifMatch), http.StatusBadRequest)
+		}
+		return version, true, nil
+	}
+
+	change, ok := changes["version"]
+	if !ok || change.NewValue == nil {
+		return 0, false, nil
+	}
+	version, ok := versionToInt64(change.NewValue)
+	if !ok {
+		return 0, false, api2go.NewHTTPError(nil, fmt.Sprintf("invalid version [%v]", change.NewValue), http.StatusBadRequest)
+	}
+	return version, true, nil
+}
+
+// SetResponseETag sets the ETag header of the response to the version of the row, when the request was made
+// over http for the row itself
+func SetResponseETag(req api2go.Request, referenceId string, version interface{}) {
+	if req.PlainRequest == nil || req.PlainRequest.URL == nil ||
+		!strings.HasSuffix(req.PlainRequest.URL.Path, "/"+referenceId) {
+		return
+	}
+	header, ok := req.PlainRequest.Context().Value("response_header").(http.Header)
+	if !ok {
+		return
+	}
+	if versionNumber, ok := versionToInt64(version); ok {
+		header.Set("ETag", VersionETag(versionNumber))
+	}
+}
+
+// getCurrentVersion reads the stored version of a row
+func (dr *DbResource) getCurrentVersion(referenceId string) (int64, error) {
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("version")).From(dr.model.GetName()).
+		Where(goqu.Ex{"reference_id": referenceId}).ToSQL()
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	err = dr.db.QueryRowx(query, args...).Scan(&version)
+	return version, err
+}
@@ -0,0 +1,69 @@
+package resource
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/artpar/api2go"
+)
+
+func TestExpectedVersion(t *testing.T) {
+
+	request := func(path string, ifMatch string) api2go.Request {
+		header := http.Header{}
+		if ifMatch != "" {
+			header.Set("If-Match", ifMatch)
+		}
+		return api2go.Request{
+			PlainRequest: &http.Request{Method: "PATCH", URL: &url.URL{Path: path}, Header: header},
+			Header:       header,
+		}
+	}
+	noChanges := map[string]api2go.Change{}
+
+	version, ok, err := ExpectedVersion(request("/api/book/r1", VersionETag(4)), "r1", noChanges)
+	if err != nil || !ok || version != 4 {
+		t.Errorf("Expected version 4 from If-Match, found %v %v %v", version, ok, err)
+	}
+
+	version, ok, err = ExpectedVersion(request("/api/book/r1", `W/"7"`), "r1", noChanges)
+	if err != nil || !ok || version != 7 {
+		t.Errorf("Expected version 7 from a weak ETag, found %v %v %v", version, ok, err)
+	}
+
+	if _, ok, _ = ExpectedVersion(request("/api/book/r1", VersionETag(4)), "r2", noChanges); ok {
+		t.Errorf("Expected If-Match to be ignored for a related row")
+	}
+
+	if _, ok, _ = ExpectedVersion(request("/api/book/r1", "*"), "r1", noChanges); ok {
+		t.Errorf("Expected If-Match * to match any version")
+	}
+
+	if _, _, err = ExpectedVersion(request("/api/book/r1", "abc"), "r1", noChanges); err == nil {
+		t.Errorf("Expected an error for an invalid If-Match header")
+	}
+
+	version, ok, err = ExpectedVersion(request("/action/book/edit", ""), "r1", map[string]api2go.Change{
+		"version": {OldValue: int64(3), NewValue: float64(2)},
+	})
+	if err != nil || !ok || version != 2 {
+		t.Errorf("Expected version 2 from the changes, found %v %v %v", version, ok, err)
+	}
+
+	if _, ok, _ = ExpectedVersion(request("/api/book/r1", ""), "r1", noChanges); ok {
+		t.Errorf("Expected updates without a version not to be checked")
+	}
+}
+
+func TestVersionConflictError(t *testing.T) {
+	err := NewVersionConflictError(VersionConflict{Type: "book", ReferenceId: "r1", ExpectedVersion: 2, CurrentVersion: 3})
+	httpError, ok := err.(api2go.HTTPError)
+	if !ok || httpError.Status() != http.StatusConflict {
+		t.Fatalf("Expected a 409 error, found %v", err)
+	}
+	conflict, ok := GetVersionConflict(err)
+	if !ok || conflict.CurrentVersion != 3 {
+		t.Errorf("Expected the conflict in the error, found %v", conflict)
+	}
+}
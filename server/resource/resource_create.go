@@ -18,11 +18,13 @@ import (
 
 	"github.com/araddon/dateparse"
 	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/database"
 	"github.com/daptin/daptin/server/statementbuilder"
 	"github.com/pkg/errors"
 
 	//"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -31,20 +33,75 @@ const DEFAULT_LANGUAGE = "en"
 func NewFromDbResourceWithTransaction(resources *DbResource, tx *sqlx.Tx) *DbResource {
 
 	return &DbResource{
-		Cruds:            resources.Cruds,
-		configStore:      resources.configStore,
-		model:            resources.model,
-		db:               tx,
-		connection:       resources.connection,
-		ActionHandlerMap: resources.ActionHandlerMap,
-		contextCache:     resources.contextCache,
-		defaultGroups:    resources.defaultGroups,
-		ms:               resources.ms,
-		tableInfo:        resources.tableInfo,
+		Cruds:              resources.Cruds,
+		configStore:        resources.configStore,
+		model:              resources.model,
+		db:                 tx,
+		connection:         database.NewTransactionConnection(resources.connection, tx),
+		ActionHandlerMap:   resources.ActionHandlerMap,
+		contextCache:       resources.contextCache,
+		defaultGroups:      resources.defaultGroups,
+		ms:                 resources.ms,
+		tableInfo:          resources.tableInfo,
+		OlricDb:            resources.OlricDb,
+		AssetFolderCache:   resources.AssetFolderCache,
+		SubsiteFolderCache: resources.SubsiteFolderCache,
+		MailSender:         resources.MailSender,
 	}
 
 }
 
+// NewCrudsWithTransaction returns a copy of the resources which all run their queries in the transaction, and use
+// each other for the rows they create, update and delete along the way. The side effects of the middlewares, events,
+// webhooks and exchanges, are held until RunAfterCommit is called once the transaction is committed
+func NewCrudsWithTransaction(cruds map[string]*DbResource, tx *sqlx.Tx) map[string]*DbResource {
+
+	queue := &afterCommitQueue{}
+	txCruds := make(map[string]*DbResource, len(cruds))
+	for name, dbResource := range cruds {
+		txCruds[name] = NewFromDbResourceWithTransaction(dbResource, tx)
+		txCruds[name].afterCommit = queue
+	}
+	for _, dbResource := range txCruds {
+		dbResource.Cruds = txCruds
+	}
+	return txCruds
+}
+
+// afterCommitQueue holds the side effects of the changes made in a transaction, they are dropped when the
+// transaction is rolled back
+type afterCommitQueue struct {
+	lock  sync.Mutex
+	funcs []func()
+}
+
+// AfterCommit runs f once the transaction of the resource is committed, right away for a resource outside a
+// transaction
+func (dr *DbResource) AfterCommit(f func()) {
+	if dr.afterCommit == nil {
+		f()
+		return
+	}
+	dr.afterCommit.lock.Lock()
+	defer dr.afterCommit.lock.Unlock()
+	dr.afterCommit.funcs = append(dr.afterCommit.funcs, f)
+}
+
+// RunAfterCommit runs the side effects held by the resources of a committed transaction, in the order they were held
+func RunAfterCommit(txCruds map[string]*DbResource) {
+	world, ok := txCruds["world"]
+	if !ok || world.afterCommit == nil {
+		return
+	}
+	world.afterCommit.lock.Lock()
+	funcs := world.afterCommit.funcs
+	world.afterCommit.funcs = nil
+	world.afterCommit.lock.Unlock()
+	for _, f := range funcs {
+		f()
+	}
+}
+
 // Create a new object. Newly created object/struct must be in Responder.
 // Possible Responder status codes are:
 // - 201 Created: Resource was created and needs to be returned
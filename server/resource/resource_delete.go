@@ -39,8 +39,15 @@ func (dr *DbResource) DeleteWithoutFilters(id string, req api2go.Request) error
 	m := dr.model
 	//log.Printf("Get all resource type: %v\n", m)
 
+	// rows of soft delete tables are moved to the trash first, deleting them from the trash deletes them
+	if dr.tableInfo.SoftDeleteEnabled && !IsTrashed(data) {
+		log.Printf("Moving [%v][%v] to the trash", dr.model.GetTableName(), id)
+		return dr.TrashRow(id, req)
+	}
+
 	if !EndsWithCheck(apiModel.GetTableName(), "_audit") && dr.tableInfo.IsAuditEnabled {
 		auditModel := apiModel.GetAuditModel()
+		auditModel.Data["source_reference_id"] = apiModel.GetID()
 		log.Printf("Object [%v][%v] has been changed, trying to audit in %v", apiModel.GetTableName(), apiModel.GetID(), auditModel.GetTableName())
 		if auditModel.GetTableName() != "" {
 			//auditModel.Data["deleted_at"] = time.Now()
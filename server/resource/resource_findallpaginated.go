@@ -128,10 +128,7 @@ func (dr *DbResource) PaginatedFindAllWithoutFilters(req api2go.Request) ([]map[
 
 	languagePreferences := make([]string, 0)
 	if dr.tableInfo.TranslationsEnabled {
-		prefs := req.PlainRequest.Context().Value("language_preference")
-		if prefs != nil {
-			languagePreferences = prefs.([]string)
-		}
+		languagePreferences = LanguageChain(req.PlainRequest.Context())
 	}
 
 	pageNumber := uint64(0)
@@ -440,6 +437,11 @@ func (dr *DbResource) PaginatedFindAllWithoutFilters(req api2go.Request) ([]map[
 
 	queryBuilder, countQueryBuilder = dr.addFilters(queryBuilder, countQueryBuilder, queries, prefix)
 
+	if trashCondition := dr.TrashCondition(req); trashCondition != nil {
+		queryBuilder = queryBuilder.Where(trashCondition)
+		countQueryBuilder = countQueryBuilder.Where(trashCondition)
+	}
+
 	//if len(groupings) > 0 && false {
 	//	for _, groupBy := range groupings {
 	//		queryBuilder = queryBuilder.GroupBy(fmt.Sprintf("%s %s", groupBy.ColumnName, groupBy.Order))
@@ -918,17 +920,14 @@ func (dr *DbResource) PaginatedFindAllWithoutFilters(req api2go.Request) ([]map[
 		}).Order(orders...)
 
 	} else {
-		var preferredLanguage = languagePreferences[0]
 		translateTableName := tableModel.GetTableName() + "_i18n"
 
-		ifNullFunctionName := "IFNULL"
-		if dr.connection.DriverName() == "postgres" {
-			ifNullFunctionName = "COALESCE"
-		} else if dr.connection.DriverName() == "mssql" {
-			ifNullFunctionName = "ISNULL"
+		// one join per language of the chain, the first language with a value wins for each column
+		translationAliases := make([]string, 0, len(languagePreferences))
+		for i := range languagePreferences {
+			translationAliases = append(translationAliases, fmt.Sprintf("%v_%d", translateTableName, i))
 		}
 
-		//translatedColumns := make([]string, 0)
 		for i, columnValue := range finalCols {
 			if IsStandardColumn(columnValue.reference) {
 				finalCols[i] = column{
@@ -937,8 +936,13 @@ func (dr *DbResource) PaginatedFindAllWithoutFilters(req api2go.Request) ([]map[
 				}
 			} else {
 				if strings.Index(columnValue.reference, ".") == -1 {
+					coalesceArguments := make([]interface{}, 0, len(translationAliases)+1)
+					for _, alias := range translationAliases {
+						coalesceArguments = append(coalesceArguments, goqu.I(alias+"."+columnValue.reference))
+					}
+					coalesceArguments = append(coalesceArguments, goqu.I(prefix+columnValue.reference))
 					finalCols[i] = column{
-						originalvalue: goqu.L(ifNullFunctionName + "(" + translateTableName + "." + columnValue.reference + "," + prefix + columnValue.reference + ") as " + columnValue.reference),
+						originalvalue: goqu.COALESCE(coalesceArguments...).As(columnValue.reference),
 						reference:     columnValue.reference,
 					}
 				} else {
@@ -948,16 +952,18 @@ func (dr *DbResource) PaginatedFindAllWithoutFilters(req api2go.Request) ([]map[
 		}
 
 		queryBuilder = statementbuilder.Squirrel.Select(ColumnToInterfaceArray(finalCols)...).
-			From(tableModel.GetTableName()).
-			LeftJoin(
-				goqu.T(translateTableName),
-				goqu.On(goqu.Ex{
-					translateTableName + ".translation_reference_id": tableModel.GetTableName() + ".id",
-					translateTableName + ".language_id":              "'" + preferredLanguage + "'",
-				})).
-			Where(goqu.Ex{
-				idColumn: ids,
-			}).Order(orders...)
+			From(tableModel.GetTableName())
+		for i, alias := range translationAliases {
+			queryBuilder = queryBuilder.LeftJoin(
+				goqu.T(translateTableName).As(alias),
+				goqu.On(
+					goqu.I(alias+".translation_reference_id").Eq(goqu.I(tableModel.GetTableName()+".id")),
+					goqu.I(alias+".language_id").Eq(languagePreferences[i]),
+				))
+		}
+		queryBuilder = queryBuilder.Where(goqu.Ex{
+			idColumn: ids,
+		}).Order(orders...)
 
 	}
 
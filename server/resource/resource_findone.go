@@ -47,10 +47,7 @@ func (dr *DbResource) FindOne(referenceId string, req api2go.Request) (api2go.Re
 
 	languagePreferences := make([]string, 0)
 	if dr.tableInfo.TranslationsEnabled {
-		prefs := req.PlainRequest.Context().Value("language_preference")
-		if prefs != nil {
-			languagePreferences = prefs.([]string)
-		}
+		languagePreferences = LanguageChain(req.PlainRequest.Context())
 	}
 
 	includedRelations := make(map[string]bool, 0)
@@ -66,30 +63,35 @@ func (dr *DbResource) FindOne(referenceId string, req api2go.Request) (api2go.Re
 	}
 
 	data, include, err := dr.GetSingleRowByReferenceId(modelName, referenceId, includedRelations)
+	if err == nil && data != nil && dr.HidesTrashedRow(req, data) {
+		return nil, api2go.NewHTTPError(errors.New("object is in the trash"), "Cannot find this object", 404)
+	}
+	if err == nil && data != nil {
+		SetResponseETag(req, referenceId, data["version"])
+	}
 
-	if len(languagePreferences) > 0 {
-		for _, lang := range languagePreferences {
+	if len(languagePreferences) > 0 && data != nil {
+		// apply the least preferred language first so fields missing in a translation fall back along the chain
+		for i := len(languagePreferences) - 1; i >= 0; i-- {
+			lang := languagePreferences[i]
 			data_i18n_id, err := dr.GetIdByWhereClause(modelName+"_i18n", goqu.Ex{
 				"translation_reference_id": data["id"],
 				"language_id":              lang,
 			})
-			if err == nil && len(data_i18n_id) > 0 {
-				for _, data_i18n := range data_i18n_id {
-					translatedObj, err := dr.GetIdToObject(modelName+"_i18n", data_i18n)
-					CheckErr(err, "Failed to fetch translated object for [%v][%v][%v]", modelName, lang, data["id"])
-					for colName, valName := range translatedObj {
-						if IsStandardColumn(colName) {
-							continue
-						}
-						if valName == nil {
-							continue
-						}
-						data[colName] = valName
-					}
-				}
-				break
-			} else {
+			if err != nil || len(data_i18n_id) == 0 {
 				CheckErr(err, "No translated rows for [%v][%v][%v]", modelName, referenceId, lang)
+				continue
+			}
+			translatedObj, err := dr.GetIdToObject(modelName+"_i18n", data_i18n_id[0])
+			CheckErr(err, "Failed to fetch translated object for [%v][%v][%v]", modelName, lang, data["id"])
+			for colName, valName := range translatedObj {
+				if IsStandardColumn(colName) {
+					continue
+				}
+				if valName == nil {
+					continue
+				}
+				data[colName] = valName
 			}
 		}
 	}
@@ -191,6 +191,11 @@ func (dr *DbResource) DataStats(req AggregationRequest) (*AggregateData, error)
 
 		}
 	}
+	if rootResource, ok := dr.Cruds[req.RootEntity]; ok {
+		if trashCondition := rootResource.TrashCondition(api2go.Request{}); trashCondition != nil {
+			whereExpressions = append(whereExpressions, trashCondition)
+		}
+	}
 	builder = builder.Where(whereExpressions...)
 
 	havingExpressions := make([]goqu.Expression, 0)
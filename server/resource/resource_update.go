@@ -61,6 +61,22 @@ func (dr *DbResource) UpdateWithoutFilters(obj interface{}, req api2go.Request)
 
 	allChanges := data.GetChanges()
 	allColumns := dr.model.GetColumns()
+
+	expectedVersion, checkVersion, err := ExpectedVersion(req, id, allChanges)
+	if err != nil {
+		return nil, err
+	}
+	delete(allChanges, "version")
+	if checkVersion {
+		if currentVersion := data.GetCurrentVersion(); currentVersion != expectedVersion {
+			return nil, NewVersionConflictError(VersionConflict{
+				Type:            dr.model.GetName(),
+				ReferenceId:     id,
+				ExpectedVersion: expectedVersion,
+				CurrentVersion:  currentVersion,
+			})
+		}
+	}
 	//log.Printf("Update object request with changes: %v", allChanges)
 
 	//dataToInsert := make(map[string]interface{})
@@ -415,11 +431,25 @@ func (dr *DbResource) UpdateWithoutFilters(obj interface{}, req api2go.Request)
 			}
 
 			log.Printf("Update query: %v", query)
-			_, err = dr.db.Exec(query, vals...)
+			result, err := dr.db.Exec(query, vals...)
 			if err != nil {
 				log.Errorf("Failed to execute update query [%s] [%v] 411: %v", query, vals, err)
 				return nil, err
 			}
+			// the row was changed by another request since it was read
+			if updatedRows, err := result.RowsAffected(); err == nil && updatedRows == 0 {
+				currentVersion, err := dr.getCurrentVersion(id)
+				if err != nil {
+					return nil, err
+				}
+				return nil, NewVersionConflictError(VersionConflict{
+					Type:            dr.model.GetName(),
+					ReferenceId:     id,
+					ExpectedVersion: data.GetCurrentVersion(),
+					CurrentVersion:  currentVersion,
+				})
+			}
+			SetResponseETag(req, id, data.GetNextVersion())
 
 		} else if len(languagePreferences) > 0 {
 
@@ -479,6 +509,7 @@ func (dr *DbResource) UpdateWithoutFilters(obj interface{}, req api2go.Request)
 	if data.IsDirty() && dr.tableInfo.IsAuditEnabled {
 
 		auditModel := data.GetAuditModel()
+		auditModel.Data["source_reference_id"] = data.GetID()
 		log.Printf("Object [%v][%v] has been changed, trying to audit in %v", data.GetTableName(), data.GetID(), auditModel.GetTableName())
 		if auditModel.GetTableName() != "" {
 			creator, ok := dr.Cruds[auditModel.GetTableName()]
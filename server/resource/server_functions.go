@@ -0,0 +1,473 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/artpar/api2go"
+	uuid "github.com/artpar/go.uuid"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/dop251/goja"
+	"github.com/doug-martin/goqu/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// ServerFunctionTableName holds javascript action performers, ServerFunctionLogTableName the lines they log
+const (
+	ServerFunctionTableName    = "server_function"
+	ServerFunctionLogTableName = "server_function_log"
+)
+
+// serverFunctionSource wraps the source of a server function, which is the body of a function called with the in
+// fields of the outcome
+func serverFunctionSource(source string) string {
+	return "(function (inFields) {\n" + source + "\n})"
+}
+
+// ServerFunctionRegistry keeps the enabled server functions as action performers by name
+type ServerFunctionRegistry struct {
+	cruds     map[string]*DbResource
+	functions map[string]*serverFunctionPerformer
+	lock      sync.RWMutex
+}
+
+func NewServerFunctionRegistry(cruds map[string]*DbResource) *ServerFunctionRegistry {
+	return &ServerFunctionRegistry{
+		cruds:     cruds,
+		functions: make(map[string]*serverFunctionPerformer),
+	}
+}
+
+var serverFunctions = NewServerFunctionRegistry(nil)
+
+// LoadServerFunctions registers the enabled server functions stored in the database
+func LoadServerFunctions(cruds map[string]*DbResource) error {
+	registry := NewServerFunctionRegistry(cruds)
+	rows, err := registry.getFunctionRows(goqu.Ex{})
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		registry.set(row)
+	}
+	serverFunctions = registry
+	log.Infof("Loaded %d server functions", len(registry.functions))
+	return nil
+}
+
+// ReloadServerFunction picks up the change of a server function row, the function is replaced, or removed when the
+// row was deleted or disabled
+func ReloadServerFunction(referenceId string) {
+	registry := serverFunctions
+	if registry.cruds == nil {
+		return
+	}
+	registry.lock.Lock()
+	for name, function := range registry.functions {
+		if function.referenceId == referenceId {
+			delete(registry.functions, name)
+		}
+	}
+	registry.lock.Unlock()
+
+	rows, err := registry.getFunctionRows(goqu.Ex{"reference_id": referenceId})
+	if err != nil {
+		log.Errorf("Failed to reload server function [%v]: %v", referenceId, err)
+		return
+	}
+	for _, row := range rows {
+		registry.set(row)
+		log.Infof("Reloaded server function [%v]", row["name"])
+	}
+}
+
+// Get returns the performer of the server function with the name
+func (r *ServerFunctionRegistry) Get(name string) (ActionPerformerInterface, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	function, ok := r.functions[name]
+	return function, ok
+}
+
+// getFunctionRows returns the enabled server function rows matching where
+func (r *ServerFunctionRegistry) getFunctionRows(where goqu.Ex) ([]map[string]interface{}, error) {
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("reference_id"), goqu.C("name"), goqu.C("source"), goqu.C("enable")).
+		From(ServerFunctionTableName).Where(where).ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.cruds["world"].connection.Queryx(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err = rows.Close()
+		CheckErr(err, "Failed to close server function rows")
+	}()
+
+	functionRows := make([]map[string]interface{}, 0)
+	for rows.Next() {
+		row := make(map[string]interface{})
+		err = rows.MapScan(row)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range row {
+			if bytes, ok := value.([]byte); ok {
+				row[key] = string(bytes)
+			}
+		}
+		// drivers return booleans as numbers, strings or booleans
+		switch fmt.Sprintf("%v", row["enable"]) {
+		case "1", "true":
+			functionRows = append(functionRows, row)
+		}
+	}
+	return functionRows, nil
+}
+
+// set compiles the source of the function row and registers it, a function which does not compile is logged and left
+// out
+func (r *ServerFunctionRegistry) set(row map[string]interface{}) {
+
+	name, _ := row["name"].(string)
+	referenceId, _ := row["reference_id"].(string)
+	source, _ := row["source"].(string)
+	if name == "" {
+		return
+	}
+	if _, ok := r.cruds["world"].ActionHandlerMap[name]; ok {
+		log.Warnf("Server function [%v] has the name of a built in performer and will not be called", name)
+	}
+
+	function := &serverFunctionPerformer{
+		name:        name,
+		referenceId: referenceId,
+		source:      serverFunctionSource(source),
+		cruds:       r.cruds,
+	}
+	_, err := javascriptRuntime.compile(function.source)
+	if err != nil {
+		log.Errorf("Server function [%v] does not compile: %v", name, err)
+		function.writeLogs("", []serverFunctionLogLine{{Level: "error", Message: "failed to compile: " + err.Error()}})
+		return
+	}
+
+	r.lock.Lock()
+	r.functions[name] = function
+	r.lock.Unlock()
+}
+
+// GetActionPerformer returns the performer which handles outcomes of the type, built in performers come before
+// server functions
+func (dr *DbResource) GetActionPerformer(name string) (ActionPerformerInterface, bool) {
+	if performer, ok := dr.ActionHandlerMap[name]; ok {
+		return performer, true
+	}
+	return serverFunctions.Get(name)
+}
+
+type serverFunctionLogLine struct {
+	Level   string
+	Message string
+}
+
+// An invocation stores at most serverFunctionMaxLogLines lines and serverFunctionMaxLogBytes bytes of messages, the
+// lines after are counted and dropped
+const (
+	serverFunctionMaxLogLines = 200
+	serverFunctionMaxLogBytes = 64 << 10
+)
+
+// serverFunctionLog collects the lines logged by an invocation within the limits
+type serverFunctionLog struct {
+	lines   []serverFunctionLogLine
+	bytes   int
+	dropped int
+}
+
+func (l *serverFunctionLog) add(level string, message string) {
+	if len(l.lines) >= serverFunctionMaxLogLines || l.bytes+len(message) > serverFunctionMaxLogBytes {
+		l.dropped++
+		return
+	}
+	l.bytes += len(message)
+	l.lines = append(l.lines, serverFunctionLogLine{Level: level, Message: message})
+}
+
+// all returns the kept lines, with a last line telling how many were dropped
+func (l *serverFunctionLog) all() []serverFunctionLogLine {
+	if l.dropped == 0 {
+		return l.lines
+	}
+	return append(l.lines, serverFunctionLogLine{
+		Level:   "warn",
+		Message: fmt.Sprintf("%d more lines were dropped, an invocation keeps %d lines and %d bytes", l.dropped, serverFunctionMaxLogLines, serverFunctionMaxLogBytes),
+	})
+}
+
+// serverFunctionPerformer runs a server function. The function gets the in fields of the outcome, logs with log()
+// and console, adds action responses with respond(type, attributes) and reads and writes rows through the api
+// object with the permissions of the user who invoked the action. A returned object is the result of the outcome
+type serverFunctionPerformer struct {
+	name        string
+	referenceId string
+	source      string
+	cruds       map[string]*DbResource
+}
+
+func (d *serverFunctionPerformer) Name() string {
+	return d.name
+}
+
+func (d *serverFunctionPerformer) DoAction(request Outcome, inFields map[string]interface{}) (api2go.Responder, []ActionResponse, []error) {
+
+	sessionUser, ok := request.Attributes["user"].(*auth.SessionUser)
+	if !ok {
+		sessionUser = &auth.SessionUser{}
+	}
+	worldResource := d.cruds["world"]
+	if !worldResource.IsAdmin(sessionUser.UserReferenceId) && !worldResource.GetRowPermission(map[string]interface{}{
+		"__type":       ServerFunctionTableName,
+		"reference_id": d.referenceId,
+	}).CanExecute(sessionUser.UserReferenceId, sessionUser.Groups) {
+		return nil, nil, []error{fmt.Errorf("not allowed to call [%v]", d.name)}
+	}
+
+	program, err := javascriptRuntime.compile(d.source)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	u, _ := uuid.NewV4()
+	invocationId := u.String()
+	logLines := &serverFunctionLog{}
+	responses := make([]ActionResponse, 0)
+
+	vm := javascriptRuntime.newVM(map[string]interface{}{
+		"user": map[string]interface{}{
+			"reference_id": sessionUser.UserReferenceId,
+			"id":           sessionUser.UserId,
+		},
+	})
+	vm.Set("user", map[string]interface{}{
+		"reference_id": sessionUser.UserReferenceId,
+	})
+
+	logger := func(level string) func(args ...interface{}) {
+		return func(args ...interface{}) {
+			parts := make([]string, 0, len(args))
+			for _, arg := range args {
+				parts = append(parts, toJson(arg))
+			}
+			logLines.add(level, strings.Join(parts, " "))
+		}
+	}
+	vm.Set("log", logger("info"))
+	console := vm.NewObject()
+	CheckErr(console.Set("log", logger("info")), "Failed to set console.log")
+	CheckErr(console.Set("info", logger("info")), "Failed to set console.info")
+	CheckErr(console.Set("warn", logger("warn")), "Failed to set console.warn")
+	CheckErr(console.Set("error", logger("error")), "Failed to set console.error")
+	vm.Set("console", console)
+
+	vm.Set("respond", func(responseType string, attributes interface{}) {
+		responses = append(responses, NewActionResponse(responseType, attributes))
+	})
+	vm.Set("api", newServerFunctionApi(d.cruds, sessionUser, vm))
+
+	stop := javascriptRuntime.watch(vm)
+	result, err := d.call(vm, program, inFields)
+	stop()
+
+	if err != nil {
+		logLines.lines = append(logLines.lines, serverFunctionLogLine{Level: "error", Message: err.Error()})
+	}
+	d.writeLogs(invocationId, logLines.all())
+	if err != nil {
+		return nil, responses, []error{fmt.Errorf("server function [%v] failed: %v", d.name, err)}
+	}
+
+	var responder api2go.Responder
+	if resultMap, ok := result.(map[string]interface{}); ok {
+		responder = NewResponse(nil, api2go.NewApi2GoModelWithData(d.name, nil, 0, nil, resultMap), 200, nil)
+	}
+	if len(responses) == 0 && result != nil {
+		responses = append(responses, NewActionResponse(d.name, result))
+	}
+	return responder, responses, nil
+}
+
+// call runs the wrapped source, which evaluates to the function, and calls it with the in fields
+func (d *serverFunctionPerformer) call(vm *goja.Runtime, program *goja.Program, inFields map[string]interface{}) (interface{}, error) {
+
+	value, err := vm.RunProgram(program)
+	if err != nil {
+		return nil, javascriptRuntime.scriptError(err)
+	}
+	function, ok := goja.AssertFunction(value)
+	if !ok {
+		return nil, errors.New("source is not a function body")
+	}
+	result, err := function(goja.Undefined(), vm.ToValue(inFields))
+	if err != nil {
+		return nil, javascriptRuntime.scriptError(err)
+	}
+	if result == nil || goja.IsUndefined(result) || goja.IsNull(result) {
+		return nil, nil
+	}
+	return result.Export(), nil
+}
+
+// writeLogs stores the lines logged by an invocation in one insert, they are readable by administrators
+func (d *serverFunctionPerformer) writeLogs(invocationId string, logLines []serverFunctionLogLine) {
+
+	if len(logLines) == 0 {
+		return
+	}
+	logResource := d.cruds[ServerFunctionLogTableName]
+	permission := logResource.model.GetDefaultPermission()
+	now := time.Now()
+	rows := make([]interface{}, 0, len(logLines))
+	for _, line := range logLines {
+		u, _ := uuid.NewV4()
+		rows = append(rows, goqu.Record{
+			"reference_id":  u.String(),
+			"permission":    permission,
+			"created_at":    now,
+			"function_name": d.name,
+			"invocation_id": invocationId,
+			"level":         line.Level,
+			"message":       line.Message,
+		})
+	}
+
+	query, args, err := statementbuilder.Squirrel.Insert(ServerFunctionLogTableName).Prepared(true).Rows(rows...).ToSQL()
+	if err == nil {
+		_, err = logResource.db.Exec(query, args...)
+	}
+	if err != nil {
+		log.Errorf("Failed to store log of server function [%v]: %v", d.name, err)
+	}
+}
+
+// PruneServerFunctionLogs deletes the lines logged before the time, and returns how many were deleted
+func (dr *DbResource) PruneServerFunctionLogs(before time.Time) (int64, error) {
+
+	query, args, err := statementbuilder.Squirrel.Delete(ServerFunctionLogTableName).
+		Where(goqu.C("created_at").Lt(before)).ToSQL()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := dr.db.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// newServerFunctionApi is the api object of a server function, every call goes through the same checks as the
+// http api for the user
+func newServerFunctionApi(cruds map[string]*DbResource, sessionUser *auth.SessionUser, vm *goja.Runtime) map[string]interface{} {
+
+	throw := func(err error) {
+		panic(vm.NewGoError(err))
+	}
+	request := func(method string) api2go.Request {
+		pr := &http.Request{
+			Method: method,
+		}
+		pr = pr.WithContext(context.WithValue(context.Background(), "user", sessionUser))
+		return api2go.Request{
+			PlainRequest: pr,
+		}
+	}
+	table := func(tableName string) *DbResource {
+		dbResource, ok := cruds[tableName]
+		if !ok {
+			throw(fmt.Errorf("no such table [%v]", tableName))
+		}
+		return dbResource
+	}
+	result := func(responder api2go.Responder) map[string]interface{} {
+		model, ok := responder.Result().(*api2go.Api2GoModel)
+		if !ok {
+			return nil
+		}
+		return model.GetAttributes()
+	}
+
+	return map[string]interface{}{
+		"find": func(tableName string, filters interface{}, limit int) []map[string]interface{} {
+			queries, err := scriptQueries(filters)
+			if err != nil {
+				throw(err)
+			}
+			if limit < 1 || (javascriptRuntime.limits.MaxQueryRows > 0 && limit > javascriptRuntime.limits.MaxQueryRows) {
+				limit = javascriptRuntime.limits.MaxQueryRows
+			}
+			req := request("GET")
+			req.QueryParams = map[string][]string{
+				"query":      {toJson(queries)},
+				"page[size]": {fmt.Sprintf("%d", limit)},
+			}
+			_, responder, err := table(tableName).PaginatedFindAll(req)
+			if err != nil {
+				throw(err)
+			}
+			rows := make([]map[string]interface{}, 0)
+			models, _ := responder.Result().([]*api2go.Api2GoModel)
+			for _, model := range models {
+				rows = append(rows, model.GetAttributes())
+			}
+			return rows
+		},
+		"get": func(tableName string, referenceId string) map[string]interface{} {
+			responder, err := table(tableName).FindOne(referenceId, request("GET"))
+			if err != nil {
+				throw(err)
+			}
+			return result(responder)
+		},
+		"create": func(tableName string, attributes map[string]interface{}) map[string]interface{} {
+			responder, err := table(tableName).Create(api2go.NewApi2GoModelWithData(tableName, nil, 0, nil, attributes), request("POST"))
+			if err != nil {
+				throw(err)
+			}
+			return result(responder)
+		},
+		"update": func(tableName string, referenceId string, attributes map[string]interface{}) map[string]interface{} {
+			dbResource := table(tableName)
+			_, err := dbResource.FindOne(referenceId, request("GET"))
+			if err != nil {
+				throw(err)
+			}
+			existing, _, err := dbResource.GetSingleRowByReferenceId(tableName, referenceId, nil)
+			if err != nil {
+				throw(err)
+			}
+			obj := api2go.NewApi2GoModelWithData(tableName, nil, 0, nil, existing)
+			obj.SetAttributes(attributes)
+			responder, err := dbResource.Update(obj, request("PATCH"))
+			if err != nil {
+				throw(err)
+			}
+			return result(responder)
+		},
+		"delete": func(tableName string, referenceId string) {
+			_, err := table(tableName).Delete(referenceId, request("DELETE"))
+			if err != nil {
+				throw(err)
+			}
+		},
+	}
+}
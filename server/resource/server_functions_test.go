@@ -0,0 +1,91 @@
+package resource
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServerFunctionCall(t *testing.T) {
+
+	run := func(source string, inFields map[string]interface{}) (interface{}, error) {
+		function := &serverFunctionPerformer{name: "greet", source: serverFunctionSource(source)}
+		program, err := javascriptRuntime.compile(function.source)
+		if err != nil {
+			return nil, err
+		}
+		return function.call(javascriptRuntime.newVM(nil), program, inFields)
+	}
+
+	result, err := run(`return {message: "hello " + inFields.name}`, map[string]interface{}{"name": "daptin"})
+	if err != nil {
+		t.Fatalf("Failed to call server function: %v", err)
+	}
+	resultMap, ok := result.(map[string]interface{})
+	if !ok || resultMap["message"] != "hello daptin" {
+		t.Errorf("Unexpected result %v", result)
+	}
+
+	result, err = run(`var unused = 1;`, nil)
+	if err != nil || result != nil {
+		t.Errorf("Expected no result from a function which returns nothing, found %v %v", result, err)
+	}
+
+	if _, err = run(`throw new Error("out of stock")`, nil); err == nil {
+		t.Errorf("Expected the thrown error to fail the call")
+	}
+
+	if _, err = run(`}) + (function () {`, nil); err == nil {
+		t.Errorf("Expected a source which escapes the function body to fail")
+	}
+
+	_, err = run(`function down(n) { return down(n + 1); } return down(0);`, nil)
+	if err == nil || !strings.Contains(err.Error(), "nested deeper") {
+		t.Errorf("Expected runaway recursion to stop at the max call depth, found %v", err)
+	}
+}
+
+func TestScriptQueries(t *testing.T) {
+
+	queries, err := scriptQueries(map[string]interface{}{"status": "open"})
+	if err != nil || len(queries) != 1 || queries[0].ColumnName != "status" || queries[0].Operator != "is" {
+		t.Errorf("Unexpected queries from an object %v %v", queries, err)
+	}
+
+	queries, err = scriptQueries([]interface{}{
+		map[string]interface{}{"column": "total", "operator": "more then", "value": 10},
+	})
+	if err != nil || len(queries) != 1 || queries[0].Operator != "more then" || queries[0].Value != 10 {
+		t.Errorf("Unexpected queries from a list %v %v", queries, err)
+	}
+
+	if _, err = scriptQueries("status = open"); err == nil {
+		t.Errorf("Expected a string filter to be rejected")
+	}
+}
+
+func TestServerFunctionLogLimits(t *testing.T) {
+
+	logLines := &serverFunctionLog{}
+	for i := 0; i < serverFunctionMaxLogLines+5; i++ {
+		logLines.add("info", "line")
+	}
+	lines := logLines.all()
+	if len(lines) != serverFunctionMaxLogLines+1 || lines[len(lines)-1].Level != "warn" {
+		t.Errorf("Expected %d lines and a warning about the dropped ones, found %d", serverFunctionMaxLogLines, len(lines))
+	}
+
+	logLines = &serverFunctionLog{}
+	big := make([]byte, serverFunctionMaxLogBytes/2+1)
+	for i := 0; i < 3; i++ {
+		logLines.add("info", string(big))
+	}
+	if len(logLines.lines) != 1 || logLines.dropped != 2 {
+		t.Errorf("Expected lines over the byte limit to be dropped, kept %d", len(logLines.lines))
+	}
+
+	logLines = &serverFunctionLog{}
+	logLines.add("info", "hello")
+	if lines := logLines.all(); len(lines) != 1 || lines[0].Message != "hello" {
+		t.Errorf("Unexpected lines %v", lines)
+	}
+}
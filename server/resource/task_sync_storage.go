@@ -75,3 +75,43 @@ func (res *DbResource) SyncStorageToPath(cloudStore CloudStore, path string, tem
 
 	return nil
 }
+
+// SyncPathToStorage copies the contents of a local directory to path in the cloud store, the reverse of SyncStorageToPath
+// when deleteExtraneous is true files which are no longer present in the local directory are removed from the cloud store
+func (res *DbResource) SyncPathToStorage(cloudStore CloudStore, localDirectoryPath string, path string, deleteExtraneous bool) error {
+
+	res.configureCloudStore(cloudStore)
+
+	args := []string{
+		localDirectoryPath,
+		cloudStore.RootPath,
+	}
+
+	if path != "" && path[0] != '/' && len(args[1]) > 0 && args[1][len(args[1])-1] != '/' {
+		path = "/" + path
+	}
+	args[1] = args[1] + path
+
+	fsrc, fdst := cmd.NewFsSrcDst(args)
+	log.Printf("Upload path [%v] ==> [%v]%v", localDirectoryPath, cloudStore.Name, args[1])
+
+	cobraCommand := &cobra.Command{
+		Use: fmt.Sprintf("Sync path [%v] to cloud store [%v]", localDirectoryPath, cloudStore.Name),
+	}
+	defaultConfig := fs.GetConfig(nil)
+	defaultConfig.LogLevel = fs.LogLevelNotice
+
+	go cmd.Run(true, false, cobraCommand, func() error {
+		if fsrc == nil || fdst == nil {
+			log.Errorf("Either source or destination is empty")
+			return nil
+		}
+		ctx := context.Background()
+		if deleteExtraneous {
+			return sync.Sync(ctx, fdst, fsrc, true)
+		}
+		return sync.CopyDir(ctx, fdst, fsrc, true)
+	})
+
+	return nil
+}
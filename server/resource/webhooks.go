@@ -0,0 +1,452 @@
+package resource
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/statementbuilder"
+	"github.com/doug-martin/goqu/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+// WebhookTableName holds the webhook subscriptions, WebhookDeliveryTableName the deliveries made for them
+const (
+	WebhookTableName         = "webhook"
+	WebhookDeliveryTableName = "webhook_delivery"
+)
+
+// Statuses of a webhook delivery, a delivery is dead when every attempt failed
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryDead      = "dead"
+)
+
+// webhookResponseBodyLimit is how much of the response of a subscriber is stored on the delivery
+const webhookResponseBodyLimit = 4 << 10
+
+// WebhookConfig sets how deliveries are sent and retried. A failed attempt is retried after RetryDelay, doubled for
+// every attempt after the first and at most MaxRetryDelay
+type WebhookConfig struct {
+	MaxAttempts   int
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	Timeout       time.Duration
+	PollInterval  time.Duration
+}
+
+var DefaultWebhookConfig = WebhookConfig{
+	MaxAttempts:   8,
+	RetryDelay:    30 * time.Second,
+	MaxRetryDelay: 6 * time.Hour,
+	Timeout:       10 * time.Second,
+	PollInterval:  5 * time.Second,
+}
+
+// SignWebhookPayload is the signature sent in the X-Daptin-Signature header, the hex HMAC-SHA256 of the timestamp
+// header, a dot and the body, keyed with the secret of the webhook
+func SignWebhookPayload(secret string, timestamp string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookSubscription is an enabled webhook with its secret decrypted
+type webhookSubscription struct {
+	referenceId string
+	url         string
+	tableName   string
+	events      []string
+	filter      string
+	secret      string
+}
+
+// matches is true when the webhook subscribes to the event and its filter, a javascript expression over row and
+// event, is true for the row
+func (s webhookSubscription) matches(event string, row map[string]interface{}) bool {
+
+	subscribed := false
+	for _, e := range s.events {
+		if e == event || e == "*" {
+			subscribed = true
+			break
+		}
+	}
+	if !subscribed {
+		return false
+	}
+
+	if strings.TrimSpace(s.filter) == "" {
+		return true
+	}
+	result, err := javascriptRuntime.Run(s.filter, map[string]interface{}{
+		"row":   row,
+		"event": event,
+	})
+	if err != nil {
+		log.Errorf("Failed to evaluate the filter of webhook [%v]: %v", s.referenceId, err)
+		return false
+	}
+	switch value := result.(type) {
+	case bool:
+		return value
+	case string:
+		return value == "1" || strings.ToLower(strings.TrimSpace(value)) == "true"
+	}
+	return result != nil
+}
+
+// WebhookDispatcher sends the changes of rows to the webhooks subscribed to their table. Deliveries are stored in
+// the webhook_delivery table before they are sent, so the ones still pending when the server stops are sent when it
+// starts again
+type WebhookDispatcher struct {
+	cruds         map[string]*DbResource
+	config        WebhookConfig
+	client        *http.Client
+	subscriptions map[string][]webhookSubscription
+	lock          sync.RWMutex
+	wake          chan struct{}
+}
+
+func NewWebhookDispatcher(cruds map[string]*DbResource, config WebhookConfig) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		cruds:  cruds,
+		config: config,
+		client: &http.Client{
+			Timeout: config.Timeout,
+		},
+		subscriptions: make(map[string][]webhookSubscription),
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+var webhookDispatcher *WebhookDispatcher
+
+// StartWebhookDispatcher loads the webhooks and starts sending their deliveries
+func StartWebhookDispatcher(cruds map[string]*DbResource, config WebhookConfig) (*WebhookDispatcher, error) {
+	dispatcher := NewWebhookDispatcher(cruds, config)
+	err := dispatcher.Reload()
+	if err != nil {
+		return nil, err
+	}
+	webhookDispatcher = dispatcher
+	go dispatcher.run()
+	return dispatcher, nil
+}
+
+// ReloadWebhooks picks up a change of the webhook table
+func ReloadWebhooks() {
+	if webhookDispatcher == nil {
+		return
+	}
+	err := webhookDispatcher.Reload()
+	CheckErr(err, "Failed to reload webhooks")
+}
+
+// Reload reads the enabled webhooks from the database
+func (d *WebhookDispatcher) Reload() error {
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("reference_id"), goqu.C("url"), goqu.C("table_name"),
+		goqu.C("events"), goqu.C("filter"), goqu.C("secret"), goqu.C("enable")).From(WebhookTableName).ToSQL()
+	if err != nil {
+		return err
+	}
+
+	dbResource := d.cruds["world"]
+	rows, err := dbResource.connection.Queryx(query, args...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = rows.Close()
+		CheckErr(err, "Failed to close webhook rows")
+	}()
+
+	encryptionSecret, _ := dbResource.configStore.GetConfigValueFor("encryption.secret", "backend")
+
+	subscriptions := make(map[string][]webhookSubscription)
+	count := 0
+	for rows.Next() {
+		row := make(map[string]interface{})
+		err = rows.MapScan(row)
+		if err != nil {
+			return err
+		}
+		for key, value := range row {
+			if bytes, ok := value.([]byte); ok {
+				row[key] = string(bytes)
+			}
+		}
+		// drivers return booleans as numbers, strings or booleans
+		switch fmt.Sprintf("%v", row["enable"]) {
+		case "1", "true":
+		default:
+			continue
+		}
+
+		subscription := webhookSubscription{}
+		subscription.referenceId, _ = row["reference_id"].(string)
+		subscription.url, _ = row["url"].(string)
+		subscription.tableName, _ = row["table_name"].(string)
+		subscription.filter, _ = row["filter"].(string)
+		events, _ := row["events"].(string)
+		for _, event := range strings.Split(events, ",") {
+			event = strings.ToLower(strings.TrimSpace(event))
+			if event != "" {
+				subscription.events = append(subscription.events, event)
+			}
+		}
+		if secret, ok := row["secret"].(string); ok && secret != "" {
+			subscription.secret, err = Decrypt([]byte(encryptionSecret), secret)
+			if err != nil {
+				log.Errorf("Failed to decrypt the secret of webhook [%v], leaving it out: %v", subscription.referenceId, err)
+				continue
+			}
+		}
+
+		subscriptions[subscription.tableName] = append(subscriptions[subscription.tableName], subscription)
+		count += 1
+	}
+
+	d.lock.Lock()
+	d.subscriptions = subscriptions
+	d.lock.Unlock()
+	log.Infof("Loaded %d webhooks", count)
+	return nil
+}
+
+// Enqueue stores a delivery for every webhook of the table which matches the event and the row
+func (d *WebhookDispatcher) Enqueue(tableName string, event string, row map[string]interface{}) {
+
+	d.lock.RLock()
+	subscriptions := d.subscriptions[tableName]
+	d.lock.RUnlock()
+
+	pr := &http.Request{
+		Method: "POST",
+	}
+	req := api2go.Request{
+		PlainRequest: pr.WithContext(context.Background()),
+	}
+
+	queued := false
+	for _, subscription := range subscriptions {
+		if !subscription.matches(event, row) {
+			continue
+		}
+		payload := map[string]interface{}{
+			"event":      event,
+			"table":      tableName,
+			"webhook_id": subscription.referenceId,
+			"created_at": time.Now().UTC().Format(time.RFC3339),
+			"data":       row,
+		}
+		_, err := d.cruds[WebhookDeliveryTableName].CreateWithoutFilter(api2go.NewApi2GoModelWithData(WebhookDeliveryTableName, nil, 0, nil, map[string]interface{}{
+			"webhook_id":      subscription.referenceId,
+			"event":           event,
+			"table_name":      tableName,
+			"payload":         toJson(payload),
+			"status":          WebhookDeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now().UTC(),
+		}), req)
+		if err != nil {
+			log.Errorf("Failed to queue the [%v] delivery of webhook [%v]: %v", event, subscription.referenceId, err)
+			continue
+		}
+		queued = true
+	}
+
+	if queued {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run sends the due deliveries every poll interval, or sooner when a delivery is queued
+func (d *WebhookDispatcher) run() {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		d.sendDue()
+		select {
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// webhookDelivery is a pending delivery read to be sent
+type webhookDelivery struct {
+	ReferenceId string `db:"reference_id"`
+	WebhookId   string `db:"webhook_id"`
+	Event       string `db:"event"`
+	Payload     string `db:"payload"`
+	Attempts    int    `db:"attempts"`
+}
+
+func (d *WebhookDispatcher) sendDue() {
+
+	query, args, err := statementbuilder.Squirrel.Select(goqu.C("reference_id"), goqu.C("webhook_id"), goqu.C("event"),
+		goqu.C("payload"), goqu.C("attempts")).From(WebhookDeliveryTableName).
+		Where(goqu.Ex{"status": WebhookDeliveryPending}, goqu.C("next_attempt_at").Lte(time.Now().UTC())).
+		Order(goqu.C("id").Asc()).Limit(100).ToSQL()
+	if err != nil {
+		log.Errorf("Failed to build the query for due webhook deliveries: %v", err)
+		return
+	}
+
+	deliveries := make([]webhookDelivery, 0)
+	err = d.cruds["world"].connection.Select(&deliveries, query, args...)
+	if err != nil {
+		log.Errorf("Failed to list due webhook deliveries: %v", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		d.send(delivery)
+	}
+}
+
+// send makes one attempt of a delivery. The attempt is claimed first, so a delivery is sent once when several
+// servers share the database
+func (d *WebhookDispatcher) send(delivery webhookDelivery) {
+
+	claimed, err := d.updateDelivery(delivery, map[string]interface{}{
+		"attempts":        delivery.Attempts + 1,
+		"next_attempt_at": time.Now().UTC().Add(d.config.Timeout + d.retryDelay(delivery.Attempts+1)),
+	})
+	if err != nil || !claimed {
+		CheckErr(err, "Failed to claim webhook delivery [%v]", delivery.ReferenceId)
+		return
+	}
+	delivery.Attempts += 1
+
+	subscription, ok := d.subscription(delivery.WebhookId)
+	if !ok {
+		_, err = d.updateDelivery(delivery, map[string]interface{}{
+			"status": WebhookDeliveryDead,
+			"error":  "the webhook was deleted or disabled",
+		})
+		CheckErr(err, "Failed to update webhook delivery [%v]", delivery.ReferenceId)
+		return
+	}
+
+	responseCode, responseBody, err := d.post(subscription, delivery.ReferenceId, delivery.Event, delivery.Payload)
+
+	changes := map[string]interface{}{
+		"response_code": responseCode,
+		"response_body": responseBody,
+	}
+	switch {
+	case err == nil:
+		changes["status"] = WebhookDeliveryDelivered
+		changes["error"] = nil
+		changes["delivered_at"] = time.Now().UTC()
+	case delivery.Attempts >= d.config.MaxAttempts:
+		log.Errorf("Webhook delivery [%v] to [%v] failed %d times, giving up: %v", delivery.ReferenceId, subscription.url, delivery.Attempts, err)
+		changes["status"] = WebhookDeliveryDead
+		changes["error"] = err.Error()
+	default:
+		changes["error"] = err.Error()
+		changes["next_attempt_at"] = time.Now().UTC().Add(d.retryDelay(delivery.Attempts))
+	}
+	_, err = d.updateDelivery(delivery, changes)
+	CheckErr(err, "Failed to update webhook delivery [%v]", delivery.ReferenceId)
+}
+
+// retryDelay is how long to wait after the failed attempt
+func (d *WebhookDispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.config.RetryDelay
+	for i := 1; i < attempts; i++ {
+		delay = delay * 2
+		if delay >= d.config.MaxRetryDelay {
+			return d.config.MaxRetryDelay
+		}
+	}
+	return delay
+}
+
+func (d *WebhookDispatcher) subscription(referenceId string) (webhookSubscription, bool) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	for _, subscriptions := range d.subscriptions {
+		for _, subscription := range subscriptions {
+			if subscription.referenceId == referenceId {
+				return subscription, true
+			}
+		}
+	}
+	return webhookSubscription{}, false
+}
+
+// post sends the payload to the webhook and returns the response, responses other than 2xx are errors
+func (d *WebhookDispatcher) post(subscription webhookSubscription, deliveryId string, event string, payload string) (int, string, error) {
+
+	request, err := http.NewRequest("POST", subscription.url, strings.NewReader(payload))
+	if err != nil {
+		return 0, "", err
+	}
+	timestamp := fmt.Sprintf("%d", time.Now().Unix())
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "daptin-webhook")
+	request.Header.Set("X-Daptin-Event", event)
+	request.Header.Set("X-Daptin-Delivery", deliveryId)
+	request.Header.Set("X-Daptin-Timestamp", timestamp)
+	if subscription.secret != "" {
+		request.Header.Set("X-Daptin-Signature", SignWebhookPayload(subscription.secret, timestamp, payload))
+	}
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		err = response.Body.Close()
+		CheckErr(err, "Failed to close webhook response body")
+	}()
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, webhookResponseBodyLimit))
+	if err != nil {
+		return response.StatusCode, "", err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, string(body), fmt.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+	return response.StatusCode, string(body), nil
+}
+
+// updateDelivery changes a delivery if it was not attempted since it was read, and tells if it did
+func (d *WebhookDispatcher) updateDelivery(delivery webhookDelivery, changes map[string]interface{}) (bool, error) {
+
+	record := goqu.Record{
+		"updated_at": time.Now(),
+	}
+	for key, value := range changes {
+		record[key] = value
+	}
+	query, args, err := statementbuilder.Squirrel.Update(WebhookDeliveryTableName).Prepared(true).Set(record).
+		Where(goqu.Ex{"reference_id": delivery.ReferenceId, "attempts": delivery.Attempts, "status": WebhookDeliveryPending}).ToSQL()
+	if err != nil {
+		return false, err
+	}
+
+	result, err := d.cruds["world"].db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	updated, err := result.RowsAffected()
+	return updated == 1, err
+}
@@ -0,0 +1,108 @@
+package resource
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookPost(t *testing.T) {
+
+	status := 200
+	var received *http.Request
+	var receivedBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = r
+		receivedBody = string(body)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	dispatcher := NewWebhookDispatcher(nil, DefaultWebhookConfig)
+	subscription := webhookSubscription{
+		referenceId: "webhook-1",
+		url:         server.URL,
+		secret:      "secret",
+	}
+	payload := `{"event":"create","table":"book","data":{"title":"Dune"}}`
+
+	code, body, err := dispatcher.post(subscription, "delivery-1", "create", payload)
+	if err != nil {
+		t.Fatalf("Expected the delivery to succeed: %v", err)
+	}
+	if code != 200 || body != "ok" {
+		t.Errorf("Unexpected response %v %v", code, body)
+	}
+	if receivedBody != payload {
+		t.Errorf("Unexpected body %v", receivedBody)
+	}
+	if received.Header.Get("X-Daptin-Event") != "create" || received.Header.Get("X-Daptin-Delivery") != "delivery-1" {
+		t.Errorf("Unexpected headers %v", received.Header)
+	}
+	expected := SignWebhookPayload("secret", received.Header.Get("X-Daptin-Timestamp"), payload)
+	if received.Header.Get("X-Daptin-Signature") != expected {
+		t.Errorf("Expected signature %v, found %v", expected, received.Header.Get("X-Daptin-Signature"))
+	}
+	if SignWebhookPayload("other", received.Header.Get("X-Daptin-Timestamp"), payload) == expected {
+		t.Errorf("Expected the signature to depend on the secret")
+	}
+
+	status = 503
+	code, body, err = dispatcher.post(subscription, "delivery-2", "create", payload)
+	if err == nil || code != 503 || body != "ok" {
+		t.Errorf("Expected a failed delivery with the response, found %v %v %v", code, body, err)
+	}
+
+	subscription.secret = ""
+	status = 204
+	_, _, err = dispatcher.post(subscription, "delivery-3", "create", payload)
+	if err != nil || received.Header.Get("X-Daptin-Signature") != "" {
+		t.Errorf("Expected an unsigned delivery, found %v %v", err, received.Header)
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+
+	dispatcher := NewWebhookDispatcher(nil, WebhookConfig{
+		RetryDelay:    time.Second,
+		MaxRetryDelay: 10 * time.Second,
+	})
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, delay := range expected {
+		if found := dispatcher.retryDelay(i + 1); found != delay {
+			t.Errorf("Expected attempt %d to wait %v, found %v", i+1, delay, found)
+		}
+	}
+}
+
+func TestWebhookSubscriptionMatches(t *testing.T) {
+
+	subscription := webhookSubscription{
+		events: []string{"create", "update"},
+		filter: "row.price > 10 && event == 'create'",
+	}
+
+	if !subscription.matches("create", map[string]interface{}{"price": 20}) {
+		t.Errorf("Expected the create of an expensive row to match")
+	}
+	if subscription.matches("create", map[string]interface{}{"price": 5}) {
+		t.Errorf("Expected the filter to leave out a cheap row")
+	}
+	if subscription.matches("delete", map[string]interface{}{"price": 20}) {
+		t.Errorf("Expected a delete not to match")
+	}
+	if subscription.matches("update", map[string]interface{}{"price": 20}) {
+		t.Errorf("Expected the filter to leave out an update")
+	}
+
+	subscription.filter = ""
+	subscription.events = []string{"*"}
+	if !subscription.matches("delete", map[string]interface{}{}) {
+		t.Errorf("Expected every event to match")
+	}
+}
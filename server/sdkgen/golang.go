@@ -0,0 +1,321 @@
+package sdkgen
+
+import (
+	"bytes"
+	"go/format"
+	"text/template"
+)
+
+var goTypes = map[string]string{
+	"string":  "string",
+	"number":  "float64",
+	"boolean": "bool",
+	"files":   "[]File",
+}
+
+var goTemplate = template.Must(template.New("go").Funcs(template.FuncMap{
+	"goType": func(field Field) string {
+		goType := goTypes[field.Type]
+		if field.Optional && field.Type != "files" {
+			return "*" + goType
+		}
+		return goType
+	},
+}).Parse(`// Code generated by daptin from the schema of {{ .Hostname }}. DO NOT EDIT.
+
+// Package daptin is a client for the daptin api
+package daptin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// File is a file stored in an asset column
+type File struct {
+	Name     string ` + "`json:\"name,omitempty\"`" + `
+	Path     string ` + "`json:\"path,omitempty\"`" + `
+	Type     string ` + "`json:\"type,omitempty\"`" + `
+	Size     int64  ` + "`json:\"size,omitempty\"`" + `
+	Src      string ` + "`json:\"src,omitempty\"`" + `
+	Contents string ` + "`json:\"contents,omitempty\"`" + `
+}
+
+// ActionResponse is one instruction in the response of an action
+type ActionResponse struct {
+	ResponseType string                 ` + "`json:\"ResponseType\"`" + `
+	Attributes   map[string]interface{} ` + "`json:\"Attributes\"`" + `
+}
+
+// Error is returned for responses with a status of 400 and above
+type Error struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("daptin: status %d: %s", e.StatusCode, e.Body)
+}
+
+// Client calls the api of a daptin server
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client for the server at baseURL, token is the JWT of the user and can be empty
+func NewClient(baseURL string, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		Token:      token,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+type resourceObject struct {
+	Type       string          ` + "`json:\"type\"`" + `
+	Id         string          ` + "`json:\"id,omitempty\"`" + `
+	Attributes json.RawMessage ` + "`json:\"attributes,omitempty\"`" + `
+}
+
+type document struct {
+	Data json.RawMessage ` + "`json:\"data\"`" + `
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}, out interface{}) error {
+
+	requestUrl := c.BaseURL + path
+	if len(query) > 0 {
+		requestUrl = requestUrl + "?" + query.Encode()
+	}
+
+	var requestBody *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		requestBody = bytes.NewReader(data)
+	} else {
+		requestBody = bytes.NewReader(nil)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, requestUrl, requestBody)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/vnd.api+json")
+	if body != nil {
+		request.Header.Set("Content-Type", "application/vnd.api+json")
+	}
+	if c.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode >= 400 {
+		return &Error{StatusCode: response.StatusCode, Body: string(data)}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// resources returns the resource objects of a document, data can be a single object or a list
+func (d document) resources() ([]resourceObject, error) {
+	trimmed := bytes.TrimSpace(d.Data)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return nil, nil
+	}
+	if trimmed[0] == '[' {
+		var list []resourceObject
+		err := json.Unmarshal(trimmed, &list)
+		return list, err
+	}
+	var single resourceObject
+	err := json.Unmarshal(trimmed, &single)
+	return []resourceObject{single}, err
+}
+
+// Execute calls an action, attributes are the input fields of the action
+func (c *Client) Execute(ctx context.Context, onType string, actionName string, attributes interface{}) ([]ActionResponse, error) {
+	var responses []ActionResponse
+	err := c.do(ctx, "POST", "/action/"+onType+"/"+actionName, nil, map[string]interface{}{
+		"attributes": attributes,
+	}, &responses)
+	return responses, err
+}
+{{ range $model := .Models }}
+// {{ .TypeName }} is a row of {{ .TableName }}
+type {{ .TypeName }} struct {
+	Id string ` + "`json:\"-\"`" + `
+{{- range .Fields }}
+{{- if .Description }}
+	// {{ .Description }}
+{{- end }}
+	{{ .Name }} {{ goType . }} ` + "`json:\"{{ .JsonName }},omitempty\"`" + `
+{{- end }}
+}
+
+func decode{{ .TypeName }}List(doc document) ([]{{ .TypeName }}, error) {
+	objects, err := doc.resources()
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]{{ .TypeName }}, 0, len(objects))
+	for _, object := range objects {
+		var row {{ .TypeName }}
+		if len(object.Attributes) > 0 {
+			err = json.Unmarshal(object.Attributes, &row)
+			if err != nil {
+				return nil, err
+			}
+		}
+		row.Id = object.Id
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// {{ .TypeName }}Client reads{{ if not .ReadOnly }} and writes{{ end }} {{ .TableName }}
+type {{ .TypeName }}Client struct {
+	client *Client
+}
+
+// {{ .TypeName }} returns the client for {{ .TableName }}
+func (c *Client) {{ .TypeName }}() *{{ .TypeName }}Client {
+	return &{{ .TypeName }}Client{client: c}
+}
+
+// List returns a page of {{ .TableName }}, query takes sort, page[number], page[size], query and filter
+func (c *{{ .TypeName }}Client) List(ctx context.Context, query url.Values) ([]{{ .TypeName }}, error) {
+	var doc document
+	err := c.client.do(ctx, "GET", "/api/{{ .TableName }}", query, nil, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return decode{{ .TypeName }}List(doc)
+}
+
+// Get returns the {{ .TableName }} with the reference id
+func (c *{{ .TypeName }}Client) Get(ctx context.Context, referenceId string) (*{{ .TypeName }}, error) {
+	var doc document
+	err := c.client.do(ctx, "GET", "/api/{{ .TableName }}/"+url.PathEscape(referenceId), nil, nil, &doc)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := decode{{ .TypeName }}List(doc)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+{{ if not .ReadOnly }}
+// Create adds a new {{ .TableName }}
+func (c *{{ .TypeName }}Client) Create(ctx context.Context, row {{ .TypeName }}) (*{{ .TypeName }}, error) {
+	var doc document
+	err := c.client.do(ctx, "POST", "/api/{{ .TableName }}", nil, map[string]interface{}{
+		"data": map[string]interface{}{
+			"type":       "{{ .TableName }}",
+			"attributes": row,
+		},
+	}, &doc)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := decode{{ .TypeName }}List(doc)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+// Update changes the non empty fields of row on the {{ .TableName }} with the reference id
+func (c *{{ .TypeName }}Client) Update(ctx context.Context, referenceId string, row {{ .TypeName }}) (*{{ .TypeName }}, error) {
+	var doc document
+	err := c.client.do(ctx, "PATCH", "/api/{{ .TableName }}/"+url.PathEscape(referenceId), nil, map[string]interface{}{
+		"data": map[string]interface{}{
+			"type":       "{{ .TableName }}",
+			"id":         referenceId,
+			"attributes": row,
+		},
+	}, &doc)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := decode{{ .TypeName }}List(doc)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+// Delete removes the {{ .TableName }} with the reference id
+func (c *{{ .TypeName }}Client) Delete(ctx context.Context, referenceId string) error {
+	return c.client.do(ctx, "DELETE", "/api/{{ .TableName }}/"+url.PathEscape(referenceId), nil, nil, nil)
+}
+{{ end }}
+{{- range .Relations }}
+// Related{{ .MethodName }} returns the {{ .Name }} of the {{ $model.TableName }} with the reference id
+func (c *{{ $model.TypeName }}Client) Related{{ .MethodName }}(ctx context.Context, referenceId string, query url.Values) ({{ if .Many }}[]{{ .TargetType }}{{ else }}*{{ .TargetType }}{{ end }}, error) {
+	var doc document
+	err := c.client.do(ctx, "GET", "/api/{{ $model.TableName }}/"+url.PathEscape(referenceId)+"/{{ .Name }}", query, nil, &doc)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := decode{{ .TargetType }}List(doc)
+{{- if .Many }}
+	return rows, err
+{{- else }}
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return &rows[0], nil
+{{- end }}
+}
+{{ end }}
+{{- end }}
+{{- range .Actions }}
+// {{ .RequestType }} are the input fields of {{ .Name }} on {{ .OnType }}
+type {{ .RequestType }} struct {
+{{- range .Fields }}
+	{{ .Name }} {{ goType . }} ` + "`json:\"{{ .JsonName }},omitempty\"`" + `
+{{- end }}
+}
+
+// {{ .MethodName }} calls the {{ .Name }} action on {{ .OnType }}{{ if .Label }}: {{ .Label }}{{ end }}
+func (c *Client) {{ .MethodName }}(ctx context.Context, request {{ .RequestType }}) ([]ActionResponse, error) {
+	return c.Execute(ctx, "{{ .OnType }}", "{{ .Name }}", request)
+}
+{{ end }}`))
+
+// GenerateGo renders the Go client package for the schema
+func GenerateGo(schema Schema) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := goTemplate.Execute(&buffer, schema)
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buffer.Bytes())
+}
@@ -0,0 +1,231 @@
+package sdkgen
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/iancoleman/strcase"
+)
+
+// Field is a column of a model or an input field of an action
+type Field struct {
+	Name        string
+	JsonName    string
+	Description string
+	Type        string // string, number, boolean or files
+	Optional    bool
+}
+
+// Relation is an accessor from a model to the rows related to it
+type Relation struct {
+	Name       string
+	MethodName string
+	TargetType string
+	Many       bool
+}
+
+// Model is a table or a stream exposed on /api
+type Model struct {
+	TypeName  string
+	TableName string
+	ReadOnly  bool
+	Fields    []Field
+	Relations []Relation
+}
+
+// Action is an action which can be called on /action
+type Action struct {
+	Name        string
+	OnType      string
+	Label       string
+	MethodName  string
+	RequestType string
+	Fields      []Field
+}
+
+// Schema is the language independent description of the api rendered by the generators
+type Schema struct {
+	Hostname string
+	Models   []Model
+	Actions  []Action
+}
+
+var nonIdentifierCharacters = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// TypeName converts a table, column or action name to an exported identifier
+func TypeName(name string) string {
+	typeName := strcase.ToCamel(nonIdentifierCharacters.ReplaceAllString(name, "_"))
+	if typeName == "" || (typeName[0] >= '0' && typeName[0] <= '9') {
+		typeName = "X" + typeName
+	}
+	return typeName
+}
+
+func fieldType(column api2go.ColumnInfo) string {
+	if column.IsForeignKey {
+		if column.ForeignKeyData.DataSource == "cloud_store" {
+			return "files"
+		}
+		return "string"
+	}
+	if resource.ColumnManager == nil {
+		return "string"
+	}
+	switch resource.ColumnManager.GetBlueprintType(column.ColumnType) {
+	case "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	}
+	return "string"
+}
+
+// columnFields lists a field for each column, a column declared more than once is listed once and stream
+// columns which only have a Name use it as the column name
+func columnFields(columns []api2go.ColumnInfo) []Field {
+	fields := make([]Field, 0)
+	seen := make(map[string]bool)
+	for _, column := range columns {
+		columnName := column.ColumnName
+		if columnName == "" {
+			columnName = column.Name
+		}
+		if column.ExcludeFromApi || columnName == "" || columnName == "id" {
+			continue
+		}
+		name := TypeName(columnName)
+		if seen[columnName] || seen[name] {
+			continue
+		}
+		seen[columnName] = true
+		seen[name] = true
+		fields = append(fields, Field{
+			Name:        name,
+			JsonName:    columnName,
+			Description: column.ColumnDescription,
+			Type:        fieldType(column),
+			Optional:    column.IsNullable,
+		})
+	}
+	return fields
+}
+
+func isJoinTable(table resource.TableInfo) bool {
+	return table.IsJoinTable || strings.Index(table.TableName, "_has_") > -1
+}
+
+// NewSchema describes the tables, streams and actions of the config
+func NewSchema(config *resource.CmsConfig) Schema {
+
+	schema := Schema{
+		Hostname: config.Hostname,
+		Models:   make([]Model, 0),
+		Actions:  make([]Action, 0),
+	}
+
+	tables := make(map[string]bool)
+	for _, table := range config.Tables {
+		if !isJoinTable(table) {
+			tables[table.TableName] = true
+		}
+	}
+
+	for _, table := range config.Tables {
+		if isJoinTable(table) {
+			continue
+		}
+
+		model := Model{
+			TypeName:  TypeName(table.TableName),
+			TableName: table.TableName,
+			Fields:    columnFields(table.Columns),
+			Relations: make([]Relation, 0),
+		}
+
+		seenRelations := make(map[string]bool)
+		for _, relation := range table.Relations {
+			name := relation.GetObjectName()
+			target := relation.GetObject()
+			many := relation.Relation == "has_many" || relation.Relation == "has_many_and_belongs_to_many"
+			if relation.GetSubject() != table.TableName {
+				name = relation.GetSubjectName()
+				target = relation.GetSubject()
+				// the reverse side of a belongs_to or has_one can have many rows
+				many = true
+			}
+			if !tables[target] || seenRelations[name] {
+				continue
+			}
+			seenRelations[name] = true
+			model.Relations = append(model.Relations, Relation{
+				Name:       name,
+				MethodName: TypeName(name),
+				TargetType: TypeName(target),
+				Many:       many,
+			})
+		}
+		sort.Slice(model.Relations, func(i, j int) bool {
+			return model.Relations[i].Name < model.Relations[j].Name
+		})
+
+		schema.Models = append(schema.Models, model)
+	}
+
+	for _, stream := range config.Streams {
+		schema.Models = append(schema.Models, Model{
+			TypeName:  TypeName(stream.StreamName),
+			TableName: stream.StreamName,
+			ReadOnly:  true,
+			Fields:    columnFields(stream.Columns),
+			Relations: []Relation{},
+		})
+	}
+
+	sort.Slice(schema.Models, func(i, j int) bool {
+		return schema.Models[i].TableName < schema.Models[j].TableName
+	})
+
+	for _, action := range config.Actions {
+		methodName := TypeName(action.Name) + "On" + TypeName(action.OnType)
+		sdkAction := Action{
+			Name:        action.Name,
+			OnType:      action.OnType,
+			Label:       action.Label,
+			MethodName:  methodName,
+			RequestType: methodName + "Request",
+			Fields:      make([]Field, 0),
+		}
+		seenFields := make(map[string]bool)
+		for _, column := range action.InFields {
+			if seenFields[column.ColumnName] {
+				continue
+			}
+			seenFields[column.ColumnName] = true
+			sdkAction.Fields = append(sdkAction.Fields, Field{
+				Name:        TypeName(column.ColumnName),
+				JsonName:    column.ColumnName,
+				Description: column.ColumnDescription,
+				Type:        fieldType(column),
+				Optional:    column.IsNullable,
+			})
+		}
+		if !action.InstanceOptional && !seenFields[action.OnType+"_id"] {
+			sdkAction.Fields = append(sdkAction.Fields, Field{
+				Name:        TypeName(action.OnType + "_id"),
+				JsonName:    action.OnType + "_id",
+				Description: "reference id of the " + action.OnType,
+				Type:        "string",
+			})
+		}
+		schema.Actions = append(schema.Actions, sdkAction)
+	}
+
+	sort.Slice(schema.Actions, func(i, j int) bool {
+		return schema.Actions[i].MethodName < schema.Actions[j].MethodName
+	})
+
+	return schema
+}
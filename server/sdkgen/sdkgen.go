@@ -0,0 +1,37 @@
+// Package sdkgen renders typed api clients from the tables, streams and actions of the running config
+package sdkgen
+
+import (
+	"fmt"
+
+	"github.com/daptin/daptin/server/resource"
+)
+
+// Languages maps the names accepted on /sdk/:language to the file name of the generated client
+var Languages = map[string]string{
+	"typescript": "daptin.ts",
+	"ts":         "daptin.ts",
+	"go":         "daptin.go",
+	"golang":     "daptin.go",
+}
+
+// GenerateSdk renders the client for the language, it returns the contents and the file name
+func GenerateSdk(language string, config *resource.CmsConfig) ([]byte, string, error) {
+
+	fileName, ok := Languages[language]
+	if !ok {
+		return nil, "", fmt.Errorf("no sdk generator for language [%v]", language)
+	}
+
+	schema := NewSchema(config)
+
+	var contents []byte
+	var err error
+	switch fileName {
+	case "daptin.ts":
+		contents, err = GenerateTypescript(schema)
+	case "daptin.go":
+		contents, err = GenerateGo(schema)
+	}
+	return contents, fileName, err
+}
@@ -0,0 +1,252 @@
+package sdkgen
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/resource"
+)
+
+func testConfig() *resource.CmsConfig {
+	return &resource.CmsConfig{
+		Hostname: "localhost",
+		Tables: []resource.TableInfo{
+			{
+				TableName: "author",
+				Columns: []api2go.ColumnInfo{
+					{ColumnName: "reference_id", ColumnType: "alias"},
+					{ColumnName: "name", ColumnType: "label", ColumnDescription: "full name"},
+				},
+				Relations: []api2go.TableRelation{
+					api2go.NewTableRelation("book", "has_many", "author"),
+				},
+			},
+			{
+				TableName: "book",
+				Columns: []api2go.ColumnInfo{
+					{ColumnName: "reference_id", ColumnType: "alias"},
+					{ColumnName: "title", ColumnType: "label"},
+					{ColumnName: "pages", ColumnType: "measurement", IsNullable: true},
+					{ColumnName: "published", ColumnType: "truefalse"},
+					{ColumnName: "cover", ColumnType: "file.jpg", IsForeignKey: true, IsNullable: true,
+						ForeignKeyData: api2go.ForeignKeyData{DataSource: "cloud_store", Namespace: "local"}},
+				},
+				Relations: []api2go.TableRelation{
+					api2go.NewTableRelation("book", "has_many", "author"),
+					api2go.NewTableRelation("book", "belongs_to", "user_account"),
+				},
+			},
+			{
+				TableName: "user_account",
+				Columns: []api2go.ColumnInfo{
+					{ColumnName: "email", ColumnType: "email"},
+				},
+			},
+			{
+				TableName:   "book_author_id_has_author_author_id",
+				IsJoinTable: true,
+			},
+		},
+		Actions: []resource.Action{
+			{
+				Name:   "publish",
+				Label:  "Publish the book",
+				OnType: "book",
+				InFields: []api2go.ColumnInfo{
+					{ColumnName: "channel", ColumnType: "label"},
+				},
+			},
+		},
+		Streams: []resource.StreamContract{
+			{
+				StreamName:     "book_titles",
+				RootEntityName: "book",
+				Columns: []api2go.ColumnInfo{
+					{ColumnName: "title", ColumnType: "label"},
+				},
+			},
+		},
+	}
+}
+
+func TestNewSchema(t *testing.T) {
+
+	resource.InitialiseColumnManager()
+	schema := NewSchema(testConfig())
+
+	if len(schema.Models) != 4 {
+		t.Fatalf("Expected 4 models without the join table, found %v", len(schema.Models))
+	}
+
+	models := make(map[string]Model)
+	for _, model := range schema.Models {
+		models[model.TableName] = model
+	}
+
+	if !models["book_titles"].ReadOnly || models["book"].ReadOnly {
+		t.Errorf("Expected only the stream to be read only")
+	}
+
+	fieldTypes := make(map[string]string)
+	for _, field := range models["book"].Fields {
+		fieldTypes[field.JsonName] = field.Type
+	}
+	if fieldTypes["pages"] != "number" || fieldTypes["published"] != "boolean" || fieldTypes["cover"] != "files" {
+		t.Errorf("Unexpected field types %v", fieldTypes)
+	}
+
+	relations := make(map[string]Relation)
+	for _, relation := range models["book"].Relations {
+		relations[relation.Name] = relation
+	}
+	if !relations["author_id"].Many || relations["user_account_id"].Many || relations["user_account_id"].TargetType != "UserAccount" {
+		t.Errorf("Unexpected relations of book %v", relations)
+	}
+
+	if len(schema.Actions) != 1 || schema.Actions[0].MethodName != "PublishOnBook" || len(schema.Actions[0].Fields) != 2 {
+		t.Errorf("Unexpected actions %v", schema.Actions)
+	}
+
+	// the standard feed table declares title twice
+	for _, model := range NewSchema(standardConfig()).Models {
+		fieldNames := make(map[string]bool)
+		for _, field := range model.Fields {
+			if fieldNames[field.Name] {
+				t.Errorf("Expected [%v] once in [%v]", field.Name, model.TableName)
+			}
+			fieldNames[field.Name] = true
+		}
+	}
+}
+
+// standardConfig is the config of a new instance, the standard tables with the standard columns and relations
+func standardConfig() *resource.CmsConfig {
+	tables := make([]resource.TableInfo, 0, len(resource.StandardTables))
+	for _, table := range resource.StandardTables {
+		table.Columns = append(append([]api2go.ColumnInfo{}, resource.StandardColumns...), table.Columns...)
+		for _, relation := range resource.StandardRelations {
+			if relation.GetSubject() == table.TableName || relation.GetObject() == table.TableName {
+				table.Relations = append(table.Relations, relation)
+			}
+		}
+		tables = append(tables, table)
+	}
+	return &resource.CmsConfig{
+		Hostname: "localhost",
+		Tables:   tables,
+		Actions:  resource.SystemActions,
+		Streams:  resource.StandardStreams,
+	}
+}
+
+func TestGenerateGoParses(t *testing.T) {
+
+	resource.InitialiseColumnManager()
+	contents, fileName, err := GenerateSdk("go", testConfig())
+	if err != nil {
+		t.Fatalf("Failed to generate go sdk: %v", err)
+	}
+	if fileName != "daptin.go" {
+		t.Errorf("Unexpected file name %v", fileName)
+	}
+
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, fileName, contents, 0)
+	if err != nil {
+		t.Fatalf("Generated go sdk does not parse: %v\n%s", err, contents)
+	}
+
+	declared := make(map[string]bool)
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			name := d.Name.Name
+			if d.Recv != nil {
+				name = receiverName(d.Recv.List[0].Type) + "." + name
+			}
+			declared[name] = true
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+					declared[typeSpec.Name.Name] = true
+				}
+			}
+		}
+	}
+
+	for _, name := range []string{
+		"Book", "BookTitles", "PublishOnBookRequest",
+		"Client.Book", "Client.PublishOnBook",
+		"BookClient.List", "BookClient.Create", "BookClient.RelatedAuthorId", "BookClient.RelatedUserAccountId",
+		"BookTitlesClient.Get",
+	} {
+		if !declared[name] {
+			t.Errorf("Expected %v in the generated go sdk", name)
+		}
+	}
+	if declared["BookTitlesClient.Create"] {
+		t.Errorf("Expected no Create on a stream")
+	}
+
+	// the sdk of the standard tables has to compile, not only parse
+	contents, fileName, err = GenerateSdk("go", standardConfig())
+	if err != nil {
+		t.Fatalf("Failed to generate go sdk of the standard tables: %v", err)
+	}
+	file, err = parser.ParseFile(fileSet, fileName, contents, 0)
+	if err != nil {
+		t.Fatalf("Generated go sdk of the standard tables does not parse: %v", err)
+	}
+	typeChecker := types.Config{
+		Importer: importer.ForCompiler(fileSet, "source", nil),
+		Error: func(err error) {
+			t.Errorf("Generated go sdk of the standard tables does not compile: %v", err)
+		},
+	}
+	_, _ = typeChecker.Check("daptin", fileSet, []*ast.File{file}, nil)
+}
+
+func receiverName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	return expr.(*ast.Ident).Name
+}
+
+func TestGenerateTypescript(t *testing.T) {
+
+	resource.InitialiseColumnManager()
+	contents, fileName, err := GenerateSdk("typescript", testConfig())
+	if err != nil {
+		t.Fatalf("Failed to generate typescript sdk: %v", err)
+	}
+	if fileName != "daptin.ts" {
+		t.Errorf("Unexpected file name %v", fileName)
+	}
+
+	source := string(contents)
+	for _, expected := range []string{
+		"export interface Book {",
+		"pages?: number;",
+		"cover?: DaptinFile[];",
+		"export class BookClient {",
+		"async relatedAuthorId(referenceId: string, params?: ListParams): Promise<Author[]>",
+		"async relatedUserAccountId(referenceId: string): Promise<UserAccount | null>",
+		"async PublishOnBook(request: PublishOnBookRequest): Promise<ActionResponse[]>",
+		"book_id: string;",
+	} {
+		if !strings.Contains(source, expected) {
+			t.Errorf("Expected [%v] in the generated typescript sdk", expected)
+		}
+	}
+
+	if _, _, err = GenerateSdk("cobol", testConfig()); err == nil {
+		t.Errorf("Expected an error for an unknown language")
+	}
+}
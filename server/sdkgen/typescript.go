@@ -0,0 +1,201 @@
+package sdkgen
+
+import (
+	"bytes"
+	"text/template"
+)
+
+var typescriptTypes = map[string]string{
+	"string":  "string",
+	"number":  "number",
+	"boolean": "boolean",
+	"files":   "DaptinFile[]",
+}
+
+var typescriptTemplate = template.Must(template.New("typescript").Funcs(template.FuncMap{
+	"tsType": func(field Field) string {
+		return typescriptTypes[field.Type]
+	},
+}).Parse(`// Code generated by daptin from the schema of {{ .Hostname }}. DO NOT EDIT.
+
+export interface DaptinFile {
+  name?: string;
+  path?: string;
+  type?: string;
+  size?: number;
+  src?: string;
+  contents?: string;
+}
+
+export interface ActionResponse {
+  ResponseType: string;
+  Attributes: { [key: string]: any };
+}
+
+export interface ListParams {
+  sort?: string;
+  "page[number]"?: number;
+  "page[size]"?: number;
+  "page[after]"?: string;
+  query?: string;
+  filter?: string;
+  included_relations?: string;
+}
+
+export class DaptinError extends Error {
+  constructor(public status: number, public body: string) {
+    super("daptin: status " + status + ": " + body);
+  }
+}
+
+interface ResourceObject {
+  type: string;
+  id?: string;
+  attributes?: { [key: string]: any };
+}
+
+function toRows<T>(data: ResourceObject | ResourceObject[] | null | undefined): Array<T & { id: string }> {
+  if (!data) {
+    return [];
+  }
+  const list = Array.isArray(data) ? data : [data];
+  return list.map((object) => ({ ...(object.attributes || {}), id: object.id } as T & { id: string }));
+}
+
+function toQuery(params?: ListParams): string {
+  if (!params) {
+    return "";
+  }
+  const parts: string[] = [];
+  for (const key of Object.keys(params)) {
+    const value = (params as any)[key];
+    if (value !== undefined && value !== null) {
+      parts.push(encodeURIComponent(key) + "=" + encodeURIComponent(String(value)));
+    }
+  }
+  return parts.length > 0 ? "?" + parts.join("&") : "";
+}
+
+export class DaptinClient {
+  constructor(public baseUrl: string, public token?: string) {
+    this.baseUrl = baseUrl.replace(/\/$/, "");
+  }
+
+  async request(method: string, path: string, body?: any): Promise<any> {
+    const headers: { [key: string]: string } = {
+      Accept: "application/vnd.api+json",
+    };
+    if (body !== undefined) {
+      headers["Content-Type"] = "application/vnd.api+json";
+    }
+    if (this.token) {
+      headers["Authorization"] = "Bearer " + this.token;
+    }
+    const response = await fetch(this.baseUrl + path, {
+      method: method,
+      headers: headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+    const text = await response.text();
+    if (response.status >= 400) {
+      throw new DaptinError(response.status, text);
+    }
+    return text.length > 0 ? JSON.parse(text) : null;
+  }
+
+  async execute(onType: string, actionName: string, attributes: { [key: string]: any }): Promise<ActionResponse[]> {
+    return this.request("POST", "/action/" + onType + "/" + actionName, { attributes: attributes });
+  }
+{{- range .Models }}
+
+  get {{ .TypeName }}(): {{ .TypeName }}Client {
+    return new {{ .TypeName }}Client(this);
+  }
+{{- end }}
+{{- range .Actions }}
+
+  /** {{ .Name }} on {{ .OnType }}{{ if .Label }}: {{ .Label }}{{ end }} */
+  async {{ .MethodName }}(request: {{ .RequestType }}): Promise<ActionResponse[]> {
+    return this.execute("{{ .OnType }}", "{{ .Name }}", request);
+  }
+{{- end }}
+}
+{{ range $model := .Models }}
+/** a row of {{ .TableName }} */
+export interface {{ .TypeName }} {
+  id?: string;
+{{- range .Fields }}
+{{- if .Description }}
+  /** {{ .Description }} */
+{{- end }}
+  {{ .JsonName }}{{ if .Optional }}?{{ end }}: {{ tsType . }};
+{{- end }}
+}
+
+export class {{ .TypeName }}Client {
+  constructor(private client: DaptinClient) {}
+
+  async list(params?: ListParams): Promise<{{ .TypeName }}[]> {
+    const document = await this.client.request("GET", "/api/{{ .TableName }}" + toQuery(params));
+    return toRows<{{ .TypeName }}>(document && document.data);
+  }
+
+  async get(referenceId: string): Promise<{{ .TypeName }} | null> {
+    const document = await this.client.request("GET", "/api/{{ .TableName }}/" + encodeURIComponent(referenceId));
+    return toRows<{{ .TypeName }}>(document && document.data)[0] || null;
+  }
+{{- if not .ReadOnly }}
+
+  async create(row: Partial<{{ .TypeName }}>): Promise<{{ .TypeName }} | null> {
+    const document = await this.client.request("POST", "/api/{{ .TableName }}", {
+      data: { type: "{{ .TableName }}", attributes: row },
+    });
+    return toRows<{{ .TypeName }}>(document && document.data)[0] || null;
+  }
+
+  async update(referenceId: string, row: Partial<{{ .TypeName }}>): Promise<{{ .TypeName }} | null> {
+    const document = await this.client.request("PATCH", "/api/{{ .TableName }}/" + encodeURIComponent(referenceId), {
+      data: { type: "{{ .TableName }}", id: referenceId, attributes: row },
+    });
+    return toRows<{{ .TypeName }}>(document && document.data)[0] || null;
+  }
+
+  async delete(referenceId: string): Promise<void> {
+    await this.client.request("DELETE", "/api/{{ .TableName }}/" + encodeURIComponent(referenceId));
+  }
+{{- end }}
+{{- range .Relations }}
+
+  /** {{ .Name }} of the {{ $model.TableName }} */
+  async related{{ .MethodName }}(referenceId: string{{ if .Many }}, params?: ListParams{{ end }}): Promise<{{ if .Many }}{{ .TargetType }}[]{{ else }}{{ .TargetType }} | null{{ end }}> {
+    const document = await this.client.request(
+      "GET",
+      "/api/{{ $model.TableName }}/" + encodeURIComponent(referenceId) + "/{{ .Name }}"{{ if .Many }} + toQuery(params){{ end }}
+    );
+{{- if .Many }}
+    return toRows<{{ .TargetType }}>(document && document.data);
+{{- else }}
+    return toRows<{{ .TargetType }}>(document && document.data)[0] || null;
+{{- end }}
+  }
+{{- end }}
+}
+{{ end }}
+{{- range .Actions }}
+/** input fields of {{ .Name }} on {{ .OnType }} */
+export interface {{ .RequestType }} {
+{{- range .Fields }}
+  {{ .JsonName }}{{ if .Optional }}?{{ end }}: {{ tsType . }};
+{{- end }}
+}
+{{ end }}`))
+
+// GenerateTypescript renders the TypeScript client module for the schema
+func GenerateTypescript(schema Schema) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := typescriptTemplate.Execute(&buffer, schema)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/sadlil/go-trigger"
 	"os"
 	"strings"
-	//"sync"
+	"sync"
 	"time"
 
 	"github.com/artpar/api2go"
@@ -45,7 +45,7 @@ var Stats = stats.New()
 
 func Main(boxRoot http.FileSystem, db database.DatabaseConnection, localStoragePath string, olricDb *olric.Olric) (
 	HostSwitch, *guerrilla.Daemon, resource.TaskScheduler, *resource.ConfigStore, *resource.CertificateManager,
-	*server2.FtpServer, *server.Server, *olric.Olric) {
+	*server2.FtpServer, *DaptinSftpServer, *server.Server, *olric.Olric) {
 
 	fmt.Print(`                                                                           
                               
@@ -185,6 +185,11 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection, localStorageP
 
 	defaultRouter.Use(NewLanguageMiddleware(configStore).LanguageMiddlewareFunc)
 
+	// FindOne and Update set the ETag of the row they return through the response headers kept in the context
+	defaultRouter.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), "response_header", c.Writer.Header()))
+	})
+
 	maxConnections, err := configStore.GetConfigIntValueFor("limit.max_connections", "backend")
 	if err != nil {
 		maxConnections = 100
@@ -236,6 +241,13 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection, localStorageP
 	err = CheckSystemSecrets(configStore)
 	resource.CheckErr(err, "Failed to initialise system secrets")
 
+	masterKey, err := resource.LoadMasterKey(localStoragePath)
+	if err != nil {
+		log.Fatalf("Failed to load the master key: %v", err)
+	}
+	_, err = resource.InitialiseEncryptionKeyring(configStore, masterKey)
+	resource.CheckErr(err, "Failed to load the encryption keyring")
+
 	jwtTokenIssuer, err := configStore.GetConfigValueFor("jwt.token.issuer", "backend")
 	resource.CheckErr(err, "No default jwt token issuer set")
 	if err != nil {
@@ -305,14 +317,49 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection, localStorageP
 		err = nil
 	}
 
+	keyringTopic, err := cruds["world"].OlricDb.NewDTopic(resource.EncryptionKeyringTopic, 4, 1)
+	resource.CheckErr(err, "Failed to create topic for the encryption keyring")
+	if err == nil {
+		_, err = keyringTopic.AddListener(func(message olric.DTopicMessage) {
+			err := resource.ReloadEncryptionKeyring(configStore)
+			resource.CheckErr(err, "Failed to reload the encryption keyring")
+		})
+		resource.CheckErr(err, "Failed to listen for encryption keyring changes")
+	}
+
 	rcloneRetries, err := configStore.GetConfigIntValueFor("rclone.retries", "backend")
 	if err != nil {
 		rcloneRetries = 5
 		_ = configStore.SetConfigIntValueFor("rclone.retries", rcloneRetries, "backend")
 	}
 
+	go func() {
+		filled, err := cruds["calendar"].BackfillCalendarEvents()
+		resource.CheckErr(err, "Failed to backfill calendar events")
+		if filled > 0 {
+			log.Printf("Filled the event columns of %d calendar rows", filled)
+		}
+	}()
+
 	certificateManager, err := resource.NewCertificateManager(cruds, configStore)
 	resource.CheckErr(err, "Failed to create certificate manager")
+	_, err = dtopicMap["site"].AddListener(func(message olric.DTopicMessage) {
+		eventMessage := message.Message.(resource.EventMessage)
+		if eventMessage.ObjectType == "site" {
+			certificateManager.ReloadSiteHostnames()
+			resetSiteAssetCaches()
+		}
+	})
+	resource.CheckErr(err, "Failed to listen for site changes")
+
+	defaultRouter.GET("/.well-known/acme-challenge/:token", func(c *gin.Context) {
+		keyAuth, ok := certificateManager.AcmeChallengeResponse(c.Param("token"))
+		if !ok {
+			c.AbortWithStatus(404)
+			return
+		}
+		c.String(200, keyAuth)
+	})
 
 	streamProcessors := GetStreamProcessors(&initConfig, configStore, cruds)
 	AddStreamsToApi2Go(api, streamProcessors, db, &ms, configStore)
@@ -429,6 +476,7 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection, localStorageP
 	for k := range cruds {
 		cruds[k].SubsiteFolderCache = subsiteCacheFolders
 	}
+	resetSiteAssetCaches()
 
 	hostSwitch.handlerMap["api"] = defaultRouter
 	hostSwitch.handlerMap["dashboard"] = defaultRouter
@@ -442,6 +490,17 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection, localStorageP
 		cruds[k].ActionHandlerMap = actionHandlerMap
 	}
 
+	err = resource.LoadServerFunctions(cruds)
+	resource.CheckErr(err, "Failed to load server functions")
+	_, err = dtopicMap[resource.ServerFunctionTableName].AddListener(func(message olric.DTopicMessage) {
+		eventMessage := message.Message.(resource.EventMessage)
+		referenceId, ok := eventMessage.EventData["reference_id"].(string)
+		if ok && eventMessage.ObjectType == resource.ServerFunctionTableName {
+			resource.ReloadServerFunction(referenceId)
+		}
+	})
+	resource.CheckErr(err, "Failed to listen for server function changes")
+
 	skipImportData, skipImportValFound := os.LookupEnv("DAPTIN_SKIP_IMPORT_DATA")
 	if skipImportValFound && skipImportData == "true" {
 		log.Info("skipping importing data from files")
@@ -463,6 +522,80 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection, localStorageP
 		Schedule:    "@every 1h",
 	})
 
+	acmeRenewSchedule, err := configStore.GetConfigValueFor("acme.renew_schedule", "backend")
+	if err != nil {
+		acmeRenewSchedule = "@every 12h"
+		err = configStore.SetConfigValueFor("acme.renew_schedule", acmeRenewSchedule, "backend")
+		resource.CheckErr(err, "Failed to store default value for acme.renew_schedule")
+	}
+
+	err = TaskScheduler.AddTask(resource.Task{
+		EntityName:  "certificate",
+		ActionName:  "renew_acme_certificates",
+		Attributes:  map[string]interface{}{},
+		AsUserEmail: cruds[resource.USER_ACCOUNT_TABLE_NAME].GetAdminEmailId(),
+		Schedule:    acmeRenewSchedule,
+	})
+	resource.CheckErr(err, "Failed to schedule acme certificate renewal")
+
+	auditPruneSchedule, err := configStore.GetConfigValueFor("audit.prune_schedule", "backend")
+	if err != nil {
+		auditPruneSchedule = "@every 24h"
+		err = configStore.SetConfigValueFor("audit.prune_schedule", auditPruneSchedule, "backend")
+		resource.CheckErr(err, "Failed to store default value for audit.prune_schedule")
+	}
+
+	err = TaskScheduler.AddTask(resource.Task{
+		EntityName:  "world",
+		ActionName:  "prune_audit_log",
+		Attributes:  map[string]interface{}{},
+		AsUserEmail: cruds[resource.USER_ACCOUNT_TABLE_NAME].GetAdminEmailId(),
+		Schedule:    auditPruneSchedule,
+	})
+	resource.CheckErr(err, "Failed to schedule audit log pruning")
+
+	serverFunctionLogPruneSchedule, err := configStore.GetConfigValueFor("server_function.log_prune_schedule", "backend")
+	if err != nil {
+		serverFunctionLogPruneSchedule = "@every 24h"
+		err = configStore.SetConfigValueFor("server_function.log_prune_schedule", serverFunctionLogPruneSchedule, "backend")
+		resource.CheckErr(err, "Failed to store default value for server_function.log_prune_schedule")
+	}
+
+	err = TaskScheduler.AddTask(resource.Task{
+		EntityName:  "world",
+		ActionName:  "prune_server_function_log",
+		Attributes:  map[string]interface{}{},
+		AsUserEmail: cruds[resource.USER_ACCOUNT_TABLE_NAME].GetAdminEmailId(),
+		Schedule:    serverFunctionLogPruneSchedule,
+	})
+	resource.CheckErr(err, "Failed to schedule server function log pruning")
+
+	trashPurgeSchedule, err := configStore.GetConfigValueFor("trash.purge_schedule", "backend")
+	if err != nil {
+		trashPurgeSchedule = "@every 24h"
+		err = configStore.SetConfigValueFor("trash.purge_schedule", trashPurgeSchedule, "backend")
+		resource.CheckErr(err, "Failed to store default value for trash.purge_schedule")
+	}
+
+	err = TaskScheduler.AddTask(resource.Task{
+		EntityName:  "world",
+		ActionName:  "purge_trash",
+		Attributes:  map[string]interface{}{},
+		AsUserEmail: cruds[resource.USER_ACCOUNT_TABLE_NAME].GetAdminEmailId(),
+		Schedule:    trashPurgeSchedule,
+	})
+	resource.CheckErr(err, "Failed to schedule trash purge")
+
+	_, err = resource.StartExchangeSyncScheduler(cruds)
+	resource.CheckErr(err, "Failed to schedule the syncs of exchanges")
+	_, err = dtopicMap[resource.DataExchangeTableName].AddListener(func(message olric.DTopicMessage) {
+		eventMessage := message.Message.(resource.EventMessage)
+		if eventMessage.ObjectType == resource.DataExchangeTableName {
+			resource.ReloadExchangeSyncs()
+		}
+	})
+	resource.CheckErr(err, "Failed to listen for exchange changes")
+
 	TaskScheduler.StartTasks()
 
 	assetColumnFolders := CreateAssetColumnSync(cruds)
@@ -503,6 +636,33 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection, localStorageP
 		}()
 	}
 
+	enableSftp, err := configStore.GetConfigValueFor("sftp.enable", "backend")
+	if err != nil {
+		enableSftp = "false"
+		err = configStore.SetConfigValueFor("sftp.enable", enableSftp, "backend")
+		auth.CheckErr(err, "Failed to store default value for sftp.enable")
+	}
+
+	var sftpServer *DaptinSftpServer
+	if enableSftp == "true" {
+
+		sftp_interface, err := configStore.GetConfigValueFor("sftp.listen_interface", "backend")
+		if err != nil {
+			sftp_interface = "0.0.0.0:2022"
+			err = configStore.SetConfigValueFor("sftp.listen_interface", sftp_interface, "backend")
+			resource.CheckErr(err, "Failed to store default value for sftp.listen_interface")
+		}
+		sftpServer, err = CreateSftpServer(cruds, configStore, sftp_interface)
+		auth.CheckErr(err, "Failed to create SFTP server")
+		if err == nil {
+			go func() {
+				log.Printf("SFTP server started at %v", sftp_interface)
+				err := sftpServer.ListenAndServe()
+				resource.CheckErr(err, "Failed to listen at sftp interface")
+			}()
+		}
+	}
+
 	defaultRouter.GET("/ping", func(c *gin.Context) {
 		_, err := cruds["world"].GetObjectByWhereClause("world", "table_name", "world")
 		if err != nil {
@@ -518,7 +678,7 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection, localStorageP
 	statsHandler := CreateStatsHandler(&initConfig, cruds)
 	resource.InitialiseColumnManager()
 
-	dbAssetHandler := CreateDbAssetHandler(cruds)
+	dbAssetHandler := CreateDbAssetHandler(cruds, configStore)
 	defaultRouter.GET("/asset/:typename/:resource_id/:columnname", dbAssetHandler)
 
 	defaultRouter.GET("/feed/:feedname", feedHandler)
@@ -535,18 +695,44 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection, localStorageP
 
 	if initConfig.EnableGraphQL {
 
+		maxDepth, err := configStore.GetConfigIntValueFor("graphql.max_depth", "backend")
+		if err != nil {
+			maxDepth = 10
+			err = configStore.SetConfigValueFor("graphql.max_depth", maxDepth, "backend")
+			resource.CheckErr(err, "Failed to store graphql.max_depth default value in db")
+		}
+		maxComplexity, err := configStore.GetConfigIntValueFor("graphql.max_complexity", "backend")
+		if err != nil {
+			maxComplexity = 1000
+			err = configStore.SetConfigValueFor("graphql.max_complexity", maxComplexity, "backend")
+			resource.CheckErr(err, "Failed to store graphql.max_complexity default value in db")
+		}
+		SetGraphqlQueryLimits(GraphqlQueryLimits{
+			MaxDepth:      maxDepth,
+			MaxComplexity: maxComplexity,
+		})
+
 		// TODO: add state machine change api available as graphql
 		graphqlSchema := MakeGraphqlSchema(&initConfig, cruds)
 
-		graphqlHttpHandler := graphqlhandler.New(&graphqlhandler.Config{
+		graphqlHttpHandler := GraphqlQueryLimitHandler(graphqlSchema, graphqlhandler.New(&graphqlhandler.Config{
 			Schema:     graphqlSchema,
 			Pretty:     true,
 			Playground: true,
 			GraphiQL:   true,
-		})
+			RootObjectFn: func(ctx context.Context, r *http.Request) map[string]interface{} {
+				return graphqlRootObject(cruds)
+			},
+		}))
 
-		// serve HTTP
+		graphqlSubscriptionHandler := CreateGraphqlSubscriptionHandler(graphqlSchema, &dtopicMap, cruds)
+
+		// serve HTTP, websocket upgrades are graphql-ws subscriptions
 		defaultRouter.Handle("GET", "/graphql", func(c *gin.Context) {
+			if strings.EqualFold(c.GetHeader("Upgrade"), "websocket") {
+				graphqlSubscriptionHandler(c)
+				return
+			}
 			graphqlHttpHandler.ServeHTTP(c.Writer, c.Request)
 		})
 		// serve HTTP
@@ -569,12 +755,120 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection, localStorageP
 
 	defaultRouter.GET("/jsmodel/:typename", handler)
 	defaultRouter.GET("/aggregate/:typename", statsHandler)
+	defaultRouter.GET("/translations/:typename/coverage", CreateTranslationCoverageHandler(cruds, configStore))
+	defaultRouter.GET("/translations/:typename/export", CreateTranslationExportHandler(cruds, configStore))
+	defaultRouter.POST("/translations/:typename/import", CreateTranslationImportHandler(cruds))
+	defaultRouter.GET("/audit/:typename/:referenceId", CreateAuditHistoryHandler(cruds))
+	defaultRouter.GET("/trash/:typename", CreateTrashListHandler(cruds))
+	defaultRouter.POST("/api/_bulk", CreateBulkOperationsHandler(cruds))
+	defaultRouter.GET("/jobs/:jobId", CreateActionJobStatusHandler(cruds))
+	defaultRouter.POST("/hook/:hookId", CreateInboundHookHandler(cruds))
+
+	oauthServer, err := resource.NewOAuthServer(cruds, configStore)
+	resource.CheckErr(err, "Failed to start the oauth provider")
+	if err == nil {
+		oauthLoginUrl, err := configStore.GetConfigValueFor("oauth.login_url", "backend")
+		if err != nil {
+			oauthLoginUrl = "/auth/signin"
+			err = configStore.SetConfigValueFor("oauth.login_url", oauthLoginUrl, "backend")
+			resource.CheckErr(err, "Failed to store default value for oauth.login_url")
+		}
+		defaultRouter.GET("/.well-known/openid-configuration", CreateOAuthDiscoveryHandler(oauthServer))
+		defaultRouter.GET("/oauth/jwks", CreateOAuthJwksHandler(oauthServer))
+		defaultRouter.GET("/oauth/authorize", CreateOAuthAuthorizeHandler(oauthServer, oauthLoginUrl))
+		defaultRouter.POST("/oauth/authorize", CreateOAuthConsentHandler(oauthServer))
+		defaultRouter.POST("/oauth/token", CreateOAuthTokenHandler(oauthServer))
+		defaultRouter.GET("/oauth/userinfo", CreateOAuthUserInfoHandler(oauthServer))
+		defaultRouter.POST("/oauth/userinfo", CreateOAuthUserInfoHandler(oauthServer))
+		defaultRouter.POST("/oauth/revoke", CreateOAuthRevokeHandler(oauthServer))
+	}
+	defaultRouter.GET("/calendar/occurrences", CreateCalendarOccurrenceHandler(cruds))
+	defaultRouter.GET("/calendar/freebusy", CreateCalendarFreeBusyHandler(cruds))
+
+	enableWebDav, err := configStore.GetConfigValueFor("webdav.enable", "backend")
+	if err != nil {
+		enableWebDav = "false"
+		err = configStore.SetConfigValueFor("webdav.enable", enableWebDav, "backend")
+		resource.CheckErr(err, "Failed to store default value for webdav.enable")
+	}
+	if enableWebDav == "true" {
+		webDavHandler := CreateWebDavHandler(cruds, authMiddleware)
+		for _, method := range WebDavMethods {
+			defaultRouter.Handle(method, "/webdav/*path", webDavHandler)
+		}
+	}
 	defaultRouter.GET("/meta", metaHandler)
 	defaultRouter.GET("/openapi.yaml", blueprintHandler)
 	defaultRouter.OPTIONS("/jsmodel/:typename", handler)
 	defaultRouter.OPTIONS("/openapi.yaml", blueprintHandler)
+	defaultRouter.GET("/sdk/:language", CreateSdkHandler(&initConfig))
 
-	actionHandler := resource.CreatePostActionHandler(&initConfig, cruds, actionPerformers)
+	javascriptLimits := resource.DefaultJavascriptLimits
+	javascriptTimeout, err := configStore.GetConfigIntValueFor("javascript.timeout_ms", "backend")
+	if err != nil {
+		javascriptTimeout = int(javascriptLimits.Timeout / time.Millisecond)
+		err = configStore.SetConfigIntValueFor("javascript.timeout_ms", javascriptTimeout, "backend")
+		resource.CheckErr(err, "Failed to store default value for javascript.timeout_ms")
+	}
+	javascriptLimits.Timeout = time.Duration(javascriptTimeout) * time.Millisecond
+	javascriptMaxCallDepth, err := configStore.GetConfigIntValueFor("javascript.max_call_depth", "backend")
+	if err != nil {
+		javascriptMaxCallDepth = javascriptLimits.MaxCallDepth
+		err = configStore.SetConfigIntValueFor("javascript.max_call_depth", javascriptMaxCallDepth, "backend")
+		resource.CheckErr(err, "Failed to store default value for javascript.max_call_depth")
+	}
+	javascriptLimits.MaxCallDepth = javascriptMaxCallDepth
+	javascriptQueryTables, err := configStore.GetConfigValueFor("javascript.query_tables", "backend")
+	if err != nil {
+		javascriptQueryTables = strings.Join(javascriptLimits.QueryTables, ",")
+		err = configStore.SetConfigValueFor("javascript.query_tables", javascriptQueryTables, "backend")
+		resource.CheckErr(err, "Failed to store default value for javascript.query_tables")
+	}
+	javascriptLimits.QueryTables = strings.Split(javascriptQueryTables, ",")
+	resource.ConfigureJavascriptRuntime(cruds, javascriptLimits)
+
+	actionJobWorkers, err := configStore.GetConfigIntValueFor("action.job_workers", "backend")
+	if err != nil {
+		actionJobWorkers = 2
+		err = configStore.SetConfigIntValueFor("action.job_workers", actionJobWorkers, "backend")
+		resource.CheckErr(err, "Failed to store default value for action.job_workers")
+	}
+	actionJobQueue := resource.NewActionJobQueue(cruds, actionJobWorkers)
+	actionJobQueue.Start()
+
+	webhookConfig := resource.DefaultWebhookConfig
+	webhookMaxAttempts, err := configStore.GetConfigIntValueFor("webhook.max_attempts", "backend")
+	if err != nil {
+		webhookMaxAttempts = webhookConfig.MaxAttempts
+		err = configStore.SetConfigIntValueFor("webhook.max_attempts", webhookMaxAttempts, "backend")
+		resource.CheckErr(err, "Failed to store default value for webhook.max_attempts")
+	}
+	webhookConfig.MaxAttempts = webhookMaxAttempts
+	webhookRetryDelay, err := configStore.GetConfigIntValueFor("webhook.retry_delay_seconds", "backend")
+	if err != nil {
+		webhookRetryDelay = int(webhookConfig.RetryDelay / time.Second)
+		err = configStore.SetConfigIntValueFor("webhook.retry_delay_seconds", webhookRetryDelay, "backend")
+		resource.CheckErr(err, "Failed to store default value for webhook.retry_delay_seconds")
+	}
+	webhookConfig.RetryDelay = time.Duration(webhookRetryDelay) * time.Second
+	webhookTimeout, err := configStore.GetConfigIntValueFor("webhook.timeout_seconds", "backend")
+	if err != nil {
+		webhookTimeout = int(webhookConfig.Timeout / time.Second)
+		err = configStore.SetConfigIntValueFor("webhook.timeout_seconds", webhookTimeout, "backend")
+		resource.CheckErr(err, "Failed to store default value for webhook.timeout_seconds")
+	}
+	webhookConfig.Timeout = time.Duration(webhookTimeout) * time.Second
+	_, err = resource.StartWebhookDispatcher(cruds, webhookConfig)
+	resource.CheckErr(err, "Failed to start the webhook dispatcher")
+	_, err = dtopicMap[resource.WebhookTableName].AddListener(func(message olric.DTopicMessage) {
+		eventMessage := message.Message.(resource.EventMessage)
+		if eventMessage.ObjectType == resource.WebhookTableName {
+			resource.ReloadWebhooks()
+		}
+	})
+	resource.CheckErr(err, "Failed to listen for webhook changes")
+
+	actionHandler := resource.CreatePostActionHandler(&initConfig, cruds, actionPerformers, actionJobQueue)
 	defaultRouter.POST("/action/:typename/:actionName", actionHandler)
 	defaultRouter.GET("/action/:typename/:actionName", actionHandler)
 
@@ -733,51 +1027,81 @@ func Main(boxRoot http.FileSystem, db database.DatabaseConnection, localStorageP
 	}
 	log.Printf("Our admin is [%v]", adminEmail)
 
-	return hostSwitch, mailDaemon, TaskScheduler, configStore, certificateManager, ftpServer, imapServer, olricDb
+	return hostSwitch, mailDaemon, TaskScheduler, configStore, certificateManager, ftpServer, sftpServer, imapServer, olricDb
 
 }
 
 func CreateFtpServers(resources map[string]*resource.DbResource, certManager *resource.CertificateManager, ftp_interface string) (*server2.FtpServer, error) {
 
-	subsites, err := resources["site"].GetAllSites()
+	sites, err := siteAssetCaches(resources, true)
 	if err != nil {
 		return nil, err
 	}
-	cloudStores, err := resources["cloud_store"].GetAllCloudStores()
 
+	driver, err := NewDaptinFtpDriver(resources, certManager, ftp_interface, sites)
+	ftpS := server2.NewFtpServer(driver)
+	resource.CheckErr(err, "Failed to create daptin ftp driver [%v]", driver)
+	return ftpS, err
+
+}
+
+// CreateSftpServer serves the same sites as the FTP server over SFTP
+func CreateSftpServer(resources map[string]*resource.DbResource, configStore *resource.ConfigStore, sftp_interface string) (*DaptinSftpServer, error) {
+
+	sites, err := siteAssetCaches(resources, true)
 	if err != nil {
 		return nil, err
 	}
-	cloudStoreMap := make(map[string]resource.CloudStore)
-	for _, cloudStore := range cloudStores {
-		cloudStoreMap[cloudStore.ReferenceId] = cloudStore
-	}
-	var driver *DaptinFtpDriver
 
-	sites := make([]SubSiteAssetCache, 0)
-	for _, ftpServer := range subsites {
+	return NewDaptinSftpServer(resources, configStore, sftp_interface, sites)
+}
 
-		if !ftpServer.FtpEnabled {
-			continue
+// the sites along with their asset folder are kept in memory, and dropped when a site changes
+var siteAssetCacheLock sync.Mutex
+var siteAssetCacheList []SubSiteAssetCache
+
+// resetSiteAssetCaches drops the sites kept in memory, the next siteAssetCaches reads them again
+func resetSiteAssetCaches() {
+	siteAssetCacheLock.Lock()
+	defer siteAssetCacheLock.Unlock()
+	siteAssetCacheList = nil
+}
+
+// siteAssetCaches lists the sites along with their local asset folder, only the ftp enabled sites when ftpEnabledOnly is set
+func siteAssetCaches(resources map[string]*resource.DbResource, ftpEnabledOnly bool) ([]SubSiteAssetCache, error) {
+
+	siteAssetCacheLock.Lock()
+	defer siteAssetCacheLock.Unlock()
+
+	if siteAssetCacheList == nil {
+		subsites, err := resources["site"].GetAllSites()
+		if err != nil {
+			return nil, err
 		}
 
-		assetCacheFolder, ok := resources["site"].SubsiteFolderCache[ftpServer.ReferenceId]
-		if !ok {
-			continue
+		allSites := make([]SubSiteAssetCache, 0)
+		for _, subsite := range subsites {
+			assetCacheFolder, ok := resources["site"].SubsiteFolderCache[subsite.ReferenceId]
+			if !ok {
+				continue
+			}
+			allSites = append(allSites, SubSiteAssetCache{
+				SubSite:          subsite,
+				AssetFolderCache: assetCacheFolder,
+			})
 		}
-		site := SubSiteAssetCache{
-			SubSite:          ftpServer,
-			AssetFolderCache: assetCacheFolder,
+		siteAssetCacheList = allSites
+	}
+
+	sites := make([]SubSiteAssetCache, 0)
+	for _, site := range siteAssetCacheList {
+		if ftpEnabledOnly && !site.FtpEnabled {
+			continue
 		}
 		sites = append(sites, site)
-
 	}
 
-	driver, err = NewDaptinFtpDriver(resources, certManager, ftp_interface, sites)
-	ftpS := server2.NewFtpServer(driver)
-	resource.CheckErr(err, "Failed to create daptin ftp driver [%v]", driver)
-	return ftpS, err
-
+	return sites, nil
 }
 
 type SubSiteAssetCache struct {
@@ -829,6 +1153,7 @@ func initialiseResources(initConfig *resource.CmsConfig, db database.DatabaseCon
 
 	resource.CheckAllTableStatus(initConfig, db)
 	resource.CheckErr(errc, "Failed to commit transaction after creating tables")
+	resource.WidenAuditSourceReferenceIds(initConfig, db)
 
 	resource.CreateRelations(initConfig, db)
 	resource.CheckErr(errc, "Failed to commit transaction after creating relations")
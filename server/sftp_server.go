@@ -0,0 +1,484 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/pkg/sftp"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// DaptinSftpServer serves the same per-site directory tree as the FTP driver over SFTP
+// Users log in with their user_account email and password or with a public key from user_ssh_key
+type DaptinSftpServer struct {
+	ListenInterface string
+	Sites           map[string]SubSiteAssetCache
+	cruds           map[string]*resource.DbResource
+	sshConfig       *ssh.ServerConfig
+	listener        net.Listener
+	lock            sync.Mutex
+}
+
+// NewDaptinSftpServer creates a sftp server for the ftp enabled sites, the host key is stored in _config as sftp.host_key
+func NewDaptinSftpServer(cruds map[string]*resource.DbResource, configStore *resource.ConfigStore,
+	listenInterface string, sites []SubSiteAssetCache) (*DaptinSftpServer, error) {
+
+	siteMap := make(map[string]SubSiteAssetCache)
+	for _, site := range sites {
+		siteMap[site.Hostname] = site
+	}
+
+	hostKey, err := sftpHostKey(configStore)
+	if err != nil {
+		return nil, err
+	}
+
+	sftpServer := &DaptinSftpServer{
+		ListenInterface: listenInterface,
+		Sites:           siteMap,
+		cruds:           cruds,
+	}
+
+	sshConfig := &ssh.ServerConfig{
+		PasswordCallback:  sftpServer.passwordCallback,
+		PublicKeyCallback: sftpServer.publicKeyCallback,
+	}
+	sshConfig.AddHostKey(hostKey)
+	sftpServer.sshConfig = sshConfig
+
+	return sftpServer, nil
+}
+
+// sftpHostKey loads the host key from _config, a new ed25519 key is generated and saved on first start
+func sftpHostKey(configStore *resource.ConfigStore) (ssh.Signer, error) {
+
+	hostKeyPem, err := configStore.GetConfigValueFor("sftp.host_key", "backend")
+	if err == nil && hostKeyPem != "" {
+		return ssh.ParsePrivateKey([]byte(hostKeyPem))
+	}
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyPem = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: privateKeyBytes,
+	}))
+	err = configStore.SetConfigValueFor("sftp.host_key", hostKeyPem, "backend")
+	resource.CheckErr(err, "Failed to store sftp host key")
+
+	return ssh.NewSignerFromKey(privateKey)
+}
+
+func (s *DaptinSftpServer) passwordCallback(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+
+	userAccount, err := s.cruds[resource.USER_ACCOUNT_TABLE_NAME].GetUserAccountRowByEmail(conn.User())
+	if err != nil {
+		return nil, err
+	}
+
+	passwordHash, ok := userAccount["password"].(string)
+	if !ok || !resource.BcryptCheckStringHash(string(password), passwordHash) {
+		return nil, fmt.Errorf("could not authenticate you")
+	}
+	// users who have to present a second factor sign in with a public key
+	userId, _ := userAccount["id"].(int64)
+	if !s.cruds[resource.USER_ACCOUNT_TABLE_NAME].AllowsPasswordOnlySignIn(userId) {
+		return nil, fmt.Errorf("could not authenticate you")
+	}
+
+	return sftpUserPermissions(userAccount), nil
+}
+
+func (s *DaptinSftpServer) publicKeyCallback(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+
+	userAccount, err := s.cruds[resource.USER_ACCOUNT_TABLE_NAME].GetUserAccountRowByEmail(conn.User())
+	if err != nil {
+		return nil, err
+	}
+
+	authorizedKeys, err := s.cruds["user_ssh_key"].GetUserSshPublicKeys(userAccount["id"].(int64))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, authorizedKey := range authorizedKeys {
+		publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+		if err != nil {
+			log.Printf("Invalid ssh public key for user [%v]: %v", conn.User(), err)
+			continue
+		}
+		if bytes.Equal(publicKey.Marshal(), key.Marshal()) {
+			return sftpUserPermissions(userAccount), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown public key for %v", conn.User())
+}
+
+func sftpUserPermissions(userAccount map[string]interface{}) *ssh.Permissions {
+	return &ssh.Permissions{
+		Extensions: map[string]string{
+			"user_id":           fmt.Sprintf("%v", userAccount["id"]),
+			"user_reference_id": userAccount["reference_id"].(string),
+		},
+	}
+}
+
+// ListenAndServe accepts ssh connections until Stop is called
+func (s *DaptinSftpServer) ListenAndServe() error {
+
+	listener, err := net.Listen("tcp", s.ListenInterface)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.listener = listener
+	s.lock.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConnection(conn)
+	}
+}
+
+// Stop closes the listener, open sessions are closed by the clients
+func (s *DaptinSftpServer) Stop() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *DaptinSftpServer) handleConnection(conn net.Conn) {
+
+	serverConn, channels, requests, err := ssh.NewServerConn(conn, s.sshConfig)
+	if err != nil {
+		log.Printf("Failed sftp handshake from [%v]: %v", conn.RemoteAddr(), err)
+		return
+	}
+	defer serverConn.Close()
+	go ssh.DiscardRequests(requests)
+
+	var userId int64
+	_, err = fmt.Sscanf(serverConn.Permissions.Extensions["user_id"], "%d", &userId)
+	if err != nil {
+		log.Errorf("Invalid user id in sftp session: %v", err)
+		return
+	}
+	userReferenceId := serverConn.Permissions.Extensions["user_reference_id"]
+	userGroups, err := s.cruds[resource.USER_ACCOUNT_TABLE_NAME].GetUserGroupsByUserId(userId, userReferenceId)
+	if err != nil {
+		log.Errorf("Failed to load groups of user [%v] for sftp: %v", serverConn.User(), err)
+		return
+	}
+
+	log.Printf("Sftp login [%v] from [%v]", serverConn.User(), conn.RemoteAddr())
+
+	for newChannel := range channels {
+
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			log.Errorf("Failed to accept sftp channel: %v", err)
+			continue
+		}
+
+		go func(in <-chan *ssh.Request) {
+			for req := range in {
+				isSftp := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(isSftp, nil)
+			}
+		}(channelRequests)
+
+		handler := &sftpSession{
+			server:          s,
+			userReferenceId: userReferenceId,
+			userGroups:      userGroups,
+		}
+		requestServer := sftp.NewRequestServer(channel, sftp.Handlers{
+			FileGet:  handler,
+			FilePut:  handler,
+			FileCmd:  handler,
+			FileList: handler,
+		})
+
+		go func() {
+			err := requestServer.Serve()
+			if err != nil && err != io.EOF {
+				log.Printf("Sftp session of [%v] ended: %v", serverConn.User(), err)
+			}
+			_ = requestServer.Close()
+		}()
+	}
+}
+
+// sftpSession handles the sftp requests of one logged in user
+type sftpSession struct {
+	server          *DaptinSftpServer
+	userReferenceId string
+	userGroups      []auth.GroupPermission
+}
+
+// resolve maps /<site hostname>/<path> to the local sync folder of the site
+// an empty site name means the virtual root which lists the sites
+func (h *sftpSession) resolve(requestPath string) (SubSiteAssetCache, string, string, error) {
+
+	cleanPath := strings.TrimPrefix(path.Clean("/"+requestPath), "/")
+	if cleanPath == "" {
+		return SubSiteAssetCache{}, "", "", nil
+	}
+
+	parts := strings.SplitN(cleanPath, "/", 2)
+	site, ok := h.server.Sites[parts[0]]
+	if !ok || !h.canRead(site) {
+		return site, "", "", os.ErrNotExist
+	}
+
+	relativePath := ""
+	if len(parts) > 1 {
+		relativePath = parts[1]
+	}
+
+	return site, filepath.Join(site.LocalSyncPath, filepath.FromSlash(relativePath)), relativePath, nil
+}
+
+func (h *sftpSession) canRead(site SubSiteAssetCache) bool {
+	return site.Permission.CanRead(h.userReferenceId, h.userGroups)
+}
+
+func (h *sftpSession) canWrite(site SubSiteAssetCache) bool {
+	return site.Permission.CanUpdate(h.userReferenceId, h.userGroups)
+}
+
+// writeBack pushes the directory containing relativePath to the cloud store of the site
+func (h *sftpSession) writeBack(site SubSiteAssetCache, relativePath string, deleteExtraneous bool) {
+	syncSiteChanges(h.server.cruds, site, relativePath, deleteExtraneous)
+}
+
+func (h *sftpSession) Fileread(request *sftp.Request) (io.ReaderAt, error) {
+
+	site, localPath, _, err := h.resolve(request.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	if localPath == "" {
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+	if !h.canRead(site) {
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+
+	return os.Open(localPath)
+}
+
+func (h *sftpSession) Filewrite(request *sftp.Request) (io.WriterAt, error) {
+
+	site, localPath, relativePath, err := h.resolve(request.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	if localPath == "" || relativePath == "" {
+		return nil, sftp.ErrSSHFxOpUnsupported
+	}
+	if !h.canWrite(site) {
+		return nil, sftp.ErrSSHFxPermissionDenied
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	pflags := request.Pflags()
+	if pflags.Trunc {
+		flags |= os.O_TRUNC
+	}
+	if pflags.Append {
+		flags |= os.O_APPEND
+	}
+	if pflags.Excl {
+		flags |= os.O_EXCL
+	}
+
+	file, err := os.OpenFile(localPath, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sftpWriteFile{
+		File: file,
+		onClose: func() {
+			h.writeBack(site, relativePath, false)
+		},
+	}, nil
+}
+
+func (h *sftpSession) Filecmd(request *sftp.Request) error {
+
+	site, localPath, relativePath, err := h.resolve(request.Filepath)
+	if err != nil {
+		return err
+	}
+	if localPath == "" || relativePath == "" {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+	if !h.canWrite(site) {
+		return sftp.ErrSSHFxPermissionDenied
+	}
+
+	switch request.Method {
+	case "Setstat":
+		attrFlags := request.AttrFlags()
+		attributes := request.Attributes()
+		if attrFlags.Permissions {
+			err = os.Chmod(localPath, attributes.FileMode())
+		}
+		if err == nil && attrFlags.Acmodtime {
+			err = os.Chtimes(localPath, time.Unix(int64(attributes.Atime), 0), time.Unix(int64(attributes.Mtime), 0))
+		}
+		if err == nil && attrFlags.Size {
+			err = os.Truncate(localPath, int64(attributes.Size))
+		}
+		return err
+	case "Mkdir":
+		return os.Mkdir(localPath, 0750)
+	case "Remove":
+		err = os.Remove(localPath)
+		if err == nil {
+			h.writeBack(site, relativePath, true)
+		}
+		return err
+	case "Rmdir":
+		err = os.RemoveAll(localPath)
+		if err == nil {
+			h.writeBack(site, relativePath, true)
+		}
+		return err
+	case "Rename":
+		targetSite, targetPath, targetRelativePath, err := h.resolve(request.Target)
+		if err != nil {
+			return err
+		}
+		if targetSite.ReferenceId != site.ReferenceId || targetRelativePath == "" {
+			return errors.New("files can only be renamed inside the same site")
+		}
+		err = os.Rename(localPath, targetPath)
+		if err == nil {
+			h.writeBack(site, relativePath, true)
+			h.writeBack(site, targetRelativePath, false)
+		}
+		return err
+	}
+
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+func (h *sftpSession) Filelist(request *sftp.Request) (sftp.ListerAt, error) {
+
+	site, localPath, _, err := h.resolve(request.Filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	switch request.Method {
+	case "List":
+		if localPath == "" {
+			files := make([]os.FileInfo, 0)
+			for hostname, site := range h.server.Sites {
+				if !h.canRead(site) {
+					continue
+				}
+				files = append(files, virtualFileInfo{
+					name: hostname,
+					mode: os.FileMode(0755) | os.ModeDir,
+				})
+			}
+			return sftpFileList(files), nil
+		}
+		if !h.canRead(site) {
+			return nil, sftp.ErrSSHFxPermissionDenied
+		}
+		files, err := ioutil.ReadDir(localPath)
+		return sftpFileList(files), err
+	case "Stat":
+		if localPath == "" {
+			return sftpFileList{virtualFileInfo{
+				name: "/",
+				mode: os.FileMode(0755) | os.ModeDir,
+			}}, nil
+		}
+		fileInfo, err := os.Stat(localPath)
+		if err != nil {
+			return nil, err
+		}
+		return sftpFileList{fileInfo}, nil
+	}
+
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+// sftpWriteFile pushes the change to the site storage once the client closes the file
+type sftpWriteFile struct {
+	*os.File
+	onClose func()
+}
+
+func (f *sftpWriteFile) Close() error {
+	err := f.File.Close()
+	if err == nil {
+		f.onClose()
+	}
+	return err
+}
+
+type sftpFileList []os.FileInfo
+
+func (l sftpFileList) ListAt(files []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(files, l[offset:])
+	if n < len(files) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// syncSiteChanges pushes the local directory containing relativePath to the same path in the cloud store of the site
+func syncSiteChanges(cruds map[string]*resource.DbResource, site SubSiteAssetCache, relativePath string, deleteExtraneous bool) {
+
+	relativeDirectory := path.Dir("/" + relativePath)
+	localDirectory := filepath.Join(site.LocalSyncPath, filepath.FromSlash(relativeDirectory))
+	remotePath := strings.TrimSuffix(site.Keyname, "/") + strings.TrimSuffix(relativeDirectory, "/")
+
+	err := cruds["site"].SyncPathToStorage(site.CloudStore, localDirectory, remotePath, deleteExtraneous)
+	resource.CheckErr(err, "Failed to sync changes of site [%v] to cloud store", site.Hostname)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/pkg/sftp"
+)
+
+func TestSftpSessionResolve(t *testing.T) {
+
+	ownSite := SubSiteAssetCache{
+		SubSite: resource.SubSite{
+			Hostname:    "own.example.com",
+			ReferenceId: "site1",
+			Permission: resource.PermissionInstance{
+				UserId:     "user1",
+				Permission: auth.UserRead | auth.UserUpdate,
+			},
+		},
+		AssetFolderCache: &resource.AssetFolderCache{LocalSyncPath: "/tmp/own"},
+	}
+	otherSite := SubSiteAssetCache{
+		SubSite: resource.SubSite{
+			Hostname:    "other.example.com",
+			ReferenceId: "site2",
+			Permission: resource.PermissionInstance{
+				UserId:     "user2",
+				Permission: auth.UserRead | auth.UserUpdate,
+			},
+		},
+		AssetFolderCache: &resource.AssetFolderCache{LocalSyncPath: "/tmp/other"},
+	}
+
+	session := &sftpSession{
+		server: &DaptinSftpServer{
+			Sites: map[string]SubSiteAssetCache{
+				ownSite.Hostname:   ownSite,
+				otherSite.Hostname: otherSite,
+			},
+		},
+		userReferenceId: "user1",
+		userGroups:      []auth.GroupPermission{},
+	}
+
+	_, localPath, _, err := session.resolve("/")
+	if err != nil || localPath != "" {
+		t.Errorf("Expected virtual root, found [%v] %v", localPath, err)
+	}
+
+	site, localPath, relativePath, err := session.resolve("/own.example.com/blog/../index.html")
+	if err != nil {
+		t.Fatalf("Failed to resolve path: %v", err)
+	}
+	if site.ReferenceId != "site1" || relativePath != "index.html" || localPath != filepath.Join("/tmp/own", "index.html") {
+		t.Errorf("Unexpected resolution [%v] [%v] [%v]", site.ReferenceId, relativePath, localPath)
+	}
+
+	_, localPath, _, err = session.resolve("/own.example.com/../../etc/passwd")
+	if err == nil {
+		t.Errorf("Expected path outside of sites to fail, found [%v]", localPath)
+	}
+
+	if _, _, _, err = session.resolve("/other.example.com/index.html"); err != os.ErrNotExist {
+		t.Errorf("Expected site without read permission to be hidden, found %v", err)
+	}
+
+	list, err := session.Filelist(&sftp.Request{Method: "List", Filepath: "/"})
+	if err != nil {
+		t.Fatalf("Failed to list root: %v", err)
+	}
+	files := make([]os.FileInfo, 5)
+	n, _ := list.ListAt(files, 0)
+	if n != 1 || files[0].Name() != "own.example.com" {
+		t.Errorf("Expected only the readable site in root listing, found %v", files[:n])
+	}
+
+}
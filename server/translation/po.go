@@ -0,0 +1,181 @@
+package translation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// poFormat writes gettext PO files, the msgctxt of each entry is the id of the unit
+type poFormat struct {
+}
+
+func (poFormat) ContentType() string {
+	return "text/x-gettext-translation"
+}
+
+func (poFormat) Extension() string {
+	return "po"
+}
+
+func poQuote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+func poUnquote(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return "", fmt.Errorf("expected a quoted string, found [%v]", value)
+	}
+	var builder strings.Builder
+	inner := value[1 : len(value)-1]
+	for i := 0; i < len(inner); i++ {
+		if inner[i] != '\\' || i == len(inner)-1 {
+			builder.WriteByte(inner[i])
+			continue
+		}
+		i++
+		switch inner[i] {
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 't':
+			builder.WriteByte('\t')
+		default:
+			builder.WriteByte(inner[i])
+		}
+	}
+	return builder.String(), nil
+}
+
+func (poFormat) Write(w io.Writer, file File) error {
+
+	writer := bufio.NewWriter(w)
+
+	header := "Content-Type: text/plain; charset=UTF-8\n" +
+		"Language: " + file.TargetLanguage + "\n" +
+		"X-Source-Language: " + file.SourceLanguage + "\n" +
+		"X-Table: " + file.TableName + "\n"
+	fmt.Fprintf(writer, "msgid \"\"\nmsgstr %v\n", poQuote(header))
+
+	for _, unit := range file.Units {
+		fmt.Fprintf(writer, "\n#: %v\nmsgctxt %v\nmsgid %v\nmsgstr %v\n",
+			file.TableName+":"+unit.Column, poQuote(unit.Id()), poQuote(unit.Source), poQuote(unit.Target))
+	}
+
+	return writer.Flush()
+}
+
+func (poFormat) Read(r io.Reader) (File, error) {
+
+	file := File{
+		Units: make([]Unit, 0),
+	}
+
+	var context, msgid, msgstr *string
+	var current **string
+
+	finishEntry := func() {
+		if context == nil && msgid != nil && *msgid == "" && msgstr != nil {
+			for _, line := range strings.Split(*msgstr, "\n") {
+				parts := strings.SplitN(line, ":", 2)
+				if len(parts) != 2 {
+					continue
+				}
+				value := strings.TrimSpace(parts[1])
+				switch strings.TrimSpace(parts[0]) {
+				case "Language":
+					file.TargetLanguage = value
+				case "X-Source-Language":
+					file.SourceLanguage = value
+				case "X-Table":
+					file.TableName = value
+				}
+			}
+		} else if context != nil && msgstr != nil {
+			referenceId, column, ok := ParseUnitId(*context)
+			if ok {
+				unit := Unit{
+					ReferenceId: referenceId,
+					Column:      column,
+					Target:      *msgstr,
+				}
+				if msgid != nil {
+					unit.Source = *msgid
+				}
+				file.Units = append(file.Units, unit)
+			}
+		}
+		context, msgid, msgstr, current = nil, nil, nil, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			finishEntry()
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if line[0] == '"' {
+			if current == nil || *current == nil {
+				return file, fmt.Errorf("line %d: string without a keyword", lineNumber)
+			}
+			value, err := poUnquote(line)
+			if err != nil {
+				return file, fmt.Errorf("line %d: %v", lineNumber, err)
+			}
+			joined := **current + value
+			*current = &joined
+			continue
+		}
+
+		separator := strings.Index(line, " ")
+		if separator < 0 {
+			return file, fmt.Errorf("line %d: unexpected [%v]", lineNumber, line)
+		}
+		keyword := line[:separator]
+		value, err := poUnquote(line[separator+1:])
+		if err != nil {
+			return file, fmt.Errorf("line %d: %v", lineNumber, err)
+		}
+
+		switch keyword {
+		case "msgctxt":
+			if msgstr != nil {
+				finishEntry()
+			}
+			context = &value
+			current = &context
+		case "msgid":
+			if msgstr != nil {
+				finishEntry()
+			}
+			msgid = &value
+			current = &msgid
+		case "msgstr", "msgstr[0]":
+			msgstr = &value
+			current = &msgstr
+		default:
+			// plural forms are not used for fields, their strings are read and dropped
+			discarded := &value
+			current = &discarded
+		}
+	}
+	finishEntry()
+
+	if err := scanner.Err(); err != nil {
+		return file, err
+	}
+	return file, nil
+}
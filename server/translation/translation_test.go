@@ -0,0 +1,89 @@
+package translation
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testFile = File{
+	TableName:      "book",
+	SourceLanguage: "en",
+	TargetLanguage: "fr",
+	Units: []Unit{
+		{ReferenceId: "3f1c2e/a", Column: "title", Source: "The \"Old\" Man", Target: "Le vieil homme"},
+		{ReferenceId: "9ab01", Column: "summary", Source: "line one\nline two & <more>", Target: ""},
+	},
+}
+
+func TestFormatsRoundTrip(t *testing.T) {
+
+	for _, name := range []string{"xliff", "po"} {
+		format, err := GetFormat(name)
+		if err != nil {
+			t.Fatalf("Missing format %v", name)
+		}
+
+		var buffer bytes.Buffer
+		err = format.Write(&buffer, testFile)
+		if err != nil {
+			t.Fatalf("Failed to write %v: %v", name, err)
+		}
+
+		file, err := format.Read(&buffer)
+		if err != nil {
+			t.Fatalf("Failed to read %v: %v\n%s", name, err, buffer.String())
+		}
+		if !reflect.DeepEqual(file, testFile) {
+			t.Errorf("Round trip through %v changed the file\nexpected %#v\nfound    %#v", name, testFile, file)
+		}
+	}
+
+	if _, err := GetFormat("docx"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
+
+func TestReadPoFromTranslator(t *testing.T) {
+
+	po := `# translated by hand
+msgid ""
+msgstr ""
+"Language: de\n"
+
+#: book:title
+msgctxt "r1/title"
+msgid "Hello"
+msgstr ""
+"Hallo "
+"Welt"
+
+msgctxt "r2/title"
+msgid "Apple"
+msgid_plural "Apples"
+msgstr[0] "Apfel"
+msgstr[1] "Äpfel"
+`
+	format, _ := GetFormat("po")
+	file, err := format.Read(strings.NewReader(po))
+	if err != nil {
+		t.Fatalf("Failed to read po: %v", err)
+	}
+	if file.TargetLanguage != "de" || len(file.Units) != 2 {
+		t.Fatalf("Unexpected file %#v", file)
+	}
+	if file.Units[0].Target != "Hallo Welt" || file.Units[1].Target != "Apfel" {
+		t.Errorf("Unexpected targets %#v", file.Units)
+	}
+}
+
+func TestParseUnitId(t *testing.T) {
+	referenceId, column, ok := ParseUnitId("a/b/title")
+	if !ok || referenceId != "a/b" || column != "title" {
+		t.Errorf("Unexpected [%v] [%v] %v", referenceId, column, ok)
+	}
+	if _, _, ok = ParseUnitId("title"); ok {
+		t.Errorf("Expected an id without a column to be rejected")
+	}
+}
@@ -0,0 +1,62 @@
+// Package translation reads and writes the files translators work with, XLIFF and gettext PO
+package translation
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Unit is one translatable field of a row
+type Unit struct {
+	ReferenceId string
+	Column      string
+	Source      string
+	Target      string
+}
+
+// Id identifies the field of the unit inside a file
+func (u Unit) Id() string {
+	return u.ReferenceId + "/" + u.Column
+}
+
+// ParseUnitId splits the id of a unit into the reference id of the row and the column
+func ParseUnitId(id string) (string, string, bool) {
+	separator := strings.LastIndex(id, "/")
+	if separator < 1 || separator == len(id)-1 {
+		return "", "", false
+	}
+	return id[:separator], id[separator+1:], true
+}
+
+// File is the content of a translation file
+type File struct {
+	TableName      string
+	SourceLanguage string
+	TargetLanguage string
+	Units          []Unit
+}
+
+// Format writes and reads one file format
+type Format interface {
+	ContentType() string
+	Extension() string
+	Write(w io.Writer, file File) error
+	Read(r io.Reader) (File, error)
+}
+
+// Formats are the formats accepted in the format parameter
+var Formats = map[string]Format{
+	"xliff": xliffFormat{},
+	"xlf":   xliffFormat{},
+	"po":    poFormat{},
+}
+
+// GetFormat returns the format by name
+func GetFormat(name string) (Format, error) {
+	format, ok := Formats[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown translation file format [%v]", name)
+	}
+	return format, nil
+}
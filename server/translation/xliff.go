@@ -0,0 +1,111 @@
+package translation
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+)
+
+const xliffNamespace = "urn:oasis:names:tc:xliff:document:1.2"
+
+type xliffDocument struct {
+	XMLName xml.Name    `xml:"xliff"`
+	Xmlns   string      `xml:"xmlns,attr,omitempty"`
+	Version string      `xml:"version,attr"`
+	Files   []xliffFile `xml:"file"`
+}
+
+type xliffFile struct {
+	Original       string           `xml:"original,attr"`
+	SourceLanguage string           `xml:"source-language,attr"`
+	TargetLanguage string           `xml:"target-language,attr,omitempty"`
+	Datatype       string           `xml:"datatype,attr"`
+	Units          []xliffTransUnit `xml:"body>trans-unit"`
+}
+
+type xliffTransUnit struct {
+	Id     string  `xml:"id,attr"`
+	Source string  `xml:"source"`
+	Target *string `xml:"target"`
+}
+
+// xliffFormat writes XLIFF 1.2 with one trans-unit per field
+type xliffFormat struct {
+}
+
+func (xliffFormat) ContentType() string {
+	return "application/x-xliff+xml"
+}
+
+func (xliffFormat) Extension() string {
+	return "xlf"
+}
+
+func (xliffFormat) Write(w io.Writer, file File) error {
+
+	units := make([]xliffTransUnit, 0, len(file.Units))
+	for _, unit := range file.Units {
+		target := unit.Target
+		units = append(units, xliffTransUnit{
+			Id:     unit.Id(),
+			Source: unit.Source,
+			Target: &target,
+		})
+	}
+
+	document := xliffDocument{
+		Xmlns:   xliffNamespace,
+		Version: "1.2",
+		Files: []xliffFile{
+			{
+				Original:       file.TableName,
+				SourceLanguage: file.SourceLanguage,
+				TargetLanguage: file.TargetLanguage,
+				Datatype:       "plaintext",
+				Units:          units,
+			},
+		},
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	return encoder.Encode(document)
+}
+
+func (xliffFormat) Read(r io.Reader) (File, error) {
+
+	var document xliffDocument
+	err := xml.NewDecoder(r).Decode(&document)
+	if err != nil {
+		return File{}, err
+	}
+	if len(document.Files) == 0 {
+		return File{}, errors.New("xliff document has no file")
+	}
+
+	file := File{
+		TableName:      document.Files[0].Original,
+		SourceLanguage: document.Files[0].SourceLanguage,
+		TargetLanguage: document.Files[0].TargetLanguage,
+		Units:          make([]Unit, 0),
+	}
+	for _, xliffFile := range document.Files {
+		for _, transUnit := range xliffFile.Units {
+			referenceId, column, ok := ParseUnitId(transUnit.Id)
+			if !ok || transUnit.Target == nil {
+				continue
+			}
+			file.Units = append(file.Units, Unit{
+				ReferenceId: referenceId,
+				Column:      column,
+				Source:      transUnit.Source,
+				Target:      *transUnit.Target,
+			})
+		}
+	}
+	return file, nil
+}
@@ -0,0 +1,257 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/daptin/daptin/server/translation"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// translationTable returns the table in the path when translations are enabled for it and the user has the
+// permission on the table, it aborts the request otherwise
+func translationTable(c *gin.Context, cruds map[string]*resource.DbResource, forUpdate bool) (*resource.DbResource, *auth.SessionUser, bool) {
+
+	typeName := c.Param("typename")
+	dbResource, ok := cruds[typeName]
+	if !ok || dbResource.TableInfo() == nil || !dbResource.TableInfo().TranslationsEnabled {
+		c.AbortWithStatusJSON(404, ErrorResponse{Message: fmt.Sprintf("translations are not enabled for [%v]", typeName)})
+		return nil, nil, false
+	}
+
+	sessionUser, _ := c.Request.Context().Value("user").(*auth.SessionUser)
+	if sessionUser == nil {
+		c.AbortWithStatus(403)
+		return nil, nil, false
+	}
+
+	permission := cruds["world"].GetObjectPermissionByWhereClause("world", "table_name", typeName)
+	allowed := permission.CanRead(sessionUser.UserReferenceId, sessionUser.Groups)
+	if forUpdate {
+		allowed = permission.CanUpdate(sessionUser.UserReferenceId, sessionUser.Groups)
+	}
+	if !allowed {
+		log.Infof("user [%v] not allowed to access translations of [%v]", sessionUser.UserReferenceId, typeName)
+		c.AbortWithStatus(403)
+		return nil, nil, false
+	}
+
+	return dbResource, sessionUser, true
+}
+
+// filterTranslationUnits keeps the units of the rows the user can read, or update when forUpdate is set
+func filterTranslationUnits(cruds map[string]*resource.DbResource, typeName string, units []translation.Unit,
+	sessionUser *auth.SessionUser, forUpdate bool) []translation.Unit {
+
+	allowedRows := make(map[string]bool)
+	filtered := make([]translation.Unit, 0, len(units))
+	for _, unit := range units {
+		allowed, checked := allowedRows[unit.ReferenceId]
+		if !checked {
+			permission := cruds["world"].GetRowPermission(map[string]interface{}{
+				"__type":       typeName,
+				"reference_id": unit.ReferenceId,
+			})
+			if forUpdate {
+				allowed = permission.CanUpdate(sessionUser.UserReferenceId, sessionUser.Groups)
+			} else {
+				allowed = permission.CanRead(sessionUser.UserReferenceId, sessionUser.Groups)
+			}
+			allowedRows[unit.ReferenceId] = allowed
+		}
+		if allowed {
+			filtered = append(filtered, unit)
+		}
+	}
+	return filtered
+}
+
+func defaultLanguage(configStore *resource.ConfigStore) string {
+	language, err := configStore.GetConfigValueFor("language.default", "backend")
+	if err != nil || language == "" {
+		return "en"
+	}
+	return language
+}
+
+// CreateTranslationCoverageHandler reports for each language how many rows and fields of a table are translated
+// the languages are taken from the language parameter, or else from language.supported and the existing translations
+func CreateTranslationCoverageHandler(cruds map[string]*resource.DbResource, configStore *resource.ConfigStore) func(*gin.Context) {
+	return func(c *gin.Context) {
+
+		dbResource, _, ok := translationTable(c, cruds, false)
+		if !ok {
+			return
+		}
+
+		languages := splitLanguageList(c.Query("language"))
+		if len(languages) == 0 {
+			supported, _ := configStore.GetConfigValueFor("language.supported", "backend")
+			languages = splitLanguageList(supported)
+			existing, err := dbResource.GetTranslationLanguages()
+			if err != nil {
+				log.Errorf("Failed to get translation languages of [%v]: %v", c.Param("typename"), err)
+			}
+			listed := make(map[string]bool)
+			for _, language := range languages {
+				listed[language] = true
+			}
+			for _, language := range existing {
+				if language != "" && !listed[language] {
+					listed[language] = true
+					languages = append(languages, language)
+				}
+			}
+		}
+
+		coverage, err := dbResource.GetTranslationCoverage(languages)
+		if err != nil {
+			c.AbortWithStatusJSON(500, resource.NewDaptinError("Failed to get translation coverage", err.Error()))
+			return
+		}
+
+		c.JSON(200, map[string]interface{}{
+			"table":     c.Param("typename"),
+			"languages": coverage,
+		})
+	}
+}
+
+// CreateTranslationExportHandler serves the fields of a table as an XLIFF or PO file for translators,
+// only the untranslated fields unless all=true
+func CreateTranslationExportHandler(cruds map[string]*resource.DbResource, configStore *resource.ConfigStore) func(*gin.Context) {
+	return func(c *gin.Context) {
+
+		dbResource, sessionUser, ok := translationTable(c, cruds, false)
+		if !ok {
+			return
+		}
+		typeName := c.Param("typename")
+
+		language := c.Query("language")
+		if language == "" {
+			c.AbortWithStatusJSON(400, ErrorResponse{Message: "language is required"})
+			return
+		}
+		format, err := translation.GetFormat(c.DefaultQuery("format", "xliff"))
+		if err != nil {
+			c.AbortWithStatusJSON(400, ErrorResponse{Message: err.Error()})
+			return
+		}
+
+		units, err := dbResource.GetTranslationUnits(language)
+		if err != nil {
+			c.AbortWithStatusJSON(500, resource.NewDaptinError("Failed to read translations", err.Error()))
+			return
+		}
+
+		if c.Query("all") != "true" {
+			untranslated := make([]translation.Unit, 0)
+			for _, unit := range units {
+				if unit.Target == "" {
+					untranslated = append(untranslated, unit)
+				}
+			}
+			units = untranslated
+		}
+		units = filterTranslationUnits(cruds, typeName, units, sessionUser, false)
+
+		c.Header("Content-Type", format.ContentType()+"; charset=utf-8")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%v.%v.%v", typeName, language, format.Extension()))
+		c.Status(200)
+		err = format.Write(c.Writer, translation.File{
+			TableName:      typeName,
+			SourceLanguage: defaultLanguage(configStore),
+			TargetLanguage: language,
+			Units:          units,
+		})
+		if err != nil {
+			log.Errorf("Failed to write translation file for [%v]: %v", typeName, err)
+		}
+	}
+}
+
+// CreateTranslationImportHandler reads a translated XLIFF or PO file, from the body or the file field of a
+// multipart form, and stores the translations of the rows the user can update
+func CreateTranslationImportHandler(cruds map[string]*resource.DbResource) func(*gin.Context) {
+	return func(c *gin.Context) {
+
+		dbResource, sessionUser, ok := translationTable(c, cruds, true)
+		if !ok {
+			return
+		}
+		typeName := c.Param("typename")
+
+		var body io.Reader = c.Request.Body
+		formatName := c.Query("format")
+		if fileHeader, err := c.FormFile("file"); err == nil {
+			file, err := fileHeader.Open()
+			if err != nil {
+				c.AbortWithStatusJSON(400, ErrorResponse{Message: err.Error()})
+				return
+			}
+			defer file.Close()
+			body = file
+			if formatName == "" {
+				formatName = strings.TrimPrefix(filepath.Ext(fileHeader.Filename), ".")
+			}
+		}
+
+		contents, err := ioutil.ReadAll(body)
+		if err != nil {
+			c.AbortWithStatusJSON(400, ErrorResponse{Message: err.Error()})
+			return
+		}
+		if formatName == "" {
+			formatName = "po"
+			if bytes.HasPrefix(bytes.TrimSpace(contents), []byte("<")) {
+				formatName = "xliff"
+			}
+		}
+
+		format, err := translation.GetFormat(formatName)
+		if err != nil {
+			c.AbortWithStatusJSON(400, ErrorResponse{Message: err.Error()})
+			return
+		}
+		file, err := format.Read(bytes.NewReader(contents))
+		if err != nil {
+			c.AbortWithStatusJSON(400, ErrorResponse{Message: "failed to read translation file: " + err.Error()})
+			return
+		}
+
+		if file.TableName != "" && file.TableName != typeName {
+			c.AbortWithStatusJSON(400, ErrorResponse{Message: fmt.Sprintf("file has translations for [%v], not [%v]", file.TableName, typeName)})
+			return
+		}
+		language := c.Query("language")
+		if language == "" {
+			language = file.TargetLanguage
+		}
+		if language == "" {
+			c.AbortWithStatusJSON(400, ErrorResponse{Message: "language is required"})
+			return
+		}
+
+		units := filterTranslationUnits(cruds, typeName, file.Units, sessionUser, true)
+		written, err := dbResource.SaveTranslations(language, units)
+		if err != nil {
+			c.AbortWithStatusJSON(400, resource.NewDaptinError("Failed to save translations", err.Error()))
+			return
+		}
+
+		c.JSON(200, map[string]interface{}{
+			"table":    typeName,
+			"language": language,
+			"fields":   written,
+			"skipped":  len(file.Units) - len(units),
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateTrashListHandler lists the trashed rows of a soft delete table which the user can read. It takes the
+// paging, sorting and filtering parameters of the table's api
+func CreateTrashListHandler(cruds map[string]*resource.DbResource) func(*gin.Context) {
+	return func(c *gin.Context) {
+
+		typeName := c.Param("typename")
+		dbResource, ok := cruds[typeName]
+		if !ok || dbResource.TableInfo() == nil || !dbResource.TableInfo().SoftDeleteEnabled {
+			c.AbortWithStatusJSON(404, ErrorResponse{Message: fmt.Sprintf("soft delete is not enabled for [%v]", typeName)})
+			return
+		}
+
+		pr := &http.Request{
+			Method: "GET",
+		}
+		pr = pr.WithContext(c.Request.Context())
+
+		params := make(map[string][]string)
+		for key, values := range c.Request.URL.Query() {
+			params[key] = values
+		}
+		params[resource.TrashedQueryParameter] = []string{"only"}
+
+		req := api2go.Request{
+			PlainRequest: pr,
+			QueryParams:  params,
+		}
+
+		total, result, err := dbResource.PaginatedFindAll(req)
+		if err != nil {
+			c.AbortWithStatusJSON(400, resource.NewDaptinError("Failed to list the trash", err.Error()))
+			return
+		}
+
+		rows := make([]map[string]interface{}, 0)
+		for _, model := range result.Result().([]*api2go.Api2GoModel) {
+			rows = append(rows, model.GetAttributes())
+		}
+
+		c.JSON(200, map[string]interface{}{
+			"table": typeName,
+			"total": total,
+			"data":  rows,
+		})
+	}
+}
@@ -199,6 +199,8 @@ func BuildMiddlewareSet(cmsConfig *resource.CmsConfig,
 	deleteEventHandler := resource.NewDeleteEventHandler(cruds, dtopicMap)
 
 	yhsHandler := resource.NewYJSHandlerMiddleware(documentProvider)
+	webhookMiddleware := resource.NewWebhookMiddleware()
+	inboundHookSecretMiddleware := resource.NewInboundHookSecretMiddleware()
 
 	ms.BeforeFindAll = []resource.DatabaseRequestInterceptor{
 		tablePermissionChecker,
@@ -216,6 +218,7 @@ func BuildMiddlewareSet(cmsConfig *resource.CmsConfig,
 		tablePermissionChecker,
 		objectPermissionChecker,
 		dataValidationMiddleware,
+		inboundHookSecretMiddleware,
 		createEventHandler,
 		exchangeMiddleware,
 	}
@@ -223,7 +226,9 @@ func BuildMiddlewareSet(cmsConfig *resource.CmsConfig,
 		tablePermissionChecker,
 		objectPermissionChecker,
 		createEventHandler,
+		webhookMiddleware,
 		exchangeMiddleware,
+		inboundHookSecretMiddleware,
 	}
 
 	ms.BeforeDelete = []resource.DatabaseRequestInterceptor{
@@ -236,6 +241,7 @@ func BuildMiddlewareSet(cmsConfig *resource.CmsConfig,
 		tablePermissionChecker,
 		objectPermissionChecker,
 		deleteEventHandler,
+		webhookMiddleware,
 		exchangeMiddleware,
 	}
 
@@ -251,6 +257,7 @@ func BuildMiddlewareSet(cmsConfig *resource.CmsConfig,
 		tablePermissionChecker,
 		objectPermissionChecker,
 		updateEventHandler,
+		webhookMiddleware,
 		exchangeMiddleware,
 	}
 
@@ -0,0 +1,735 @@
+package server
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/artpar/api2go"
+	"github.com/daptin/daptin/server/auth"
+	"github.com/daptin/daptin/server/resource"
+	"github.com/doug-martin/goqu/v9"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/webdav"
+)
+
+// WebDavMethods are the http methods routed to the webdav handler
+var WebDavMethods = []string{
+	"OPTIONS", "GET", "HEAD", "PUT", "DELETE", "PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK",
+}
+
+// locks are held in memory and shared by all webdav requests
+var webDavLockSystem = webdav.NewMemLS()
+
+// CreateWebDavHandler serves sites and asset columns as a webdav tree under /webdav
+//
+//	/webdav/site/<hostname>/<path>                              files of a site
+//	/webdav/table/<table name>/<column name>/<reference id>/<file>  files in the asset column of a row
+//
+// Clients authenticate with basic auth or a JWT token
+func CreateWebDavHandler(cruds map[string]*resource.DbResource, authMiddleware *auth.AuthMiddleware) func(*gin.Context) {
+
+	return func(c *gin.Context) {
+
+		request := c.Request
+		if request.Context().Value("user") == nil {
+			ok, abort, newRequest := authMiddleware.AuthCheckMiddlewareWithHttp(c.Request, c.Writer, true)
+			if abort || !ok {
+				c.AbortWithStatus(401)
+				return
+			}
+			request = newRequest
+		}
+
+		user, ok := request.Context().Value("user").(*auth.SessionUser)
+		if !ok || user == nil || user.UserId == 0 {
+			c.Header("WWW-Authenticate", `Basic realm="daptin"`)
+			c.AbortWithStatus(401)
+			return
+		}
+
+		handler := &webdav.Handler{
+			Prefix: "/webdav",
+			FileSystem: &daptinWebDavFileSystem{
+				cruds: cruds,
+				user:  user,
+			},
+			LockSystem: webDavLockSystem,
+			Logger: func(r *http.Request, err error) {
+				if err != nil {
+					log.Printf("WebDAV [%v] [%v]: %v", r.Method, r.URL.Path, err)
+				}
+			},
+		}
+		handler.ServeHTTP(c.Writer, request)
+	}
+
+}
+
+// daptinWebDavFileSystem maps the webdav tree to site folders and asset column caches
+// every operation is checked against the permissions of the logged in user
+type daptinWebDavFileSystem struct {
+	cruds map[string]*resource.DbResource
+	user  *auth.SessionUser
+}
+
+func webDavPathParts(name string) []string {
+	cleanPath := strings.Trim(path.Clean("/"+name), "/")
+	if cleanPath == "" {
+		return []string{}
+	}
+	return strings.Split(cleanPath, "/")
+}
+
+func webDavDirectory(name string) virtualFileInfo {
+	return virtualFileInfo{
+		name: name,
+		mode: os.FileMode(0755) | os.ModeDir,
+	}
+}
+
+// site returns the readable site by hostname and the path of the file relative to the site root
+func (fs *daptinWebDavFileSystem) site(parts []string) (SubSiteAssetCache, string, error) {
+
+	sites, err := siteAssetCaches(fs.cruds, false)
+	if err != nil {
+		return SubSiteAssetCache{}, "", err
+	}
+
+	for _, site := range sites {
+		if site.Hostname != parts[1] {
+			continue
+		}
+		if !site.Permission.CanRead(fs.user.UserReferenceId, fs.user.Groups) {
+			return site, "", os.ErrNotExist
+		}
+		return site, strings.Join(parts[2:], "/"), nil
+	}
+
+	return SubSiteAssetCache{}, "", os.ErrNotExist
+}
+
+func (fs *daptinWebDavFileSystem) canWriteSite(site SubSiteAssetCache) bool {
+	return site.Permission.CanUpdate(fs.user.UserReferenceId, fs.user.Groups)
+}
+
+// assetColumn returns the asset cache of a column when the user can read the table
+func (fs *daptinWebDavFileSystem) assetColumn(tableName string, columnName string) (*resource.AssetFolderCache, error) {
+
+	columns, ok := fs.cruds["world"].AssetFolderCache[tableName]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	tablePermission := fs.cruds["world"].GetObjectPermissionByWhereClause("world", "table_name", tableName)
+	if !tablePermission.CanRead(fs.user.UserReferenceId, fs.user.Groups) {
+		return nil, os.ErrNotExist
+	}
+	if columnName == "" {
+		return nil, nil
+	}
+	assetCache, ok := columns[columnName]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return assetCache, nil
+}
+
+// columnRow loads a row through the permission checked FindOne and returns the file metadata in the column
+func (fs *daptinWebDavFileSystem) columnRow(ctx context.Context, tableName string, columnName string, referenceId string) (*api2go.Api2GoModel, []map[string]interface{}, error) {
+
+	if _, err := fs.assetColumn(tableName, columnName); err != nil {
+		return nil, nil, err
+	}
+
+	pr := &http.Request{
+		Method: "GET",
+	}
+	pr = pr.WithContext(ctx)
+	obj, err := fs.cruds[tableName].FindOne(referenceId, api2go.Request{
+		PlainRequest: pr,
+	})
+	if err != nil || obj == nil || obj.Result() == nil {
+		return nil, nil, os.ErrNotExist
+	}
+
+	row := obj.Result().(*api2go.Api2GoModel)
+	return row, webDavColumnFiles(row.Data[columnName]), nil
+}
+
+// webDavColumnFiles reads the file metadata stored in an asset column
+func webDavColumnFiles(value interface{}) []map[string]interface{} {
+	files := make([]map[string]interface{}, 0)
+	switch typed := value.(type) {
+	case []map[string]interface{}:
+		files = typed
+	case []interface{}:
+		for _, file := range typed {
+			fileMap, ok := file.(map[string]interface{})
+			if ok {
+				files = append(files, fileMap)
+			}
+		}
+	case string:
+		var parsed []map[string]interface{}
+		if err := json.Unmarshal([]byte(typed), &parsed); err == nil {
+			files = parsed
+		}
+	}
+	return files
+}
+
+// webDavColumnFilePath is the location of the file inside the column asset cache
+func webDavColumnFilePath(file map[string]interface{}) string {
+	name, _ := file["name"].(string)
+	filePath, _ := file["path"].(string)
+	if filePath != "" {
+		return filePath + "/" + name
+	}
+	return name
+}
+
+// updateColumnFiles stores new file metadata in the column through Update, files which have
+// contents are uploaded to the cloud store by the update
+func (fs *daptinWebDavFileSystem) updateColumnFiles(ctx context.Context, tableName string, columnName string,
+	row *api2go.Api2GoModel, files []map[string]interface{}) error {
+
+	permission := fs.cruds[tableName].GetRowPermission(row.GetAllAsAttributes())
+	if !permission.CanUpdate(fs.user.UserReferenceId, fs.user.Groups) {
+		return os.ErrPermission
+	}
+
+	values := make([]interface{}, 0)
+	for _, file := range files {
+		values = append(values, file)
+	}
+
+	obj := api2go.NewApi2GoModelWithData(tableName, nil, 0, nil, row.Data)
+	obj.SetAttributes(map[string]interface{}{
+		columnName: values,
+	})
+
+	pr := &http.Request{
+		Method: "PATCH",
+	}
+	pr = pr.WithContext(ctx)
+	_, err := fs.cruds[tableName].Update(obj, api2go.Request{
+		PlainRequest: pr,
+	})
+	return err
+}
+
+func (fs *daptinWebDavFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+
+	parts := webDavPathParts(name)
+	if len(parts) < 3 || parts[0] != "site" {
+		return os.ErrPermission
+	}
+
+	site, relativePath, err := fs.site(parts)
+	if err != nil {
+		return err
+	}
+	if !fs.canWriteSite(site) {
+		return os.ErrPermission
+	}
+
+	err = webdav.Dir(site.LocalSyncPath).Mkdir(ctx, relativePath, perm)
+	if err == nil {
+		syncSiteChanges(fs.cruds, site, relativePath, false)
+	}
+	return err
+}
+
+func (fs *daptinWebDavFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+
+	isWrite := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0
+	parts := webDavPathParts(name)
+
+	if len(parts) > 2 && parts[0] == "site" {
+
+		site, relativePath, err := fs.site(parts)
+		if err != nil {
+			return nil, err
+		}
+		if isWrite && !fs.canWriteSite(site) {
+			return nil, os.ErrPermission
+		}
+
+		file, err := webdav.Dir(site.LocalSyncPath).OpenFile(ctx, relativePath, flag, perm)
+		if err != nil || !isWrite {
+			return file, err
+		}
+		return &webDavWriteFile{
+			File: file,
+			onClose: func() error {
+				syncSiteChanges(fs.cruds, site, relativePath, false)
+				return nil
+			},
+		}, nil
+	}
+
+	if len(parts) == 5 && parts[0] == "table" {
+
+		row, files, err := fs.columnRow(ctx, parts[1], parts[2], parts[3])
+		if err != nil {
+			return nil, err
+		}
+		assetCache, _ := fs.assetColumn(parts[1], parts[2])
+
+		if isWrite {
+			return &webDavUploadFile{
+				name: parts[4],
+				hash: md5.New(),
+				onClose: func(contents io.Reader, size int64, md5Hash string) error {
+					return fs.uploadColumnFile(ctx, parts[1], parts[2], row, files, parts[4], contents, size, md5Hash)
+				},
+			}, nil
+		}
+
+		for _, file := range files {
+			if file["name"] == parts[4] {
+				return assetCache.GetFileByName(webDavColumnFilePath(file))
+			}
+		}
+		return nil, os.ErrNotExist
+	}
+
+	if isWrite {
+		return nil, os.ErrPermission
+	}
+
+	children, err := fs.readDir(ctx, parts)
+	if err != nil {
+		return nil, err
+	}
+	directoryName := "/"
+	if len(parts) > 0 {
+		directoryName = parts[len(parts)-1]
+	}
+	return &webDavVirtualDirectory{
+		info:     webDavDirectory(directoryName),
+		children: children,
+	}, nil
+}
+
+// uploadColumnFile streams the contents to the cloud store of the column and its local cache, and replaces the
+// file with the same name in the column, or adds it. The row is updated with the file metadata only
+func (fs *daptinWebDavFileSystem) uploadColumnFile(ctx context.Context, tableName string, columnName string,
+	row *api2go.Api2GoModel, existingFiles []map[string]interface{}, fileName string, contents io.Reader, size int64, md5Hash string) error {
+
+	permission := fs.cruds[tableName].GetRowPermission(row.GetAllAsAttributes())
+	if !permission.CanUpdate(fs.user.UserReferenceId, fs.user.Groups) {
+		return os.ErrPermission
+	}
+
+	column, ok := fs.cruds[tableName].TableInfo().GetColumnByName(columnName)
+	if !ok || column.ForeignKeyData.DataSource != "cloud_store" {
+		return os.ErrNotExist
+	}
+	cloudStore, err := fs.cruds["cloud_store"].GetCloudStoreByName(column.ForeignKeyData.Namespace)
+	if err != nil {
+		return err
+	}
+
+	assetCache, err := fs.assetColumn(tableName, columnName)
+	if err != nil {
+		return err
+	}
+	localFile, err := os.Create(filepath.Join(assetCache.LocalSyncPath, filepath.Base(fileName)))
+	if err != nil {
+		return err
+	}
+	err = fs.cruds["cloud_store"].WriteCloudStoreObject(ctx, cloudStore, column.ForeignKeyData.KeyName, fileName,
+		io.TeeReader(contents, localFile))
+	closeErr := localFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	files := make([]map[string]interface{}, 0)
+	for _, file := range existingFiles {
+		if file["name"] != fileName {
+			files = append(files, file)
+		}
+	}
+
+	fileType := mime.TypeByExtension(filepath.Ext(fileName))
+	if fileType == "" {
+		fileType = "application/octet-stream"
+	}
+	files = append(files, map[string]interface{}{
+		"name": fileName,
+		"path": "",
+		"type": fileType,
+		"size": size,
+		"md5":  md5Hash,
+	})
+
+	return fs.updateColumnFiles(ctx, tableName, columnName, row, files)
+}
+
+// readDir lists the virtual directories of the tree
+func (fs *daptinWebDavFileSystem) readDir(ctx context.Context, parts []string) ([]os.FileInfo, error) {
+
+	children := make([]os.FileInfo, 0)
+
+	switch {
+	case len(parts) == 0:
+		children = append(children, webDavDirectory("site"), webDavDirectory("table"))
+
+	case len(parts) == 1 && parts[0] == "site":
+		sites, err := siteAssetCaches(fs.cruds, false)
+		if err != nil {
+			return nil, err
+		}
+		for _, site := range sites {
+			if site.Permission.CanRead(fs.user.UserReferenceId, fs.user.Groups) {
+				children = append(children, webDavDirectory(site.Hostname))
+			}
+		}
+
+	case len(parts) == 1 && parts[0] == "table":
+		for tableName := range fs.cruds["world"].AssetFolderCache {
+			if _, err := fs.assetColumn(tableName, ""); err == nil {
+				children = append(children, webDavDirectory(tableName))
+			}
+		}
+
+	case len(parts) == 2 && parts[0] == "table":
+		if _, err := fs.assetColumn(parts[1], ""); err != nil {
+			return nil, err
+		}
+		for columnName := range fs.cruds["world"].AssetFolderCache[parts[1]] {
+			children = append(children, webDavDirectory(columnName))
+		}
+
+	case len(parts) == 3 && parts[0] == "table":
+		if _, err := fs.assetColumn(parts[1], parts[2]); err != nil {
+			return nil, err
+		}
+		rows, err := fs.cruds[parts[1]].GetAllObjectsWithWhere(parts[1], goqu.Ex{parts[2]: goqu.Op{"isNot": nil}})
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			permission := fs.cruds[parts[1]].GetRowPermission(row)
+			if permission.CanRead(fs.user.UserReferenceId, fs.user.Groups) {
+				children = append(children, webDavDirectory(row["reference_id"].(string)))
+			}
+		}
+
+	case len(parts) == 4 && parts[0] == "table":
+		_, files, err := fs.columnRow(ctx, parts[1], parts[2], parts[3])
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			children = append(children, fs.columnFileInfo(parts[1], parts[2], file))
+		}
+
+	default:
+		return nil, os.ErrNotExist
+	}
+
+	return children, nil
+}
+
+// columnFileInfo stats the cached copy of a column file, falling back to the stored metadata
+func (fs *daptinWebDavFileSystem) columnFileInfo(tableName string, columnName string, file map[string]interface{}) os.FileInfo {
+
+	name, _ := file["name"].(string)
+	assetCache, err := fs.assetColumn(tableName, columnName)
+	if err == nil {
+		fileInfo, err := os.Stat(filepath.Join(assetCache.LocalSyncPath, filepath.FromSlash(webDavColumnFilePath(file))))
+		if err == nil {
+			return fileInfo
+		}
+	}
+
+	var size int64
+	if sizeValue, ok := file["size"].(float64); ok {
+		size = int64(sizeValue)
+	}
+	return virtualFileInfo{
+		name: name,
+		size: size,
+		mode: os.FileMode(0644),
+	}
+}
+
+func (fs *daptinWebDavFileSystem) RemoveAll(ctx context.Context, name string) error {
+
+	parts := webDavPathParts(name)
+
+	if len(parts) > 2 && parts[0] == "site" {
+		site, relativePath, err := fs.site(parts)
+		if err != nil {
+			return err
+		}
+		if !fs.canWriteSite(site) {
+			return os.ErrPermission
+		}
+		err = webdav.Dir(site.LocalSyncPath).RemoveAll(ctx, relativePath)
+		if err == nil {
+			syncSiteChanges(fs.cruds, site, relativePath, true)
+		}
+		return err
+	}
+
+	if len(parts) == 5 && parts[0] == "table" {
+		row, files, err := fs.columnRow(ctx, parts[1], parts[2], parts[3])
+		if err != nil {
+			return err
+		}
+		remainingFiles := make([]map[string]interface{}, 0)
+		for _, file := range files {
+			if file["name"] != parts[4] {
+				remainingFiles = append(remainingFiles, file)
+			}
+		}
+		if len(remainingFiles) == len(files) {
+			return os.ErrNotExist
+		}
+		// the file is removed from the row, the blob is left in the cloud store like the other asset column updates do
+		return fs.updateColumnFiles(ctx, parts[1], parts[2], row, remainingFiles)
+	}
+
+	return os.ErrPermission
+}
+
+func (fs *daptinWebDavFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+
+	oldParts := webDavPathParts(oldName)
+	newParts := webDavPathParts(newName)
+
+	if len(oldParts) > 2 && len(newParts) > 2 && oldParts[0] == "site" && newParts[0] == "site" {
+		if oldParts[1] != newParts[1] {
+			return os.ErrPermission
+		}
+		site, oldRelativePath, err := fs.site(oldParts)
+		if err != nil {
+			return err
+		}
+		if !fs.canWriteSite(site) {
+			return os.ErrPermission
+		}
+		newRelativePath := strings.Join(newParts[2:], "/")
+		err = webdav.Dir(site.LocalSyncPath).Rename(ctx, oldRelativePath, newRelativePath)
+		if err == nil {
+			syncSiteChanges(fs.cruds, site, oldRelativePath, true)
+			syncSiteChanges(fs.cruds, site, newRelativePath, false)
+		}
+		return err
+	}
+
+	if len(oldParts) == 5 && len(newParts) == 5 && oldParts[0] == "table" &&
+		strings.Join(oldParts[:4], "/") == strings.Join(newParts[:4], "/") {
+
+		row, files, err := fs.columnRow(ctx, oldParts[1], oldParts[2], oldParts[3])
+		if err != nil {
+			return err
+		}
+		assetCache, _ := fs.assetColumn(oldParts[1], oldParts[2])
+		for _, file := range files {
+			if file["name"] != oldParts[4] {
+				continue
+			}
+			contents, err := os.Open(filepath.Join(assetCache.LocalSyncPath, filepath.FromSlash(webDavColumnFilePath(file))))
+			if err != nil {
+				return err
+			}
+			defer contents.Close()
+			fileInfo, err := contents.Stat()
+			if err != nil {
+				return err
+			}
+			md5Hash, _ := file["md5"].(string)
+			remainingFiles := make([]map[string]interface{}, 0)
+			for _, otherFile := range files {
+				if otherFile["name"] != oldParts[4] {
+					remainingFiles = append(remainingFiles, otherFile)
+				}
+			}
+			return fs.uploadColumnFile(ctx, oldParts[1], oldParts[2], row, remainingFiles, newParts[4], contents, fileInfo.Size(), md5Hash)
+		}
+		return os.ErrNotExist
+	}
+
+	return os.ErrPermission
+}
+
+func (fs *daptinWebDavFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+
+	parts := webDavPathParts(name)
+
+	if len(parts) > 2 && parts[0] == "site" {
+		site, relativePath, err := fs.site(parts)
+		if err != nil {
+			return nil, err
+		}
+		return webdav.Dir(site.LocalSyncPath).Stat(ctx, relativePath)
+	}
+
+	if len(parts) == 5 && parts[0] == "table" {
+		_, files, err := fs.columnRow(ctx, parts[1], parts[2], parts[3])
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if file["name"] == parts[4] {
+				return fs.columnFileInfo(parts[1], parts[2], file), nil
+			}
+		}
+		return nil, os.ErrNotExist
+	}
+
+	// a row directory is looked up by its reference id instead of listing the table
+	if len(parts) == 4 && parts[0] == "table" {
+		if _, _, err := fs.columnRow(ctx, parts[1], parts[2], parts[3]); err != nil {
+			return nil, err
+		}
+		return webDavDirectory(parts[3]), nil
+	}
+
+	if len(parts) == 0 {
+		return webDavDirectory("/"), nil
+	}
+
+	// a virtual directory exists when its parent lists it
+	siblings, err := fs.readDir(ctx, parts[:len(parts)-1])
+	if err != nil {
+		return nil, err
+	}
+	for _, sibling := range siblings {
+		if sibling.Name() == parts[len(parts)-1] {
+			return sibling, nil
+		}
+	}
+	return nil, os.ErrNotExist
+}
+
+// webDavVirtualDirectory is a directory of the tree which does not exist on disk
+type webDavVirtualDirectory struct {
+	info     os.FileInfo
+	children []os.FileInfo
+	offset   int
+}
+
+func (d *webDavVirtualDirectory) Close() error {
+	return nil
+}
+
+func (d *webDavVirtualDirectory) Read(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (d *webDavVirtualDirectory) Seek(offset int64, whence int) (int64, error) {
+	return 0, os.ErrInvalid
+}
+
+func (d *webDavVirtualDirectory) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (d *webDavVirtualDirectory) Stat() (os.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *webDavVirtualDirectory) Readdir(count int) ([]os.FileInfo, error) {
+	remaining := d.children[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.children)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+	d.offset += count
+	return remaining[:count], nil
+}
+
+// webDavWriteFile syncs a site file to the cloud store once it is closed
+type webDavWriteFile struct {
+	webdav.File
+	onClose func() error
+}
+
+func (f *webDavWriteFile) Close() error {
+	err := f.File.Close()
+	if err != nil {
+		return err
+	}
+	return f.onClose()
+}
+
+// webDavUploadFile spools the body of a PUT for an asset column to a temporary file, which is streamed to the cloud
+// store and the row updated on close
+type webDavUploadFile struct {
+	name    string
+	spool   *os.File
+	hash    hash.Hash
+	size    int64
+	onClose func(contents io.Reader, size int64, md5Hash string) error
+}
+
+func (f *webDavUploadFile) Close() error {
+	if f.spool == nil {
+		return f.onClose(strings.NewReader(""), 0, hex.EncodeToString(f.hash.Sum(nil)))
+	}
+	defer os.Remove(f.spool.Name())
+	defer f.spool.Close()
+	if _, err := f.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return f.onClose(f.spool, f.size, hex.EncodeToString(f.hash.Sum(nil)))
+}
+
+func (f *webDavUploadFile) Read(p []byte) (int, error) {
+	return 0, os.ErrInvalid
+}
+
+func (f *webDavUploadFile) Seek(offset int64, whence int) (int64, error) {
+	return f.size, nil
+}
+
+func (f *webDavUploadFile) Write(p []byte) (int, error) {
+	if f.spool == nil {
+		spool, err := ioutil.TempFile(os.Getenv("DAPTIN_CACHE_FOLDER"), "webdav-upload-")
+		if err != nil {
+			return 0, err
+		}
+		f.spool = spool
+	}
+	n, err := f.spool.Write(p)
+	f.hash.Write(p[:n])
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *webDavUploadFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (f *webDavUploadFile) Stat() (os.FileInfo, error) {
+	return virtualFileInfo{
+		name: f.name,
+		size: f.size,
+		mode: os.FileMode(0644),
+	}, nil
+}
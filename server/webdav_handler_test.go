@@ -0,0 +1,68 @@
+package server
+
+import (
+	"crypto/md5"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestWebDavColumnFiles(t *testing.T) {
+
+	files := webDavColumnFiles(`[{"name":"a.png","path":"images","type":"image/png"},{"name":"b.txt","path":""}]`)
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files, found %v", files)
+	}
+	if webDavColumnFilePath(files[0]) != "images/a.png" || webDavColumnFilePath(files[1]) != "b.txt" {
+		t.Errorf("Unexpected file paths [%v] [%v]", webDavColumnFilePath(files[0]), webDavColumnFilePath(files[1]))
+	}
+
+	files = webDavColumnFiles([]interface{}{map[string]interface{}{"name": "c.txt"}, "invalid"})
+	if len(files) != 1 || files[0]["name"] != "c.txt" {
+		t.Errorf("Expected only the valid file entry, found %v", files)
+	}
+
+	parts := webDavPathParts("/table/../site//example.com/index.html")
+	if len(parts) != 3 || parts[0] != "site" || parts[2] != "index.html" {
+		t.Errorf("Unexpected path parts %v", parts)
+	}
+
+}
+
+func TestWebDavVirtualDirectory(t *testing.T) {
+
+	directory := &webDavVirtualDirectory{
+		info:     webDavDirectory("/"),
+		children: []os.FileInfo{webDavDirectory("site"), webDavDirectory("table")},
+	}
+
+	first, err := directory.Readdir(1)
+	if err != nil || len(first) != 1 || first[0].Name() != "site" {
+		t.Errorf("Unexpected first entry %v %v", first, err)
+	}
+	rest, err := directory.Readdir(5)
+	if err != nil || len(rest) != 1 || rest[0].Name() != "table" || !rest[0].IsDir() {
+		t.Errorf("Unexpected remaining entries %v %v", rest, err)
+	}
+	if _, err = directory.Readdir(1); err != io.EOF {
+		t.Errorf("Expected EOF after all entries, found %v", err)
+	}
+
+	upload := &webDavUploadFile{name: "notes.txt", hash: md5.New(), onClose: func(contents io.Reader, size int64, md5Hash string) error {
+		uploaded, _ := ioutil.ReadAll(contents)
+		if string(uploaded) != "hello" || size != 5 || md5Hash != "5d41402abc4b2a76b9719d911017c592" {
+			t.Errorf("Unexpected uploaded contents [%v] %v [%v]", string(uploaded), size, md5Hash)
+		}
+		return nil
+	}}
+	_, _ = upload.Write([]byte("hello"))
+	info, _ := upload.Stat()
+	if info.Size() != 5 {
+		t.Errorf("Expected size 5, found %v", info.Size())
+	}
+	if err = upload.Close(); err != nil {
+		t.Errorf("Failed to close upload: %v", err)
+	}
+
+}
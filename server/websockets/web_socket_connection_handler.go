@@ -8,6 +8,28 @@ import (
 	"strings"
 )
 
+// CanReadEvent checks the row permission of the object in the event for the user, events of
+// user created topics are not rows of a table and can be read by everyone
+func CanReadEvent(cruds map[string]*resource.DbResource, eventMessage resource.EventMessage, user *auth.SessionUser) bool {
+
+	typeName, _ := eventMessage.EventData["__type"]
+	tableExists := false
+	if typeName != nil {
+		_, tableExists = cruds[typeName.(string)]
+	}
+
+	permission := resource.PermissionInstance{Permission: auth.ALLOW_ALL_PERMISSIONS}
+
+	if tableExists {
+		permission = cruds["world"].GetRowPermission(eventMessage.EventData)
+
+	}
+	if user == nil {
+		return permission.CanRead("", []auth.GroupPermission{})
+	}
+	return permission.CanRead(user.UserReferenceId, user.Groups)
+}
+
 // WebSocketConnectionHandlerImpl : Each websocket connection has its own handler
 type WebSocketConnectionHandlerImpl struct {
 	DtopicMap        *map[string]*olric.DTopic
@@ -48,19 +70,7 @@ func (wsch *WebSocketConnectionHandlerImpl) MessageFromClient(message WebSocketP
 					return func(message olric.DTopicMessage) {
 						eventMessage := message.Message.(resource.EventMessage)
 
-						typeName, _ := eventMessage.EventData["__type"]
-						tableExists := false
-						if typeName != nil {
-							_, tableExists = wsch.cruds[typeName.(string)]
-						}
-
-						permission := resource.PermissionInstance{Permission: auth.ALLOW_ALL_PERMISSIONS}
-
-						if tableExists {
-							permission = wsch.cruds["world"].GetRowPermission(eventMessage.EventData)
-
-						}
-						if permission.CanRead(client.user.UserReferenceId, client.user.Groups) {
+						if CanReadEvent(wsch.cruds, eventMessage, client.user) {
 
 							sendMessage := true
 							if filtersMap != nil {